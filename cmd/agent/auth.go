@@ -0,0 +1,158 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// 认证结果缓存时间，避免每个连接都请求面板
+const (
+	authCacheTTL      = 30 * time.Second // 认证通过
+	authDenyCacheTTL  = 10 * time.Second // 认证失败
+	authStaleTTL      = 10 * time.Minute // 面板不可达时沿用最近一次通过的结果
+	authCacheMaxItems = 4096
+)
+
+// authRequest GOST HTTP 认证插件请求
+type authRequest struct {
+	Username string `json:"username"`
+	Password string `json:"password"`
+	Client   string `json:"client"`
+}
+
+// authResponse GOST HTTP 认证插件响应
+type authResponse struct {
+	OK bool   `json:"ok"`
+	ID string `json:"id"`
+}
+
+type authCacheEntry struct {
+	resp      authResponse
+	expiresAt time.Time
+	checkedAt time.Time
+}
+
+// authPlugin 本地 HTTP 认证插件，GOST 通过它校验用户凭据，结果由面板决定并短时缓存
+type authPlugin struct {
+	agent *Agent
+	mu    sync.Mutex
+	cache map[[32]byte]authCacheEntry
+}
+
+// authPluginListen 注册时上报的认证插件地址，面板据此生成 GOST 插件配置 ("off" 表示未启用)
+func (a *Agent) authPluginListen() string {
+	if a.authListen == "" {
+		return "off"
+	}
+	return a.authListen
+}
+
+// serveAuthPlugin 启动本地认证插件服务 (仅节点模式)
+func (a *Agent) serveAuthPlugin() {
+	p := &authPlugin{
+		agent: a,
+		cache: make(map[[32]byte]authCacheEntry),
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/auth", p.handleAuth)
+
+	log.Printf("Auth plugin listening on %s", a.authListen)
+	if err := http.ListenAndServe(a.authListen, mux); err != nil {
+		log.Printf("Auth plugin server error: %v", err)
+	}
+}
+
+func (p *authPlugin) handleAuth(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	// GOST 使用配置中的 token (即节点 Token，登记密钥后由面板在注册响应中下发) 调用插件
+	if strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ") != p.agent.authToken() {
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+
+	var req authRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(p.authenticate(req))
+}
+
+// authenticate 优先使用缓存，未命中时请求面板
+func (p *authPlugin) authenticate(req authRequest) authResponse {
+	key := sha256.Sum256([]byte(req.Username + "\x00" + req.Password))
+	now := time.Now()
+
+	p.mu.Lock()
+	entry, cached := p.cache[key]
+	p.mu.Unlock()
+	if cached && now.Before(entry.expiresAt) {
+		return entry.resp
+	}
+
+	resp, err := p.agent.queryPanelAuth(req)
+	if err != nil {
+		// 面板暂时不可达时，已通过认证的用户继续可用
+		if cached && entry.resp.OK && now.Sub(entry.checkedAt) < authStaleTTL {
+			return entry.resp
+		}
+		log.Printf("Auth plugin: panel query failed: %v", err)
+		return authResponse{}
+	}
+
+	ttl := authDenyCacheTTL
+	if resp.OK {
+		ttl = authCacheTTL
+	}
+
+	p.mu.Lock()
+	if len(p.cache) >= authCacheMaxItems {
+		for k, e := range p.cache {
+			if now.Sub(e.checkedAt) >= authStaleTTL {
+				delete(p.cache, k)
+			}
+		}
+	}
+	p.cache[key] = authCacheEntry{resp: resp, expiresAt: now.Add(ttl), checkedAt: now}
+	p.mu.Unlock()
+
+	return resp
+}
+
+// queryPanelAuth 请求面板校验凭据
+func (a *Agent) queryPanelAuth(req authRequest) (authResponse, error) {
+	var result authResponse
+
+	body, _ := json.Marshal(req)
+	httpReq, err := a.newPanelRequest(http.MethodPost, "/agent/auth", body)
+	if err != nil {
+		return result, err
+	}
+
+	client := &http.Client{Timeout: 5 * time.Second}
+	resp, err := client.Do(httpReq)
+	if err != nil {
+		return result, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return result, fmt.Errorf("panel returned status %d", resp.StatusCode)
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return result, err
+	}
+	return result, nil
+}
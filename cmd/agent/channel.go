@@ -0,0 +1,214 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/AliceNetworks/gost-panel/internal/probe"
+	"github.com/gorilla/websocket"
+)
+
+// 控制通道消息类型 (与面板 internal/api/agent_channel.go 保持一致)
+const (
+	msgConfig       = "config"
+	msgReload       = "reload"
+	msgRestart      = "restart"
+	msgUninstall    = "uninstall"
+	msgHeartbeat    = "heartbeat"
+	msgHeartbeatAck = "heartbeat_ack"
+	msgProbe        = "probe"
+	msgProbeResult  = "probe_result"
+)
+
+// controlMessage 控制通道消息
+type controlMessage struct {
+	Type string          `json:"type"`
+	Data json.RawMessage `json:"data,omitempty"`
+}
+
+// controlChannel 与面板之间的 WebSocket 长连接
+type controlChannel struct {
+	conn *websocket.Conn
+	mu   sync.Mutex // 串行化写操作
+}
+
+func (ch *controlChannel) send(msgType string, data interface{}) error {
+	msg := controlMessage{Type: msgType}
+	if data != nil {
+		raw, err := json.Marshal(data)
+		if err != nil {
+			return err
+		}
+		msg.Data = raw
+	}
+
+	ch.mu.Lock()
+	defer ch.mu.Unlock()
+	ch.conn.SetWriteDeadline(time.Now().Add(10 * time.Second))
+	return ch.conn.WriteJSON(msg)
+}
+
+// getChannel 返回当前在线的控制通道，未连接时返回 nil
+func (a *Agent) getChannel() *controlChannel {
+	a.channelMu.Lock()
+	defer a.channelMu.Unlock()
+	return a.channel
+}
+
+func (a *Agent) setChannel(ch *controlChannel) {
+	a.channelMu.Lock()
+	a.channel = ch
+	a.channelMu.Unlock()
+}
+
+// channelLoop 保持控制通道连接，断开后指数退避重连
+func (a *Agent) channelLoop() {
+	backoff := 5 * time.Second
+	maxBackoff := 60 * time.Second
+
+	for !a.stopping.Load() {
+		start := time.Now()
+		err := a.runChannel()
+		if a.stopping.Load() {
+			return
+		}
+
+		// 连接稳定运行过一段时间，重置退避
+		if time.Since(start) > maxBackoff {
+			backoff = 5 * time.Second
+		}
+
+		log.Printf("Control channel disconnected: %v, retrying in %v (HTTP heartbeat active)", err, backoff)
+		time.Sleep(backoff)
+		backoff = min(backoff*2, maxBackoff)
+	}
+}
+
+// runChannel 建立一次控制通道连接并处理消息，直到连接断开
+func (a *Agent) runChannel() error {
+	dialer := websocket.Dialer{
+		Proxy:            http.ProxyFromEnvironment,
+		HandshakeTimeout: 10 * time.Second,
+	}
+	header := http.Header{}
+	a.authorize(header, http.MethodGet, channelRoute(a.channelURL), nil)
+
+	conn, resp, err := dialer.Dial(a.channelURL, header)
+	if err != nil {
+		if resp != nil {
+			return fmt.Errorf("%w (status %d)", err, resp.StatusCode)
+		}
+		return err
+	}
+	defer conn.Close()
+
+	ch := &controlChannel{conn: conn}
+	a.setChannel(ch)
+	defer a.setChannel(nil)
+	log.Printf("Control channel connected: %s", a.channelURL)
+
+	// 连接后立即上报一次，面板据此核对配置
+	go func() {
+		if err := a.sendHeartbeat(); err != nil {
+			log.Printf("Heartbeat failed: %v", err)
+		}
+	}()
+
+	conn.SetReadDeadline(time.Now().Add(90 * time.Second))
+	conn.SetPingHandler(func(appData string) error {
+		conn.SetReadDeadline(time.Now().Add(90 * time.Second))
+		return conn.WriteControl(websocket.PongMessage, []byte(appData), time.Now().Add(10*time.Second))
+	})
+
+	for {
+		var msg controlMessage
+		if err := conn.ReadJSON(&msg); err != nil {
+			return err
+		}
+		conn.SetReadDeadline(time.Now().Add(90 * time.Second))
+		a.handleControlMessage(msg)
+	}
+}
+
+// handleControlMessage 处理面板下发的消息
+func (a *Agent) handleControlMessage(msg controlMessage) {
+	switch msg.Type {
+	case msgConfig:
+		var payload struct {
+			Hash   string `json:"hash"`
+			Config string `json:"config"`
+		}
+		if err := json.Unmarshal(msg.Data, &payload); err != nil {
+			log.Printf("Invalid config message: %v", err)
+			return
+		}
+		if fmt.Sprintf("%x", sha256.Sum256([]byte(payload.Config))) != payload.Hash {
+			log.Println("Pushed config hash mismatch, ignoring")
+			return
+		}
+		if payload.Hash == a.getConfigHash() {
+			return
+		}
+		log.Println("Config pushed by panel, applying...")
+		go func() {
+			if err := a.installConfig([]byte(payload.Config), true); err != nil {
+				log.Printf("Failed to apply pushed config: %v", err)
+			}
+		}()
+
+	case msgReload:
+		log.Println("Reload command received from panel")
+		a.clearRejectedConfig()
+		go a.reloadConfig()
+
+	case msgRestart:
+		log.Println("Restart command received from panel")
+		go a.restartGost()
+
+	case msgUninstall:
+		// 只执行面板签名的卸载命令
+		a.handleDecommission(msg.Data)
+
+	case msgHeartbeatAck:
+		var result map[string]interface{}
+		if err := json.Unmarshal(msg.Data, &result); err == nil {
+			// 补报可能正持有 statsMu 等待 HTTP 请求，不阻塞通道读取
+			go func() {
+				a.statsMu.Lock()
+				defer a.statsMu.Unlock()
+				a.ackStats(result)
+			}()
+			a.handleHeartbeatResult(result)
+		}
+
+	case msgProbe:
+		var req probe.Request
+		if err := json.Unmarshal(msg.Data, &req); err != nil {
+			log.Printf("Invalid probe message: %v", err)
+			return
+		}
+		go a.runProbe(req)
+	}
+}
+
+// runProbe 替面板从本机探测其他节点，并通过控制通道上报结果
+func (a *Agent) runProbe(req probe.Request) {
+	result := probe.Run(req.Proxy, req.Target, time.Duration(req.Timeout)*time.Second)
+	if !result.Success {
+		log.Printf("Probe of node %d via %s failed at %s: %s", req.NodeID, req.Proxy.Addr, result.Stage, result.Error)
+	}
+
+	ch := a.getChannel()
+	if ch == nil {
+		log.Println("Control channel closed, dropping probe result")
+		return
+	}
+	if err := ch.send(msgProbeResult, probe.Report{NodeID: req.NodeID, Target: req.Target, Result: result}); err != nil {
+		log.Printf("Failed to send probe result: %v", err)
+	}
+}
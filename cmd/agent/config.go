@@ -0,0 +1,505 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/goccy/go-yaml"
+)
+
+// ==================== 配置校验与回滚 ====================
+//
+// 新配置先写入临时文件 (gost.yml.new) 校验: GOST 解析配置 (-O 输出后退出)、检查服务和引用、
+// 检查新增端口是否可用。通过后保留当前配置 (gost.yml.prev) 再替换，让 GOST 重新加载并观察
+// 一段时间；GOST 退出或没有加载新服务时恢复上一版本。结果和错误信息上报面板，
+// 失败的配置记录下来，面板配置变化 (或手动重新加载) 之前不再尝试。
+
+const (
+	configVerifyTimeout = 20 * time.Second // 等待 GOST 加载新服务的时间
+	configVerifyStable  = 3                // 连续检查通过的次数
+	configVerifyGrace   = 5 * time.Second  // 没有 API 时只观察 GOST 是否退出
+	configDryRunTimeout = 10 * time.Second
+)
+
+// 配置应用结果 (与面板一致)
+const (
+	configApplied    = "applied"
+	configRejected   = "rejected"
+	configRolledBack = "rolled_back"
+)
+
+// udpListeners 监听 UDP 端口的 listener 类型
+var udpListeners = map[string]bool{
+	"udp": true, "redu": true, "dns": true, "quic": true, "kcp": true,
+	"h3": true, "http3": true, "wt": true, "dtls": true,
+}
+
+// noBindListeners 不在本机监听端口的 listener 类型 (远程端口转发在对端监听，tun/tap 使用虚拟网卡)
+var noBindListeners = map[string]bool{
+	"rtcp": true, "rudp": true, "tun": true, "tap": true,
+}
+
+// gostConfig 校验需要的 GOST 配置字段
+type gostConfig struct {
+	Services   []gostService `yaml:"services"`
+	Chains     []gostNamed   `yaml:"chains"`
+	Authers    []gostNamed   `yaml:"authers"`
+	Limiters   []gostNamed   `yaml:"limiters"`
+	RLimiters  []gostNamed   `yaml:"rlimiters"`
+	Admissions []gostNamed   `yaml:"admissions"`
+	Bypasses   []gostNamed   `yaml:"bypasses"`
+	Hosts      []gostNamed   `yaml:"hosts"`
+	API        *gostAddr     `yaml:"api"`
+	Metrics    *gostAddr     `yaml:"metrics"`
+}
+
+type gostService struct {
+	Name      string `yaml:"name"`
+	Addr      string `yaml:"addr"`
+	Admission string `yaml:"admission"`
+	Limiter   string `yaml:"limiter"`
+	RLimiter  string `yaml:"rlimiter"`
+	Handler   struct {
+		Type   string `yaml:"type"`
+		Chain  string `yaml:"chain"`
+		Auther string `yaml:"auther"`
+		Bypass string `yaml:"bypass"`
+		Hosts  string `yaml:"hosts"`
+	} `yaml:"handler"`
+	Listener struct {
+		Type  string `yaml:"type"`
+		Chain string `yaml:"chain"`
+	} `yaml:"listener"`
+}
+
+type gostNamed struct {
+	Name string `yaml:"name"`
+}
+
+type gostAddr struct {
+	Addr string `yaml:"addr"`
+}
+
+func newConfigPath(configPath string) string {
+	return configPath + ".new"
+}
+
+// prevConfigPath 替换前的配置，新配置失败时恢复
+func prevConfigPath(configPath string) string {
+	return configPath + ".prev"
+}
+
+// syncConfig 从面板下载配置并校验、替换。apply 为 true 时让运行中的 GOST 加载并在失败时回滚
+func (a *Agent) syncConfig(apply bool) error {
+	data, err := a.downloadConfig()
+	if err != nil {
+		return err
+	}
+	return a.installConfig(data, apply)
+}
+
+// installConfig 校验新配置后替换配置文件。apply 为 true 时让 GOST 重新加载并观察运行状态，
+// 异常时恢复上一版本；为 false 时 (GOST 尚未启动或正等待重启) 只校验和替换
+func (a *Agent) installConfig(data []byte, apply bool) error {
+	a.configMu.Lock()
+	defer a.configMu.Unlock()
+
+	hash := fmt.Sprintf("%x", sha256.Sum256(data))
+	if hash == a.getConfigHash() {
+		return nil
+	}
+	if hash == a.rejectedConfig() {
+		return fmt.Errorf("config %s failed before, waiting for a new config", hash[:12])
+	}
+
+	if err := os.MkdirAll(filepath.Dir(a.configPath), 0755); err != nil {
+		return err
+	}
+	newPath := newConfigPath(a.configPath)
+	if err := writeFileAtomic(newPath, data, 0644); err != nil {
+		return err
+	}
+	defer os.Remove(newPath)
+
+	if err := a.validateConfig(newPath, data); err != nil {
+		a.configFailed(hash, configRejected, err)
+		return fmt.Errorf("config %s rejected: %w", hash[:12], err)
+	}
+
+	// 保留上一版本后替换
+	hasPrev := false
+	if old, err := os.ReadFile(a.configPath); err == nil {
+		if err := writeFileAtomic(prevConfigPath(a.configPath), old, 0644); err != nil {
+			return fmt.Errorf("keep previous config: %w", err)
+		}
+		hasPrev = true
+	}
+	if err := os.Rename(newPath, a.configPath); err != nil {
+		return err
+	}
+
+	if !apply || a.gostCmd == nil || a.gostSuspended.Load() {
+		log.Printf("Config %s installed", hash[:12])
+		return nil
+	}
+
+	exits := a.gostExits.Load()
+	a.applyConfig()
+	err := a.verifyConfig(data, exits)
+	if err == nil {
+		log.Printf("Config %s applied", hash[:12])
+		a.reportConfig(hash, configApplied, "")
+		return nil
+	}
+
+	log.Printf("GOST failed with config %s: %v", hash[:12], err)
+	if !hasPrev {
+		err = fmt.Errorf("%w (no previous config to restore)", err)
+		a.configFailed(hash, configRolledBack, err)
+		return err
+	}
+	if rerr := a.restorePrevConfig(exits); rerr != nil {
+		err = fmt.Errorf("%w (restore previous config: %v)", err, rerr)
+	} else {
+		log.Println("Previous config restored")
+	}
+	a.configFailed(hash, configRolledBack, err)
+	return err
+}
+
+// restorePrevConfig 恢复上一版本。GOST 已退出时由 watchGost 使用恢复的配置重启，否则重新加载
+func (a *Agent) restorePrevConfig(exits uint64) error {
+	data, err := os.ReadFile(prevConfigPath(a.configPath))
+	if err != nil {
+		return err
+	}
+	if err := writeFileAtomic(a.configPath, data, 0644); err != nil {
+		return err
+	}
+	if a.gostExits.Load() == exits {
+		a.applyConfig()
+	}
+	return nil
+}
+
+// ==================== 校验 ====================
+
+// validateConfig 校验临时文件中的新配置: GOST 能否解析、服务和引用是否完整、新增端口是否可用
+func (a *Agent) validateConfig(path string, data []byte) error {
+	var cfg gostConfig
+	if err := yaml.Unmarshal(data, &cfg); err != nil {
+		return fmt.Errorf("parse config: %w", err)
+	}
+	if err := a.dryRunConfig(path); err != nil {
+		return err
+	}
+	if err := checkConfigRefs(&cfg); err != nil {
+		return err
+	}
+	return a.checkConfigPorts(&cfg)
+}
+
+// dryRunConfig 让 GOST 解析配置并输出 (-O)，不启动服务
+func (a *Agent) dryRunConfig(path string) error {
+	if a.gostPath == "" {
+		return nil
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), configDryRunTimeout)
+	defer cancel()
+
+	var output bytes.Buffer
+	cmd := exec.CommandContext(ctx, a.gostPath, "-C", path, "-O", "json")
+	cmd.Stdout = io.Discard
+	cmd.Stderr = &output
+	if err := cmd.Run(); err != nil {
+		msg := strings.TrimSpace(output.String())
+		// 不支持 -O 的 GOST 版本跳过这一步
+		if strings.Contains(msg, "flag provided but not defined") {
+			return nil
+		}
+		if len(msg) > 512 {
+			msg = msg[len(msg)-512:]
+		}
+		return fmt.Errorf("gost rejected config: %v: %s", err, msg)
+	}
+	return nil
+}
+
+// checkConfigRefs 检查服务名称、地址以及对链、认证器、限速器等的引用
+func checkConfigRefs(cfg *gostConfig) error {
+	names := func(items []gostNamed) map[string]bool {
+		m := make(map[string]bool, len(items))
+		for _, item := range items {
+			m[item.Name] = true
+		}
+		return m
+	}
+	refs := []struct {
+		kind    string
+		defined map[string]bool
+		ref     func(svc *gostService) string
+	}{
+		{"chain", names(cfg.Chains), func(svc *gostService) string { return svc.Handler.Chain }},
+		{"chain", names(cfg.Chains), func(svc *gostService) string { return svc.Listener.Chain }},
+		{"auther", names(cfg.Authers), func(svc *gostService) string { return svc.Handler.Auther }},
+		{"bypass", names(cfg.Bypasses), func(svc *gostService) string { return svc.Handler.Bypass }},
+		{"hosts", names(cfg.Hosts), func(svc *gostService) string { return svc.Handler.Hosts }},
+		{"limiter", names(cfg.Limiters), func(svc *gostService) string { return svc.Limiter }},
+		{"rlimiter", names(cfg.RLimiters), func(svc *gostService) string { return svc.RLimiter }},
+		{"admission", names(cfg.Admissions), func(svc *gostService) string { return svc.Admission }},
+	}
+
+	seen := make(map[string]bool, len(cfg.Services))
+	for i := range cfg.Services {
+		svc := &cfg.Services[i]
+		if svc.Name == "" {
+			return fmt.Errorf("service #%d has no name", i+1)
+		}
+		if seen[svc.Name] {
+			return fmt.Errorf("duplicate service %s", svc.Name)
+		}
+		seen[svc.Name] = true
+		if svc.Addr != "" {
+			if _, _, err := net.SplitHostPort(svc.Addr); err != nil {
+				return fmt.Errorf("service %s: invalid addr %q", svc.Name, svc.Addr)
+			}
+		}
+		for _, r := range refs {
+			if name := r.ref(svc); name != "" && !r.defined[name] {
+				return fmt.Errorf("service %s: %s %s not defined", svc.Name, r.kind, name)
+			}
+		}
+	}
+	return nil
+}
+
+// checkConfigPorts 检查新增的监听端口是否可用 (当前配置已使用的端口由 GOST 占用，跳过)
+func (a *Agent) checkConfigPorts(cfg *gostConfig) error {
+	inUse := make(map[string]bool)
+	if data, err := os.ReadFile(a.configPath); err == nil {
+		var current gostConfig
+		if yaml.Unmarshal(data, &current) == nil {
+			for _, l := range current.listens() {
+				inUse[l.network+"/"+l.port] = true
+			}
+		}
+	}
+
+	for _, l := range cfg.listens() {
+		if inUse[l.network+"/"+l.port] {
+			continue
+		}
+		if err := checkPortFree(l.network, l.addr); err != nil {
+			return fmt.Errorf("%s: %s port %s unavailable: %v", l.owner, l.network, l.port, err)
+		}
+	}
+	return nil
+}
+
+// configListen 配置中的一个本地监听地址
+type configListen struct {
+	owner   string // 服务名或 api/metrics
+	network string // tcp/udp
+	addr    string
+	port    string
+}
+
+// listens 配置在本机监听的地址 (跳过端口为 0 或端口范围等无法预先检查的地址)
+func (cfg *gostConfig) listens() []configListen {
+	var result []configListen
+	add := func(owner, network, addr string) {
+		_, port, err := net.SplitHostPort(addr)
+		if err != nil {
+			return
+		}
+		if n, err := strconv.Atoi(port); err != nil || n == 0 {
+			return
+		}
+		result = append(result, configListen{owner: owner, network: network, addr: addr, port: port})
+	}
+
+	for _, svc := range cfg.Services {
+		if noBindListeners[svc.Listener.Type] {
+			continue
+		}
+		network := "tcp"
+		if udpListeners[svc.Listener.Type] {
+			network = "udp"
+		}
+		add("service "+svc.Name, network, svc.Addr)
+	}
+	if cfg.API != nil {
+		add("api", "tcp", cfg.API.Addr)
+	}
+	if cfg.Metrics != nil {
+		add("metrics", "tcp", cfg.Metrics.Addr)
+	}
+	return result
+}
+
+func checkPortFree(network, addr string) error {
+	if network == "udp" {
+		conn, err := net.ListenPacket("udp", addr)
+		if err != nil {
+			return err
+		}
+		return conn.Close()
+	}
+	ln, err := net.Listen("tcp", addr)
+	if err != nil {
+		return err
+	}
+	return ln.Close()
+}
+
+// ==================== 运行状态 ====================
+
+// verifyConfig 观察 GOST 加载新配置后的状态: 退出视为失败；有 API 时等待新配置的服务全部出现
+func (a *Agent) verifyConfig(data []byte, exits uint64) error {
+	var cfg gostConfig
+	if err := yaml.Unmarshal(data, &cfg); err != nil {
+		return err
+	}
+
+	// 没有 API (例如客户端) 或 API 端口变化 (Agent 仍访问原地址) 时只能观察 GOST 是否退出
+	if cfg.API == nil || !a.gostAPIMatches(cfg.API.Addr) {
+		deadline := time.Now().Add(configVerifyGrace)
+		for time.Now().Before(deadline) {
+			time.Sleep(time.Second)
+			if a.gostExits.Load() != exits {
+				return errors.New("GOST exited after loading the new config")
+			}
+		}
+		return nil
+	}
+
+	want := make(map[string]string, len(cfg.Services))
+	for _, svc := range cfg.Services {
+		want[svc.Name] = svc.Addr
+	}
+	stable := 0
+	lastErr := errors.New("no response from GOST API")
+	deadline := time.Now().Add(configVerifyTimeout)
+	for time.Now().Before(deadline) {
+		time.Sleep(time.Second)
+		if a.gostExits.Load() != exits {
+			return errors.New("GOST exited after loading the new config")
+		}
+		services, err := a.fetchGostServices()
+		if err == nil {
+			err = matchServices(want, services)
+		}
+		if err != nil {
+			lastErr = err
+			stable = 0
+			continue
+		}
+		if stable++; stable >= configVerifyStable {
+			return nil
+		}
+	}
+	return fmt.Errorf("GOST did not load the new config within %v: %v", configVerifyTimeout, lastErr)
+}
+
+// gostAPIMatches 配置中的 API 端口是否就是 Agent 访问的 GOST API
+func (a *Agent) gostAPIMatches(addr string) bool {
+	_, port, err := net.SplitHostPort(addr)
+	if err != nil {
+		return false
+	}
+	u, err := url.Parse(a.gostAPI)
+	return err == nil && u.Port() == port
+}
+
+// matchServices GOST 当前运行的服务是否与新配置一致
+func matchServices(want map[string]string, services []map[string]interface{}) error {
+	running := make(map[string]string, len(services))
+	for _, svc := range services {
+		name, _ := svc["name"].(string)
+		addr, _ := svc["addr"].(string)
+		running[name] = addr
+	}
+	for name, addr := range want {
+		got, ok := running[name]
+		if !ok {
+			return fmt.Errorf("service %s not running", name)
+		}
+		if got != addr {
+			return fmt.Errorf("service %s listening on %s, expected %s", name, got, addr)
+		}
+	}
+	return nil
+}
+
+// ==================== 结果上报 ====================
+
+// rejectedConfig 最近一次失败的配置哈希
+func (a *Agent) rejectedConfig() string {
+	a.stateMu.Lock()
+	defer a.stateMu.Unlock()
+	return a.state.RejectedConfigHash
+}
+
+// clearRejectedConfig 手动重新加载时重新尝试失败过的配置
+func (a *Agent) clearRejectedConfig() {
+	a.stateMu.Lock()
+	defer a.stateMu.Unlock()
+	if a.state.RejectedConfigHash != "" {
+		a.state.RejectedConfigHash = ""
+		a.saveState()
+	}
+}
+
+// configFailed 记录失败的配置 (重启后也不再尝试) 并上报面板
+func (a *Agent) configFailed(hash, status string, cause error) {
+	a.stateMu.Lock()
+	a.state.RejectedConfigHash = hash
+	a.saveState()
+	a.stateMu.Unlock()
+
+	a.reportConfig(hash, status, cause.Error())
+}
+
+// reportConfig 上报配置应用结果，面板显示在节点和配置版本上
+func (a *Agent) reportConfig(hash, status, errText string) {
+	data := map[string]string{
+		"hash":   hash,
+		"status": status,
+		"error":  errText,
+	}
+	if _, enrolled := a.agentKey(); !enrolled {
+		data["token"] = a.token
+	}
+
+	body, _ := json.Marshal(data)
+	req, err := a.newPanelRequest(http.MethodPost, "/agent/config-result", body)
+	if err != nil {
+		log.Printf("Failed to report config result: %v", err)
+		return
+	}
+	resp, err := a.client.Do(req)
+	if err != nil {
+		log.Printf("Failed to report config result: %v", err)
+		return
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		respBody, _ := io.ReadAll(resp.Body)
+		log.Printf("Failed to report config result: status %d: %s", resp.StatusCode, respBody)
+	}
+}
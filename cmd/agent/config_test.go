@@ -0,0 +1,176 @@
+package main
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/goccy/go-yaml"
+)
+
+func parseTestConfig(t *testing.T, data string) *gostConfig {
+	t.Helper()
+	var cfg gostConfig
+	if err := yaml.Unmarshal([]byte(data), &cfg); err != nil {
+		t.Fatal(err)
+	}
+	return &cfg
+}
+
+func TestCheckConfigRefs(t *testing.T) {
+	defs := `
+chains: [{name: chain-1}]
+authers: [{name: auther-1}]
+limiters: [{name: limiter-1}]
+rlimiters: [{name: rlimiter-1}]
+admissions: [{name: admission-1}]
+bypasses: [{name: bypass-1}]
+hosts: [{name: hosts-1}]
+`
+	tests := []struct {
+		services string
+		err      string // 为空表示通过
+	}{
+		{`[{name: a, addr: ":1080", admission: admission-1, limiter: limiter-1, rlimiter: rlimiter-1,
+		   handler: {type: socks5, chain: chain-1, auther: auther-1, bypass: bypass-1, hosts: hosts-1}}]`, ""},
+		{`[{name: a, addr: ":8080", handler: {type: rtcp}, listener: {type: rtcp, chain: chain-1}}]`, ""},
+		{`[{name: a}, {name: b}]`, ""}, // 没有地址的服务 (例如 tun) 不检查地址
+		{`[{name: a, handler: {chain: chain-2}}]`, "service a: chain chain-2 not defined"},
+		{`[{name: a, listener: {chain: chain-2}}]`, "service a: chain chain-2 not defined"},
+		{`[{name: a, handler: {auther: auther-2}}]`, "service a: auther auther-2 not defined"},
+		{`[{name: a, handler: {bypass: bypass-2}}]`, "service a: bypass bypass-2 not defined"},
+		{`[{name: a, handler: {hosts: hosts-2}}]`, "service a: hosts hosts-2 not defined"},
+		{`[{name: a, limiter: limiter-2}]`, "service a: limiter limiter-2 not defined"},
+		{`[{name: a, rlimiter: rlimiter-2}]`, "service a: rlimiter rlimiter-2 not defined"},
+		{`[{name: a, admission: admission-2}]`, "service a: admission admission-2 not defined"},
+		{`[{name: a, limiter: rlimiter-1}]`, "service a: limiter rlimiter-1 not defined"}, // 不同种类的同名配置不能互相引用
+		{`[{name: a, addr: ":1080"}, {name: a, addr: ":1081"}]`, "duplicate service a"},
+		{`[{name: a}, {addr: ":1081"}]`, "service #2 has no name"},
+		{`[{name: a, addr: "1080"}]`, `service a: invalid addr "1080"`},
+	}
+	for _, tt := range tests {
+		err := checkConfigRefs(parseTestConfig(t, defs+"services: "+tt.services))
+		if tt.err == "" && err != nil {
+			t.Errorf("services %s: %v, want ok", tt.services, err)
+		}
+		if tt.err != "" && (err == nil || err.Error() != tt.err) {
+			t.Errorf("services %s: %v, want %q", tt.services, err, tt.err)
+		}
+	}
+}
+
+func TestConfigListens(t *testing.T) {
+	cfg := parseTestConfig(t, `
+services:
+  - {name: socks, addr: ":1080", listener: {type: tcp}}
+  - {name: default, addr: "127.0.0.1:1081"}
+  - {name: ws, addr: ":443", listener: {type: wss}}
+  - {name: dns, addr: ":53", listener: {type: dns}}
+  - {name: quic, addr: ":8443", listener: {type: quic}}
+  - {name: forward, addr: ":2000", listener: {type: udp}}
+  - {name: rtcp, addr: ":3000", listener: {type: rtcp}}
+  - {name: tun, addr: ":8421", listener: {type: tun}}
+  - {name: any-port, addr: ":0"}
+  - {name: range, addr: ":10000-10010"}
+  - {name: no-addr}
+api: {addr: ":18080"}
+metrics: {addr: ":9000"}
+`)
+	want := []configListen{
+		{"service socks", "tcp", ":1080", "1080"},
+		{"service default", "tcp", "127.0.0.1:1081", "1081"},
+		{"service ws", "tcp", ":443", "443"},
+		{"service dns", "udp", ":53", "53"},
+		{"service quic", "udp", ":8443", "8443"},
+		{"service forward", "udp", ":2000", "2000"},
+		{"api", "tcp", ":18080", "18080"},
+		{"metrics", "tcp", ":9000", "9000"},
+	}
+	if got := cfg.listens(); !reflect.DeepEqual(got, want) {
+		t.Errorf("listens() = %+v\nwant %+v", got, want)
+	}
+}
+
+// 新配置中被占用的端口报错，当前配置已使用的端口 (同一协议) 跳过
+func TestCheckConfigPorts(t *testing.T) {
+	busyTCP, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer busyTCP.Close()
+	addr := busyTCP.Addr().String()
+	busyUDP, err := net.ListenPacket("udp", addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer busyUDP.Close()
+	otherTCP, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer otherTCP.Close()
+	other := otherTCP.Addr().String()
+
+	a := newTestAgent(t, "")
+	tests := []struct {
+		current  string // 当前配置的服务，为空表示没有当前配置
+		services string
+		err      string
+	}{
+		// 当前配置的服务改名或改用同协议的 listener 时端口仍由 GOST 占用
+		{fmt.Sprintf("[{name: old, addr: %q}]", addr), fmt.Sprintf("[{name: new, addr: %q, listener: {type: ws}}]", addr), ""},
+		{fmt.Sprintf("[{name: old, addr: %q, listener: {type: udp}}]", addr), fmt.Sprintf("[{name: new, addr: %q, listener: {type: quic}}]", addr), ""},
+		// 端口号相同但协议不同，不是当前配置占用的端口
+		{fmt.Sprintf("[{name: old, addr: %q}]", addr), fmt.Sprintf("[{name: new, addr: %q, listener: {type: udp}}]", addr), "service new: udp port"},
+		{fmt.Sprintf("[{name: old, addr: %q, listener: {type: udp}}]", addr), fmt.Sprintf("[{name: new, addr: %q}]", addr), "service new: tcp port"},
+		// 不在本机监听的服务不检查
+		{"", fmt.Sprintf("[{name: remote, addr: %q, listener: {type: rtcp}}]", addr), ""},
+		{fmt.Sprintf("[{name: old, addr: %q}]", addr), fmt.Sprintf("[{name: new, addr: %q}]", other), "service new: tcp port"},
+		{"", fmt.Sprintf("[{name: new, addr: %q}]", addr), "service new: tcp port"},
+		{"", "[{name: new, addr: \"127.0.0.1:0\"}]", ""},
+	}
+	for _, tt := range tests {
+		os.Remove(a.configPath)
+		if tt.current != "" {
+			if err := os.WriteFile(a.configPath, []byte("services: "+tt.current), 0600); err != nil {
+				t.Fatal(err)
+			}
+		}
+		err := a.checkConfigPorts(parseTestConfig(t, "services: "+tt.services))
+		if tt.err == "" && err != nil {
+			t.Errorf("current %s, services %s: %v, want ok", tt.current, tt.services, err)
+		}
+		if tt.err != "" && (err == nil || !strings.HasPrefix(err.Error(), tt.err)) {
+			t.Errorf("current %s, services %s: %v, want %q", tt.current, tt.services, err, tt.err)
+		}
+	}
+
+	// API 和 metrics 端口同样检查
+	os.Remove(a.configPath)
+	cfg := parseTestConfig(t, fmt.Sprintf("api: {addr: %q}", addr))
+	if err := a.checkConfigPorts(cfg); err == nil || !strings.HasPrefix(err.Error(), "api: tcp port") {
+		t.Errorf("api on a busy port: %v, want api port unavailable", err)
+	}
+}
+
+func TestMatchServices(t *testing.T) {
+	want := map[string]string{"a": ":1080", "b": ":1081"}
+	tests := []struct {
+		running []map[string]interface{}
+		err     string
+	}{
+		{[]map[string]interface{}{{"name": "a", "addr": ":1080"}, {"name": "b", "addr": ":1081"}}, ""},
+		{[]map[string]interface{}{{"name": "a", "addr": ":1080"}, {"name": "b", "addr": ":1081"}, {"name": "old", "addr": ":2000"}}, ""},
+		{[]map[string]interface{}{{"name": "a", "addr": ":1080"}}, "service b not running"},
+		{[]map[string]interface{}{{"name": "a", "addr": ":1080"}, {"name": "b", "addr": ":2000"}}, "service b listening on :2000, expected :1081"},
+	}
+	for _, tt := range tests {
+		err := matchServices(want, tt.running)
+		if (err == nil) != (tt.err == "") || (err != nil && err.Error() != tt.err) {
+			t.Errorf("matchServices(%v) = %v, want %q", tt.running, err, tt.err)
+		}
+	}
+}
@@ -0,0 +1,117 @@
+package main
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"log"
+	"net/http"
+	"net/url"
+
+	"github.com/AliceNetworks/gost-panel/internal/signing"
+)
+
+// ==================== 密钥登记与请求签名 ====================
+//
+// Agent 首次注册时生成 Ed25519 密钥对，用启动参数中的 Token (安装脚本中的节点/客户端 Token
+// 或管理员签发的一次性加入令牌) 向面板登记公钥。登记后所有请求都用私钥签名，不再发送 Token；
+// 面板吊销凭据后 Agent 进入孤立状态，需用新的加入令牌执行 'gost-agent orphan reenroll'。
+
+// agentKey 当前密钥 (没有时生成并保存)，返回私钥和面板是否已登记该公钥
+func (a *Agent) agentKey() (ed25519.PrivateKey, bool) {
+	a.stateMu.Lock()
+	defer a.stateMu.Unlock()
+
+	if a.state.PrivateKey == "" {
+		_, priv, err := signing.GenerateKey()
+		if err != nil {
+			log.Printf("Failed to generate agent key: %v", err)
+			return nil, false
+		}
+		a.state.PrivateKey = priv
+		a.state.KeyToken = signing.TokenHash(a.token)
+		a.state.Enrolled = false
+		a.saveState()
+	}
+	key, err := signing.ParsePrivateKey(a.state.PrivateKey)
+	if err != nil {
+		log.Printf("Invalid agent key in %s: %v", statePath(a.configPath), err)
+		return nil, false
+	}
+	return key, a.state.Enrolled
+}
+
+// markEnrolled 面板确认登记了公钥，记录 GOST 调用本地认证插件使用的 Token
+func (a *Agent) markEnrolled(enrolled bool, authToken string) {
+	a.stateMu.Lock()
+	defer a.stateMu.Unlock()
+
+	changed := false
+	if enrolled && !a.state.Enrolled && a.state.PrivateKey != "" {
+		a.state.Enrolled = true
+		changed = true
+		log.Println("Agent key enrolled, panel requests are now signed")
+	}
+	if authToken != "" && authToken != a.state.AuthToken {
+		a.state.AuthToken = authToken
+		changed = true
+	}
+	if changed {
+		a.saveState()
+	}
+}
+
+// credential 面板识别 Agent 的凭据: 已登记时为公钥，否则为 Token (卸载命令与之绑定)
+func (a *Agent) credential() string {
+	if key, enrolled := a.agentKey(); enrolled {
+		return signing.PublicKey(key)
+	}
+	return a.token
+}
+
+// authToken GOST 调用本地认证插件时使用的 Token (即配置中的节点 Token)
+func (a *Agent) authToken() string {
+	a.stateMu.Lock()
+	defer a.stateMu.Unlock()
+	if a.state.AuthToken != "" {
+		return a.state.AuthToken
+	}
+	return a.token
+}
+
+// signHeader 添加签名头，route 为面板路由及查询参数
+func signHeader(h http.Header, key ed25519.PrivateKey, method, route string, body []byte) {
+	for k, v := range signing.SignRequest(key, method, route, body) {
+		h[k] = v
+	}
+}
+
+// newPanelRequest 创建发往面板的请求: 已登记密钥时签名，否则携带 Token
+func (a *Agent) newPanelRequest(method, route string, body []byte) (*http.Request, error) {
+	req, err := http.NewRequest(method, a.panelURL+route, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	a.authorize(req.Header, req.Method, route, body)
+	return req, nil
+}
+
+// authorize 添加认证头: 已登记密钥时签名，否则携带 Token
+func (a *Agent) authorize(h http.Header, method, route string, body []byte) {
+	if key, enrolled := a.agentKey(); enrolled {
+		signHeader(h, key, method, route, body)
+		return
+	}
+	h.Set("Authorization", "Bearer "+a.token)
+}
+
+// channelRoute 控制通道地址中参与签名的路由部分
+func channelRoute(channelURL string) string {
+	u, err := url.Parse(channelURL)
+	if err != nil {
+		return channelURL
+	}
+	return u.RequestURI()
+}
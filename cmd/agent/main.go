@@ -5,13 +5,16 @@ import (
 	"archive/zip"
 	"bytes"
 	"compress/gzip"
+	"crypto/ed25519"
 	"crypto/sha256"
 	"encoding/json"
+	"errors"
 	"flag"
 	"fmt"
 	"io"
 	"log"
 	"net/http"
+	"net/url"
 	"os"
 	"os/exec"
 	"os/signal"
@@ -19,9 +22,12 @@ import (
 	"runtime"
 	"strconv"
 	"strings"
+	"sync"
 	"sync/atomic"
 	"syscall"
 	"time"
+
+	"github.com/AliceNetworks/gost-panel/internal/signing"
 )
 
 // 版本信息 - 通过 ldflags 在构建时注入
@@ -41,6 +47,10 @@ var (
 	gostUser    = flag.String("gost-user", "", "GOST API username")
 	gostPass    = flag.String("gost-pass", "", "GOST API password")
 	autoUpdate  = flag.Bool("auto-update", true, "Enable auto update")
+	updateKey   = flag.String("update-key", "", "Release public key for verifying updates (built-in key if empty)")
+	channelURL  = flag.String("channel", "", "Control channel URL (provided by panel if empty, \"off\" to disable)")
+	authListen  = flag.String("auth-listen", "127.0.0.1:18079", "Local auth plugin address for GOST (\"off\" to disable)")
+	orphanGrace = flag.Duration("orphan-grace", 7*24*time.Hour, "Stop GOST after the panel has rejected the token for this long (0 = never)")
 	showVersion = flag.Bool("version", false, "Show version")
 )
 
@@ -55,12 +65,34 @@ type Agent struct {
 	gostPass   string
 	autoUpdate bool
 	gostCmd    *exec.Cmd
+	gostExits  atomic.Uint64 // GOST 意外退出的次数 (应用新配置后据此判断是否失败)
 	client     *http.Client
 	stopping   atomic.Bool
+	configMu   sync.Mutex // 同一时间只应用一个配置
+	// 签名更新
+	execPath        string
+	updatePublicKey string
+	updateKey       ed25519.PublicKey
+	pendingUpdate   *pendingUpdate // 尚未确认的更新 (当前进程是刚安装的新版本)
+	// 孤立状态 (面板不认识 Token)
+	state         agentState
+	stateMu       sync.Mutex
+	orphanGrace   time.Duration
+	gostSuspended atomic.Bool // 超过宽限期后停止 GOST
+	// 离线运行 (面板不可达时缓存的心跳统计)
+	stats   statsBuffer
+	statsMu sync.Mutex
+	// 控制通道
+	channelURL string
+	channel    *controlChannel
+	channelMu  sync.Mutex
+	// 本地认证插件
+	authListen string
 	// 用于计算增量流量
 	lastTrafficIn    int64
 	lastTrafficOut   int64
 	lastServiceStats map[string]ServiceStats // 按服务名记录上次统计
+	lastUserStats    map[string]ServiceStats // 按 服务名/认证用户名 记录上次统计
 }
 
 // ServiceStats 单个服务的统计
@@ -81,7 +113,9 @@ func NewAgent(panelURL, token, mode, configPath, gostPath, gostAPI, gostUser, go
 		gostUser:         gostUser,
 		gostPass:         gostPass,
 		autoUpdate:       autoUpdate,
+		execPath:         resolveExecutable(),
 		lastServiceStats: make(map[string]ServiceStats),
+		lastUserStats:    make(map[string]ServiceStats),
 		client: &http.Client{
 			Timeout: 30 * time.Second,
 		},
@@ -89,8 +123,17 @@ func NewAgent(panelURL, token, mode, configPath, gostPath, gostAPI, gostUser, go
 }
 
 func (a *Agent) Run() error {
+	a.loadState()
+	a.loadStats()
+	a.initUpdateKey()
+
+	// 上次安装的更新尚未确认时先完成确认，超过期限则回滚
+	if err := a.loadPendingUpdate(); err != nil {
+		log.Printf("Update rollback failed: %v", err)
+	}
+
 	// 检查更新
-	if a.autoUpdate {
+	if a.autoUpdate && a.pendingUpdate == nil {
 		if updated, err := a.checkAndUpdate(); err != nil {
 			log.Printf("Update check failed: %v", err)
 		} else if updated {
@@ -99,27 +142,70 @@ func (a *Agent) Run() error {
 		}
 	}
 
-	// 注册到面板
-	if err := a.register(); err != nil {
-		return fmt.Errorf("register failed: %w", err)
+	// 注册到面板 (更新后的新版本在确认期限内重试，失败则回滚)
+	err := a.register()
+	if err != nil && a.pendingUpdate != nil && !isTokenRejected(err) {
+		err = a.registerAfterUpdate(err)
+	}
+	var rejected *tokenRejectedError
+	offline := false
+	if errors.As(err, &rejected) {
+		// 面板不认识 Token: 不回滚更新，使用本地已有的配置继续运行 GOST
+		a.handleTokenRejected(rejected.result)
+	} else if err != nil {
+		// 面板不可达: 有本地配置时离线运行并在后台重新注册，否则等待面板恢复
+		if a.useCachedConfig() {
+			log.Printf("Register failed: %v, running offline with local config", err)
+			offline = true
+		} else {
+			log.Printf("Register failed: %v, no local config to run offline", err)
+			if !a.registerWithBackoff() {
+				return nil
+			}
+		}
+	} else {
+		log.Println("Registered to panel successfully")
+		a.clearOrphaned()
+		a.confirmUpdate()
 	}
-	log.Println("Registered to panel successfully")
 
 	// 下载配置
-	if err := a.downloadConfig(); err != nil {
-		return fmt.Errorf("download config failed: %w", err)
+	if offline {
+		log.Println("Using local config until the panel is reachable")
+	} else if err := a.syncConfig(false); err != nil {
+		if !a.useCachedConfig() {
+			return fmt.Errorf("download config failed and no local config: %w", err)
+		}
+		log.Printf("Config not updated: %v, using local config", err)
+	} else {
+		log.Println("Config downloaded")
 	}
-	log.Println("Config downloaded")
 
-	// 启动 GOST
-	if err := a.startGost(); err != nil {
+	// 启动本地认证插件 (GOST 启动前就绪，用户凭据由面板实时校验)
+	if a.mode == "node" && a.authPluginListen() != "off" {
+		go a.serveAuthPlugin()
+	}
+
+	// 启动 GOST (孤立状态已超过宽限期时等待面板重新识别)
+	if a.orphanGraceExpired() {
+		a.gostSuspended.Store(true)
+		log.Printf("Agent has been orphaned for more than %s, GOST not started", a.orphanGrace)
+	} else if err := a.startGost(); err != nil {
 		return fmt.Errorf("start gost failed: %w", err)
+	} else {
+		log.Println("GOST started")
 	}
-	log.Println("GOST started")
 
-	// 启动心跳
+	// 启动心跳 (控制通道在线时通过通道上报)
 	go a.heartbeatLoop()
 
+	// 启动控制通道 (离线时在重新注册成功后启动)
+	if offline {
+		go a.reconnect()
+	} else if a.channelURL != "" && a.channelURL != "off" {
+		go a.channelLoop()
+	}
+
 	// 启动更新检查
 	if a.autoUpdate {
 		go a.updateCheckLoop()
@@ -139,48 +225,98 @@ func (a *Agent) Run() error {
 
 func (a *Agent) register() error {
 	data := map[string]string{
-		"token":   a.token,
 		"version": AgentVersion,
 	}
+	if a.mode == "node" {
+		data["auth_listen"] = a.authPluginListen()
+	}
+	// 尚未登记时用 Token 登记公钥，之后只用签名认证
+	key, enrolled := a.agentKey()
+	if !enrolled {
+		data["token"] = a.token
+		if key != nil {
+			data["public_key"] = signing.PublicKey(key)
+		}
+	}
+	// 上报尚未通知面板的更新回滚
+	failed := a.loadFailedUpdate()
+	if failed != nil && !failed.Reported {
+		data["update_failed"] = failed.Version
+		data["update_error"] = failed.Reason
+	}
 
 	body, _ := json.Marshal(data)
-	resp, err := a.client.Post(a.panelURL+"/agent/register", "application/json", bytes.NewReader(body))
+	req, err := http.NewRequest(http.MethodPost, a.panelURL+"/agent/register", bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if key != nil {
+		signHeader(req.Header, key, req.Method, "/agent/register", body)
+	}
+	resp, err := a.client.Do(req)
 	if err != nil {
 		return err
 	}
 	defer resp.Body.Close()
 
+	if resp.StatusCode == http.StatusUnauthorized {
+		var result map[string]interface{}
+		if err := json.NewDecoder(resp.Body).Decode(&result); err == nil {
+			return &tokenRejectedError{result: result}
+		}
+	}
 	if resp.StatusCode != http.StatusOK {
 		respBody, _ := io.ReadAll(resp.Body)
 		return fmt.Errorf("register failed: %s", string(respBody))
 	}
+	if failed != nil && !failed.Reported {
+		a.markRollbackReported(failed)
+	}
+
+	var result registerResult
+	if err := json.NewDecoder(resp.Body).Decode(&result); err == nil {
+		// 未指定控制通道地址时使用面板下发的地址
+		if a.channelURL == "" {
+			a.channelURL = result.ChannelURL
+		}
+		a.pinPanelKey(result.PanelKey)
+		a.markEnrolled(result.Enrolled, result.AuthToken)
+	}
 
 	return nil
 }
 
-func (a *Agent) downloadConfig() error {
-	resp, err := a.client.Get(a.panelURL + "/agent/config/" + a.token)
+// downloadConfig 从面板下载配置 (由 installConfig 校验后写入)
+func (a *Agent) downloadConfig() ([]byte, error) {
+	route := "/agent/config"
+	if _, enrolled := a.agentKey(); !enrolled {
+		route += "/" + a.token
+	}
+	req, err := a.newPanelRequest(http.MethodGet, route, nil)
 	if err != nil {
-		return err
+		return nil, err
+	}
+	resp, err := a.client.Do(req)
+	if err != nil {
+		return nil, err
 	}
 	defer resp.Body.Close()
 
 	if resp.StatusCode != http.StatusOK {
-		return fmt.Errorf("download config failed: status %d", resp.StatusCode)
+		return nil, fmt.Errorf("download config failed: status %d", resp.StatusCode)
 	}
 
+	return io.ReadAll(resp.Body)
+}
+
+// writeConfig 写入配置文件
+func (a *Agent) writeConfig(data []byte) error {
 	// 确保目录存在
 	if err := os.MkdirAll("/etc/gost", 0755); err != nil {
 		return err
 	}
-
-	// 写入配置文件
-	configData, err := io.ReadAll(resp.Body)
-	if err != nil {
-		return err
-	}
-
-	return os.WriteFile(a.configPath, configData, 0644)
+	return os.WriteFile(a.configPath, data, 0644)
 }
 
 // findGost 自动检测 GOST 二进制路径，找不到则自动下载
@@ -406,9 +542,10 @@ func (a *Agent) watchGost() {
 
 	for {
 		err := a.gostCmd.Wait()
-		if a.stopping.Load() {
+		if a.stopping.Load() || a.gostSuspended.Load() {
 			return
 		}
+		a.gostExits.Add(1)
 
 		if err != nil {
 			log.Printf("GOST exited with error: %v, restarting in %v...", err, backoff)
@@ -417,13 +554,13 @@ func (a *Agent) watchGost() {
 		}
 
 		time.Sleep(backoff)
-		if a.stopping.Load() {
+		if a.stopping.Load() || a.gostSuspended.Load() {
 			return
 		}
 
-		// 重新下载配置（可能已更新）
-		if err := a.downloadConfig(); err != nil {
-			log.Printf("Failed to download config before restart: %v", err)
+		// 重新下载配置（可能已更新）；正在应用新配置时等待其完成 (失败时恢复上一版本)
+		if err := a.syncConfig(false); err != nil {
+			log.Printf("Failed to sync config before restart: %v", err)
 		}
 
 		a.gostCmd = exec.Command(a.gostPath, "-C", a.configPath)
@@ -459,30 +596,69 @@ func (a *Agent) heartbeatLoop() {
 		if err := a.sendHeartbeat(); err != nil {
 			log.Printf("Heartbeat failed: %v", err)
 		}
+		a.checkOrphanGrace()
+		a.markConfigGood()
 	}
 }
 
 func (a *Agent) sendHeartbeat() error {
+	// 统计按序号入账，同一时间只发送一个心跳
+	a.statsMu.Lock()
+	defer a.statsMu.Unlock()
+
 	// 从 GOST API 获取统计数据
 	stats := a.getGostStats()
 	serviceStats := a.getServiceStats()
+	userStats := a.getUserStats()
 
 	// 计算当前配置的哈希值
 	configHash := a.getConfigHash()
 
 	data := map[string]interface{}{
-		"token":          a.token,
-		"connections":    stats.Connections,
-		"traffic_in":     stats.TrafficIn,
-		"traffic_out":    stats.TrafficOut,
-		"config_hash":    configHash,
-		"agent_version":  AgentVersion,
-		"service_stats":  serviceStats, // 按服务名分类的统计
+		"connections":   stats.Connections,
+		"config_hash":   configHash,
+		"agent_version": AgentVersion,
+	}
+	// 已登记密钥时通过签名 (或控制通道连接) 认证，不再发送 Token
+	if _, enrolled := a.agentKey(); !enrolled {
+		data["token"] = a.token
+	}
+
+	// 有离线期间缓存的统计时，本次统计排在其后按序补报；否则随心跳上报
+	entry := a.nextStatsEntry(stats.TrafficIn, stats.TrafficOut, serviceStats, userStats)
+	if len(a.stats.Pending) > 0 {
+		a.bufferStats(entry)
+		entry = nil
+		if err := a.replayStats(); err != nil {
+			log.Printf("Failed to replay offline stats: %v", err)
+		}
+	} else if entry != nil {
+		data["traffic_in"] = entry.TrafficIn
+		data["traffic_out"] = entry.TrafficOut
+		data["service_stats"] = entry.ServiceStats // 按服务名分类的统计
+		data["user_stats"] = entry.UserStats       // 按认证用户名分类的统计
+		data["stats_epoch"] = a.stats.Epoch
+		data["stats_seq"] = entry.Seq
+		// 面板确认该序号前保留在缓存中，未确认的统计之后通过 /agent/stats 补报
+		a.bufferStats(entry)
+	}
+
+	// 控制通道在线时通过通道上报，响应以 heartbeat_ack 消息返回 (由 ackStats 清除已确认的统计)
+	if ch := a.getChannel(); ch != nil {
+		if err := ch.send(msgHeartbeat, data); err == nil {
+			return nil
+		}
+		log.Println("Control channel send failed, falling back to HTTP heartbeat")
 	}
 
 	body, _ := json.Marshal(data)
-	resp, err := a.client.Post(a.panelURL+"/agent/heartbeat", "application/json", bytes.NewReader(body))
+	req, err := a.newPanelRequest(http.MethodPost, "/agent/heartbeat", body)
+	if err != nil {
+		return err
+	}
+	resp, err := a.client.Do(req)
 	if err != nil {
+		// 面板不可达: 统计保留在缓存中，恢复后补报
 		return err
 	}
 	defer resp.Body.Close()
@@ -493,17 +669,27 @@ func (a *Agent) sendHeartbeat() error {
 		return fmt.Errorf("failed to decode response: %w", err)
 	}
 
-	// 检查是否需要卸载
-	if uninstall, ok := result["uninstall"].(bool); ok && uninstall {
-		log.Println("Received uninstall command from panel, uninstalling...")
-		go a.uninstall()
-		return nil
+	// 面板没有确认入账 (包括拒绝 Token 时) 的统计留在缓存中，之后补报
+	if resp.StatusCode == http.StatusOK {
+		a.ackStats(result)
 	}
-
-	if resp.StatusCode != http.StatusOK {
+	// Token 被拒绝 (401) 时由 handleHeartbeatResult 校验卸载命令或进入孤立状态
+	if resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusUnauthorized {
 		return fmt.Errorf("heartbeat failed: status %d", resp.StatusCode)
 	}
 
+	a.handleHeartbeatResult(result)
+	return nil
+}
+
+// handleHeartbeatResult 处理心跳响应 (HTTP 与控制通道共用)
+func (a *Agent) handleHeartbeatResult(result map[string]interface{}) {
+	if _, rejected := result["error"]; rejected {
+		a.handleTokenRejected(result)
+		return
+	}
+	a.clearOrphaned()
+
 	// 检查是否需要重载配置
 	if reload, ok := result["reload_config"].(bool); ok && reload {
 		log.Println("Config update detected, reloading...")
@@ -522,8 +708,6 @@ func (a *Agent) sendHeartbeat() error {
 			log.Println("Update available, will update on next restart")
 		}
 	}
-
-	return nil
 }
 
 // performUpdate 执行更新
@@ -567,29 +751,35 @@ func (a *Agent) uninstall() {
 	os.Exit(0)
 }
 
-// getConfigHash 获取当前配置文件的修改时间作为版本号
+// getConfigHash 计算当前配置文件内容的 SHA-256 (与面板对生成配置的计算方式一致)
 func (a *Agent) getConfigHash() string {
-	info, err := os.Stat(a.configPath)
+	data, err := os.ReadFile(a.configPath)
 	if err != nil {
 		return ""
 	}
-	return strconv.FormatInt(info.ModTime().Unix(), 10)
+	return fmt.Sprintf("%x", sha256.Sum256(data))
 }
 
-// reloadConfig 重新下载并应用配置
+// reloadConfig 重新下载配置，校验通过后应用 (失败时回滚)
 func (a *Agent) reloadConfig() {
 	if a.stopping.Load() {
 		return
 	}
 
-	if err := a.downloadConfig(); err != nil {
-		log.Printf("Failed to download config: %v", err)
+	if err := a.syncConfig(true); err != nil {
+		log.Printf("Failed to reload config: %v", err)
+	}
+}
+
+// applyConfig 让 GOST 加载已写入的配置文件
+func (a *Agent) applyConfig() {
+	if a.stopping.Load() {
 		return
 	}
 
 	// 优先 SIGHUP 热重载 (不中断连接)
 	if a.gostCmd != nil && a.gostCmd.Process != nil {
-		log.Println("Config downloaded, sending SIGHUP to GOST for hot reload...")
+		log.Println("Config updated, sending SIGHUP to GOST for hot reload...")
 		if err := a.gostCmd.Process.Signal(syscall.SIGHUP); err == nil {
 			log.Println("GOST config reloaded (hot reload)")
 			return
@@ -611,6 +801,13 @@ func (a *Agent) reloadConfig() {
 	}
 }
 
+// restartGost 结束 GOST 进程，由 watchGost 重新拉取配置后拉起
+func (a *Agent) restartGost() {
+	if a.gostCmd != nil && a.gostCmd.Process != nil {
+		a.gostCmd.Process.Signal(syscall.SIGTERM)
+	}
+}
+
 // GostStats GOST 统计数据
 type GostStats struct {
 	Connections int
@@ -905,6 +1102,79 @@ func (a *Agent) getServiceStats() map[string]map[string]int64 {
 	return result
 }
 
+// getUserStats 获取按认证用户名分类的流量统计 (增量)
+// 数据来自处理器级观察器 (observer 统计中的 clients 列表)，同一用户在多个服务上的流量合并上报
+func (a *Agent) getUserStats() map[string]map[string]int64 {
+	result := make(map[string]map[string]int64)
+
+	observerStats, err := a.fetchObserverStats()
+	if err != nil || observerStats == nil {
+		return result
+	}
+	clients, ok := observerStats["clients"].([]interface{})
+	if !ok {
+		return result
+	}
+
+	for _, item := range clients {
+		clientMap, ok := item.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		username, _ := clientMap["client"].(string)
+		if username == "" {
+			continue // 未认证的连接
+		}
+		service, _ := clientMap["service"].(string)
+
+		var totalIn, totalOut int64
+		var conns int
+		if inputBytes, ok := clientMap["inputBytes"].(float64); ok {
+			totalIn = int64(inputBytes)
+		}
+		if outputBytes, ok := clientMap["outputBytes"].(float64); ok {
+			totalOut = int64(outputBytes)
+		}
+		if currentConns, ok := clientMap["currentConns"].(float64); ok {
+			conns = int(currentConns)
+		}
+
+		// 计算增量
+		key := service + "/" + username
+		lastStats := a.lastUserStats[key]
+		deltaIn := totalIn - lastStats.TrafficIn
+		deltaOut := totalOut - lastStats.TrafficOut
+
+		// 处理重置
+		if deltaIn < 0 {
+			deltaIn = totalIn
+		}
+		if deltaOut < 0 {
+			deltaOut = totalOut
+		}
+
+		a.lastUserStats[key] = ServiceStats{
+			TrafficIn:   totalIn,
+			TrafficOut:  totalOut,
+			Connections: conns,
+		}
+
+		if deltaIn <= 0 && deltaOut <= 0 && conns <= 0 {
+			continue
+		}
+		stats, ok := result[username]
+		if !ok {
+			stats = map[string]int64{}
+			result[username] = stats
+		}
+		stats["traffic_in"] += deltaIn
+		stats["traffic_out"] += deltaOut
+		stats["connections"] += int64(conns)
+	}
+
+	return result
+}
+
 // ==================== 自动更新相关 ====================
 
 // UpdateInfo represents update check response
@@ -914,6 +1184,7 @@ type UpdateInfo struct {
 	NeedsUpdate    bool   `json:"needs_update"`
 	DownloadURL    string `json:"download_url"`
 	Checksum       string `json:"checksum"`
+	Signature      string `json:"signature"`
 }
 
 // updateCheckLoop periodically checks for updates
@@ -934,10 +1205,15 @@ func (a *Agent) updateCheckLoop() {
 
 // checkAndUpdate checks for updates and downloads if available
 func (a *Agent) checkAndUpdate() (bool, error) {
-	url := fmt.Sprintf("%s/agent/check-update?version=%s&os=%s&arch=%s",
-		a.panelURL, AgentVersion, runtime.GOOS, runtime.GOARCH)
+	route := fmt.Sprintf("/agent/check-update?version=%s&os=%s&arch=%s",
+		url.QueryEscape(AgentVersion), runtime.GOOS, runtime.GOARCH)
 
-	resp, err := a.client.Get(url)
+	// 面板要求签名或 Token 认证，并据此判断是否在灰度范围内
+	req, err := a.newPanelRequest(http.MethodGet, route, nil)
+	if err != nil {
+		return false, err
+	}
+	resp, err := a.client.Do(req)
 	if err != nil {
 		return false, err
 	}
@@ -957,26 +1233,43 @@ func (a *Agent) checkAndUpdate() (bool, error) {
 		return false, nil
 	}
 
+	// 只安装比当前版本新的版本 (旧版本同样有合法签名)
+	if err := checkUpdateVersion(info.LatestVersion, AgentVersion); err != nil {
+		return false, err
+	}
+
+	// 已回滚过的版本不再自动安装，等待下一个版本
+	if failed := a.loadFailedUpdate(); failed != nil && failed.Version == info.LatestVersion {
+		log.Printf("Skipping update to %s: it was rolled back (%s)", info.LatestVersion, failed.Reason)
+		return false, nil
+	}
+
 	log.Printf("Update available: %s -> %s", AgentVersion, info.LatestVersion)
 
 	if info.DownloadURL == "" {
 		return false, fmt.Errorf("no download URL provided")
 	}
+	if info.Signature == "" {
+		return false, fmt.Errorf("update %s is not signed", info.LatestVersion)
+	}
 
 	// Download the update
-	if err := a.downloadUpdate(info.DownloadURL, info.Checksum); err != nil {
+	if err := a.downloadUpdate(&info); err != nil {
 		return false, fmt.Errorf("download update failed: %w", err)
 	}
 
 	return true, nil
 }
 
-// downloadUpdate downloads and installs the update
-func (a *Agent) downloadUpdate(downloadURL, expectedChecksum string) error {
-	fullURL := a.panelURL + downloadURL
-	log.Printf("Downloading update from %s", fullURL)
+// downloadUpdate downloads, verifies and installs the update
+func (a *Agent) downloadUpdate(info *UpdateInfo) error {
+	log.Printf("Downloading update from %s%s", a.panelURL, info.DownloadURL)
 
-	resp, err := a.client.Get(fullURL)
+	req, err := a.newPanelRequest(http.MethodGet, info.DownloadURL, nil)
+	if err != nil {
+		return err
+	}
+	resp, err := a.client.Do(req)
 	if err != nil {
 		return err
 	}
@@ -986,15 +1279,7 @@ func (a *Agent) downloadUpdate(downloadURL, expectedChecksum string) error {
 		return fmt.Errorf("download failed: status %d", resp.StatusCode)
 	}
 
-	// Get current executable path
-	execPath, err := os.Executable()
-	if err != nil {
-		return err
-	}
-	execPath, err = filepath.EvalSymlinks(execPath)
-	if err != nil {
-		return err
-	}
+	execPath := a.execPath
 
 	// Create temp file
 	tmpFile := execPath + ".new"
@@ -1015,17 +1300,32 @@ func (a *Agent) downloadUpdate(downloadURL, expectedChecksum string) error {
 	}
 
 	// Verify checksum
-	if expectedChecksum != "" {
-		actualChecksum := fmt.Sprintf("%x", hash.Sum(nil))
-		if actualChecksum != expectedChecksum {
-			os.Remove(tmpFile)
-			return fmt.Errorf("checksum mismatch: expected %s, got %s", expectedChecksum, actualChecksum)
-		}
-		log.Println("Checksum verified")
+	actualChecksum := fmt.Sprintf("%x", hash.Sum(nil))
+	if info.Checksum != "" && actualChecksum != info.Checksum {
+		os.Remove(tmpFile)
+		return fmt.Errorf("checksum mismatch: expected %s, got %s", info.Checksum, actualChecksum)
+	}
+
+	// 校验发布签名: 签名绑定版本、平台和 SHA-256，面板无法伪造或替换更新包
+	if err := signing.Verify(a.updateKey, info.LatestVersion, runtime.GOOS, runtime.GOARCH, actualChecksum, info.Signature); err != nil {
+		os.Remove(tmpFile)
+		return err
+	}
+	log.Println("Signature verified")
+
+	if err := checkUpdateVersion(info.LatestVersion, AgentVersion); err != nil {
+		os.Remove(tmpFile)
+		return err
+	}
+
+	if err := verifyUpdateBinary(tmpFile, info.LatestVersion); err != nil {
+		os.Remove(tmpFile)
+		return err
 	}
 
 	// Backup old binary
 	backupPath := execPath + ".bak"
+	os.Remove(backupPath)
 	if err := os.Rename(execPath, backupPath); err != nil {
 		os.Remove(tmpFile)
 		return fmt.Errorf("backup failed: %w", err)
@@ -1038,16 +1338,18 @@ func (a *Agent) downloadUpdate(downloadURL, expectedChecksum string) error {
 		return fmt.Errorf("install failed: %w", err)
 	}
 
+	// 新版本需在期限内重新注册，否则自动回滚到 .bak
+	if err := a.markUpdatePending(info.LatestVersion); err != nil {
+		log.Printf("Failed to record pending update: %v", err)
+	}
+
 	log.Printf("Update installed successfully")
 	return nil
 }
 
 // restartSelf restarts the agent process
 func (a *Agent) restartSelf() error {
-	execPath, err := os.Executable()
-	if err != nil {
-		return err
-	}
+	execPath := a.execPath
 
 	// Re-exec with same arguments
 	args := os.Args
@@ -1073,6 +1375,10 @@ func main() {
 		handleAgentServiceCommand()
 		return
 	}
+	if len(os.Args) > 1 && os.Args[1] == "orphan" {
+		handleOrphanCommand(os.Args[2:])
+		return
+	}
 
 	flag.Parse()
 
@@ -1094,6 +1400,10 @@ func main() {
 		fmt.Println("  -gost-user   GOST API username (optional)")
 		fmt.Println("  -gost-pass   GOST API password (optional)")
 		fmt.Println("  -auto-update Enable auto update (default: true)")
+		fmt.Println("  -update-key  Release public key for verifying updates (default: built-in)")
+		fmt.Println("  -channel     Control channel URL (provided by panel if empty, \"off\" to disable)")
+		fmt.Println("  -auth-listen Local auth plugin address (default: 127.0.0.1:18079, \"off\" to disable)")
+		fmt.Println("  -orphan-grace Stop GOST after the panel has rejected the token this long (default: 168h, 0 = never)")
 		fmt.Println("  -version     Show version")
 		os.Exit(1)
 	}
@@ -1108,6 +1418,10 @@ func main() {
 	log.Printf("Using GOST: %s", resolvedGostPath)
 
 	agent := NewAgent(*panelURL, *token, *mode, *configPath, resolvedGostPath, *gostAPI, *gostUser, *gostPass, *autoUpdate)
+	agent.channelURL = *channelURL
+	agent.authListen = *authListen
+	agent.updatePublicKey = *updateKey
+	agent.orphanGrace = *orphanGrace
 	if err := agent.Run(); err != nil {
 		log.Fatalf("Agent error: %v", err)
 	}
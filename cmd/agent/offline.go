@@ -0,0 +1,316 @@
+package main
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	mrand "math/rand/v2"
+	"net/http"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// ==================== 离线运行 ====================
+//
+// 面板不可达时 (例如节点重启时面板正在维护) Agent 不再退出，而是用本地缓存的最近一次
+// 有效配置启动 GOST，后台按指数退避重新注册。离线期间每次心跳的增量统计写入磁盘，
+// 恢复连接后按序号补报，面板跳过已入账的序号，流量既不丢失也不重复计算。
+
+const (
+	registerBackoffMin = 5 * time.Second
+	registerBackoffMax = 5 * time.Minute
+
+	statsBufferMax   = 2880 // 最多缓存的心跳统计 (30 秒心跳约 24 小时)，超出后合并最早的记录
+	statsReplayBatch = 100  // 每次补报的条数
+)
+
+// statsEntry 一次心跳的增量统计
+type statsEntry struct {
+	Seq          uint64                      `json:"seq"`
+	At           time.Time                   `json:"at"`
+	TrafficIn    int64                       `json:"traffic_in"`
+	TrafficOut   int64                       `json:"traffic_out"`
+	ServiceStats map[string]map[string]int64 `json:"service_stats,omitempty"`
+	UserStats    map[string]map[string]int64 `json:"user_stats,omitempty"`
+}
+
+// statsBuffer 统计序号和尚未送达面板的统计 (agent-stats.json)
+type statsBuffer struct {
+	Epoch   string        `json:"epoch"` // 本地状态丢失 (重新安装) 后重新生成，面板据此重新开始计数
+	Seq     uint64        `json:"seq"`
+	Pending []*statsEntry `json:"pending,omitempty"`
+}
+
+func statsBufferPath(configPath string) string {
+	return filepath.Join(filepath.Dir(configPath), "agent-stats.json")
+}
+
+// goodConfigPath 最近一次有效配置的缓存 (GOST 使用该配置正常运行过)
+func goodConfigPath(configPath string) string {
+	return configPath + ".good"
+}
+
+// ==================== 配置缓存 ====================
+
+// markConfigGood GOST 使用当前配置正常运行 (API 可访问) 时缓存该配置
+func (a *Agent) markConfigGood() {
+	data, err := os.ReadFile(a.configPath)
+	if err != nil {
+		return
+	}
+	hash := fmt.Sprintf("%x", sha256.Sum256(data))
+
+	a.stateMu.Lock()
+	cached := a.state.GoodConfigHash
+	a.stateMu.Unlock()
+	if hash == cached {
+		return
+	}
+	// 正在应用的新配置由 installConfig 确认
+	if !a.configMu.TryLock() {
+		return
+	}
+	defer a.configMu.Unlock()
+	if _, err := a.fetchGostServices(); err != nil {
+		return
+	}
+
+	a.stateMu.Lock()
+	defer a.stateMu.Unlock()
+	if err := writeFileAtomic(goodConfigPath(a.configPath), data, 0600); err != nil {
+		log.Printf("Failed to cache config: %v", err)
+		return
+	}
+	now := time.Now()
+	a.state.GoodConfigHash = hash
+	a.state.GoodConfigAt = &now
+	a.saveState()
+	log.Printf("Cached known-good config %s", hash[:12])
+}
+
+// useCachedConfig 面板不可达时准备本地配置: 优先恢复最近一次有效配置，
+// 其次使用现有配置文件，都没有时返回 false
+func (a *Agent) useCachedConfig() bool {
+	a.stateMu.Lock()
+	goodHash := a.state.GoodConfigHash
+	a.stateMu.Unlock()
+
+	if goodHash != "" {
+		data, err := os.ReadFile(goodConfigPath(a.configPath))
+		if err == nil && fmt.Sprintf("%x", sha256.Sum256(data)) == goodHash {
+			if a.getConfigHash() != goodHash {
+				if err := a.writeConfig(data); err != nil {
+					log.Printf("Failed to restore cached config: %v", err)
+				} else {
+					log.Printf("Restored known-good config %s", goodHash[:12])
+				}
+			}
+			return true
+		}
+		log.Printf("Cached config %s is missing or corrupted", goodConfigPath(a.configPath))
+	}
+
+	_, err := os.Stat(a.configPath)
+	return err == nil
+}
+
+func writeFileAtomic(path string, data []byte, perm os.FileMode) error {
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, perm); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+// ==================== 重新注册 ====================
+
+// registerBackoff 第 n 次重试前的等待时间 (指数退避，带 ±20% 抖动避免面板恢复时所有 Agent 同时重连)
+func registerBackoff(n int) time.Duration {
+	d := registerBackoffMin
+	for i := 0; i < n && d < registerBackoffMax; i++ {
+		d *= 2
+	}
+	d = min(d, registerBackoffMax)
+	return d + time.Duration((mrand.Float64()*0.4-0.2)*float64(d))
+}
+
+// registerWithBackoff 按指数退避重试注册，直到面板可达 (Token 被拒绝也视为可达)。
+// Agent 停止时返回 false
+func (a *Agent) registerWithBackoff() bool {
+	for attempt := 0; ; attempt++ {
+		wait := registerBackoff(attempt)
+		log.Printf("Panel unreachable, retrying registration in %v", wait.Round(time.Second))
+		time.Sleep(wait)
+		if a.stopping.Load() {
+			return false
+		}
+
+		err := a.register()
+		var rejected *tokenRejectedError
+		switch {
+		case errors.As(err, &rejected):
+			a.handleTokenRejected(rejected.result)
+			return true
+		case err != nil:
+			log.Printf("Register failed: %v", err)
+		default:
+			log.Println("Registered to panel successfully")
+			a.clearOrphaned()
+			a.confirmUpdate()
+			return true
+		}
+	}
+}
+
+// reconnect 离线启动后在后台重新注册，成功后同步配置并启动控制通道
+func (a *Agent) reconnect() {
+	if !a.registerWithBackoff() {
+		return
+	}
+	log.Println("Panel reachable again, leaving offline mode")
+
+	if err := a.syncConfig(true); err != nil {
+		log.Printf("Failed to sync config: %v", err)
+	}
+
+	// 离线启动时还不知道控制通道地址
+	if a.channelURL != "" && a.channelURL != "off" {
+		go a.channelLoop()
+	}
+}
+
+// ==================== 统计缓存 ====================
+
+// loadStats 加载统计序号和未送达的统计，首次运行时生成 epoch
+func (a *Agent) loadStats() {
+	readJSONFile(statsBufferPath(a.configPath), &a.stats)
+	if a.stats.Epoch == "" {
+		b := make([]byte, 8)
+		rand.Read(b)
+		a.stats = statsBuffer{Epoch: hex.EncodeToString(b)}
+		a.saveStats()
+	}
+	if n := len(a.stats.Pending); n > 0 {
+		log.Printf("%d heartbeats recorded offline will be replayed to the panel", n)
+	}
+}
+
+// saveStats 保存统计缓存，调用方需持有 statsMu
+func (a *Agent) saveStats() {
+	data, err := json.Marshal(a.stats)
+	if err == nil {
+		err = writeFileAtomic(statsBufferPath(a.configPath), data, 0600)
+	}
+	if err != nil {
+		log.Printf("Failed to save stats buffer: %v", err)
+	}
+}
+
+// nextStatsEntry 为本次心跳的增量统计分配序号，没有流量时返回 nil。调用方需持有 statsMu
+func (a *Agent) nextStatsEntry(trafficIn, trafficOut int64, serviceStats, userStats map[string]map[string]int64) *statsEntry {
+	if trafficIn == 0 && trafficOut == 0 && len(serviceStats) == 0 && len(userStats) == 0 {
+		return nil
+	}
+	a.stats.Seq++
+	a.saveStats()
+	return &statsEntry{
+		Seq:          a.stats.Seq,
+		At:           time.Now(),
+		TrafficIn:    trafficIn,
+		TrafficOut:   trafficOut,
+		ServiceStats: serviceStats,
+		UserStats:    userStats,
+	}
+}
+
+// bufferStats 缓存未送达的统计。调用方需持有 statsMu
+func (a *Agent) bufferStats(entry *statsEntry) {
+	if entry == nil {
+		return
+	}
+	a.stats.Pending = append(a.stats.Pending, entry)
+	if len(a.stats.Pending) > statsBufferMax {
+		// 合并最早的两条，序号取较新的一条
+		first, second := a.stats.Pending[0], a.stats.Pending[1]
+		second.TrafficIn += first.TrafficIn
+		second.TrafficOut += first.TrafficOut
+		second.ServiceStats = mergeStats(first.ServiceStats, second.ServiceStats)
+		second.UserStats = mergeStats(first.UserStats, second.UserStats)
+		a.stats.Pending = a.stats.Pending[1:]
+	}
+	a.saveStats()
+}
+
+// ackStats 从缓存中移除心跳响应确认已入账的统计。调用方需持有 statsMu
+func (a *Agent) ackStats(result map[string]interface{}) {
+	epoch, _ := result["stats_epoch"].(string)
+	seq, _ := result["stats_seq"].(float64)
+	if epoch != a.stats.Epoch || seq <= 0 {
+		return
+	}
+	for i, entry := range a.stats.Pending {
+		if entry.Seq == uint64(seq) {
+			a.stats.Pending = append(a.stats.Pending[:i], a.stats.Pending[i+1:]...)
+			a.saveStats()
+			return
+		}
+	}
+}
+
+// mergeStats 累加按名称分类的流量 (连接数取较新的值)
+func mergeStats(older, newer map[string]map[string]int64) map[string]map[string]int64 {
+	if newer == nil {
+		newer = make(map[string]map[string]int64)
+	}
+	for name, o := range older {
+		n, ok := newer[name]
+		if !ok {
+			newer[name] = o
+			continue
+		}
+		n["traffic_in"] += o["traffic_in"]
+		n["traffic_out"] += o["traffic_out"]
+	}
+	return newer
+}
+
+// replayStats 按序补报缓存的统计。调用方需持有 statsMu
+func (a *Agent) replayStats() error {
+	total := len(a.stats.Pending)
+	for len(a.stats.Pending) > 0 {
+		n := min(len(a.stats.Pending), statsReplayBatch)
+		data := map[string]interface{}{
+			"stats_epoch": a.stats.Epoch,
+			"entries":     a.stats.Pending[:n],
+		}
+		if _, enrolled := a.agentKey(); !enrolled {
+			data["token"] = a.token
+		}
+
+		body, _ := json.Marshal(data)
+		req, err := a.newPanelRequest(http.MethodPost, "/agent/stats", body)
+		if err != nil {
+			return err
+		}
+		resp, err := a.client.Do(req)
+		if err != nil {
+			return err
+		}
+		respBody, _ := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusOK {
+			return fmt.Errorf("panel returned %d: %s", resp.StatusCode, respBody)
+		}
+
+		a.stats.Pending = a.stats.Pending[n:]
+		a.saveStats()
+	}
+	log.Printf("Replayed %d heartbeats recorded offline", total)
+	return nil
+}
@@ -0,0 +1,130 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+)
+
+// newStatsTestAgent 返回连接到 panel 的 Agent，GOST observer 每次查询时服务流量增加 100 字节
+func newStatsTestAgent(t *testing.T, panel http.Handler) *Agent {
+	t.Helper()
+	var traffic atomic.Int64
+	gost := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		n := traffic.Add(100)
+		fmt.Fprintf(w, `{"services":[{"service":"tunnel-1","inputBytes":%d,"outputBytes":%d}]}`, n, n)
+	}))
+	t.Cleanup(gost.Close)
+	srv := httptest.NewServer(panel)
+	t.Cleanup(srv.Close)
+
+	a := newTestAgent(t, srv.URL)
+	a.gostAPI = gost.URL
+	a.loadStats()
+	return a
+}
+
+func pendingSeqs(a *Agent) []uint64 {
+	a.statsMu.Lock()
+	defer a.statsMu.Unlock()
+	var seqs []uint64
+	for _, entry := range a.stats.Pending {
+		seqs = append(seqs, entry.Seq)
+	}
+	return seqs
+}
+
+// 心跳统计在面板确认入账前保留在缓存中，未确认的统计在下次心跳时补报
+func TestHeartbeatStatsKeptUntilAcked(t *testing.T) {
+	var mu sync.Mutex
+	ack := false
+	var replayed []uint64
+	panel := http.NewServeMux()
+	panel.HandleFunc("/agent/heartbeat", func(w http.ResponseWriter, r *http.Request) {
+		var req map[string]interface{}
+		json.NewDecoder(r.Body).Decode(&req)
+		resp := map[string]interface{}{"status": "ok"}
+		mu.Lock()
+		if _, ok := req["stats_seq"]; ok && ack {
+			resp["stats_epoch"] = req["stats_epoch"]
+			resp["stats_seq"] = req["stats_seq"]
+		}
+		mu.Unlock()
+		json.NewEncoder(w).Encode(resp)
+	})
+	panel.HandleFunc("/agent/stats", func(w http.ResponseWriter, r *http.Request) {
+		var req struct {
+			Entries []statsEntry `json:"entries"`
+		}
+		json.NewDecoder(r.Body).Decode(&req)
+		mu.Lock()
+		for _, entry := range req.Entries {
+			replayed = append(replayed, entry.Seq)
+		}
+		mu.Unlock()
+		json.NewEncoder(w).Encode(map[string]interface{}{"status": "ok"})
+	})
+	a := newStatsTestAgent(t, panel)
+
+	// 响应中没有确认序号 (例如面板入账失败)
+	if err := a.sendHeartbeat(); err != nil {
+		t.Fatal(err)
+	}
+	if seqs := pendingSeqs(a); len(seqs) != 1 || seqs[0] != 1 {
+		t.Fatalf("pending after unacknowledged heartbeat = %v, want [1]", seqs)
+	}
+
+	// 下次心跳先按序补报缓存的统计，本次统计排在其后
+	if err := a.sendHeartbeat(); err != nil {
+		t.Fatal(err)
+	}
+	if seqs := pendingSeqs(a); len(seqs) != 0 {
+		t.Fatalf("pending after replay = %v, want none", seqs)
+	}
+	if len(replayed) != 2 || replayed[0] != 1 || replayed[1] != 2 {
+		t.Fatalf("replayed %v, want [1 2]", replayed)
+	}
+
+	// 面板确认后移除
+	mu.Lock()
+	ack = true
+	mu.Unlock()
+	if err := a.sendHeartbeat(); err != nil {
+		t.Fatal(err)
+	}
+	if seqs := pendingSeqs(a); len(seqs) != 0 {
+		t.Fatalf("pending after acknowledged heartbeat = %v, want none", seqs)
+	}
+	if len(replayed) != 2 {
+		t.Fatalf("acknowledged heartbeat replayed again: %v", replayed)
+	}
+}
+
+// 重新加载的缓存保留未确认的统计；其他 epoch 或未知序号的确认不移除任何统计
+func TestAckStats(t *testing.T) {
+	a := newStatsTestAgent(t, http.NotFoundHandler())
+	a.statsMu.Lock()
+	for i := 0; i < 3; i++ {
+		a.bufferStats(a.nextStatsEntry(100, 100, nil, nil))
+	}
+	epoch := a.stats.Epoch
+	a.ackStats(map[string]interface{}{"stats_epoch": "other", "stats_seq": float64(2)})
+	a.ackStats(map[string]interface{}{"stats_epoch": epoch, "stats_seq": float64(9)})
+	a.ackStats(map[string]interface{}{"stats_epoch": epoch})
+	a.ackStats(map[string]interface{}{"stats_epoch": epoch, "stats_seq": float64(2)})
+	a.statsMu.Unlock()
+
+	reloaded := newTestAgent(t, "")
+	reloaded.configPath = a.configPath
+	reloaded.loadStats()
+	if seqs := pendingSeqs(reloaded); len(seqs) != 2 || seqs[0] != 1 || seqs[1] != 3 {
+		t.Fatalf("pending = %v, want [1 3]", seqs)
+	}
+	if reloaded.stats.Epoch != epoch || reloaded.stats.Seq != 3 {
+		t.Fatalf("reloaded epoch %q seq %d, want %q 3", reloaded.stats.Epoch, reloaded.stats.Seq, epoch)
+	}
+}
@@ -0,0 +1,387 @@
+package main
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/AliceNetworks/gost-panel/internal/signing"
+	svc "github.com/kardianos/service"
+)
+
+// ==================== 孤立状态与签名卸载 ====================
+//
+// 面板不认识 Agent 的 Token 时 (面板恢复了旧备份、Agent 连错了面板等)，Agent 不再自行卸载，
+// 而是进入孤立状态: GOST 继续运行，超过宽限期后停止 GOST 但不删除任何文件，
+// 等待面板重新识别、管理员在本机确认卸载或重新登记到面板。
+// 只有用首次注册时记录的面板公钥校验通过的卸载命令才会卸载 Agent。
+
+// agentState Agent 本地状态 (与 GOST 配置放在同一目录)
+type agentState struct {
+	PanelKey      string     `json:"panel_key,omitempty"`      // 首次注册时记录的面板公钥，用于校验卸载命令
+	OrphanedAt    *time.Time `json:"orphaned_at,omitempty"`    // 面板开始拒绝 Token 的时间
+	RejectedToken string     `json:"rejected_token,omitempty"` // 被拒绝的 Token (SHA-256)
+	Panel         string     `json:"panel,omitempty"`          // 重新登记的面板地址，覆盖启动参数
+	Token         string     `json:"token,omitempty"`          // 重新登记的 Token，覆盖启动参数
+	Replaces      string     `json:"replaces,omitempty"`       // 重新登记替换的启动参数 Token (SHA-256)
+	// 密钥登记
+	PrivateKey string `json:"private_key,omitempty"` // Agent 私钥 (base64 Ed25519)
+	KeyToken   string `json:"key_token,omitempty"`   // 生成密钥时使用的 Token (SHA-256)，Token 更换后重新生成密钥
+	Enrolled   bool   `json:"enrolled,omitempty"`    // 面板已登记公钥，请求改为签名认证
+	AuthToken  string `json:"auth_token,omitempty"`  // GOST 调用本地认证插件使用的 Token
+	// 最近一次有效配置 (面板不可达时使用)
+	GoodConfigHash string     `json:"good_config_hash,omitempty"`
+	GoodConfigAt   *time.Time `json:"good_config_at,omitempty"`
+	// 校验失败或回滚的配置，面板配置变化之前不再尝试
+	RejectedConfigHash string `json:"rejected_config_hash,omitempty"`
+}
+
+// tokenRejectedError 面板拒绝了 Agent 的 Token (401)
+type tokenRejectedError struct {
+	result map[string]interface{}
+}
+
+func (e *tokenRejectedError) Error() string {
+	return fmt.Sprintf("panel rejected token: %v", e.result["error"])
+}
+
+func isTokenRejected(err error) bool {
+	var rejected *tokenRejectedError
+	return errors.As(err, &rejected)
+}
+
+func statePath(configPath string) string {
+	return filepath.Join(filepath.Dir(configPath), "agent-state.json")
+}
+
+func readState(configPath string) agentState {
+	var st agentState
+	readJSONFile(statePath(configPath), &st)
+	return st
+}
+
+// saveState 保存本地状态，调用方需持有 stateMu
+func (a *Agent) saveState() {
+	if err := writeJSONFile(statePath(a.configPath), a.state); err != nil {
+		log.Printf("Failed to save agent state: %v", err)
+	}
+}
+
+// loadState 加载本地状态，重新登记过的面板地址和 Token 覆盖启动参数
+func (a *Agent) loadState() {
+	a.stateMu.Lock()
+	defer a.stateMu.Unlock()
+
+	a.state = readState(a.configPath)
+	if a.state.Token != "" {
+		if a.state.Replaces == "" || a.state.Replaces == signing.TokenHash(a.token) {
+			log.Printf("Using re-enrolled panel %s from %s", a.state.Panel, statePath(a.configPath))
+			a.panelURL = a.state.Panel
+			a.token = a.state.Token
+		} else {
+			// 启动参数已换成新的 Token (例如重新执行了安装脚本)，重新登记的记录不再适用
+			a.state.Panel, a.state.Token, a.state.Replaces = "", "", ""
+			a.saveState()
+		}
+	}
+	if a.state.PrivateKey != "" && a.state.KeyToken != signing.TokenHash(a.token) {
+		// 使用新的 Token 安装: 生成新密钥并用该 Token 重新登记
+		log.Println("Agent token changed, a new key will be enrolled")
+		a.state.PrivateKey, a.state.KeyToken, a.state.Enrolled, a.state.AuthToken = "", "", false, ""
+		a.saveState()
+	}
+	if a.state.OrphanedAt != nil {
+		log.Printf("Agent is orphaned since %s, GOST keeps running until the panel recognizes it again",
+			a.state.OrphanedAt.Format(time.RFC3339))
+	}
+}
+
+// pinPanelKey 记录面板公钥 (首次注册时)，之后面板公钥变化不会覆盖已记录的公钥
+func (a *Agent) pinPanelKey(encoded string) {
+	if encoded == "" {
+		return
+	}
+	a.stateMu.Lock()
+	defer a.stateMu.Unlock()
+
+	switch a.state.PanelKey {
+	case encoded:
+	case "":
+		a.state.PanelKey = encoded
+		a.saveState()
+		log.Println("Recorded panel key for verifying decommission commands")
+	default:
+		log.Println("Warning: panel key changed, keeping the recorded key (use 'gost-agent orphan reenroll' to trust a new panel)")
+	}
+}
+
+// panelKey 已记录的面板公钥，未记录时返回 nil
+func (a *Agent) panelKey() ed25519.PublicKey {
+	a.stateMu.Lock()
+	encoded := a.state.PanelKey
+	a.stateMu.Unlock()
+	if encoded == "" {
+		return nil
+	}
+	key, err := signing.ParsePublicKey(encoded)
+	if err != nil {
+		return nil
+	}
+	return key
+}
+
+// handleTokenRejected 面板拒绝了 Token: 附带签名有效的卸载命令时卸载，否则进入孤立状态
+func (a *Agent) handleTokenRejected(result map[string]interface{}) {
+	if cmd, ok := result["decommission"]; ok {
+		data, _ := json.Marshal(cmd)
+		if a.handleDecommission(data) {
+			return
+		}
+	}
+	a.markOrphaned(fmt.Sprint(result["error"]))
+}
+
+// handleDecommission 校验并执行面板签名的卸载命令，校验失败时忽略并返回 false
+func (a *Agent) handleDecommission(data []byte) bool {
+	var cmd signing.Decommission
+	if len(data) == 0 || json.Unmarshal(data, &cmd) != nil {
+		log.Println("Ignoring unsigned uninstall command")
+		return false
+	}
+	key := a.panelKey()
+	if key == nil {
+		log.Println("Ignoring uninstall command: no panel key recorded")
+		return false
+	}
+	if err := cmd.Verify(key, a.credential(), time.Now()); err != nil {
+		log.Printf("Ignoring uninstall command: %v", err)
+		return false
+	}
+
+	log.Printf("Verified decommission of %s %d from panel, uninstalling...", cmd.Kind, cmd.ID)
+	go a.uninstall()
+	return true
+}
+
+// markOrphaned 进入孤立状态 (GOST 继续运行)
+func (a *Agent) markOrphaned(reason string) {
+	a.stateMu.Lock()
+	defer a.stateMu.Unlock()
+	if a.state.OrphanedAt != nil {
+		return
+	}
+	now := time.Now()
+	a.state.OrphanedAt = &now
+	a.state.RejectedToken = signing.TokenHash(a.token)
+	a.saveState()
+
+	log.Printf("Panel rejected this agent (%s), entering orphaned state: GOST keeps running", reason)
+	if a.orphanGrace > 0 {
+		log.Printf("GOST will be stopped if the panel still rejects this agent after %s", a.orphanGrace)
+	}
+	log.Println("Run 'gost-agent orphan confirm' to uninstall, or 'gost-agent orphan reenroll -panel <url> -token <join-token>' to join a panel")
+}
+
+// clearOrphaned 面板重新识别了 Token，恢复正常状态
+func (a *Agent) clearOrphaned() {
+	a.stateMu.Lock()
+	if a.state.OrphanedAt == nil {
+		a.stateMu.Unlock()
+		return
+	}
+	a.state.OrphanedAt = nil
+	a.state.RejectedToken = ""
+	a.saveState()
+	a.stateMu.Unlock()
+
+	log.Println("Panel recognizes this agent again, leaving orphaned state")
+	if a.gostSuspended.CompareAndSwap(true, false) {
+		if err := a.startGost(); err != nil {
+			log.Printf("Failed to start GOST: %v", err)
+		} else {
+			log.Println("GOST started")
+		}
+	}
+}
+
+// orphanGraceExpired 孤立状态是否已超过宽限期
+func (a *Agent) orphanGraceExpired() bool {
+	a.stateMu.Lock()
+	defer a.stateMu.Unlock()
+	return a.orphanGrace > 0 && a.state.OrphanedAt != nil && time.Since(*a.state.OrphanedAt) > a.orphanGrace
+}
+
+// checkOrphanGrace 超过宽限期后停止 GOST (不删除任何文件，面板重新识别后自动恢复)
+func (a *Agent) checkOrphanGrace() {
+	if !a.orphanGraceExpired() || !a.gostSuspended.CompareAndSwap(false, true) {
+		return
+	}
+	log.Printf("Agent has been orphaned for more than %s, stopping GOST", a.orphanGrace)
+	a.stopGost()
+}
+
+// ==================== 本地命令 ====================
+
+// handleOrphanCommand gost-agent orphan status|confirm|reenroll
+func handleOrphanCommand(args []string) {
+	if len(args) < 1 {
+		printOrphanUsage()
+		os.Exit(1)
+	}
+	action := args[0]
+
+	fs := flag.NewFlagSet("orphan "+action, flag.ExitOnError)
+	config := fs.String("config", "/etc/gost/gost.yml", "GOST config path (agent state is stored next to it)")
+	agentMode := fs.String("mode", "node", "Agent mode: node or client")
+	panel := fs.String("panel", "", "Panel URL to re-enroll with")
+	newToken := fs.String("token", "", "Join token (or agent token) to re-enroll with")
+	force := fs.Bool("force", false, "Uninstall even if the agent is not orphaned")
+	fs.Usage = printOrphanUsage
+	fs.Parse(args[1:])
+
+	st := readState(*config)
+
+	switch action {
+	case "status":
+		if st.OrphanedAt != nil {
+			fmt.Printf("Orphaned since %s (%s ago)\n", st.OrphanedAt.Format(time.RFC3339), time.Since(*st.OrphanedAt).Round(time.Second))
+		} else {
+			fmt.Println("Not orphaned")
+		}
+		if st.PanelKey != "" {
+			fmt.Printf("Panel key: %s\n", st.PanelKey)
+		} else {
+			fmt.Println("Panel key: not recorded (decommission commands are ignored)")
+		}
+		if st.Token != "" {
+			fmt.Printf("Re-enrolled with panel: %s\n", st.Panel)
+		}
+		if st.Enrolled {
+			fmt.Println("Agent key: enrolled (requests are signed)")
+		} else {
+			fmt.Println("Agent key: not enrolled (token authentication)")
+		}
+
+	case "confirm":
+		if st.OrphanedAt == nil && !*force {
+			fmt.Println("Agent is not orphaned, use -force to uninstall anyway")
+			os.Exit(1)
+		}
+		(&Agent{mode: *agentMode}).uninstall()
+
+	case "reenroll":
+		if *panel == "" || *newToken == "" {
+			printOrphanUsage()
+			os.Exit(1)
+		}
+		panelURL := strings.TrimRight(*panel, "/")
+		_, privateKey, err := signing.GenerateKey()
+		if err != nil {
+			fmt.Printf("Failed to generate agent key: %v\n", err)
+			os.Exit(1)
+		}
+		result, err := verifyEnrollment(panelURL, *newToken, privateKey)
+		if err != nil {
+			fmt.Printf("Re-enroll failed: %v\n", err)
+			os.Exit(1)
+		}
+
+		st.Replaces = st.RejectedToken
+		st.Panel = panelURL
+		st.Token = *newToken
+		st.PanelKey = result.PanelKey
+		st.PrivateKey = privateKey
+		st.KeyToken = signing.TokenHash(*newToken)
+		st.Enrolled = result.Enrolled
+		st.AuthToken = result.AuthToken
+		st.OrphanedAt = nil
+		st.RejectedToken = ""
+		if err := writeJSONFile(statePath(*config), st); err != nil {
+			fmt.Printf("Failed to save agent state: %v\n", err)
+			os.Exit(1)
+		}
+		fmt.Printf("Re-enrolled with %s\n", panelURL)
+
+		svr, err := svc.New(&agentProgram{}, getAgentSvcConfig(*agentMode))
+		if err == nil {
+			err = svc.Control(svr, "restart")
+		}
+		if err != nil {
+			fmt.Printf("Restart the agent to apply: %v\n", err)
+			return
+		}
+		fmt.Println("Agent restarted")
+
+	default:
+		printOrphanUsage()
+		os.Exit(1)
+	}
+}
+
+// registerResult 注册响应
+type registerResult struct {
+	ChannelURL string `json:"channel_url"`
+	PanelKey   string `json:"panel_key"`
+	Enrolled   bool   `json:"enrolled"`   // 面板已登记请求签名所用的公钥
+	AuthToken  string `json:"auth_token"` // GOST 调用本地认证插件使用的 Token (仅节点)
+}
+
+// verifyEnrollment 用新的面板地址和 Token 注册并登记新密钥
+func verifyEnrollment(panelURL, token, privateKey string) (*registerResult, error) {
+	key, err := signing.ParsePrivateKey(privateKey)
+	if err != nil {
+		return nil, err
+	}
+	body, _ := json.Marshal(map[string]string{
+		"token":      token,
+		"public_key": signing.PublicKey(key),
+		"version":    AgentVersion,
+	})
+	req, err := http.NewRequest(http.MethodPost, panelURL+"/agent/register", bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	signHeader(req.Header, key, req.Method, "/agent/register", body)
+
+	client := &http.Client{Timeout: 30 * time.Second}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		respBody, _ := io.ReadAll(resp.Body)
+		return nil, fmt.Errorf("panel returned %d: %s", resp.StatusCode, strings.TrimSpace(string(respBody)))
+	}
+	var result registerResult
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return nil, err
+	}
+	return &result, nil
+}
+
+func printOrphanUsage() {
+	fmt.Println("GOST Panel Agent - Orphaned State")
+	fmt.Println()
+	fmt.Println("Usage:")
+	fmt.Println("  gost-agent orphan status   [-config path]")
+	fmt.Println("  gost-agent orphan confirm  [-config path] [-mode node|client] [-force]")
+	fmt.Println("  gost-agent orphan reenroll -panel <url> -token <join-token> [-config path] [-mode node|client]")
+	fmt.Println()
+	fmt.Println("When the panel no longer recognizes the agent token, the agent keeps GOST")
+	fmt.Println("running instead of uninstalling itself. confirm uninstalls the agent and GOST;")
+	fmt.Println("reenroll enrolls a new agent key with a panel (use a join token issued by")
+	fmt.Println("the panel) and restarts the agent.")
+}
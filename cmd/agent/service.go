@@ -64,6 +64,10 @@ func (p *agentProgram) run() {
 	log.Printf("Using GOST: %s", resolvedGostPath)
 
 	p.agent = NewAgent(*panelURL, *token, *mode, *configPath, resolvedGostPath, *gostAPI, *gostUser, *gostPass, *autoUpdate)
+	p.agent.channelURL = *channelURL
+	p.agent.authListen = *authListen
+	p.agent.updatePublicKey = *updateKey
+	p.agent.orphanGrace = *orphanGrace
 	if err := p.agent.Run(); err != nil {
 		log.Fatalf("Agent error: %v", err)
 	}
@@ -0,0 +1,214 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/AliceNetworks/gost-panel/internal/signing"
+)
+
+// UpdatePublicKey 发布公钥 (base64 Ed25519)，通过 ldflags 在构建时注入:
+// -X 'main.UpdatePublicKey=<gost-panel sign-agent keygen 输出的公钥>'
+// 未配置公钥时 Agent 不会安装任何更新
+var UpdatePublicKey = ""
+
+// updateConfirmTimeout 更新后新版本必须在此时间内重新注册到面板，否则回滚到旧版本
+const updateConfirmTimeout = 2 * time.Minute
+
+// pendingUpdate 已安装但尚未确认的更新 (<exec>.update)
+type pendingUpdate struct {
+	From     string    `json:"from"`
+	To       string    `json:"to"`
+	Deadline time.Time `json:"deadline"`
+}
+
+// failedUpdate 已回滚的更新 (<exec>.failed)，同一版本不再自动安装
+type failedUpdate struct {
+	Version  string `json:"version"`
+	Reason   string `json:"reason"`
+	Reported bool   `json:"reported"` // 是否已上报面板
+}
+
+// resolveExecutable 当前二进制的真实路径。
+// 启动时解析并保存: 更新时二进制会被重命名，之后 os.Executable 在 Linux 上会指向改名后的旧文件
+func resolveExecutable() string {
+	execPath, err := os.Executable()
+	if err != nil {
+		return os.Args[0]
+	}
+	if resolved, err := filepath.EvalSymlinks(execPath); err == nil {
+		return resolved
+	}
+	return execPath
+}
+
+func readJSONFile(path string, v interface{}) bool {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return false
+	}
+	return json.Unmarshal(data, v) == nil
+}
+
+func writeJSONFile(path string, v interface{}) error {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, data, 0600)
+}
+
+// verifyUpdateBinary 在安装前运行新二进制的 -version，
+// 确认它能在本机执行且内置版本与签名中的版本一致
+func verifyUpdateBinary(path, version string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	out, err := exec.CommandContext(ctx, path, "-version").CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("new binary failed to run: %w", err)
+	}
+	if !strings.Contains(string(out), "version "+version+" ") {
+		return fmt.Errorf("new binary reports unexpected version: %s", strings.TrimSpace(strings.SplitN(string(out), "\n", 2)[0]))
+	}
+	return nil
+}
+
+// checkUpdateVersion 拒绝不比当前版本新的更新: 旧版本同样有合法的发布签名，
+// 被攻破或恢复了旧备份的面板不能借此把 Agent 降级到有已知问题的版本
+func checkUpdateVersion(latest, current string) error {
+	if signing.CompareVersions(latest, current) <= 0 {
+		return fmt.Errorf("refusing update to %s: not newer than current version %s", latest, current)
+	}
+	return nil
+}
+
+// markUpdatePending 记录刚安装的更新，新版本启动后需在期限内注册成功
+func (a *Agent) markUpdatePending(version string) error {
+	return writeJSONFile(a.execPath+".update", pendingUpdate{
+		From:     AgentVersion,
+		To:       version,
+		Deadline: time.Now().Add(updateConfirmTimeout),
+	})
+}
+
+// loadPendingUpdate 检查当前进程是否是尚未确认的新版本。
+// 已超过确认期限 (例如新版本启动后崩溃，由服务管理器重新拉起) 时直接回滚
+func (a *Agent) loadPendingUpdate() error {
+	var p pendingUpdate
+	if !readJSONFile(a.execPath+".update", &p) {
+		return nil
+	}
+	if p.To != AgentVersion {
+		// 二进制已被手动替换或已回滚，标记不再适用
+		os.Remove(a.execPath + ".update")
+		return nil
+	}
+	if time.Now().After(p.Deadline) {
+		return a.rollbackUpdate(&p, "did not register before the deadline")
+	}
+	a.pendingUpdate = &p
+	log.Printf("Update %s -> %s pending confirmation (rollback at %s)", p.From, p.To, p.Deadline.Format(time.RFC3339))
+	return nil
+}
+
+// registerAfterUpdate 更新后首次注册失败时在确认期限内重试，仍失败则回滚
+func (a *Agent) registerAfterUpdate(err error) error {
+	p := a.pendingUpdate
+	for err != nil && time.Now().Before(p.Deadline) {
+		log.Printf("Register after update failed: %v, retrying...", err)
+		time.Sleep(10 * time.Second)
+		err = a.register()
+	}
+	if err != nil {
+		return a.rollbackUpdate(p, err.Error())
+	}
+	return nil
+}
+
+// confirmUpdate 新版本注册成功，更新生效
+func (a *Agent) confirmUpdate() {
+	if a.pendingUpdate == nil {
+		return
+	}
+	log.Printf("Update to %s confirmed", a.pendingUpdate.To)
+	os.Remove(a.execPath + ".update")
+	os.Remove(a.execPath + ".failed")
+	a.pendingUpdate = nil
+}
+
+// rollbackUpdate 恢复 .bak 中的旧版本并重启，记录失败的版本供旧版本上报
+func (a *Agent) rollbackUpdate(p *pendingUpdate, reason string) error {
+	backupPath := a.execPath + ".bak"
+	if _, err := os.Stat(backupPath); err != nil {
+		os.Remove(a.execPath + ".update")
+		return fmt.Errorf("rollback to %s failed: %w", p.From, err)
+	}
+	log.Printf("Rolling back update %s -> %s: %s", p.From, p.To, reason)
+
+	// 先把当前二进制移走再恢复备份 (Windows 不能覆盖运行中的文件，但可以重命名)
+	failedPath := a.execPath + ".rollback"
+	os.Remove(failedPath)
+	if err := os.Rename(a.execPath, failedPath); err != nil {
+		return fmt.Errorf("rollback failed: %w", err)
+	}
+	if err := os.Rename(backupPath, a.execPath); err != nil {
+		os.Rename(failedPath, a.execPath)
+		return fmt.Errorf("rollback failed: %w", err)
+	}
+
+	if err := writeJSONFile(a.execPath+".failed", failedUpdate{Version: p.To, Reason: reason}); err != nil {
+		log.Printf("Failed to record failed update: %v", err)
+	}
+	os.Remove(a.execPath + ".update")
+
+	a.stopGost()
+	return a.restartSelf()
+}
+
+// loadFailedUpdate 读取已回滚的更新记录
+func (a *Agent) loadFailedUpdate() *failedUpdate {
+	var f failedUpdate
+	if !readJSONFile(a.execPath+".failed", &f) {
+		return nil
+	}
+	return &f
+}
+
+// markRollbackReported 回滚已上报面板 (只上报一次)
+func (a *Agent) markRollbackReported(f *failedUpdate) {
+	f.Reported = true
+	writeJSONFile(a.execPath+".failed", f)
+	os.Remove(a.execPath + ".rollback")
+}
+
+// initUpdateKey 加载校验更新签名的发布公钥 (-update-key 优先于构建时内置的公钥)，
+// 没有可用公钥时关闭自动更新
+func (a *Agent) initUpdateKey() {
+	if !a.autoUpdate {
+		return
+	}
+	encoded := a.updatePublicKey
+	if encoded == "" {
+		encoded = UpdatePublicKey
+	}
+	if encoded == "" {
+		log.Println("Auto update disabled: no update public key (build with -X main.UpdatePublicKey or use -update-key)")
+		a.autoUpdate = false
+		return
+	}
+	key, err := signing.ParsePublicKey(encoded)
+	if err != nil {
+		log.Printf("Auto update disabled: %v", err)
+		a.autoUpdate = false
+		return
+	}
+	a.updateKey = key
+}
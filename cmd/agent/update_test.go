@@ -0,0 +1,136 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"runtime"
+	"sync/atomic"
+	"testing"
+
+	"github.com/AliceNetworks/gost-panel/internal/signing"
+)
+
+func setAgentVersion(t *testing.T, version string) {
+	t.Helper()
+	old := AgentVersion
+	AgentVersion = version
+	t.Cleanup(func() { AgentVersion = old })
+}
+
+func newTestAgent(t *testing.T, panelURL string) *Agent {
+	t.Helper()
+	dir := t.TempDir()
+	a := NewAgent(panelURL, "test-token", "node", filepath.Join(dir, "gost.yml"), "", "", "", "", true)
+	a.execPath = filepath.Join(dir, "gost-agent")
+	if err := os.WriteFile(a.execPath, []byte("current"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	return a
+}
+
+func TestCheckUpdateVersion(t *testing.T) {
+	tests := []struct {
+		latest, current string
+		ok              bool
+	}{
+		{"1.3.0", "1.2.0", true},
+		{"v1.2.1", "1.2.0", true},
+		{"1.0.0", "dev", true},
+		{"1.2.0", "1.2.0", false},
+		{"v1.2.0", "1.2.0", false},
+		{"1.1.9", "1.2.0", false},
+		{"0.9.0", "1.2.0", false},
+	}
+	for _, tt := range tests {
+		err := checkUpdateVersion(tt.latest, tt.current)
+		if (err == nil) != tt.ok {
+			t.Errorf("checkUpdateVersion(%q, %q) = %v, want ok=%v", tt.latest, tt.current, err, tt.ok)
+		}
+	}
+}
+
+// 面板宣告相同或更旧的版本时不下载
+func TestCheckAndUpdateRejectsStaleVersion(t *testing.T) {
+	setAgentVersion(t, "1.2.0")
+
+	for _, latest := range []string{"1.2.0", "1.1.0"} {
+		t.Run(latest, func(t *testing.T) {
+			var downloads atomic.Int32
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if r.URL.Path == "/agent/check-update" {
+					json.NewEncoder(w).Encode(UpdateInfo{
+						LatestVersion: latest,
+						NeedsUpdate:   true,
+						DownloadURL:   "/agent/download/linux/amd64",
+						Checksum:      "00",
+						Signature:     "c2ln",
+					})
+					return
+				}
+				downloads.Add(1)
+			}))
+			defer srv.Close()
+
+			a := newTestAgent(t, srv.URL)
+			updated, err := a.checkAndUpdate()
+			if err == nil || updated {
+				t.Fatalf("checkAndUpdate() = %v, %v; want rejection", updated, err)
+			}
+			if n := downloads.Load(); n != 0 {
+				t.Fatalf("downloaded %d times, want 0", n)
+			}
+		})
+	}
+}
+
+// 签名有效的旧版本在安装前仍被拒绝
+func TestDownloadUpdateRejectsSignedOlderVersion(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("release stand-in is a shell script")
+	}
+	setAgentVersion(t, "1.2.0")
+
+	pub, priv, err := signing.GenerateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	privKey, _ := signing.ParsePrivateKey(priv)
+	pubKey, _ := signing.ParsePublicKey(pub)
+
+	for _, version := range []string{"1.2.0", "1.1.0"} {
+		t.Run(version, func(t *testing.T) {
+			// 能通过 -version 自检的发布包，只有版本检查能拦住它
+			binary := []byte(fmt.Sprintf("#!/bin/sh\necho 'gost-agent version %s (%s/%s)'\n", version, runtime.GOOS, runtime.GOARCH))
+			checksum := fmt.Sprintf("%x", sha256.Sum256(binary))
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.Write(binary)
+			}))
+			defer srv.Close()
+
+			a := newTestAgent(t, srv.URL)
+			a.updateKey = pubKey
+			err := a.downloadUpdate(&UpdateInfo{
+				LatestVersion: version,
+				DownloadURL:   "/agent/download/linux/amd64",
+				Checksum:      checksum,
+				Signature:     signing.Sign(privKey, version, runtime.GOOS, runtime.GOARCH, checksum),
+			})
+			if err == nil {
+				t.Fatal("downloadUpdate() installed a release that is not newer")
+			}
+
+			data, _ := os.ReadFile(a.execPath)
+			if string(data) != "current" {
+				t.Fatalf("executable replaced: %q", data)
+			}
+			if _, err := os.Stat(a.execPath + ".new"); !os.IsNotExist(err) {
+				t.Fatalf("temporary update file left behind: %v", err)
+			}
+		})
+	}
+}
@@ -0,0 +1,101 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"sort"
+
+	"github.com/AliceNetworks/gost-panel/internal/model"
+	"gorm.io/gorm"
+)
+
+// handleCopyDBCommand 将数据库复制到另一种数据库，例如把已有的 SQLite 迁移到 PostgreSQL/MySQL
+// 复制前应停止面板，避免源数据库在复制期间被修改
+func handleCopyDBCommand(args []string) {
+	fs := flag.NewFlagSet("copy-db", flag.ExitOnError)
+	fromDriver := fs.String("from-driver", model.DriverSQLite, "Source database driver (sqlite/postgres/mysql)")
+	from := fs.String("from", "./data/panel.db", "Source DSN (database file path for sqlite)")
+	toDriver := fs.String("to-driver", getEnvDefault("DB_DRIVER", model.DriverSQLite), "Target database driver (default $DB_DRIVER)")
+	to := fs.String("to", os.Getenv("DB_DSN"), "Target DSN (default $DB_DSN)")
+	force := fs.Bool("force", false, "Overwrite a target database that already contains nodes or clients")
+	fs.Usage = printCopyDBUsage
+	fs.Parse(args)
+
+	if *to == "" {
+		log.Fatal("Target DSN is required (-to or DB_DSN)")
+	}
+	if *fromDriver == *toDriver && *from == *to {
+		log.Fatal("Source and target are the same database")
+	}
+	if *fromDriver == model.DriverSQLite {
+		// 打开不存在的 SQLite 文件会创建空数据库
+		if _, err := os.Stat(*from); err != nil {
+			log.Fatalf("Source database not found: %v", err)
+		}
+	}
+
+	// 源数据库只读取，不做迁移；缺少的表和列按空值处理
+	src, err := model.OpenDB(*fromDriver, *from)
+	if err != nil {
+		log.Fatalf("Failed to open source database: %v", err)
+	}
+	dst, err := model.InitDB(*toDriver, *to)
+	if err != nil {
+		log.Fatalf("Failed to init target database: %v", err)
+	}
+
+	if !*force {
+		var nodes, clients int64
+		dst.Model(&model.Node{}).Count(&nodes)
+		dst.Model(&model.Client{}).Count(&clients)
+		if nodes > 0 || clients > 0 {
+			log.Fatalf("Target database already contains %d nodes and %d clients, use -force to overwrite", nodes, clients)
+		}
+	}
+
+	var counts map[string]int64
+	err = dst.Transaction(func(tx *gorm.DB) error {
+		counts, err = model.CopyDatabase(src, tx)
+		return err
+	})
+	if err != nil {
+		log.Fatalf("Copy failed, target database unchanged: %v", err)
+	}
+
+	tables := make([]string, 0, len(counts))
+	for table := range counts {
+		tables = append(tables, table)
+	}
+	sort.Strings(tables)
+	for _, table := range tables {
+		fmt.Printf("  %-24s %d\n", table, counts[table])
+	}
+	fmt.Printf("Copied %s database to %s database\n", *fromDriver, *toDriver)
+}
+
+func getEnvDefault(key, defaultValue string) string {
+	if value := os.Getenv(key); value != "" {
+		return value
+	}
+	return defaultValue
+}
+
+func printCopyDBUsage() {
+	fmt.Println("Copy all panel data into another database (the target is migrated first and its data replaced)")
+	fmt.Println()
+	fmt.Println("Usage:")
+	fmt.Println("  gost-panel copy-db [options]")
+	fmt.Println()
+	fmt.Println("Options:")
+	fmt.Println("  -from-driver string  Source database driver (default \"sqlite\")")
+	fmt.Println("  -from string         Source DSN, database file path for sqlite (default \"./data/panel.db\")")
+	fmt.Println("  -to-driver string    Target database driver (default $DB_DRIVER)")
+	fmt.Println("  -to string           Target DSN (default $DB_DSN)")
+	fmt.Println("  -force               Overwrite a target database that already contains nodes or clients")
+	fmt.Println()
+	fmt.Println("Examples:")
+	fmt.Println("  gost-panel copy-db -from ./data/panel.db -to-driver postgres -to \"host=db user=gost password=secret dbname=gost\"")
+	fmt.Println("  DB_DRIVER=mysql DB_DSN=\"gost:secret@tcp(db:3306)/gost\" gost-panel copy-db")
+}
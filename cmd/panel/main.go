@@ -8,9 +8,9 @@ import (
 	"os"
 	"os/signal"
 	"syscall"
-	"time"
 
 	"github.com/AliceNetworks/gost-panel/internal/api"
+	"github.com/AliceNetworks/gost-panel/internal/cluster"
 	"github.com/AliceNetworks/gost-panel/internal/config"
 	"github.com/AliceNetworks/gost-panel/internal/model"
 	"github.com/AliceNetworks/gost-panel/internal/service"
@@ -34,6 +34,18 @@ func main() {
 		handleServiceCommand()
 		return
 	}
+	if len(os.Args) > 1 && os.Args[1] == "copy-db" {
+		handleCopyDBCommand(os.Args[2:])
+		return
+	}
+	if len(os.Args) > 1 && os.Args[1] == "migrate" {
+		handleMigrateCommand(os.Args[2:])
+		return
+	}
+	if len(os.Args) > 1 && os.Args[1] == "sign-agent" {
+		handleSignAgentCommand(os.Args[2:])
+		return
+	}
 
 	parseFlags()
 
@@ -63,19 +75,13 @@ func main() {
 	}
 
 	// 初始化数据库
-	db, err := model.InitDB(cfg.DBPath)
+	db, err := model.InitDB(cfg.DBDriver, cfg.DatabaseDSN())
 	if err != nil {
 		log.Fatalf("Failed to init database: %v", err)
 	}
 
 	// 初始化服务
-	svc := service.NewService(db, cfg)
-
-	// 启动流量历史记录定时任务
-	go startTrafficRecorder(svc)
-
-	// 启动会话清理定时任务
-	go startSessionCleaner(svc)
+	svc := service.NewService(db, cfg, openClusterStore(cfg))
 
 	// 启动 API 服务
 	server := api.NewServer(svc, cfg)
@@ -98,12 +104,28 @@ func main() {
 	}
 }
 
+// openClusterStore 打开多实例共享状态存储，未配置 REDIS_URL 时使用进程内存储
+func openClusterStore(cfg *config.Config) cluster.Store {
+	if cfg.InstanceID == "" {
+		cfg.InstanceID = cluster.DefaultInstanceID()
+	}
+	store, err := cluster.NewStore(cfg.RedisURL)
+	if err != nil {
+		log.Fatalf("Failed to open cluster store: %v", err)
+	}
+	log.Printf("Cluster store: %s, instance: %s", store.Name(), cfg.InstanceID)
+	return store
+}
+
 func printUsage() {
 	fmt.Println("GOST Panel - GOST Proxy Management Panel")
 	fmt.Println()
 	fmt.Println("Usage:")
 	fmt.Println("  gost-panel [options]")
 	fmt.Println("  gost-panel service <command> [options]")
+	fmt.Println("  gost-panel copy-db [options]")
+	fmt.Println("  gost-panel migrate status|up|down [options]")
+	fmt.Println("  gost-panel sign-agent keygen|sign [options]")
 	fmt.Println()
 	fmt.Println("Options:")
 	fmt.Println("  -listen string    Listen address (default \":8080\")")
@@ -121,12 +143,26 @@ func printUsage() {
 	fmt.Println("  service restart    Restart the service")
 	fmt.Println("  service status     Check service status")
 	fmt.Println()
+	fmt.Println("Database Commands:")
+	fmt.Println("  copy-db            Copy data into another database (e.g. SQLite to PostgreSQL/MySQL)")
+	fmt.Println("  migrate status     Show database migration status")
+	fmt.Println("  migrate up         Apply pending migrations")
+	fmt.Println("  migrate down       Roll back the most recent migration")
+	fmt.Println()
+	fmt.Println("Release Commands:")
+	fmt.Println("  sign-agent keygen  Generate the Ed25519 key pair for agent updates")
+	fmt.Println("  sign-agent sign    Sign agent binaries (writes <binary>.sig)")
+	fmt.Println()
 	fmt.Println("Environment Variables:")
 	fmt.Println("  LISTEN_ADDR       Listen address (same as -listen)")
 	fmt.Println("  DB_PATH           Database path (same as -db)")
+	fmt.Println("  DB_DRIVER         Database driver: sqlite/postgres/mysql (default sqlite)")
+	fmt.Println("  DB_DSN            Database DSN for postgres/mysql")
 	fmt.Println("  JWT_SECRET        JWT secret key (required for production)")
 	fmt.Println("  DEBUG             Enable debug mode (true/false)")
 	fmt.Println("  ALLOWED_ORIGINS   Comma-separated list of allowed CORS origins")
+	fmt.Println("  REDIS_URL         Redis URL for shared state when running multiple replicas")
+	fmt.Println("  INSTANCE_ID       Instance name in a multi-replica deployment (default hostname-based)")
 	fmt.Println()
 	fmt.Println("Examples:")
 	fmt.Println("  gost-panel -listen :9000")
@@ -134,32 +170,3 @@ func printUsage() {
 	fmt.Println("  gost-panel service start")
 	fmt.Println("  LISTEN_ADDR=:9000 JWT_SECRET=mysecret gost-panel")
 }
-
-// startTrafficRecorder 启动流量记录定时任务
-func startTrafficRecorder(svc *service.Service) {
-	// 每分钟记录一次流量数据
-	ticker := time.NewTicker(1 * time.Minute)
-	defer ticker.Stop()
-
-	// 立即记录一次
-	svc.RecordTrafficHistory()
-
-	for range ticker.C {
-		if err := svc.RecordTrafficHistory(); err != nil {
-			log.Printf("Failed to record traffic history: %v", err)
-		}
-	}
-}
-
-// startSessionCleaner 启动会话清理定时任务
-func startSessionCleaner(svc *service.Service) {
-	// 每小时清理一次过期会话
-	ticker := time.NewTicker(1 * time.Hour)
-	defer ticker.Stop()
-
-	for range ticker.C {
-		if err := svc.CleanupExpiredSessions(); err != nil {
-			log.Printf("Failed to cleanup expired sessions: %v", err)
-		}
-	}
-}
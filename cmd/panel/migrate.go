@@ -0,0 +1,111 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"os"
+
+	"github.com/AliceNetworks/gost-panel/internal/model"
+)
+
+// handleMigrateCommand 管理数据库版本化迁移: status/up/down
+func handleMigrateCommand(args []string) {
+	if len(args) < 1 {
+		printMigrateUsage()
+		os.Exit(1)
+	}
+	action := args[0]
+
+	fs := flag.NewFlagSet("migrate "+action, flag.ExitOnError)
+	path := fs.String("db", "", "Database path for sqlite (default $DB_PATH or ./data/panel.db)")
+	target := fs.Int("to", 0, "Target version for up (default latest)")
+	steps := fs.Int("steps", 1, "Number of migrations to roll back for down")
+	fs.Usage = printMigrateUsage
+	fs.Parse(args[1:])
+
+	driver := getEnvDefault("DB_DRIVER", model.DriverSQLite)
+	dsn := os.Getenv("DB_DSN")
+	if driver == model.DriverSQLite {
+		dsn = *path
+		if dsn == "" {
+			dsn = getEnvDefault("DB_PATH", "./data/panel.db")
+		}
+	}
+	db, err := model.OpenDB(driver, dsn)
+	if err != nil {
+		log.Fatalf("Failed to open database: %v", err)
+	}
+
+	switch action {
+	case "status":
+		statuses, err := model.MigrationStatuses(db)
+		if err != nil {
+			log.Fatalf("Failed to read migrations: %v", err)
+		}
+		version, _ := model.SchemaVersion(db)
+		fmt.Printf("Database version: %d, binary version: %d\n\n", version, model.LatestSchemaVersion())
+		for _, st := range statuses {
+			state := "pending"
+			if st.Applied {
+				state = "applied " + st.AppliedAt.Format("2006-01-02 15:04:05")
+			}
+			note := ""
+			if st.Unknown {
+				note = " (unknown to this binary)"
+			} else if !st.Reversible {
+				note = " (irreversible)"
+			}
+			fmt.Printf("  %4d  %-28s %s%s\n", st.Version, st.Name, state, note)
+		}
+	case "up":
+		applied, err := model.MigrateUp(db, *target)
+		for _, m := range applied {
+			fmt.Printf("Applied %d (%s)\n", m.Version, m.Name)
+		}
+		if err != nil {
+			log.Fatalf("Migration failed: %v", err)
+		}
+		if len(applied) == 0 {
+			fmt.Println("Database is up to date")
+		}
+	case "down":
+		if *steps < 1 {
+			log.Fatal("-steps must be at least 1")
+		}
+		reverted, err := model.MigrateDown(db, *steps)
+		for _, m := range reverted {
+			fmt.Printf("Rolled back %d (%s)\n", m.Version, m.Name)
+		}
+		if err != nil {
+			log.Fatalf("Rollback failed: %v", err)
+		}
+		if len(reverted) == 0 {
+			fmt.Println("No applied migrations to roll back")
+		}
+	default:
+		printMigrateUsage()
+		os.Exit(1)
+	}
+}
+
+func printMigrateUsage() {
+	fmt.Println("Manage versioned database migrations (uses DB_DRIVER / DB_DSN / DB_PATH)")
+	fmt.Println()
+	fmt.Println("Usage:")
+	fmt.Println("  gost-panel migrate <command> [options]")
+	fmt.Println()
+	fmt.Println("Commands:")
+	fmt.Println("  status    Show applied and pending migrations")
+	fmt.Println("  up        Apply pending migrations (also done automatically on startup)")
+	fmt.Println("  down      Roll back the most recent migrations")
+	fmt.Println()
+	fmt.Println("Options:")
+	fmt.Println("  -db string    Database path for sqlite (default $DB_PATH or \"./data/panel.db\")")
+	fmt.Println("  -to int       Target version for up (default latest)")
+	fmt.Println("  -steps int    Number of migrations to roll back for down (default 1)")
+	fmt.Println()
+	fmt.Println("Examples:")
+	fmt.Println("  gost-panel migrate status")
+	fmt.Println("  gost-panel migrate down -steps 1")
+}
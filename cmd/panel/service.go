@@ -56,15 +56,12 @@ func (p *program) run() {
 		cfg.Debug = true
 	}
 
-	db, err := model.InitDB(cfg.DBPath)
+	db, err := model.InitDB(cfg.DBDriver, cfg.DatabaseDSN())
 	if err != nil {
 		log.Fatalf("Failed to init database: %v", err)
 	}
 
-	svcInst := service.NewService(db, cfg)
-
-	go startTrafficRecorder(svcInst)
-	go startSessionCleaner(svcInst)
+	svcInst := service.NewService(db, cfg, openClusterStore(cfg))
 
 	server := api.NewServer(svcInst, cfg)
 
@@ -0,0 +1,97 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+
+	"github.com/AliceNetworks/gost-panel/internal/signing"
+)
+
+// handleSignAgentCommand 管理 Agent 更新包的发布签名: keygen/sign
+// 签名应在发布环境中完成，私钥不要放到面板服务器上
+func handleSignAgentCommand(args []string) {
+	if len(args) < 1 {
+		printSignAgentUsage()
+		os.Exit(1)
+	}
+	action := args[0]
+
+	fs := flag.NewFlagSet("sign-agent "+action, flag.ExitOnError)
+	out := fs.String("out", "agent-release.key", "Private key output path for keygen")
+	keyPath := fs.String("key", "", "Private key file for sign (default $AGENT_SIGNING_KEY)")
+	version := fs.String("version", "", "Agent version embedded in the binaries (required for sign)")
+	fs.Usage = printSignAgentUsage
+	fs.Parse(args[1:])
+
+	switch action {
+	case "keygen":
+		if _, err := os.Stat(*out); err == nil {
+			log.Fatalf("%s already exists", *out)
+		}
+		pub, priv, err := signing.GenerateKey()
+		if err != nil {
+			log.Fatalf("Failed to generate key: %v", err)
+		}
+		if err := os.WriteFile(*out, []byte(priv+"\n"), 0600); err != nil {
+			log.Fatalf("Failed to write private key: %v", err)
+		}
+		fmt.Printf("Private key written to %s (keep it offline)\n", *out)
+		fmt.Printf("Public key: %s\n", pub)
+		fmt.Println()
+		fmt.Println("Build agents with:")
+		fmt.Printf("  -ldflags \"-X 'main.UpdatePublicKey=%s'\"\n", pub)
+	case "sign":
+		if *version == "" || fs.NArg() == 0 {
+			printSignAgentUsage()
+			os.Exit(1)
+		}
+		encoded := os.Getenv("AGENT_SIGNING_KEY")
+		if *keyPath != "" {
+			data, err := os.ReadFile(*keyPath)
+			if err != nil {
+				log.Fatalf("Failed to read key: %v", err)
+			}
+			encoded = string(data)
+		}
+		if encoded == "" {
+			log.Fatal("-key or AGENT_SIGNING_KEY is required")
+		}
+		key, err := signing.ParsePrivateKey(encoded)
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		for _, path := range fs.Args() {
+			goos, goarch, ok := signing.PlatformFromFileName(filepath.Base(path))
+			if !ok {
+				log.Fatalf("%s: file name must be gost-agent-<os>-<arch>", path)
+			}
+			checksum, err := signing.FileChecksum(path)
+			if err != nil {
+				log.Fatalf("%s: %v", path, err)
+			}
+			sig := signing.Sign(key, *version, goos, goarch, checksum)
+			if err := os.WriteFile(path+signing.SignatureExt, []byte(sig+"\n"), 0644); err != nil {
+				log.Fatalf("%s: %v", path, err)
+			}
+			fmt.Printf("Signed %s (%s/%s)\n", path, goos, goarch)
+		}
+	default:
+		printSignAgentUsage()
+		os.Exit(1)
+	}
+}
+
+func printSignAgentUsage() {
+	fmt.Println("Usage:")
+	fmt.Println("  gost-panel sign-agent keygen [-out agent-release.key]")
+	fmt.Println("  gost-panel sign-agent sign -key agent-release.key -version <version> <agent binaries...>")
+	fmt.Println()
+	fmt.Println("keygen creates an Ed25519 release key pair. Embed the public key in agent builds")
+	fmt.Println("(-X main.UpdatePublicKey=...) and keep the private key out of the panel server.")
+	fmt.Println("sign writes <binary>.sig next to each gost-agent-<os>-<arch> binary; the panel")
+	fmt.Println("serves it with the update and agents refuse updates whose signature does not verify.")
+}
@@ -0,0 +1,184 @@
+package api
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/AliceNetworks/gost-panel/internal/signing"
+	"github.com/gin-gonic/gin"
+)
+
+// ==================== Agent 请求认证 ====================
+//
+// 已登记密钥的 Agent 用私钥签名每个请求 (X-Agent-Key/Timestamp/Nonce/Signature)，
+// 尚未登记的 Agent 继续使用 Token。节点/客户端登记密钥后其 Token 不再被接受。
+
+// agentRequestMaxBody Agent 请求体上限 (签名校验需要读取完整请求体)
+const agentRequestMaxBody = 8 << 20
+
+// agentCaller 发起请求的 Agent
+type agentCaller struct {
+	Token      string // 节点/客户端的 Token (内部仍按 Token 关联)，无法识别时为空
+	Credential string // Agent 出示的凭据 (已登记的公钥或 Token)，用于识别已删除的 Agent
+}
+
+// verifyAgentSignature 校验请求签名并拒绝重复的 nonce，未签名时返回 signing.ErrUnsignedRequest
+func (s *Server) verifyAgentSignature(r *http.Request, body []byte) (string, error) {
+	publicKey, nonce, err := signing.VerifyRequest(r.Header, r.Method, r.URL.RequestURI(), body, time.Now())
+	if err != nil {
+		return "", err
+	}
+	fresh, err := s.svc.Store().SetNX("agent-nonce:"+nonce, "1", 2*signing.RequestMaxSkew)
+	if err != nil {
+		return "", err
+	}
+	if !fresh {
+		return "", errors.New("replayed request")
+	}
+	return publicKey, nil
+}
+
+// verifyAgentRequest 读取请求体并校验签名 (请求体会被还原，之后仍可正常绑定)，
+// 未签名的请求返回空公钥
+func (s *Server) verifyAgentRequest(c *gin.Context) (string, error) {
+	var body []byte
+	if c.Request.Body != nil {
+		data, err := io.ReadAll(io.LimitReader(c.Request.Body, agentRequestMaxBody))
+		if err != nil {
+			return "", err
+		}
+		body = data
+		c.Request.Body = io.NopCloser(bytes.NewReader(body))
+	}
+
+	publicKey, err := s.verifyAgentSignature(c.Request, body)
+	if errors.Is(err, signing.ErrUnsignedRequest) {
+		return "", nil
+	}
+	return publicKey, err
+}
+
+// resolveAgent 根据签名公钥 (优先) 或 Token 确定发起请求的 Agent
+func (s *Server) resolveAgent(publicKey, token string) agentCaller {
+	if publicKey != "" {
+		caller := agentCaller{Credential: publicKey}
+		if _, agentToken, err := s.svc.GetAgentByKey(publicKey); err == nil {
+			caller.Token = agentToken
+		}
+		return caller
+	}
+	caller := agentCaller{Credential: token}
+	if s.svc.AgentTokenUsable(token) {
+		caller.Token = token
+	}
+	return caller
+}
+
+// authenticateAgent 校验签名或 Token (token 为空时使用 Authorization: Bearer)，签名无效时返回错误
+func (s *Server) authenticateAgent(c *gin.Context, token string) (agentCaller, error) {
+	publicKey, err := s.verifyAgentRequest(c)
+	if err != nil {
+		return agentCaller{}, err
+	}
+	if token == "" {
+		token = strings.TrimPrefix(c.GetHeader("Authorization"), "Bearer ")
+	}
+	return s.resolveAgent(publicKey, token), nil
+}
+
+// ==================== 加入令牌与凭据吊销 ====================
+
+// issueJoinToken 签发一次性加入令牌
+func (s *Server) issueJoinToken(c *gin.Context, kind string, id uint) {
+	userID, _ := getUserInfo(c)
+	token, jt, err := s.svc.CreateJoinToken(kind, id, userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	modeFlag := ""
+	if kind == "client" {
+		modeFlag = " -mode client"
+	}
+	s.audit.LogSuccess(c, "join_token", kind, id, "expires "+jt.ExpiresAt.Format(time.RFC3339))
+	c.JSON(http.StatusOK, gin.H{
+		"token":      token,
+		"expires_at": jt.ExpiresAt,
+		// 已安装的 Agent 在本机重新登记 (例如吊销凭据之后)
+		"reenroll_command": fmt.Sprintf("gost-agent orphan reenroll -panel %s -token %s%s", s.getPanelURL(c), token, modeFlag),
+	})
+}
+
+// revokeAgentCredentials 吊销 Agent 凭据 (公钥和 Token)
+func (s *Server) revokeAgentCredentials(c *gin.Context, kind string, id uint) {
+	if err := s.svc.RevokeAgentCredentials(kind, id); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	// Token 变化后认证插件配置随之变化
+	if kind == "node" {
+		s.pushNodeConfig(id)
+	}
+	s.audit.LogSuccess(c, "revoke_agent", kind, id, "agent key and token revoked")
+	c.JSON(http.StatusOK, gin.H{"success": true})
+}
+
+func (s *Server) issueNodeJoinToken(c *gin.Context) {
+	id, _ := strconv.ParseUint(c.Param("id"), 10, 32)
+	userID, isAdmin := getUserInfo(c)
+	if _, err := s.svc.GetNodeByOwner(uint(id), userID, isAdmin); err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "node not found"})
+		return
+	}
+	s.issueJoinToken(c, "node", uint(id))
+}
+
+func (s *Server) issueClientJoinToken(c *gin.Context) {
+	id, _ := strconv.ParseUint(c.Param("id"), 10, 32)
+	userID, isAdmin := getUserInfo(c)
+	if _, err := s.svc.GetClientByOwner(uint(id), userID, isAdmin); err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "client not found"})
+		return
+	}
+	s.issueJoinToken(c, "client", uint(id))
+}
+
+func (s *Server) revokeNodeAgent(c *gin.Context) {
+	id, _ := strconv.ParseUint(c.Param("id"), 10, 32)
+	userID, isAdmin := getUserInfo(c)
+	if _, err := s.svc.GetNodeByOwner(uint(id), userID, isAdmin); err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "node not found"})
+		return
+	}
+	s.revokeAgentCredentials(c, "node", uint(id))
+}
+
+func (s *Server) revokeClientAgent(c *gin.Context) {
+	id, _ := strconv.ParseUint(c.Param("id"), 10, 32)
+	userID, isAdmin := getUserInfo(c)
+	if _, err := s.svc.GetClientByOwner(uint(id), userID, isAdmin); err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "client not found"})
+		return
+	}
+	s.revokeAgentCredentials(c, "client", uint(id))
+}
+
+// installToken 安装脚本中使用的 Token: 要求密钥登记时签发一次性加入令牌 (Token 不再被接受)
+func (s *Server) installToken(c *gin.Context, kind string, id uint, token string) string {
+	if !s.svc.RequireAgentEnrollment() {
+		return token
+	}
+	userID, _ := getUserInfo(c)
+	joinToken, _, err := s.svc.CreateJoinToken(kind, id, userID)
+	if err != nil {
+		return token
+	}
+	return joinToken
+}
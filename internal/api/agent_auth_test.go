@@ -0,0 +1,135 @@
+package api
+
+import (
+	"crypto/ed25519"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/AliceNetworks/gost-panel/internal/cluster"
+	"github.com/AliceNetworks/gost-panel/internal/config"
+	"github.com/AliceNetworks/gost-panel/internal/model"
+	"github.com/AliceNetworks/gost-panel/internal/service"
+	"github.com/AliceNetworks/gost-panel/internal/signing"
+	"gorm.io/gorm"
+)
+
+// newTestServer 只有 Service 的 Server (不注册路由)
+func newTestServer(t *testing.T) (*Server, *gorm.DB) {
+	t.Helper()
+	cfg := &config.Config{DBPath: filepath.Join(t.TempDir(), "panel.db"), InstanceID: "test"}
+	db, err := model.InitDB(model.DriverSQLite, cfg.DBPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	svc := service.NewService(db, cfg, cluster.NewMemoryStore())
+	t.Cleanup(func() {
+		svc.Close()
+		if sqlDB, err := db.DB(); err == nil {
+			sqlDB.Close()
+		}
+	})
+	return &Server{svc: svc, cfg: cfg}, db
+}
+
+func newAgentKey(t *testing.T) (string, ed25519.PrivateKey) {
+	t.Helper()
+	publicKey, privateKey, err := signing.GenerateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	key, err := signing.ParsePrivateKey(privateKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return publicKey, key
+}
+
+func signedRequest(key ed25519.PrivateKey, route string, body []byte) *http.Request {
+	r := httptest.NewRequest(http.MethodPost, route, strings.NewReader(string(body)))
+	for k, v := range signing.SignRequest(key, http.MethodPost, route, body) {
+		r.Header[k] = v
+	}
+	return r
+}
+
+// 签名覆盖路由、请求体和时间，同一 nonce 只能使用一次
+func TestVerifyAgentSignature(t *testing.T) {
+	s, _ := newTestServer(t)
+	publicKey, key := newAgentKey(t)
+	body := []byte(`{"connections":1}`)
+
+	r := signedRequest(key, "/agent/heartbeat", body)
+	got, err := s.verifyAgentSignature(r, body)
+	if err != nil || got != publicKey {
+		t.Fatalf("verifyAgentSignature() = %q, %v; want %q", got, err, publicKey)
+	}
+	if _, err := s.verifyAgentSignature(r, body); err == nil || !strings.Contains(err.Error(), "replayed") {
+		t.Fatalf("replayed request = %v, want rejected", err)
+	}
+
+	if _, err := s.verifyAgentSignature(signedRequest(key, "/agent/heartbeat", body), []byte(`{"connections":2}`)); err == nil {
+		t.Fatal("request with a modified body accepted")
+	}
+	moved := signedRequest(key, "/agent/heartbeat", body)
+	moved.URL.Path = "/agent/stats"
+	if _, err := s.verifyAgentSignature(moved, body); err == nil {
+		t.Fatal("request signed for another route accepted")
+	}
+
+	for _, tt := range []struct {
+		shift time.Duration
+		err   string
+	}{
+		{-signing.RequestMaxSkew - time.Minute, "out of range"},
+		{signing.RequestMaxSkew + time.Minute, "out of range"},
+		{time.Minute, "invalid request signature"}, // 时间在允许范围内，但签名覆盖了原来的时间
+	} {
+		r := signedRequest(key, "/agent/heartbeat", body)
+		ts, _ := strconv.ParseInt(r.Header.Get(signing.HeaderAgentTimestamp), 10, 64)
+		r.Header.Set(signing.HeaderAgentTimestamp, strconv.FormatInt(ts+int64(tt.shift.Seconds()), 10))
+		if _, err := s.verifyAgentSignature(r, body); err == nil || !strings.Contains(err.Error(), tt.err) {
+			t.Errorf("timestamp shifted by %v: %v, want %q", tt.shift, err, tt.err)
+		}
+	}
+
+	unsigned := httptest.NewRequest(http.MethodPost, "/agent/heartbeat", nil)
+	if _, err := s.verifyAgentSignature(unsigned, nil); !errors.Is(err, signing.ErrUnsignedRequest) {
+		t.Fatalf("unsigned request = %v, want ErrUnsignedRequest", err)
+	}
+}
+
+// 未登记的 Agent 按 Token 识别；登记密钥后只按签名公钥识别，Token 不再被接受
+func TestResolveAgent(t *testing.T) {
+	s, db := newTestServer(t)
+	node := model.Node{Name: "node", Host: "127.0.0.1", AgentToken: "node-token"}
+	if err := db.Create(&node).Error; err != nil {
+		t.Fatal(err)
+	}
+	publicKey, _ := newAgentKey(t)
+
+	if caller := s.resolveAgent("", "node-token"); caller.Token != "node-token" || caller.Credential != "node-token" {
+		t.Fatalf("before enrollment: %+v, want node token", caller)
+	}
+	if caller := s.resolveAgent(publicKey, ""); caller.Token != "" || caller.Credential != publicKey {
+		t.Fatalf("unknown key: %+v, want unidentified", caller)
+	}
+
+	if _, _, err := s.svc.EnrollAgent("node-token", publicKey); err != nil {
+		t.Fatal(err)
+	}
+	if caller := s.resolveAgent("", "node-token"); caller.Token != "" || caller.Credential != "node-token" {
+		t.Fatalf("token after enrollment: %+v, want rejected", caller)
+	}
+	if caller := s.resolveAgent(publicKey, "node-token"); caller.Token != "node-token" || caller.Credential != publicKey {
+		t.Fatalf("enrolled key: %+v, want node token", caller)
+	}
+	if caller := s.resolveAgent("", "unknown"); caller.Token != "" {
+		t.Fatalf("unknown token: %+v, want unidentified", caller)
+	}
+}
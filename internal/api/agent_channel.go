@@ -0,0 +1,588 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/AliceNetworks/gost-panel/internal/cluster"
+	"github.com/AliceNetworks/gost-panel/internal/gost"
+	"github.com/AliceNetworks/gost-panel/internal/probe"
+	"github.com/AliceNetworks/gost-panel/internal/signing"
+	"github.com/gin-gonic/gin"
+	"github.com/gorilla/websocket"
+)
+
+// ==================== Agent 控制通道 ====================
+//
+// Agent 通过 WebSocket 与面板保持长连接 (监听 AGENT_GRPC_ADDR)：
+//   面板 -> Agent: config (推送完整配置), reload, restart, uninstall (面板签名的卸载命令), heartbeat_ack, probe (代为探测其他节点)
+//   Agent -> 面板: heartbeat (与 HTTP 心跳相同的统计数据), probe_result
+// HTTP 心跳保留为回退方案，通道断开时 Agent 自动切回轮询。
+
+// AgentChannelPath Agent 控制通道路径
+const AgentChannelPath = "/agent/channel"
+
+// Agent 控制通道消息类型
+const (
+	AgentMsgConfig       = "config"
+	AgentMsgReload       = "reload"
+	AgentMsgRestart      = "restart"
+	AgentMsgUninstall    = "uninstall"
+	AgentMsgHeartbeat    = "heartbeat"
+	AgentMsgHeartbeatAck = "heartbeat_ack"
+	AgentMsgProbe        = "probe"
+	AgentMsgProbeResult  = "probe_result"
+)
+
+var agentUpgrader = websocket.Upgrader{
+	ReadBufferSize:  4096,
+	WriteBufferSize: 4096,
+	// Agent 不是浏览器，不做 Origin 校验，依赖 Token 认证
+	CheckOrigin: func(r *http.Request) bool { return true },
+}
+
+// AgentChannelMessage 控制通道消息
+type AgentChannelMessage struct {
+	Type string          `json:"type"`
+	Data json.RawMessage `json:"data,omitempty"`
+}
+
+// agentConn 单个 Agent 连接
+type agentConn struct {
+	hub       *AgentHub
+	key       string
+	token     string // 连接时出示的 Token (未登记密钥的 Agent)
+	publicKey string // 连接时签名所用的公钥 (已登记密钥的 Agent)
+	conn      *websocket.Conn
+	send      chan []byte
+
+	configHash string // Agent 当前配置的哈希 (心跳上报或最近一次推送)
+}
+
+// agentPresenceTTL Agent 在线记录的过期时间，连接存活期间随 ping 续期
+const agentPresenceTTL = 2 * time.Minute
+
+// AgentHub 管理在线 Agent 的控制通道 (按 node-{id} / client-{id} 索引)
+// 连接只存在于接受它的实例，共享存储中记录每个 Agent 连接在哪个实例上
+type AgentHub struct {
+	conns      map[string]*agentConn
+	store      cluster.Store
+	instanceID string
+	mu         sync.RWMutex
+}
+
+// NewAgentHub 创建 Agent 连接管理器
+func NewAgentHub(store cluster.Store, instanceID string) *AgentHub {
+	return &AgentHub{
+		conns:      make(map[string]*agentConn),
+		store:      store,
+		instanceID: instanceID,
+	}
+}
+
+func agentKey(kind string, id uint) string {
+	return fmt.Sprintf("%s-%d", kind, id)
+}
+
+func agentPresenceKey(key string) string {
+	return "agent:" + key
+}
+
+// add 注册连接，同一 Agent 重复连接时关闭旧连接
+func (h *AgentHub) add(c *agentConn) {
+	h.mu.Lock()
+	if old, ok := h.conns[c.key]; ok {
+		old.conn.Close()
+	}
+	h.conns[c.key] = c
+	h.mu.Unlock()
+	if err := h.store.Set(agentPresenceKey(c.key), h.instanceID, agentPresenceTTL); err != nil {
+		log.Printf("Agent channel %s: failed to record presence: %v", c.key, err)
+	}
+	log.Printf("Agent channel connected: %s", c.key)
+}
+
+// remove 注销连接 (仅由连接自身的 readPump 调用)
+func (h *AgentHub) remove(c *agentConn) {
+	h.mu.Lock()
+	if h.conns[c.key] == c {
+		delete(h.conns, c.key)
+		// Agent 可能已重连到其他实例，只删除本实例的记录
+		h.store.CompareAndDelete(agentPresenceKey(c.key), h.instanceID)
+		log.Printf("Agent channel disconnected: %s", c.key)
+	}
+	close(c.send)
+	h.mu.Unlock()
+}
+
+// refreshPresence 续期在线记录 (记录过期或丢失时重新写入)
+func (h *AgentHub) refreshPresence(key string) {
+	ok, err := h.store.CompareAndExpire(agentPresenceKey(key), h.instanceID, agentPresenceTTL)
+	if err == nil && !ok {
+		_, err = h.store.SetNX(agentPresenceKey(key), h.instanceID, agentPresenceTTL)
+	}
+	if err != nil {
+		log.Printf("Agent channel %s: failed to refresh presence: %v", key, err)
+	}
+}
+
+// Send 向指定 Agent 发送消息，Agent 不在线时返回 false
+func (h *AgentHub) Send(kind string, id uint, msgType string, data interface{}) bool {
+	msg, err := encodeAgentMessage(msgType, data)
+	if err != nil {
+		log.Printf("Failed to marshal agent message: %v", err)
+		return false
+	}
+
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	c, ok := h.conns[agentKey(kind, id)]
+	if !ok {
+		return false
+	}
+	select {
+	case c.send <- msg:
+		return true
+	default:
+		log.Printf("Agent channel %s send buffer full, dropping %s", c.key, msgType)
+		return false
+	}
+}
+
+// IsConnected 检查 Agent 是否连接在当前实例
+func (h *AgentHub) IsConnected(kind string, id uint) bool {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	_, ok := h.conns[agentKey(kind, id)]
+	return ok
+}
+
+// Owner 返回 Agent 所连接的实例，不在线时返回空
+func (h *AgentHub) Owner(kind string, id uint) string {
+	if h.IsConnected(kind, id) {
+		return h.instanceID
+	}
+	owner, err := h.store.Get(agentPresenceKey(agentKey(kind, id)))
+	if err != nil {
+		return ""
+	}
+	return owner
+}
+
+// SetConfigHash 记录 Agent 当前配置的哈希
+func (h *AgentHub) SetConfigHash(kind string, id uint, hash string) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if c, ok := h.conns[agentKey(kind, id)]; ok {
+		c.configHash = hash
+	}
+}
+
+// ConfigHash 返回 Agent 当前配置的哈希，未连接时返回空
+func (h *AgentHub) ConfigHash(kind string, id uint) string {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	if c, ok := h.conns[agentKey(kind, id)]; ok {
+		return c.configHash
+	}
+	return ""
+}
+
+// ClusterKeys 返回所有实例上在线 Agent 的标识
+func (h *AgentHub) ClusterKeys() []string {
+	keys, err := h.store.Keys(agentPresenceKey(""))
+	if err != nil {
+		log.Printf("Failed to list agent channels: %v", err)
+		return h.Keys()
+	}
+	for i, key := range keys {
+		keys[i] = strings.TrimPrefix(key, agentPresenceKey(""))
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// Keys 返回当前实例上在线 Agent 的标识
+func (h *AgentHub) Keys() []string {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	keys := make([]string, 0, len(h.conns))
+	for key := range h.conns {
+		keys = append(keys, key)
+	}
+	return keys
+}
+
+// CloseAll 关闭所有 Agent 连接，Agent 会自动重连
+func (h *AgentHub) CloseAll() {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	for _, c := range h.conns {
+		c.conn.Close()
+	}
+}
+
+func encodeAgentMessage(msgType string, data interface{}) ([]byte, error) {
+	msg := AgentChannelMessage{Type: msgType}
+	if data != nil {
+		raw, err := json.Marshal(data)
+		if err != nil {
+			return nil, err
+		}
+		msg.Data = raw
+	}
+	return json.Marshal(msg)
+}
+
+// writePump 将消息写入 Agent 连接
+func (c *agentConn) writePump() {
+	ticker := time.NewTicker(30 * time.Second)
+	defer func() {
+		ticker.Stop()
+		c.conn.Close()
+	}()
+
+	for {
+		select {
+		case message, ok := <-c.send:
+			c.conn.SetWriteDeadline(time.Now().Add(10 * time.Second))
+			if !ok {
+				c.conn.WriteMessage(websocket.CloseMessage, []byte{})
+				return
+			}
+			if err := c.conn.WriteMessage(websocket.TextMessage, message); err != nil {
+				return
+			}
+
+		case <-ticker.C:
+			c.conn.SetWriteDeadline(time.Now().Add(10 * time.Second))
+			if err := c.conn.WriteMessage(websocket.PingMessage, nil); err != nil {
+				return
+			}
+			c.hub.refreshPresence(c.key)
+		}
+	}
+}
+
+// readPump 读取 Agent 上报的消息
+func (c *agentConn) readPump(s *Server) {
+	defer func() {
+		c.hub.remove(c)
+		c.conn.Close()
+	}()
+
+	c.conn.SetReadLimit(1 << 20)
+	c.conn.SetReadDeadline(time.Now().Add(90 * time.Second))
+	c.conn.SetPongHandler(func(string) error {
+		c.conn.SetReadDeadline(time.Now().Add(90 * time.Second))
+		return nil
+	})
+
+	for {
+		_, data, err := c.conn.ReadMessage()
+		if err != nil {
+			if websocket.IsUnexpectedCloseError(err, websocket.CloseGoingAway, websocket.CloseAbnormalClosure, websocket.CloseNoStatusReceived, websocket.CloseNormalClosure) {
+				log.Printf("Agent channel %s error: %v", c.key, err)
+			}
+			return
+		}
+		c.conn.SetReadDeadline(time.Now().Add(90 * time.Second))
+
+		var msg AgentChannelMessage
+		if err := json.Unmarshal(data, &msg); err != nil {
+			continue
+		}
+
+		switch msg.Type {
+		case AgentMsgHeartbeat:
+			var req AgentHeartbeatRequest
+			if err := json.Unmarshal(msg.Data, &req); err != nil {
+				continue
+			}
+			// 每次心跳重新认证，凭据吊销或密钥更换后旧连接随之失效
+			caller := s.resolveAgent(c.publicKey, c.token)
+			req.Token = caller.Token
+			resp, ok := s.processAgentHeartbeat(&req, caller.Credential)
+			msgType := AgentMsgHeartbeatAck
+			var payload interface{} = resp
+			if cmd, decommissioned := resp["decommission"]; !ok && decommissioned {
+				msgType = AgentMsgUninstall
+				payload = cmd
+			}
+			if reply, err := encodeAgentMessage(msgType, payload); err == nil {
+				select {
+				case c.send <- reply:
+				default:
+				}
+			}
+		case AgentMsgProbeResult:
+			var report probe.Report
+			if err := json.Unmarshal(msg.Data, &report); err != nil {
+				continue
+			}
+			node, err := s.svc.GetNodeByToken(s.resolveAgent(c.publicKey, c.token).Token)
+			if err != nil {
+				continue
+			}
+			if err := s.svc.HandleProbeReport(node.ID, report); err != nil {
+				log.Printf("Agent channel %s: rejected probe result: %v", c.key, err)
+			}
+		}
+	}
+}
+
+// handleAgentChannel 处理 Agent 控制通道连接 (签名或 Authorization 头中的 Token 认证)
+func (s *Server) handleAgentChannel(w http.ResponseWriter, r *http.Request) {
+	publicKey, err := s.verifyAgentSignature(r, nil)
+	if err != nil && !errors.Is(err, signing.ErrUnsignedRequest) {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	token := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+	caller := s.resolveAgent(publicKey, token)
+	if caller.Token == "" {
+		http.Error(w, "invalid token", http.StatusUnauthorized)
+		return
+	}
+
+	var key string
+	if node, err := s.svc.GetNodeByToken(caller.Token); err == nil {
+		key = agentKey("node", node.ID)
+	} else if client, err := s.svc.GetClientByToken(caller.Token); err == nil {
+		key = agentKey("client", client.ID)
+	} else {
+		http.Error(w, "invalid token", http.StatusUnauthorized)
+		return
+	}
+
+	conn, err := agentUpgrader.Upgrade(w, r, nil)
+	if err != nil {
+		log.Printf("Failed to upgrade agent channel: %v", err)
+		return
+	}
+
+	c := &agentConn{
+		hub:       s.agentHub,
+		key:       key,
+		token:     token,
+		publicKey: publicKey,
+		conn:      conn,
+		send:      make(chan []byte, 64),
+	}
+	s.agentHub.add(c)
+
+	go c.writePump()
+	go c.readPump(s)
+}
+
+// runAgentChannel 在 AgentGRPCAddr 上启动控制通道服务
+func (s *Server) runAgentChannel(ctx context.Context) {
+	if s.cfg.AgentGRPCAddr == "" {
+		return
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc(AgentChannelPath, s.handleAgentChannel)
+	srv := &http.Server{
+		Addr:    s.cfg.AgentGRPCAddr,
+		Handler: mux,
+	}
+
+	go func() {
+		<-ctx.Done()
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		srv.Shutdown(shutdownCtx)
+	}()
+
+	log.Printf("Agent channel listening on %s", s.cfg.AgentGRPCAddr)
+	if err := srv.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+		log.Printf("Agent channel server error: %v", err)
+	}
+}
+
+// getAgentChannelURL 返回 Agent 连接控制通道的地址
+func (s *Server) getAgentChannelURL(c *gin.Context) string {
+	if s.cfg.AgentChannelURL != "" {
+		return s.cfg.AgentChannelURL
+	}
+	if s.cfg.AgentGRPCAddr == "" {
+		return ""
+	}
+
+	_, port, err := net.SplitHostPort(s.cfg.AgentGRPCAddr)
+	if err != nil {
+		return ""
+	}
+
+	host := c.Request.Host
+	if panelURL, err := url.Parse(s.getPanelURL(c)); err == nil && panelURL.Host != "" {
+		host = panelURL.Host
+	}
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		host = h
+	}
+
+	return fmt.Sprintf("ws://%s%s", net.JoinHostPort(strings.Trim(host, "[]"), port), AgentChannelPath)
+}
+
+// pushNodeConfig 通过控制通道向节点推送最新配置
+func (s *Server) pushNodeConfig(nodeID uint) bool {
+	if !s.agentHub.IsConnected("node", nodeID) {
+		return s.forwardToAgentOwner(clusterEvent{Type: clusterEventAgentPush, Kind: "node", ID: nodeID})
+	}
+	node, err := s.svc.GetNode(nodeID)
+	if err != nil {
+		return false
+	}
+	return s.pushAgentConfig("node", nodeID, s.svc.GenerateNodeFullConfig(node))
+}
+
+// pushClientConfig 通过控制通道向客户端推送最新配置
+func (s *Server) pushClientConfig(clientID uint) bool {
+	if !s.agentHub.IsConnected("client", clientID) {
+		return s.forwardToAgentOwner(clusterEvent{Type: clusterEventAgentPush, Kind: "client", ID: clientID})
+	}
+	client, err := s.svc.GetClient(clientID)
+	if err != nil {
+		return false
+	}
+	return s.pushAgentConfig("client", clientID, s.generateClientConfig(client))
+}
+
+func (s *Server) pushAgentConfig(kind string, id uint, config map[string]interface{}) bool {
+	data, err := gost.MarshalConfig(config)
+	if err != nil {
+		return false
+	}
+	hash, _ := gost.ConfigHash(config)
+	if !s.agentHub.Send(kind, id, AgentMsgConfig, gin.H{
+		"hash":   hash,
+		"config": string(data),
+	}) {
+		return false
+	}
+	s.agentHub.SetConfigHash(kind, id, hash)
+	return true
+}
+
+// requestAgentReconcile 请求所有实例核对各自在线 Agent 的配置
+func (s *Server) requestAgentReconcile() {
+	if err := s.publishClusterEvent(clusterEvent{Type: clusterEventAgentReconcile}); err != nil {
+		log.Printf("Failed to publish agent reconcile request, reconciling locally: %v", err)
+		s.queueAgentReconcile()
+	}
+}
+
+// queueAgentReconcile 核对当前实例上 Agent 的配置 (多次请求合并为一次)
+func (s *Server) queueAgentReconcile() {
+	select {
+	case s.agentReconcileCh <- struct{}{}:
+	default:
+	}
+}
+
+// runAgentReconciler 处理配置核对请求，如超限状态变化后向受影响的 Agent 推送新配置
+func (s *Server) runAgentReconciler() {
+	for range s.agentReconcileCh {
+		s.reconcileAgentConfigs()
+	}
+}
+
+// reconcileAgentConfigs 对比在线 Agent 的配置哈希，不一致时推送最新配置
+func (s *Server) reconcileAgentConfigs() {
+	for _, key := range s.agentHub.Keys() {
+		var id uint
+		if n, _ := fmt.Sscanf(key, "node-%d", &id); n == 1 {
+			node, err := s.svc.GetNode(id)
+			if err != nil {
+				continue
+			}
+			config := s.svc.GenerateNodeFullConfig(node)
+			if hash, _ := gost.ConfigHash(config); hash != s.agentHub.ConfigHash("node", id) {
+				s.pushAgentConfig("node", id, config)
+			}
+		} else if n, _ := fmt.Sscanf(key, "client-%d", &id); n == 1 {
+			client, err := s.svc.GetClient(id)
+			if err != nil {
+				continue
+			}
+			config := s.generateClientConfig(client)
+			if hash, _ := gost.ConfigHash(config); hash != s.agentHub.ConfigHash("client", id) {
+				s.pushAgentConfig("client", id, config)
+			}
+		}
+	}
+}
+
+// AgentCommandRequest 控制通道命令请求
+type AgentCommandRequest struct {
+	Command string `json:"command" binding:"required"` // reload, restart
+}
+
+// sendAgentCommand 通过控制通道下发命令
+func (s *Server) sendAgentCommand(c *gin.Context, kind string, id uint) {
+	var req AgentCommandRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if req.Command != AgentMsgReload && req.Command != AgentMsgRestart {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "unsupported command"})
+		return
+	}
+
+	if !s.sendToAgent(kind, id, req.Command, nil) {
+		c.JSON(http.StatusConflict, gin.H{"error": "agent channel not connected"})
+		return
+	}
+
+	s.audit.LogSuccess(c, req.Command, kind, id, "via agent channel")
+	c.JSON(http.StatusOK, gin.H{"success": true})
+}
+
+func (s *Server) sendNodeAgentCommand(c *gin.Context) {
+	id, _ := strconv.ParseUint(c.Param("id"), 10, 32)
+	userID, isAdmin := getUserInfo(c)
+	if _, err := s.svc.GetNodeByOwner(uint(id), userID, isAdmin); err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "node not found"})
+		return
+	}
+	s.sendAgentCommand(c, "node", uint(id))
+}
+
+func (s *Server) sendClientAgentCommand(c *gin.Context) {
+	id, _ := strconv.ParseUint(c.Param("id"), 10, 32)
+	userID, isAdmin := getUserInfo(c)
+	if _, err := s.svc.GetClientByOwner(uint(id), userID, isAdmin); err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "client not found"})
+		return
+	}
+	s.sendAgentCommand(c, "client", uint(id))
+}
+
+// dispatchProbe 将探测请求下发给负责探测的节点 Agent (可能连接在其他实例上)
+func (s *Server) dispatchProbe(fromNodeID uint, req probe.Request) bool {
+	return s.sendToAgent("node", fromNodeID, AgentMsgProbe, req)
+}
+
+// listAgentChannels 列出在线的控制通道 (管理员)
+func (s *Server) listAgentChannels(c *gin.Context) {
+	_, isAdmin := getUserInfo(c)
+	if !isAdmin {
+		c.JSON(http.StatusForbidden, gin.H{"error": "admin only"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"channels": s.agentHub.ClusterKeys()})
+}
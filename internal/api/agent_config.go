@@ -0,0 +1,84 @@
+package api
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+
+	"github.com/AliceNetworks/gost-panel/internal/service"
+	"github.com/gin-gonic/gin"
+)
+
+// agentConfigErrorMax 保存的错误信息上限
+const agentConfigErrorMax = 4096
+
+// AgentConfigResultRequest Agent 上报配置应用结果的请求
+type AgentConfigResultRequest struct {
+	Token  string `json:"token"`                     // 已登记密钥的 Agent 通过签名认证，不发送 Token
+	Hash   string `json:"hash" binding:"required"`   // 新配置的哈希
+	Status string `json:"status" binding:"required"` // applied/rejected/rolled_back
+	Error  string `json:"error"`                     // 校验失败或回滚的原因
+}
+
+// agentConfigResult 记录 Agent 应用配置的结果，失败时告警
+func (s *Server) agentConfigResult(c *gin.Context) {
+	publicKey, err := s.verifyAgentRequest(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	var req AgentConfigResultRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if !service.ValidAgentConfigStatus(req.Status) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid status"})
+		return
+	}
+	if len(req.Error) > agentConfigErrorMax {
+		req.Error = req.Error[:agentConfigErrorMax]
+	}
+
+	caller := s.resolveAgent(publicKey, req.Token)
+	kind, id := s.identifyAgent(caller.Token)
+	if id == 0 {
+		c.JSON(http.StatusUnauthorized, s.agentTokenRejection(caller.Credential))
+		return
+	}
+
+	changed, err := s.svc.ReportAgentConfig(kind, id, req.Hash, req.Status, req.Error)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	if changed && service.AgentConfigFailed(req.Status) {
+		s.alertConfigFailed(kind, id, &req)
+	}
+	c.JSON(http.StatusOK, gin.H{"success": true})
+}
+
+// alertConfigFailed Agent 拒绝或回滚了新配置时告警
+func (s *Server) alertConfigFailed(kind string, id uint, req *AgentConfigResultRequest) {
+	var name string
+	if kind == "node" {
+		if node, err := s.svc.GetNode(id); err == nil {
+			name = node.Name
+		}
+	} else if client, err := s.svc.GetClient(id); err == nil {
+		name = client.Name
+	}
+
+	action := "校验失败，未应用"
+	if req.Status == service.AgentConfigRolledBack {
+		action = "应用后 GOST 运行异常，已回滚到上一版本"
+	}
+	log.Printf("Agent %s %s %s config %.12s: %s", kind, name, req.Status, req.Hash, req.Error)
+	s.svc.GetAlertService().TriggerAlert("config_apply", kind, id, name,
+		fmt.Sprintf("新配置%s\n%s: %s\n配置哈希: %.12s\n原因: %s", action, kind, name, req.Hash, req.Error))
+}
+
+// agentConfigRejected Agent 是否已拒绝或回滚该配置 (心跳不再要求重新加载，等待配置变化)
+func agentConfigRejected(status, statusHash, hash string) bool {
+	return service.AgentConfigFailed(status) && statusHash == hash
+}
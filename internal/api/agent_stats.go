@@ -0,0 +1,114 @@
+package api
+
+import (
+	"log"
+	"net/http"
+	"sort"
+	"time"
+
+	"github.com/AliceNetworks/gost-panel/internal/service"
+	"github.com/gin-gonic/gin"
+)
+
+// AgentStatsEntry Agent 离线期间缓存的一次心跳统计 (增量)
+type AgentStatsEntry struct {
+	Seq          uint64                      `json:"seq"`
+	At           time.Time                   `json:"at"` // Agent 记录统计的时间
+	TrafficIn    int64                       `json:"traffic_in"`
+	TrafficOut   int64                       `json:"traffic_out"`
+	ServiceStats map[string]map[string]int64 `json:"service_stats"`
+	UserStats    map[string]map[string]int64 `json:"user_stats"`
+}
+
+// AgentStatsReplayRequest Agent 补报离线统计的请求
+type AgentStatsReplayRequest struct {
+	Token      string            `json:"token"` // 已登记密钥的 Agent 通过签名认证，不发送 Token
+	StatsEpoch string            `json:"stats_epoch" binding:"required"`
+	Entries    []AgentStatsEntry `json:"entries"`
+}
+
+// agentReplayStats 按序号入账 Agent 离线期间缓存的统计，已入账的序号会被跳过
+func (s *Server) agentReplayStats(c *gin.Context) {
+	publicKey, err := s.verifyAgentRequest(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	var req AgentStatsReplayRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	caller := s.resolveAgent(publicKey, req.Token)
+	kind, id := s.identifyAgent(caller.Token)
+	if id == 0 {
+		c.JSON(http.StatusUnauthorized, s.agentTokenRejection(caller.Credential))
+		return
+	}
+
+	sort.Slice(req.Entries, func(i, j int) bool { return req.Entries[i].Seq < req.Entries[j].Seq })
+	applied := 0
+	var trafficIn, trafficOut int64
+	for _, entry := range req.Entries {
+		if entry.Seq == 0 {
+			continue
+		}
+		stats := &service.AgentStats{
+			At:         entry.At,
+			TrafficIn:  entry.TrafficIn,
+			TrafficOut: entry.TrafficOut,
+		}
+		if kind == "node" {
+			stats.Resources = serviceTraffic(entry.ServiceStats)
+			stats.UserStats = entry.UserStats
+		}
+		// 序号登记和入账在同一事务中，失败时序号不登记，Agent 重试整批时重新入账
+		fresh, err := s.svc.ApplyAgentStats(kind, id, req.StatsEpoch, entry.Seq, stats)
+		if err != nil {
+			log.Printf("Failed to apply replayed stats %d of %s %d: %v", entry.Seq, kind, id, err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error(), "applied": applied})
+			return
+		}
+		if !fresh {
+			continue
+		}
+		applied++
+		trafficIn += entry.TrafficIn
+		trafficOut += entry.TrafficOut
+	}
+
+	if applied > 0 {
+		log.Printf("Replayed %d offline heartbeats from %s %d (in %d, out %d bytes)", applied, kind, id, trafficIn, trafficOut)
+	}
+	c.JSON(http.StatusOK, gin.H{"applied": applied})
+}
+
+// applyHeartbeatStats 心跳携带统计序号时在同一事务中登记序号并入账，之后清零 req 中的统计 (只更新在线状态)。
+// 已入账 (包括重复上报) 时返回需要在响应中确认的序号；入账失败时不确认，Agent 保留该统计并通过 /agent/stats 补报
+func (s *Server) applyHeartbeatStats(kind string, id uint, req *AgentHeartbeatRequest) gin.H {
+	if req.StatsSeq == 0 {
+		return nil
+	}
+	stats := &service.AgentStats{TrafficIn: req.TrafficIn, TrafficOut: req.TrafficOut}
+	if kind == "node" {
+		stats.Resources = serviceTraffic(req.ServiceStats)
+		stats.UserStats = req.UserStats
+	}
+	req.TrafficIn, req.TrafficOut = 0, 0
+	req.ServiceStats, req.UserStats = nil, nil
+
+	if _, err := s.svc.ApplyAgentStats(kind, id, req.StatsEpoch, req.StatsSeq, stats); err != nil {
+		log.Printf("Failed to apply heartbeat stats %d of %s %d: %v", req.StatsSeq, kind, id, err)
+		return nil
+	}
+	return gin.H{"stats_epoch": req.StatsEpoch, "stats_seq": req.StatsSeq}
+}
+
+// withStatsAck 在心跳响应中确认已入账的统计序号
+func withStatsAck(resp, ack gin.H) gin.H {
+	for k, v := range ack {
+		resp[k] = v
+	}
+	return resp
+}
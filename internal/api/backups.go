@@ -0,0 +1,163 @@
+package api
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+
+	"github.com/AliceNetworks/gost-panel/internal/model"
+	"github.com/gin-gonic/gin"
+)
+
+// ==================== 备份管理 ====================
+//
+// 备份使用 VACUUM INTO 生成一致快照，可选加密后上传到本地目录、S3 兼容存储或 WebDAV。
+// 存储类型和参数保存在站点配置中 (backup_target / backup_target_config)，定时备份见 backup 任务。
+
+// listBackups 获取已存储的备份
+func (s *Server) listBackups(c *gin.Context) {
+	_, isAdmin := getUserInfo(c)
+	if !isAdmin {
+		c.JSON(http.StatusForbidden, gin.H{"error": "admin only"})
+		return
+	}
+
+	list, err := s.svc.ListBackups()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, list)
+}
+
+// createBackup 立即备份到备份存储
+func (s *Server) createBackup(c *gin.Context) {
+	_, isAdmin := getUserInfo(c)
+	if !isAdmin {
+		c.JSON(http.StatusForbidden, gin.H{"error": "admin only"})
+		return
+	}
+
+	obj, err := s.svc.CreateBackup()
+	if err != nil {
+		s.audit.LogFailed(c, "create", "backup", 0, err.Error())
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	s.audit.LogSuccess(c, "create", "backup", 0, obj.Name)
+	c.JSON(http.StatusOK, obj)
+}
+
+// downloadBackup 下载已存储的备份 (加密备份原样返回)
+func (s *Server) downloadBackup(c *gin.Context) {
+	_, isAdmin := getUserInfo(c)
+	if !isAdmin {
+		c.JSON(http.StatusForbidden, gin.H{"error": "admin only"})
+		return
+	}
+
+	name := c.Param("name")
+	r, err := s.svc.OpenBackup(name)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "backup not found"})
+		return
+	}
+	defer r.Close()
+
+	c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=%s", name))
+	c.Header("Content-Type", "application/octet-stream")
+	c.Status(http.StatusOK)
+	io.Copy(c.Writer, r)
+}
+
+// deleteBackup 删除已存储的备份
+func (s *Server) deleteBackup(c *gin.Context) {
+	_, isAdmin := getUserInfo(c)
+	if !isAdmin {
+		c.JSON(http.StatusForbidden, gin.H{"error": "admin only"})
+		return
+	}
+
+	name := c.Param("name")
+	if err := s.svc.DeleteBackup(name); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	s.audit.LogSuccess(c, "delete", "backup", 0, name)
+	c.JSON(http.StatusOK, gin.H{"success": true})
+}
+
+// testBackupTarget 测试备份存储是否可用，未提供参数时测试当前配置
+func (s *Server) testBackupTarget(c *gin.Context) {
+	_, isAdmin := getUserInfo(c)
+	if !isAdmin {
+		c.JSON(http.StatusForbidden, gin.H{"error": "admin only"})
+		return
+	}
+
+	var req struct {
+		Target string `json:"target"`
+		Config string `json:"config"`
+	}
+	c.ShouldBindJSON(&req)
+	if req.Target == "" {
+		req.Target = s.svc.GetSiteConfig(model.ConfigBackupTarget)
+		req.Config = s.svc.GetSiteConfig(model.ConfigBackupTargetConfig)
+	}
+
+	if err := s.svc.TestBackupTarget(req.Target, req.Config); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"success": true, "message": "备份存储可用"})
+}
+
+// validateBackupConfigs 校验站点配置中的备份相关项
+func (s *Server) validateBackupConfigs(configs map[string]string) error {
+	kind, kindSet := configs[model.ConfigBackupTarget]
+	config, configSet := configs[model.ConfigBackupTargetConfig]
+	if kindSet || configSet {
+		if !kindSet {
+			kind = s.svc.GetSiteConfig(model.ConfigBackupTarget)
+		}
+		if !configSet {
+			config = s.svc.GetSiteConfig(model.ConfigBackupTargetConfig)
+		}
+		if _, err := s.svc.NewBackupTarget(kind, config); err != nil {
+			return fmt.Errorf("invalid backup target: %v", err)
+		}
+	}
+
+	if v, ok := configs[model.ConfigBackupRetention]; ok && v != "" {
+		if n, err := strconv.Atoi(v); err != nil || n < 0 {
+			return fmt.Errorf("backup_retention must be a non-negative integer")
+		}
+	}
+	return nil
+}
+
+// restoreBackup 从备份存储中的备份在线恢复数据库
+func (s *Server) restoreBackup(c *gin.Context) {
+	_, isAdmin := getUserInfo(c)
+	if !isAdmin {
+		c.JSON(http.StatusForbidden, gin.H{"error": "admin only"})
+		return
+	}
+
+	name := c.Param("name")
+	result, err := s.svc.RestoreBackup(name)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	s.afterDatabaseRestore()
+
+	s.audit.LogSuccess(c, "restore", "database", 0, name)
+	c.JSON(http.StatusOK, gin.H{
+		"message": "Database restored successfully",
+		"result":  result,
+	})
+}
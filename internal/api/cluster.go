@@ -0,0 +1,131 @@
+package api
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ==================== 多实例 ====================
+//
+// 多个面板实例共享数据库和 Redis 时，需要其他实例配合的操作通过事件频道转发：
+//   agent_send / agent_push: 发往连接在指定实例上的 Agent
+//   agent_reconcile: 所有实例核对各自在线 Agent 的配置
+//   restored: 数据库恢复后所有实例清理限流记录和长连接
+
+// clusterEventChannel 跨实例事件频道
+const clusterEventChannel = "events"
+
+// 跨实例事件类型
+const (
+	clusterEventAgentSend      = "agent_send"
+	clusterEventAgentPush      = "agent_push"
+	clusterEventAgentReconcile = "agent_reconcile"
+	clusterEventRestored       = "restored"
+)
+
+// clusterEvent 跨实例事件
+type clusterEvent struct {
+	Type     string          `json:"type"`
+	Instance string          `json:"instance,omitempty"` // 目标实例，为空表示所有实例
+	Kind     string          `json:"kind,omitempty"`     // node / client
+	ID       uint            `json:"id,omitempty"`
+	Message  string          `json:"message,omitempty"` // agent_send 的消息类型
+	Data     json.RawMessage `json:"data,omitempty"`    // agent_send 的消息内容
+}
+
+// publishClusterEvent 发布事件 (当前实例也会收到)
+func (s *Server) publishClusterEvent(ev clusterEvent) error {
+	data, err := json.Marshal(ev)
+	if err != nil {
+		return err
+	}
+	return s.svc.Store().Publish(clusterEventChannel, data)
+}
+
+// runClusterEvents 处理其他实例 (及当前实例) 发布的事件
+func (s *Server) runClusterEvents(events <-chan []byte) {
+	for data := range events {
+		var ev clusterEvent
+		if err := json.Unmarshal(data, &ev); err != nil {
+			continue
+		}
+		if ev.Instance != "" && ev.Instance != s.cfg.InstanceID {
+			continue
+		}
+
+		switch ev.Type {
+		case clusterEventAgentSend:
+			var data interface{}
+			if len(ev.Data) > 0 {
+				data = ev.Data
+			}
+			s.agentHub.Send(ev.Kind, ev.ID, ev.Message, data)
+		case clusterEventAgentPush:
+			// 只推送本实例上的连接，避免在实例间来回转发
+			if !s.agentHub.IsConnected(ev.Kind, ev.ID) {
+				continue
+			}
+			if ev.Kind == "node" {
+				s.pushNodeConfig(ev.ID)
+			} else if ev.Kind == "client" {
+				s.pushClientConfig(ev.ID)
+			}
+		case clusterEventAgentReconcile:
+			s.queueAgentReconcile()
+		case clusterEventRestored:
+			s.resetAfterRestore()
+		}
+	}
+}
+
+// sendToAgent 向 Agent 发送消息，Agent 连接在其他实例上时转发给该实例
+func (s *Server) sendToAgent(kind string, id uint, msgType string, data interface{}) bool {
+	if s.agentHub.Send(kind, id, msgType, data) {
+		return true
+	}
+	ev := clusterEvent{Type: clusterEventAgentSend, Kind: kind, ID: id, Message: msgType}
+	if data != nil {
+		raw, err := json.Marshal(data)
+		if err != nil {
+			return false
+		}
+		ev.Data = raw
+	}
+	return s.forwardToAgentOwner(ev)
+}
+
+// forwardToAgentOwner 将事件转发给 Agent 所连接的其他实例，Agent 不在线时返回 false
+func (s *Server) forwardToAgentOwner(ev clusterEvent) bool {
+	owner := s.agentHub.Owner(ev.Kind, ev.ID)
+	if owner == "" || owner == s.cfg.InstanceID {
+		return false
+	}
+	ev.Instance = owner
+	if err := s.publishClusterEvent(ev); err != nil {
+		log.Printf("Failed to forward %s to instance %s: %v", ev.Type, owner, err)
+		return false
+	}
+	return true
+}
+
+// getClusterStatus 查看多实例状态 (管理员)
+func (s *Server) getClusterStatus(c *gin.Context) {
+	_, isAdmin := getUserInfo(c)
+	if !isAdmin {
+		c.JSON(http.StatusForbidden, gin.H{"error": "admin only"})
+		return
+	}
+
+	elector := s.svc.Elector()
+	c.JSON(http.StatusOK, gin.H{
+		"instance_id":    s.cfg.InstanceID,
+		"store":          s.svc.Store().Name(),
+		"leader":         elector.Leader(),
+		"is_leader":      elector.IsLeader(),
+		"agent_channels": len(s.agentHub.Keys()),
+		"ws_clients":     s.wsHub.ClientCount(),
+	})
+}
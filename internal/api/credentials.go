@@ -0,0 +1,245 @@
+package api
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/AliceNetworks/gost-panel/internal/model"
+	"github.com/gin-gonic/gin"
+)
+
+// ==================== 用户代理凭据 ====================
+//
+// 共享节点上每个用户拥有独立的代理用户名/密码，合并到节点主服务的认证器中。
+// 管理员和节点所有者可为用户签发、停用凭据；用户可为公共节点、自己的节点或套餐包含的节点自助申请。
+// 凭据变更后立即推送节点配置，轮换或吊销单个用户不影响其他用户。
+
+// isNodeOwner 检查用户是否为节点所有者
+func isNodeOwner(node *model.Node, userID uint) bool {
+	return node.OwnerID != nil && *node.OwnerID == userID
+}
+
+// canManageNodeCredentials 管理员或节点所有者可管理节点上的凭据
+func (s *Server) canManageNodeCredentials(c *gin.Context, nodeID uint) bool {
+	userID, isAdmin := getUserInfo(c)
+	if isAdmin {
+		return true
+	}
+	node, err := s.svc.GetNode(nodeID)
+	return err == nil && isNodeOwner(node, userID)
+}
+
+// getCredentialForAction 获取凭据并检查权限，allowSelf 表示凭据持有人本人也可操作
+func (s *Server) getCredentialForAction(c *gin.Context, allowSelf bool) (*model.ProxyCredential, bool) {
+	id, _ := strconv.ParseUint(c.Param("id"), 10, 32)
+	cred, err := s.svc.GetProxyCredential(uint(id))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "credential not found"})
+		return nil, false
+	}
+
+	userID, _ := getUserInfo(c)
+	if s.canManageNodeCredentials(c, cred.NodeID) || (allowSelf && cred.UserID == userID) {
+		return cred, true
+	}
+
+	c.JSON(http.StatusForbidden, gin.H{"error": "无权操作此凭据"})
+	return nil, false
+}
+
+// listNodeCredentials 获取节点上的用户凭据
+func (s *Server) listNodeCredentials(c *gin.Context) {
+	id, _ := strconv.ParseUint(c.Param("id"), 10, 32)
+	if !s.canManageNodeCredentials(c, uint(id)) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "无权查看此节点的凭据"})
+		return
+	}
+
+	creds, err := s.svc.ListNodeCredentials(uint(id))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, creds)
+}
+
+// createNodeCredential 为指定用户签发节点凭据
+func (s *Server) createNodeCredential(c *gin.Context) {
+	id, _ := strconv.ParseUint(c.Param("id"), 10, 32)
+	if !s.canManageNodeCredentials(c, uint(id)) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "无权管理此节点的凭据"})
+		return
+	}
+
+	var req struct {
+		UserID uint `json:"user_id" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if _, err := s.svc.GetUser(req.UserID); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "user not found"})
+		return
+	}
+
+	cred, err := s.svc.CreateProxyCredential(uint(id), req.UserID)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	s.pushNodeConfig(cred.NodeID)
+	s.audit.LogSuccess(c, "create", "proxy_credential", cred.ID, fmt.Sprintf("node #%d, user #%d", cred.NodeID, cred.UserID))
+	c.JSON(http.StatusOK, cred)
+}
+
+// listMyCredentials 获取当前用户的凭据 (含节点连接信息)
+func (s *Server) listMyCredentials(c *gin.Context) {
+	userID, _ := getUserInfo(c)
+	creds, err := s.svc.ListUserCredentials(userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	result := make([]gin.H, 0, len(creds))
+	for _, cred := range creds {
+		item := gin.H{
+			"id":           cred.ID,
+			"node_id":      cred.NodeID,
+			"username":     cred.Username,
+			"password":     cred.Password,
+			"enabled":      cred.Enabled,
+			"traffic_in":   cred.TrafficIn,
+			"traffic_out":  cred.TrafficOut,
+			"last_used_at": cred.LastUsedAt,
+			"rotated_at":   cred.RotatedAt,
+			"created_at":   cred.CreatedAt,
+		}
+		if cred.Node != nil {
+			item["node_name"] = cred.Node.Name
+			item["host"] = cred.Node.Host
+			item["port"] = cred.Node.Port
+			item["protocol"] = cred.Node.Protocol
+		}
+		result = append(result, item)
+	}
+	c.JSON(http.StatusOK, result)
+}
+
+// createMyCredential 用户自助申请节点凭据
+func (s *Server) createMyCredential(c *gin.Context) {
+	userID, _ := getUserInfo(c)
+
+	var req struct {
+		NodeID uint `json:"node_id" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if !s.svc.CanUseNode(userID, req.NodeID) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "无权使用此节点"})
+		return
+	}
+
+	cred, err := s.svc.CreateProxyCredential(req.NodeID, userID)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	s.pushNodeConfig(cred.NodeID)
+	s.audit.LogSuccess(c, "create", "proxy_credential", cred.ID, fmt.Sprintf("node #%d", cred.NodeID))
+	c.JSON(http.StatusOK, cred)
+}
+
+// rotateCredential 轮换凭据密码
+func (s *Server) rotateCredential(c *gin.Context) {
+	cred, ok := s.getCredentialForAction(c, true)
+	if !ok {
+		return
+	}
+
+	rotated, err := s.svc.RotateProxyCredential(cred.ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	s.pushNodeConfig(cred.NodeID)
+	s.audit.LogSuccess(c, "rotate", "proxy_credential", cred.ID, "")
+	c.JSON(http.StatusOK, rotated)
+}
+
+// updateCredential 启用或停用凭据
+func (s *Server) updateCredential(c *gin.Context) {
+	cred, ok := s.getCredentialForAction(c, false)
+	if !ok {
+		return
+	}
+
+	var req struct {
+		Enabled *bool `json:"enabled" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err := s.svc.SetProxyCredentialEnabled(cred.ID, *req.Enabled); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	s.pushNodeConfig(cred.NodeID)
+	s.audit.LogSuccess(c, "update", "proxy_credential", cred.ID, fmt.Sprintf("enabled=%v", *req.Enabled))
+	c.JSON(http.StatusOK, gin.H{"success": true})
+}
+
+// deleteCredential 吊销凭据
+func (s *Server) deleteCredential(c *gin.Context) {
+	cred, ok := s.getCredentialForAction(c, true)
+	if !ok {
+		return
+	}
+
+	if err := s.svc.DeleteProxyCredential(cred.ID); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	s.pushNodeConfig(cred.NodeID)
+	s.audit.LogSuccess(c, "delete", "proxy_credential", cred.ID, fmt.Sprintf("node #%d, user #%d", cred.NodeID, cred.UserID))
+	c.JSON(http.StatusOK, gin.H{"success": true})
+}
+
+// agentAuth GOST HTTP 认证插件接口，由节点 Agent 转发 (签名或 Authorization: Bearer <AgentToken>)
+// 请求/响应格式与 GOST auther 插件一致: {"username","password","client"} -> {"ok","id"}
+func (s *Server) agentAuth(c *gin.Context) {
+	caller, err := s.authenticateAgent(c, "")
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	node, err := s.svc.GetNodeByToken(caller.Token)
+	if caller.Token == "" || err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "invalid token"})
+		return
+	}
+
+	var req struct {
+		Username string `json:"username"`
+		Password string `json:"password"`
+		Client   string `json:"client"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	id, ok := s.svc.AuthenticateProxyUser(node, req.Username, req.Password)
+	c.JSON(http.StatusOK, gin.H{"ok": ok, "id": id})
+}
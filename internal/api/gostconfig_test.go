@@ -0,0 +1,44 @@
+package api
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+
+	"github.com/AliceNetworks/gost-panel/internal/model"
+	"github.com/gin-gonic/gin"
+)
+
+// 下载的节点配置与 Agent 获取的字节一致，哈希与面板记录的相同
+func TestGetNodeGostConfigMatchesHash(t *testing.T) {
+	s, db := newTestServer(t)
+	node := model.Node{Name: "node", Host: "127.0.0.1", Port: 1080, APIPort: 18080, AgentToken: "node-token", Protocol: "socks5", Transport: "tcp", SpeedLimit: 1 << 20}
+	if err := db.Create(&node).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	c.Request = httptest.NewRequest(http.MethodGet, "/api/nodes/"+strconv.Itoa(int(node.ID))+"/gost-config", nil)
+	c.Params = gin.Params{{Key: "id", Value: strconv.Itoa(int(node.ID))}}
+	c.Set("role", "admin")
+	s.getNodeGostConfig(c)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("status = %d, want 200: %s", w.Code, w.Body)
+	}
+	sum := sha256.Sum256(w.Body.Bytes())
+	if got, want := hex.EncodeToString(sum[:]), s.svc.GetNodeConfigHash(node.ID); got != want {
+		t.Fatalf("downloaded config hash = %s, want %s", got, want)
+	}
+
+	agent := httptest.NewRecorder()
+	c, _ = gin.CreateTestContext(agent)
+	s.writeAgentConfig(c, s.svc.GenerateNodeFullConfig(&node))
+	if agent.Body.String() != w.Body.String() {
+		t.Fatalf("downloaded config differs from agent config:\n%s\nwant:\n%s", w.Body, agent.Body)
+	}
+}
@@ -2,8 +2,10 @@ package api
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
+	"log"
 	"net"
 	"net/http"
 	"os"
@@ -17,7 +19,9 @@ import (
 	"github.com/goccy/go-yaml"
 	"github.com/AliceNetworks/gost-panel/internal/gost"
 	"github.com/AliceNetworks/gost-panel/internal/model"
+	"github.com/AliceNetworks/gost-panel/internal/probe"
 	"github.com/AliceNetworks/gost-panel/internal/service"
+	"github.com/AliceNetworks/gost-panel/internal/signing"
 )
 
 // ==================== 辅助函数 ====================
@@ -152,6 +156,28 @@ type CreateNodeRequest struct {
 	ConnRateLimit int   `json:"conn_rate_limit"`
 	// DNS
 	DNSServer string `json:"dns_server"`
+	// 端到端探测
+	ProbeTarget     string `json:"probe_target"`
+	ProbeFromNodeID *uint  `json:"probe_from_node_id"`
+}
+
+// validateNodeProbe 校验节点的探测目标和探测来源 (来源节点需对当前用户可见)
+func (s *Server) validateNodeProbe(nodeID uint, target string, fromNodeID *uint, userID uint, isAdmin bool) error {
+	if target != "" {
+		if err := probe.ValidateTarget(target); err != nil {
+			return err
+		}
+	}
+	if fromNodeID == nil {
+		return nil
+	}
+	if *fromNodeID == nodeID {
+		return errors.New("a node cannot be its own probe source")
+	}
+	if _, err := s.svc.GetNodeByOwner(*fromNodeID, userID, isAdmin); err != nil {
+		return errors.New("probe source node not found")
+	}
+	return nil
 }
 
 func (s *Server) createNode(c *gin.Context) {
@@ -172,32 +198,39 @@ func (s *Server) createNode(c *gin.Context) {
 		}
 	}
 
+	if err := s.validateNodeProbe(0, req.ProbeTarget, req.ProbeFromNodeID, userID, isAdmin); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
 	node := &model.Node{
-		Name:           req.Name,
-		Host:           req.Host,
-		Port:           req.Port,
-		APIPort:        req.APIPort,
-		APIUser:        req.APIUser,
-		APIPass:        req.APIPass,
-		ProxyUser:      req.ProxyUser,
-		ProxyPass:      req.ProxyPass,
-		TrafficQuota:   req.TrafficQuota,
-		QuotaResetDay:  req.QuotaResetDay,
-		Protocol:       req.Protocol,
-		Transport:      req.Transport,
-		TransportOpts:  req.TransportOpts,
-		SSMethod:       req.SSMethod,
-		SSPassword:     req.SSPassword,
-		TLSEnabled:     req.TLSEnabled,
-		TLSCertFile:    req.TLSCertFile,
-		TLSKeyFile:     req.TLSKeyFile,
-		TLSSNI:         req.TLSSNI,
-		WSPath:         req.WSPath,
-		WSHost:         req.WSHost,
-		SpeedLimit:     req.SpeedLimit,
-		ConnRateLimit:  req.ConnRateLimit,
-		DNSServer:      req.DNSServer,
-		OwnerID:        &userID,
+		Name:            req.Name,
+		Host:            req.Host,
+		Port:            req.Port,
+		APIPort:         req.APIPort,
+		APIUser:         req.APIUser,
+		APIPass:         req.APIPass,
+		ProxyUser:       req.ProxyUser,
+		ProxyPass:       req.ProxyPass,
+		TrafficQuota:    req.TrafficQuota,
+		QuotaResetDay:   req.QuotaResetDay,
+		Protocol:        req.Protocol,
+		Transport:       req.Transport,
+		TransportOpts:   req.TransportOpts,
+		SSMethod:        req.SSMethod,
+		SSPassword:      req.SSPassword,
+		TLSEnabled:      req.TLSEnabled,
+		TLSCertFile:     req.TLSCertFile,
+		TLSKeyFile:      req.TLSKeyFile,
+		TLSSNI:          req.TLSSNI,
+		WSPath:          req.WSPath,
+		WSHost:          req.WSHost,
+		SpeedLimit:      req.SpeedLimit,
+		ConnRateLimit:   req.ConnRateLimit,
+		DNSServer:       req.DNSServer,
+		ProbeTarget:     req.ProbeTarget,
+		ProbeFromNodeID: req.ProbeFromNodeID,
+		OwnerID:         &userID,
 	}
 
 	// 默认值
@@ -244,8 +277,10 @@ func (s *Server) updateNode(c *gin.Context) {
 	// 不允许更新的字段
 	delete(updates, "id")
 	delete(updates, "agent_token")
+	delete(updates, "agent_version")
 	delete(updates, "created_at")
 	delete(updates, "owner_id")
+	stripQuotaState(updates, isAdmin)
 
 	// 密码字段为空时不更新，防止编辑时误覆盖已有密码
 	for _, key := range []string{"api_pass", "proxy_pass", "ss_password"} {
@@ -254,11 +289,35 @@ func (s *Server) updateNode(c *gin.Context) {
 		}
 	}
 
+	// 探测来源为 0 或 null 表示由面板发起
+	if v, ok := updates["probe_from_node_id"]; ok {
+		var fromNodeID *uint
+		if f, isNum := v.(float64); isNum && f > 0 {
+			from := uint(f)
+			fromNodeID = &from
+		}
+		target, _ := updates["probe_target"].(string)
+		if err := s.validateNodeProbe(uint(id), target, fromNodeID, userID, isAdmin); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		updates["probe_from_node_id"] = fromNodeID
+	} else if target, ok := updates["probe_target"].(string); ok {
+		if err := s.validateNodeProbe(uint(id), target, nil, userID, isAdmin); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+	}
+
 	if err := s.svc.UpdateNode(uint(id), updates); err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
 
+	// 配额调整后重新判断超限状态
+	s.svc.SyncQuotaStates()
+	s.pushNodeConfig(uint(id))
+
 	c.JSON(http.StatusOK, gin.H{"success": true})
 }
 
@@ -273,13 +332,39 @@ func (s *Server) deleteNode(c *gin.Context) {
 	}
 
 	if err := s.svc.DeleteNode(uint(id)); err != nil {
+		var inUse *service.NodeInUseError
+		if errors.As(err, &inUse) {
+			c.JSON(http.StatusConflict, nodeInUseResponse(inUse))
+			return
+		}
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
+	s.sendToAgent("node", uint(id), AgentMsgUninstall, s.svc.DecommissionCommand("node", uint(id)))
 
 	c.JSON(http.StatusOK, gin.H{"success": true})
 }
 
+// nodeInUseResponse 节点仍是隧道中转节点时的响应，列出受影响的隧道
+func nodeInUseResponse(err *service.NodeInUseError) gin.H {
+	names := make([]string, 0, len(err.Tunnels))
+	for _, t := range err.Tunnels {
+		names = append(names, t.Name)
+	}
+	return gin.H{
+		"error":   "节点是以下隧道的中转节点，请先从隧道中移除: " + strings.Join(names, ", "),
+		"tunnels": nodeInUseTunnels(err),
+	}
+}
+
+func nodeInUseTunnels(err *service.NodeInUseError) []gin.H {
+	tunnels := make([]gin.H, 0, len(err.Tunnels))
+	for _, t := range err.Tunnels {
+		tunnels = append(tunnels, gin.H{"id": t.ID, "name": t.Name})
+	}
+	return tunnels
+}
+
 // ==================== 批量操作 ====================
 
 // BatchOperationRequest 批量操作请求
@@ -305,18 +390,29 @@ func (s *Server) batchDeleteNodes(c *gin.Context) {
 
 	successCount := 0
 	failCount := 0
+	inUse := map[uint][]gin.H{} // 仍是隧道中转节点而未删除的节点及相关隧道
 	for _, id := range allowedIDs {
 		if err := s.svc.DeleteNode(id); err != nil {
 			failCount++
+			var e *service.NodeInUseError
+			if errors.As(err, &e) {
+				inUse[id] = nodeInUseTunnels(e)
+			}
 		} else {
+			s.sendToAgent("node", id, AgentMsgUninstall, s.svc.DecommissionCommand("node", id))
 			successCount++
 		}
 	}
 
+	message := fmt.Sprintf("成功删除 %d 个节点，失败 %d 个", successCount, failCount)
+	if len(inUse) > 0 {
+		message += fmt.Sprintf("，其中 %d 个是隧道的中转节点，请先从隧道中移除", len(inUse))
+	}
 	c.JSON(http.StatusOK, gin.H{
 		"success": successCount,
 		"failed":  failCount,
-		"message": fmt.Sprintf("成功删除 %d 个节点，失败 %d 个", successCount, failCount),
+		"in_use":  inUse,
+		"message": message,
 	})
 }
 
@@ -349,8 +445,7 @@ func (s *Server) batchSyncNodes(c *gin.Context) {
 			offlineCount++
 			continue
 		}
-		// 标记节点需要重新加载配置
-		s.svc.TouchNode(id)
+		s.pushNodeConfig(id)
 		successCount++
 	}
 
@@ -432,6 +527,7 @@ func (s *Server) batchDeleteClients(c *gin.Context) {
 		if err := s.svc.DeleteClient(id); err != nil {
 			failCount++
 		} else {
+			s.sendToAgent("client", id, AgentMsgUninstall, s.svc.DecommissionCommand("client", id))
 			successCount++
 		}
 	}
@@ -520,8 +616,7 @@ func (s *Server) batchSyncClients(c *gin.Context) {
 			offlineCount++
 			continue
 		}
-		// 标记客户端需要重新加载配置
-		s.svc.DB().Model(&model.Client{}).Where("id = ?", id).Update("updated_at", time.Now())
+		s.pushClientConfig(id)
 		successCount++
 	}
 
@@ -835,26 +930,24 @@ func (s *Server) syncNodeConfig(c *gin.Context) {
 	}
 
 	// 生成配置并自动保存版本快照
-	generator := gost.NewConfigGenerator()
-	bypasses, _ := s.svc.GetBypassesByNode(node.ID)
-	admissions, _ := s.svc.GetAdmissionsByNode(node.ID)
-	hostMappings, _ := s.svc.GetHostMappingsByNode(node.ID)
-	ingresses, _ := s.svc.GetIngressesByNode(node.ID)
-	config := generator.GenerateNodeConfigWithRules(node, bypasses, admissions, hostMappings, ingresses)
+	config := s.svc.GenerateNodeFullConfig(node)
 
 	// 将配置序列化为 YAML 字符串并保存版本
 	configYAML, err := yaml.Marshal(config)
 	if err == nil {
-		s.svc.SaveConfigVersion(uint(id), string(configYAML), "Auto-saved on sync")
+		hash, _ := gost.ConfigHash(config)
+		s.svc.SaveConfigVersion(uint(id), string(configYAML), hash, "Auto-saved on sync")
 		s.svc.CleanupOldVersions(uint(id), 20) // 保留最新 20 个版本
 	}
 
-	// 标记节点需要重新加载配置（通过更新 updated_at）
-	s.svc.TouchNode(uint(id))
+	// Agent 控制通道在线时立即推送
+	pushed := s.pushNodeConfig(uint(id))
 
 	// 根据节点状态返回不同提示
 	msg := "配置已更新，Agent 将在下次心跳时自动同步（最多 30 秒）"
-	if node.Status != "online" {
+	if pushed {
+		msg = "配置已推送到 Agent"
+	} else if node.Status != "online" {
 		msg = "配置已生成，Agent 上线后将自动加载最新配置"
 	}
 
@@ -874,15 +967,10 @@ func (s *Server) getNodeGostConfig(c *gin.Context) {
 		return
 	}
 
-	// 使用新的配置生成器
-	generator := gost.NewConfigGenerator()
-	bypasses, _ := s.svc.GetBypassesByNode(node.ID)
-	admissions, _ := s.svc.GetAdmissionsByNode(node.ID)
-	hostMappings, _ := s.svc.GetHostMappingsByNode(node.ID)
-	ingresses, _ := s.svc.GetIngressesByNode(node.ID)
-	config := generator.GenerateNodeConfigWithRules(node, bypasses, admissions, hostMappings, ingresses)
+	// 生成完整合并配置，与 Agent 下载的字节一致 (哈希可对照)
+	config := s.svc.GenerateNodeFullConfig(node)
 
-	c.YAML(http.StatusOK, config)
+	s.writeAgentConfig(c, config)
 }
 
 func (s *Server) getNodeInstallScript(c *gin.Context) {
@@ -898,13 +986,14 @@ func (s *Server) getNodeInstallScript(c *gin.Context) {
 
 	// 获取正确的 Panel URL（支持反向代理）
 	panelURL := s.getPanelURL(c)
+	token := s.installToken(c, "node", node.ID, node.AgentToken)
 	githubRaw := s.cfg.GitHubRawURL
 
 	var script, oneLineCommand string
 
 	if osType == "windows" {
 		// PowerShell 安装命令
-		oneLineCommand = fmt.Sprintf(`irm "%s/install-node.ps1" -OutFile "$env:TEMP\install-node.ps1"; & "$env:TEMP\install-node.ps1" -PanelUrl "%s" -Token "%s"`, githubRaw, panelURL, node.AgentToken)
+		oneLineCommand = fmt.Sprintf(`irm "%s/install-node.ps1" -OutFile "$env:TEMP\install-node.ps1"; & "$env:TEMP\install-node.ps1" -PanelUrl "%s" -Token "%s"`, githubRaw, panelURL, token)
 		script = fmt.Sprintf(`# GOST Panel Node Installation for Windows
 # Run in PowerShell as Administrator
 
@@ -913,7 +1002,7 @@ func (s *Server) getNodeInstallScript(c *gin.Context) {
 `, oneLineCommand)
 	} else {
 		// Bash 安装命令
-		oneLineCommand = fmt.Sprintf(`(curl -fsSL "%s/install-node.sh" 2>/dev/null || wget -qO- "%s/install-node.sh") | bash -s -- -p "%s" -t "%s"`, githubRaw, githubRaw, panelURL, node.AgentToken)
+		oneLineCommand = fmt.Sprintf(`(curl -fsSL "%s/install-node.sh" 2>/dev/null || wget -qO- "%s/install-node.sh") | bash -s -- -p "%s" -t "%s"`, githubRaw, githubRaw, panelURL, token)
 		script = fmt.Sprintf(`#!/bin/bash
 # GOST Panel Node Installation
 # Supported: Linux (amd64, arm64, armv7, armv6, mips, mipsle)
@@ -923,7 +1012,7 @@ func (s *Server) getNodeInstallScript(c *gin.Context) {
 
 # Or with forced architecture (for cross-compilation):
 # (curl -fsSL "%s/install-node.sh" 2>/dev/null || wget -qO- "%s/install-node.sh") | bash -s -- -p "%s" -t "%s" -a armv6
-`, oneLineCommand, githubRaw, githubRaw, panelURL, node.AgentToken)
+`, oneLineCommand, githubRaw, githubRaw, panelURL, token)
 	}
 
 	c.JSON(http.StatusOK, gin.H{
@@ -1057,8 +1146,10 @@ func (s *Server) updateClient(c *gin.Context) {
 
 	delete(updates, "id")
 	delete(updates, "token")
+	delete(updates, "agent_version")
 	delete(updates, "created_at")
 	delete(updates, "owner_id")
+	stripQuotaState(updates, isAdmin)
 
 	// 密码字段为空时不更新，防止编辑时误覆盖已有密码
 	if v, ok := updates["proxy_pass"]; ok && v == "" {
@@ -1070,6 +1161,10 @@ func (s *Server) updateClient(c *gin.Context) {
 		return
 	}
 
+	// 配额调整后重新判断超限状态
+	s.svc.SyncQuotaStates()
+	s.pushClientConfig(uint(id))
+
 	c.JSON(http.StatusOK, gin.H{"success": true})
 }
 
@@ -1087,6 +1182,7 @@ func (s *Server) deleteClient(c *gin.Context) {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
+	s.sendToAgent("client", uint(id), AgentMsgUninstall, s.svc.DecommissionCommand("client", uint(id)))
 
 	c.JSON(http.StatusOK, gin.H{"success": true})
 }
@@ -1104,13 +1200,14 @@ func (s *Server) getClientInstallScript(c *gin.Context) {
 
 	// 获取正确的 Panel URL（支持反向代理）
 	panelURL := s.getPanelURL(c)
+	token := s.installToken(c, "client", client.ID, client.Token)
 	githubRaw := s.cfg.GitHubRawURL
 
 	var script, oneLineCommand string
 
 	if osType == "windows" {
 		// PowerShell 安装命令
-		oneLineCommand = fmt.Sprintf(`irm "%s/install-client.ps1" -OutFile "$env:TEMP\install-client.ps1"; & "$env:TEMP\install-client.ps1" -PanelUrl "%s" -Token "%s"`, githubRaw, panelURL, client.Token)
+		oneLineCommand = fmt.Sprintf(`irm "%s/install-client.ps1" -OutFile "$env:TEMP\install-client.ps1"; & "$env:TEMP\install-client.ps1" -PanelUrl "%s" -Token "%s"`, githubRaw, panelURL, token)
 		script = fmt.Sprintf(`# GOST Panel Client Installation for Windows
 # Run in PowerShell as Administrator
 
@@ -1122,7 +1219,7 @@ func (s *Server) getClientInstallScript(c *gin.Context) {
 `, client.Name, client.LocalPort, oneLineCommand)
 	} else {
 		// Bash 安装命令
-		oneLineCommand = fmt.Sprintf(`(curl -fsSL "%s/install-client.sh" 2>/dev/null || wget -qO- "%s/install-client.sh") | bash -s -- -p "%s" -t "%s"`, githubRaw, githubRaw, panelURL, client.Token)
+		oneLineCommand = fmt.Sprintf(`(curl -fsSL "%s/install-client.sh" 2>/dev/null || wget -qO- "%s/install-client.sh") | bash -s -- -p "%s" -t "%s"`, githubRaw, githubRaw, panelURL, token)
 		script = fmt.Sprintf(`#!/bin/bash
 # GOST Panel Client Installation (Agent Mode)
 # Supported: Linux (amd64, arm64, armv7, armv6, mips, mipsle)
@@ -1135,13 +1232,13 @@ func (s *Server) getClientInstallScript(c *gin.Context) {
 
 # Or with forced architecture:
 # (curl -fsSL "%s/install-client.sh" 2>/dev/null || wget -qO- "%s/install-client.sh") | bash -s -- -p "%s" -t "%s" -a armv6
-`, client.Name, client.LocalPort, oneLineCommand, githubRaw, githubRaw, panelURL, client.Token)
+`, client.Name, client.LocalPort, oneLineCommand, githubRaw, githubRaw, panelURL, token)
 	}
 
 	c.JSON(http.StatusOK, gin.H{
 		"script":           script,
 		"one_line_command": oneLineCommand,
-		"token":            client.Token,
+		"token":            token,
 	})
 }
 
@@ -1156,7 +1253,7 @@ func (s *Server) getClientGostConfig(c *gin.Context) {
 	}
 
 	config := s.generateClientConfig(client)
-	c.YAML(http.StatusOK, config)
+	s.writeAgentConfig(c, config)
 }
 
 func (s *Server) getClientProxyURI(c *gin.Context) {
@@ -1293,142 +1390,270 @@ func (s *Server) generateClientConfig(client *model.Client) map[string]interface
 		},
 	}
 
+	// 客户端或其所有者流量超限
+	if s.svc.IsClientQuotaExceeded(client) {
+		gost.ApplyQuotaPolicy(config, s.svc.GetQuotaPolicy())
+	}
+
 	return config
 }
 
+// stripQuotaState 移除不允许直接修改的配额状态字段
+// 超限状态由配额同步计算，已用流量只有管理员可以修改
+func stripQuotaState(updates map[string]interface{}, isAdmin bool) {
+	delete(updates, "quota_exceeded")
+	if !isAdmin {
+		delete(updates, "quota_used")
+		delete(updates, "quota_reset_at")
+	}
+}
+
 // ==================== Agent 接口 ====================
 
 type AgentRegisterRequest struct {
-	Token   string `json:"token" binding:"required"`
-	Type    string `json:"type"` // node/client
-	Version string `json:"version"`
+	Token        string `json:"token"`      // 节点/客户端 Token 或加入令牌 (已登记密钥的 Agent 不再发送)
+	PublicKey    string `json:"public_key"` // 要登记的 Agent 公钥 (请求须用对应私钥签名)
+	Type         string `json:"type"`       // node/client
+	Version      string `json:"version"`
+	UpdateFailed string `json:"update_failed"` // 更新后未能按时注册而回滚的版本
+	UpdateError  string `json:"update_error"`  // 回滚原因
+	AuthListen   string `json:"auth_listen"`   // 节点 Agent 本地认证插件地址 ("off" 表示未启用，旧 Agent 不上报)
 }
 
 func (s *Server) agentRegister(c *gin.Context) {
+	publicKey, err := s.verifyAgentRequest(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
 	var req AgentRegisterRequest
 	if err := c.ShouldBindJSON(&req); err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
+	if publicKey == "" && req.Token == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "token required"})
+		return
+	}
+
+	caller := s.resolveAgent(publicKey, req.Token)
+	// 新密钥: 用加入令牌或尚未登记密钥的 Token 登记，请求必须由该密钥签名
+	if publicKey != "" && caller.Token == "" && req.Token != "" {
+		if req.PublicKey != publicKey {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "public key does not match request signature"})
+			return
+		}
+		kind, id, err := s.svc.EnrollAgent(req.Token, publicKey)
+		switch {
+		case err == nil:
+			log.Printf("Agent key enrolled for %s #%d", kind, id)
+			caller = s.resolveAgent(publicKey, "")
+		case errors.Is(err, service.ErrAgentTokenUnknown):
+			// 未知 Token (可能属于已删除的节点/客户端)
+			caller.Credential = req.Token
+		default:
+			c.JSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
+			return
+		}
+	}
+	enrolled := publicKey != "" && caller.Token != ""
 
 	// 尝试查找节点
-	node, err := s.svc.GetNodeByToken(req.Token)
-	if err == nil {
+	node, err := s.svc.GetNodeByToken(caller.Token)
+	if caller.Token != "" && err == nil {
 		s.svc.UpdateNodeStatus(node.ID, "online", 0, 0, 0)
+		s.svc.SetAgentVersion("node", node.ID, node.AgentVersion, req.Version)
+		s.svc.SetAgentAuthListen(node.ID, node.AgentAuthListen, req.AuthListen)
+		s.reportAgentRollback("node", node.ID, node.Name, &req)
 		c.JSON(http.StatusOK, gin.H{
-			"type":    "node",
-			"id":      node.ID,
-			"message": "registered",
+			"type":        "node",
+			"id":          node.ID,
+			"message":     "registered",
+			"channel_url": s.getAgentChannelURL(c),
+			"panel_key":   s.svc.PanelPublicKey(),
+			"enrolled":    enrolled,
+			"auth_token":  node.AgentToken, // GOST 调用本地认证插件时使用 (配置中的插件 token)
 		})
 		return
 	}
 
 	// 尝试查找客户端
-	client, err := s.svc.GetClientByToken(req.Token)
-	if err == nil {
+	client, err := s.svc.GetClientByToken(caller.Token)
+	if caller.Token != "" && err == nil {
 		s.svc.UpdateClient(client.ID, map[string]interface{}{"status": "online", "last_seen": time.Now()})
+		s.svc.SetAgentVersion("client", client.ID, client.AgentVersion, req.Version)
+		s.reportAgentRollback("client", client.ID, client.Name, &req)
 		c.JSON(http.StatusOK, gin.H{
-			"type":    "client",
-			"id":      client.ID,
-			"message": "registered",
+			"type":        "client",
+			"id":          client.ID,
+			"message":     "registered",
+			"channel_url": s.getAgentChannelURL(c),
+			"panel_key":   s.svc.PanelPublicKey(),
+			"enrolled":    enrolled,
 		})
 		return
 	}
 
-	c.JSON(http.StatusUnauthorized, gin.H{"error": "invalid token"})
+	c.JSON(http.StatusUnauthorized, s.agentTokenRejection(caller.Credential))
+}
+
+// agentTokenRejection 无法识别凭据 (Token 或已登记的公钥) 时的响应。
+// 只有确实由面板删除的 Agent 才会收到签名的卸载命令；其他未知凭据
+// (面板恢复了旧备份、Agent 连错了面板、凭据已吊销等) 只返回错误，Agent 进入孤立状态而不会卸载
+func (s *Server) agentTokenRejection(credential string) gin.H {
+	if credential == "" {
+		return gin.H{"error": "invalid token"}
+	}
+	if cmd := s.svc.DecommissionCommandByToken(credential); cmd != nil {
+		return gin.H{
+			"error":        "agent decommissioned",
+			"uninstall":    true,
+			"decommission": cmd,
+		}
+	}
+	return gin.H{"error": "invalid token"}
+}
+
+// reportAgentRollback Agent 更新后未能按时重新注册并已回滚到旧版本时发送告警
+func (s *Server) reportAgentRollback(kind string, id uint, name string, req *AgentRegisterRequest) {
+	if req.UpdateFailed == "" {
+		return
+	}
+	log.Printf("Agent %s %s rolled back from %s to %s: %s", kind, name, req.UpdateFailed, req.Version, req.UpdateError)
+	s.svc.GetAlertService().TriggerAlert("agent_update", kind, id, name,
+		fmt.Sprintf("Agent 更新失败并已自动回滚\n%s: %s\n失败版本: %s\n当前版本: %s\n原因: %s",
+			kind, name, req.UpdateFailed, req.Version, req.UpdateError))
 }
 
 type AgentHeartbeatRequest struct {
-	Token        string                       `json:"token" binding:"required"`
+	Token        string                       `json:"token"` // 已登记密钥的 Agent 通过签名认证，不发送 Token
 	Connections  int                          `json:"connections"`
 	TrafficIn    int64                        `json:"traffic_in"`
 	TrafficOut   int64                        `json:"traffic_out"`
 	ConfigHash   string                       `json:"config_hash"`   // 当前配置的哈希值
 	AgentVersion string                       `json:"agent_version"` // Agent 版本
 	ServiceStats map[string]map[string]int64  `json:"service_stats"` // 按服务名分类的统计
+	UserStats    map[string]map[string]int64  `json:"user_stats"`    // 按认证用户名分类的统计
+	StatsEpoch   string                       `json:"stats_epoch"`   // 统计序号所属的 epoch
+	StatsSeq     uint64                       `json:"stats_seq"`     // 统计序号 (0 表示旧 Agent，不去重)
 }
 
 func (s *Server) agentHeartbeat(c *gin.Context) {
+	publicKey, err := s.verifyAgentRequest(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
 	var req AgentHeartbeatRequest
 	if err := c.ShouldBindJSON(&req); err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
 
+	caller := s.resolveAgent(publicKey, req.Token)
+	req.Token = caller.Token
+	resp, ok := s.processAgentHeartbeat(&req, caller.Credential)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, resp)
+		return
+	}
+	c.JSON(http.StatusOK, resp)
+}
+
+// processAgentHeartbeat 处理心跳数据 (HTTP 心跳与控制通道共用)。
+// req.Token 为已认证的节点/客户端 Token，无法识别时返回 false 和按 credential 生成的拒绝响应
+func (s *Server) processAgentHeartbeat(req *AgentHeartbeatRequest, credential string) (gin.H, bool) {
+	if req.Token == "" {
+		return s.agentTokenRejection(credential), false
+	}
+
 	// 尝试更新节点
 	node, err := s.svc.GetNodeByToken(req.Token)
 	if err == nil {
+		statsAck := s.applyHeartbeatStats("node", node.ID, req)
 		s.svc.UpdateNodeStatus(node.ID, "online", req.Connections, req.TrafficIn, req.TrafficOut)
+		s.svc.SetAgentVersion("node", node.ID, node.AgentVersion, req.AgentVersion)
+		// 重新获取 (流量可能已在入账统计时更新)
+		if updated, err := s.svc.GetNode(node.ID); err == nil {
+			node = updated
+		}
 		// 广播节点状态更新
-		s.BroadcastNodeStatus(node.ID, "online", req.Connections, node.TrafficIn+req.TrafficIn, node.TrafficOut+req.TrafficOut)
+		s.BroadcastNodeStatus(node.ID, "online", req.Connections, node.TrafficIn, node.TrafficOut)
 
 		// 处理服务级别统计 (隧道流量)
 		if req.ServiceStats != nil {
 			s.processServiceStats(node.ID, req.ServiceStats)
 		}
+		// 处理认证用户级别统计 (共享节点上的用户流量)
+		if req.UserStats != nil {
+			s.processUserStats(node.ID, req.UserStats)
+		}
+		if req.ConfigHash != "" {
+			s.agentHub.SetConfigHash("node", node.ID, req.ConfigHash)
+		}
 
 		// 检查配置是否需要更新
 		reloadConfig := false
 		if req.ConfigHash != "" {
 			// 计算当前节点配置的哈希值
 			currentHash := s.svc.GetNodeConfigHash(node.ID)
-			if currentHash != req.ConfigHash {
+			if currentHash != req.ConfigHash && !agentConfigRejected(node.ConfigStatus, node.ConfigStatusHash, currentHash) {
 				reloadConfig = true
 			}
 		}
 
 		// 检查 Agent 是否需要更新
-		needsUpdate, forceUpdate := s.checkAgentNeedsUpdate(req.AgentVersion)
+		needsUpdate, forceUpdate := s.checkAgentNeedsUpdate("node", node.ID, req.AgentVersion)
 
-		c.JSON(http.StatusOK, gin.H{
+		return withStatsAck(gin.H{
 			"status":        "ok",
 			"reload_config": reloadConfig,
 			"needs_update":  needsUpdate,
 			"force_update":  forceUpdate,
-		})
-		return
+		}, statsAck), true
 	}
 
 	// 尝试更新客户端
 	client, err := s.svc.GetClientByToken(req.Token)
 	if err == nil {
-		s.svc.UpdateClient(client.ID, map[string]interface{}{
-			"status":      "online",
-			"last_seen":   time.Now(),
-			"traffic_in":  client.TrafficIn + req.TrafficIn,
-			"traffic_out": client.TrafficOut + req.TrafficOut,
-		})
+		statsAck := s.applyHeartbeatStats("client", client.ID, req)
+		s.svc.UpdateClientStatus(client.ID, "online", req.TrafficIn, req.TrafficOut)
+		s.svc.SetAgentVersion("client", client.ID, client.AgentVersion, req.AgentVersion)
+		if req.ConfigHash != "" {
+			s.agentHub.SetConfigHash("client", client.ID, req.ConfigHash)
+		}
+
+		// 重新获取 (流量配额状态可能已变化)
+		if updated, err := s.svc.GetClient(client.ID); err == nil {
+			client = updated
+		}
 
 		// 检查配置是否需要更新（包括关联节点的密码变更）
 		reloadConfig := false
 		if req.ConfigHash != "" {
-			currentHash := s.svc.GetClientConfigHash(client.ID)
-			if currentHash != req.ConfigHash {
+			currentHash, _ := gost.ConfigHash(s.generateClientConfig(client))
+			if currentHash != req.ConfigHash && !agentConfigRejected(client.ConfigStatus, client.ConfigStatusHash, currentHash) {
 				reloadConfig = true
 			}
 		}
 
 		// 检查 Agent 是否需要更新
-		needsUpdate, forceUpdate := s.checkAgentNeedsUpdate(req.AgentVersion)
+		needsUpdate, forceUpdate := s.checkAgentNeedsUpdate("client", client.ID, req.AgentVersion)
 
-		c.JSON(http.StatusOK, gin.H{
+		return withStatsAck(gin.H{
 			"status":        "ok",
 			"reload_config": reloadConfig,
 			"needs_update":  needsUpdate,
 			"force_update":  forceUpdate,
-		})
-		return
+		}, statsAck), true
 	}
 
-	// Token 无效，通知 Agent 卸载自己
-	c.JSON(http.StatusUnauthorized, gin.H{
-		"error":     "invalid token",
-		"uninstall": true,
-	})
+	// Token 无效: 已删除的 Agent 收到签名的卸载命令，未知 Token 只返回错误
+	return s.agentTokenRejection(credential), false
 }
 
-// checkAgentNeedsUpdate 检查 Agent 是否需要更新
-func (s *Server) checkAgentNeedsUpdate(clientVersion string) (needsUpdate, forceUpdate bool) {
+// checkAgentNeedsUpdate 检查 Agent 是否需要更新 (不在灰度范围内的 Agent 暂不更新)
+func (s *Server) checkAgentNeedsUpdate(kind string, id uint, clientVersion string) (needsUpdate, forceUpdate bool) {
 	if clientVersion == "" {
 		return false, false
 	}
@@ -1440,7 +1665,8 @@ func (s *Server) checkAgentNeedsUpdate(clientVersion string) (needsUpdate, force
 	}
 
 	// 比较版本
-	needsUpdate = compareVersions(clientVersion, CurrentAgentVersion) < 0
+	needsUpdate = signing.CompareVersions(clientVersion, CurrentAgentVersion) < 0 &&
+		s.svc.AgentUpdateEligible(kind, id, CurrentAgentVersion)
 
 	// 检查是否强制更新
 	if needsUpdate {
@@ -1453,17 +1679,50 @@ func (s *Server) checkAgentNeedsUpdate(clientVersion string) (needsUpdate, force
 
 // processServiceStats 处理按服务分类的流量统计
 func (s *Server) processServiceStats(nodeID uint, stats map[string]map[string]int64) {
+	for _, r := range serviceTraffic(stats) {
+		switch r.Type {
+		case model.TrafficResourceTunnel:
+			s.svc.UpdateTunnelTraffic(r.ID, r.TrafficIn, r.TrafficOut)
+		case model.TrafficResourceClient:
+			s.svc.UpdateClientTraffic(r.ID, r.TrafficIn, r.TrafficOut)
+		case model.TrafficResourcePortForward:
+			s.svc.UpdatePortForwardTraffic(r.ID, r.TrafficIn, r.TrafficOut)
+		}
+	}
+}
+
+// serviceTraffic 按服务名解析隧道、客户端或端口转发的流量
+func serviceTraffic(stats map[string]map[string]int64) []service.ResourceTraffic {
+	var resources []service.ResourceTraffic
 	for serviceName, serviceStats := range stats {
-		trafficIn := serviceStats["traffic_in"]
-		trafficOut := serviceStats["traffic_out"]
+		r := service.ResourceTraffic{
+			TrafficIn:  serviceStats["traffic_in"],
+			TrafficOut: serviceStats["traffic_out"],
+		}
 
-		// 解析服务名，匹配隧道或客户端
+		// 解析服务名，匹配隧道、客户端或端口转发
 		// 隧道服务名格式: tunnel-{id}-tcp, tunnel-{id}-udp, tunnel-{id}
 		// 客户端服务名格式: rtcp-tunnel, rudp-tunnel, client-{id}
+		// 端口转发服务名格式: forward-{id}
 		if tunnelID := parseTunnelID(serviceName); tunnelID > 0 {
-			s.svc.UpdateTunnelTraffic(uint(tunnelID), trafficIn, trafficOut)
+			r.Type, r.ID = model.TrafficResourceTunnel, uint(tunnelID)
 		} else if clientID := parseClientID(serviceName); clientID > 0 {
-			s.svc.UpdateClientTraffic(uint(clientID), trafficIn, trafficOut)
+			r.Type, r.ID = model.TrafficResourceClient, uint(clientID)
+		} else if forwardID := parsePortForwardID(serviceName); forwardID > 0 {
+			r.Type, r.ID = model.TrafficResourcePortForward, uint(forwardID)
+		} else {
+			continue
+		}
+		resources = append(resources, r)
+	}
+	return resources
+}
+
+// processUserStats 处理按认证用户名分类的流量统计，计入对应凭据的持有人
+func (s *Server) processUserStats(nodeID uint, stats map[string]map[string]int64) {
+	for username, userStats := range stats {
+		if err := s.svc.ChargeCredentialTraffic(nodeID, username, userStats["traffic_in"], userStats["traffic_out"]); err != nil {
+			log.Printf("Failed to charge traffic of %s on node %d: %v", username, nodeID, err)
 		}
 	}
 }
@@ -1493,34 +1752,57 @@ func parseClientID(serviceName string) int {
 	return 0
 }
 
+// parsePortForwardID 从服务名解析端口转发ID
+func parsePortForwardID(serviceName string) int {
+	var id int
+	if n, _ := fmt.Sscanf(serviceName, "forward-%d", &id); n == 1 {
+		return id
+	}
+	return 0
+}
+
+// agentGetConfig 下载配置: 已登记密钥的 Agent 使用签名的 GET /agent/config，
+// 旧 Agent 使用 /agent/config/:token
 func (s *Server) agentGetConfig(c *gin.Context) {
-	token := c.Param("token")
+	caller, err := s.authenticateAgent(c, c.Param("token"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	token := caller.Token
+	if token == "" {
+		c.JSON(http.StatusNotFound, gin.H{"error": "not found"})
+		return
+	}
 
 	// 尝试查找节点
 	node, err := s.svc.GetNodeByToken(token)
 	if err == nil {
-		// 使用 ConfigGenerator 生成完整配置（包含规则）
-		generator := gost.NewConfigGenerator()
-		bypasses, _ := s.svc.GetBypassesByNode(node.ID)
-		admissions, _ := s.svc.GetAdmissionsByNode(node.ID)
-		hostMappings, _ := s.svc.GetHostMappingsByNode(node.ID)
-		ingresses, _ := s.svc.GetIngressesByNode(node.ID)
-		config := generator.GenerateNodeConfigWithRules(node, bypasses, admissions, hostMappings, ingresses)
-		c.YAML(http.StatusOK, config)
+		// 生成完整合并配置（规则、隧道入口、端口转发等）
+		s.writeAgentConfig(c, s.svc.GenerateNodeFullConfig(node))
 		return
 	}
 
 	// 尝试查找客户端
 	client, err := s.svc.GetClientByToken(token)
 	if err == nil {
-		config := s.generateClientConfig(client)
-		c.YAML(http.StatusOK, config)
+		s.writeAgentConfig(c, s.generateClientConfig(client))
 		return
 	}
 
 	c.JSON(http.StatusNotFound, gin.H{"error": "not found"})
 }
 
+// writeAgentConfig 按字节输出配置，保证 Agent 落盘内容与面板计算哈希时一致
+func (s *Server) writeAgentConfig(c *gin.Context, config map[string]interface{}) {
+	data, err := gost.MarshalConfig(config)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to serialize config"})
+		return
+	}
+	c.Data(http.StatusOK, "application/x-yaml; charset=utf-8", data)
+}
+
 // ==================== GOST 操作 ====================
 
 // ==================== 用户管理 ====================
@@ -1617,12 +1899,22 @@ func (s *Server) updateUser(c *gin.Context) {
 	// 防止篡改敏感字段
 	delete(updates, "id")
 	delete(updates, "created_at")
+	stripQuotaState(updates, isAdmin)
 
 	if err := s.svc.UpdateUser(uint(id), updates); err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
 
+	// 配额调整后重新判断超限状态，状态变化时自动推送到 Agent
+	if _, ok := updates["traffic_quota"]; ok {
+		s.svc.SyncQuotaStates()
+	}
+	// 启用/停用用户会影响其代理凭据是否生效
+	if _, ok := updates["enabled"]; ok {
+		s.requestAgentReconcile()
+	}
+
 	c.JSON(http.StatusOK, gin.H{"success": true})
 }
 
@@ -1639,6 +1931,8 @@ func (s *Server) deleteUser(c *gin.Context) {
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
+	// 用户的代理凭据已随之删除，更新相关节点配置
+	s.requestAgentReconcile()
 
 	c.JSON(http.StatusOK, gin.H{"success": true})
 }
@@ -1898,40 +2192,136 @@ func (s *Server) disable2FA(c *gin.Context) {
 
 // ==================== 流量历史 ====================
 
+// getTrafficHistory 查询流量时间序列 (每个点为该时间段内的增量)
+// 时间范围使用 from/to (RFC3339 或 Unix 秒)，未指定时取最近 hours 小时；resolution 可选 minute/hour/day
 func (s *Server) getTrafficHistory(c *gin.Context) {
 	userID, isAdmin := getUserInfo(c)
-	hoursStr := c.DefaultQuery("hours", "1")
-	hours, _ := strconv.Atoi(hoursStr)
-
-	nodeIDStr := c.Query("node_id")
-	var nodeID *uint
-	if nodeIDStr != "" {
-		id, err := strconv.ParseUint(nodeIDStr, 10, 32)
-		if err == nil {
-			uid := uint(id)
-			// Verify ownership of the node
-			if _, err := s.svc.GetNodeByOwner(uid, userID, isAdmin); err != nil {
-				c.JSON(http.StatusNotFound, gin.H{"error": "节点不存在"})
-				return
-			}
-			nodeID = &uid
+
+	resolution := c.Query("resolution")
+	if !service.ValidTrafficResolution(resolution) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid resolution"})
+		return
+	}
+	from, to, err := parseTimeRange(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	// 资源筛选: resource_type + resource_id，node_id 等同于 resource_type=node
+	// 未指定时管理员查看全站流量，普通用户查看自己的流量
+	resourceType := c.Query("resource_type")
+	resourceIDStr := c.Query("resource_id")
+	if nodeIDStr := c.Query("node_id"); nodeIDStr != "" && resourceType == "" {
+		resourceType, resourceIDStr = model.TrafficResourceNode, nodeIDStr
+	}
+	if resourceType == "" {
+		resourceType = model.TrafficResourceUser
+		if isAdmin {
+			resourceType = model.TrafficResourceTotal
+		}
+	}
+	var resourceID uint
+	if resourceIDStr != "" {
+		id, err := strconv.ParseUint(resourceIDStr, 10, 32)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid resource_id"})
+			return
+		}
+		resourceID = uint(id)
+	}
+
+	switch resourceType {
+	case model.TrafficResourceTotal:
+		if !isAdmin {
+			c.JSON(http.StatusForbidden, gin.H{"error": "admin only"})
+			return
+		}
+		resourceID = 0
+	case model.TrafficResourceUser:
+		if resourceID == 0 {
+			resourceID = userID
+		}
+		if !isAdmin && resourceID != userID {
+			c.JSON(http.StatusForbidden, gin.H{"error": "无权查看其他用户的流量"})
+			return
+		}
+	case model.TrafficResourceNode, model.TrafficResourceTunnel, model.TrafficResourceClient, model.TrafficResourcePortForward:
+		if resourceID == 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "resource_id is required"})
+			return
+		}
+		if !s.canViewTrafficResource(resourceType, resourceID, userID, isAdmin) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "资源不存在"})
+			return
 		}
-	} else if !isAdmin {
-		// Non-admin without node_id: only show their own nodes' traffic
-		// For simplicity, return empty if no node_id specified for non-admin
-		c.JSON(http.StatusOK, []interface{}{})
+	default:
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid resource_type"})
 		return
 	}
 
-	history, err := s.svc.GetTrafficHistory(nodeID, hours)
+	history, err := s.svc.GetTrafficSeries(resourceType, resourceID, from, to, resolution)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
 
 	c.JSON(http.StatusOK, history)
 }
 
+// canViewTrafficResource 检查用户是否可查看节点/隧道/客户端/端口转发的流量
+func (s *Server) canViewTrafficResource(resourceType string, id, userID uint, isAdmin bool) bool {
+	var err error
+	switch resourceType {
+	case model.TrafficResourceNode:
+		_, err = s.svc.GetNodeByOwner(id, userID, isAdmin)
+	case model.TrafficResourceTunnel:
+		_, err = s.svc.GetTunnelByOwner(id, userID, isAdmin)
+	case model.TrafficResourceClient:
+		_, err = s.svc.GetClientByOwner(id, userID, isAdmin)
+	case model.TrafficResourcePortForward:
+		_, err = s.svc.GetPortForwardByOwner(id, userID, isAdmin)
+	default:
+		return false
+	}
+	return err == nil
+}
+
+// parseTimeRange 解析查询时间范围: from/to 或最近 hours 小时 (默认 1 小时)
+func parseTimeRange(c *gin.Context) (time.Time, time.Time, error) {
+	now := time.Now()
+	to := now.Truncate(time.Minute).Add(time.Minute)
+	if v := c.Query("to"); v != "" {
+		t, err := parseTimeParam(v)
+		if err != nil {
+			return time.Time{}, time.Time{}, fmt.Errorf("invalid to: %w", err)
+		}
+		to = t
+	}
+
+	if v := c.Query("from"); v != "" {
+		from, err := parseTimeParam(v)
+		if err != nil {
+			return time.Time{}, time.Time{}, fmt.Errorf("invalid from: %w", err)
+		}
+		return from, to, nil
+	}
+
+	hours, _ := strconv.Atoi(c.DefaultQuery("hours", "1"))
+	if hours <= 0 {
+		hours = 1
+	}
+	return to.Add(-time.Duration(hours) * time.Hour), to, nil
+}
+
+// parseTimeParam 解析 RFC3339 或 Unix 秒格式的时间
+func parseTimeParam(v string) (time.Time, error) {
+	if sec, err := strconv.ParseInt(v, 10, 64); err == nil {
+		return time.Unix(sec, 0), nil
+	}
+	return time.Parse(time.RFC3339, v)
+}
+
 // ==================== 通知渠道管理 ====================
 
 func (s *Server) listNotifyChannels(c *gin.Context) {
@@ -2961,7 +3351,7 @@ func (s *Server) pingNode(c *gin.Context) {
 	}
 
 	// 测试 TCP 连接延迟到节点的代理端口
-	addr := fmt.Sprintf("%s:%d", node.Host, node.Port)
+	addr := net.JoinHostPort(node.Host, strconv.Itoa(node.Port))
 	start := time.Now()
 
 	conn, err := net.DialTimeout("tcp", addr, 5*time.Second)
@@ -3002,7 +3392,7 @@ func (s *Server) pingAllNodes(c *gin.Context) {
 			semaphore <- struct{}{}        // 获取信号量
 			defer func() { <-semaphore }() // 释放信号量
 
-			addr := fmt.Sprintf("%s:%d", n.Host, n.Port)
+			addr := net.JoinHostPort(n.Host, strconv.Itoa(n.Port))
 			start := time.Now()
 
 			conn, err := net.DialTimeout("tcp", addr, 3*time.Second)
@@ -3022,6 +3412,46 @@ func (s *Server) pingAllNodes(c *gin.Context) {
 	c.JSON(http.StatusOK, gin.H{"results": results})
 }
 
+// probeNode 立即对节点执行端到端探测
+// 由面板发起时返回探测结果；由其他节点的 Agent 发起时返回 dispatched，结果稍后写入健康检查日志
+func (s *Server) probeNode(c *gin.Context) {
+	userID, isAdmin := getUserInfo(c)
+	id, _ := strconv.ParseUint(c.Param("id"), 10, 32)
+
+	node, err := s.svc.GetNodeByOwner(uint(id), userID, isAdmin)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "node not found"})
+		return
+	}
+
+	result, dispatched, err := s.svc.ProbeNode(node)
+	switch {
+	case errors.Is(err, service.ErrNoProbeTarget), errors.Is(err, probe.ErrUnsupported):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	case errors.Is(err, service.ErrProbeAgentOffline):
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": err.Error()})
+		return
+	case err != nil:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	if dispatched {
+		c.JSON(http.StatusAccepted, gin.H{
+			"dispatched": true,
+			"source":     service.ProbeSource(*node.ProbeFromNodeID),
+			"target":     s.svc.ProbeTarget(node),
+		})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"source": service.ProbeSourcePanel,
+		"target": s.svc.ProbeTarget(node),
+		"result": result,
+	})
+}
+
 // getNodeHealthLogs 获取节点健康检查日志
 func (s *Server) getNodeHealthLogs(c *gin.Context) {
 	id, _ := strconv.ParseUint(c.Param("id"), 10, 32)
@@ -3031,8 +3461,14 @@ func (s *Server) getNodeHealthLogs(c *gin.Context) {
 		limit = 50
 	}
 
+	query := s.svc.DB().Where("node_id = ?", uint(id))
+	// 按检查类型过滤: heartbeat / api / probe
+	if checkType := c.Query("type"); checkType != "" {
+		query = query.Where("type = ?", checkType)
+	}
+
 	var logs []model.HealthCheckLog
-	if err := s.svc.DB().Where("node_id = ?", uint(id)).
+	if err := query.
 		Order("checked_at DESC").
 		Limit(limit).
 		Find(&logs).Error; err != nil {
@@ -3058,6 +3494,8 @@ func (s *Server) getHealthSummary(c *gin.Context) {
 		LastCheck   time.Time `json:"last_check"`
 		AvgLatency  int       `json:"avg_latency"`
 		FailureRate float64   `json:"failure_rate"`
+		// 最近一次端到端探测，未配置探测时为空
+		Probe *model.HealthCheckLog `json:"probe,omitempty"`
 	}
 
 	summaries := make([]NodeHealthSummary, 0, len(nodes))
@@ -3083,13 +3521,14 @@ func (s *Server) getHealthSummary(c *gin.Context) {
 			Where("node_id = ? AND checked_at >= ? AND status = ?", node.ID, since, "unhealthy").
 			Count(&failedChecks)
 
-		// 计算平均延迟（仅健康检查）
+		// 计算平均延迟（仅健康检查，端到端探测的延迟单独展示）
 		var result struct {
 			AvgLatency float64
 		}
 		s.svc.DB().Model(&model.HealthCheckLog{}).
 			Select("AVG(latency) as avg_latency").
 			Where("node_id = ? AND checked_at >= ? AND status = ?", node.ID, since, "healthy").
+			Where("type IS NULL OR type <> ?", "probe").
 			Scan(&result)
 		avgLatency = result.AvgLatency
 
@@ -3098,14 +3537,23 @@ func (s *Server) getHealthSummary(c *gin.Context) {
 			failureRate = float64(failedChecks) / float64(totalChecks) * 100
 		}
 
-		summaries = append(summaries, NodeHealthSummary{
+		summary := NodeHealthSummary{
 			NodeID:      node.ID,
 			NodeName:    node.Name,
 			Status:      node.Status,
 			LastCheck:   lastLog.CheckedAt,
 			AvgLatency:  int(avgLatency),
 			FailureRate: failureRate,
-		})
+		}
+
+		var probeLog model.HealthCheckLog
+		if s.svc.DB().Where("node_id = ? AND type = ?", node.ID, "probe").
+			Order("checked_at DESC").
+			First(&probeLog).Error == nil {
+			summary.Probe = &probeLog
+		}
+
+		summaries = append(summaries, summary)
 	}
 
 	c.JSON(http.StatusOK, gin.H{"summaries": summaries})
@@ -3113,42 +3561,8 @@ func (s *Server) getHealthSummary(c *gin.Context) {
 
 // ==================== 数据导出 ====================
 
-// ExportNode 节点导出结构
-type ExportNode struct {
-	Name          string `json:"name" yaml:"name"`
-	Host          string `json:"host" yaml:"host"`
-	Port          int    `json:"port" yaml:"port"`
-	Protocol      string `json:"protocol" yaml:"protocol"`
-	Transport     string `json:"transport" yaml:"transport"`
-	ProxyUser     string `json:"proxy_user,omitempty" yaml:"proxy_user,omitempty"`
-	ProxyPass     string `json:"proxy_pass,omitempty" yaml:"proxy_pass,omitempty"`
-	SSMethod      string `json:"ss_method,omitempty" yaml:"ss_method,omitempty"`
-	SSPassword    string `json:"ss_password,omitempty" yaml:"ss_password,omitempty"`
-	TLSEnabled    bool   `json:"tls_enabled" yaml:"tls_enabled"`
-	TLSSNI        string `json:"tls_sni,omitempty" yaml:"tls_sni,omitempty"`
-	WSPath        string `json:"ws_path,omitempty" yaml:"ws_path,omitempty"`
-	WSHost        string `json:"ws_host,omitempty" yaml:"ws_host,omitempty"`
-}
-
-// ExportClient 客户端导出结构
-type ExportClient struct {
-	Name       string `json:"name" yaml:"name"`
-	NodeName   string `json:"node_name" yaml:"node_name"`
-	LocalPort  int    `json:"local_port" yaml:"local_port"`
-	RemotePort int    `json:"remote_port" yaml:"remote_port"`
-	ProxyUser  string `json:"proxy_user,omitempty" yaml:"proxy_user,omitempty"`
-	ProxyPass  string `json:"proxy_pass,omitempty" yaml:"proxy_pass,omitempty"`
-}
-
-// ExportData 导出数据结构
-type ExportData struct {
-	Version   string         `json:"version" yaml:"version"`
-	ExportAt  string         `json:"export_at" yaml:"export_at"`
-	Nodes     []ExportNode   `json:"nodes,omitempty" yaml:"nodes,omitempty"`
-	Clients   []ExportClient `json:"clients,omitempty" yaml:"clients,omitempty"`
-}
-
-// exportData 导出数据
+// exportData 导出配置数据
+// type 为 all 或逗号分隔的分区名 (见 service.ExportSections)，跨资源引用按名称导出
 func (s *Server) exportData(c *gin.Context) {
 	_, isAdmin := getUserInfo(c)
 	if !isAdmin {
@@ -3157,60 +3571,28 @@ func (s *Server) exportData(c *gin.Context) {
 	}
 
 	format := c.DefaultQuery("format", "json")
-	dataType := c.DefaultQuery("type", "all") // all, nodes, clients
-
-	exportData := ExportData{
-		Version:  "1.0",
-		ExportAt: time.Now().Format(time.RFC3339),
-	}
+	dataType := c.DefaultQuery("type", "all")
 
-	// 导出节点
-	if dataType == "all" || dataType == "nodes" {
-		nodes, err := s.svc.ListNodes()
-		if err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
-			return
+	var sections []string
+	if dataType != "all" {
+		valid := make(map[string]bool, len(service.ExportSections))
+		for _, sec := range service.ExportSections {
+			valid[sec] = true
 		}
-		for _, n := range nodes {
-			exportData.Nodes = append(exportData.Nodes, ExportNode{
-				Name:          n.Name,
-				Host:          n.Host,
-				Port:          n.Port,
-				Protocol:      n.Protocol,
-				Transport:     n.Transport,
-				ProxyUser:     n.ProxyUser,
-				ProxyPass:     n.ProxyPass,
-				SSMethod:      n.SSMethod,
-				SSPassword:    n.SSPassword,
-				TLSEnabled:    n.TLSEnabled,
-				TLSSNI:        n.TLSSNI,
-				WSPath:        n.WSPath,
-				WSHost:        n.WSHost,
-			})
+		for _, sec := range strings.Split(dataType, ",") {
+			sec = strings.TrimSpace(sec)
+			if !valid[sec] {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "unknown export type: " + sec})
+				return
+			}
+			sections = append(sections, sec)
 		}
 	}
 
-	// 导出客户端
-	if dataType == "all" || dataType == "clients" {
-		clients, err := s.svc.ListClients()
-		if err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
-			return
-		}
-		for _, cl := range clients {
-			nodeName := ""
-			if cl.Node != nil {
-				nodeName = cl.Node.Name
-			}
-			exportData.Clients = append(exportData.Clients, ExportClient{
-				Name:       cl.Name,
-				NodeName:   nodeName,
-				LocalPort:  cl.LocalPort,
-				RemotePort: cl.RemotePort,
-				ProxyUser:  cl.ProxyUser,
-				ProxyPass:  cl.ProxyPass,
-			})
-		}
+	exportData, err := s.svc.ExportConfig(sections)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
 	}
 
 	// 输出格式
@@ -3233,7 +3615,8 @@ func (s *Server) exportData(c *gin.Context) {
 	}
 }
 
-// importData 导入数据
+// importData 导入配置数据
+// dry_run=true 时只返回导入结果不写入；conflict 指定同名资源的处理方式: skip (默认) / overwrite / rename
 func (s *Server) importData(c *gin.Context) {
 	_, isAdmin := getUserInfo(c)
 	if !isAdmin {
@@ -3261,102 +3644,74 @@ func (s *Server) importData(c *gin.Context) {
 		return
 	}
 
-	// 解析数据
-	var importData ExportData
-
-	// 尝试 JSON 解析
-	if err := json.Unmarshal(content, &importData); err != nil {
-		// 尝试 YAML 解析
-		if err := yaml.Unmarshal(content, &importData); err != nil {
-			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid file format (expected JSON or YAML)"})
-			return
-		}
+	importData, err := service.ParseExportData(content)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
 	}
 
-	// 导入统计
-	var nodesCreated, nodesSkipped, clientsCreated, clientsSkipped int
-
-	// 预先查询所有节点和客户端，避免 N+1 查询
-	existingNodes, _ := s.svc.ListNodes()
-	existingClients, _ := s.svc.ListClients()
-
-	// 构建名称查找 map
-	nodeNameSet := make(map[string]bool)
-	nodeNameToID := make(map[string]uint)
-	for _, n := range existingNodes {
-		nodeNameSet[n.Name] = true
-		nodeNameToID[n.Name] = n.ID
+	dryRun, _ := strconv.ParseBool(c.DefaultPostForm("dry_run", c.Query("dry_run")))
+	opts := service.ImportOptions{
+		DryRun:   dryRun,
+		Conflict: c.DefaultPostForm("conflict", c.Query("conflict")),
 	}
-	clientNameSet := make(map[string]bool)
-	for _, c := range existingClients {
-		clientNameSet[c.Name] = true
+	result, err := s.svc.ImportConfig(importData, opts)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
 	}
 
-	// 导入节点
-	for _, n := range importData.Nodes {
-		// 检查是否已存在同名节点
-		if nodeNameSet[n.Name] {
-			nodesSkipped++
-			continue
-		}
+	if !result.DryRun {
+		s.audit.LogSuccess(c, "import", "data", 0, fmt.Sprintf("conflict=%s %v", result.Conflict, result.Summary))
+	}
+	c.JSON(http.StatusOK, result)
+}
 
-		node := &model.Node{
-			Name:           n.Name,
-			Host:           n.Host,
-			Port:           n.Port,
-			Protocol:       n.Protocol,
-			Transport:      n.Transport,
-			ProxyUser:      n.ProxyUser,
-			ProxyPass:      n.ProxyPass,
-			SSMethod:       n.SSMethod,
-			SSPassword:     n.SSPassword,
-			TLSEnabled:     n.TLSEnabled,
-			TLSSNI:         n.TLSSNI,
-			WSPath:         n.WSPath,
-			WSHost:         n.WSHost,
-		}
-		if err := s.svc.CreateNode(node); err == nil {
-			nodesCreated++
-			// 更新 map 以便客户端导入时可以找到新创建的节点
-			nodeNameSet[n.Name] = true
-			nodeNameToID[n.Name] = node.ID
-		}
+// importGOSTConfig 导入原生 GOST v3 配置 (gost.yml)，映射为指定节点及其转发、规则等资源
+func (s *Server) importGOSTConfig(c *gin.Context) {
+	_, isAdmin := getUserInfo(c)
+	if !isAdmin {
+		c.JSON(http.StatusForbidden, gin.H{"error": "admin only"})
+		return
 	}
 
-	// 导入客户端
-	for _, cl := range importData.Clients {
-		// 检查是否已存在同名客户端
-		if clientNameSet[cl.Name] {
-			clientsSkipped++
-			continue
-		}
+	file, err := c.FormFile("file")
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "no file provided"})
+		return
+	}
+	f, err := file.Open()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to open file"})
+		return
+	}
+	defer f.Close()
 
-		// 查找节点 ID
-		var nodeID uint
-		if cl.NodeName != "" {
-			nodeID = nodeNameToID[cl.NodeName]
-		}
+	content, err := io.ReadAll(f)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to read file"})
+		return
+	}
 
-		client := &model.Client{
-			Name:       cl.Name,
-			NodeID:     nodeID,
-			LocalPort:  cl.LocalPort,
-			RemotePort: cl.RemotePort,
-			ProxyUser:  cl.ProxyUser,
-			ProxyPass:  cl.ProxyPass,
-		}
-		if err := s.svc.CreateClient(client); err == nil {
-			clientsCreated++
-		}
+	gostOpts := service.GOSTImportOptions{
+		NodeName: c.DefaultPostForm("node_name", c.Query("node_name")),
+		Host:     c.DefaultPostForm("host", c.Query("host")),
+	}
+	dryRun, _ := strconv.ParseBool(c.DefaultPostForm("dry_run", c.Query("dry_run")))
+	opts := service.ImportOptions{
+		DryRun:   dryRun,
+		Conflict: c.DefaultPostForm("conflict", c.Query("conflict")),
+	}
+	result, err := s.svc.ImportGOSTConfig(content, gostOpts, opts)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
 	}
 
-	c.JSON(http.StatusOK, gin.H{
-		"message":         "Import completed",
-		"nodes_created":   nodesCreated,
-		"nodes_skipped":   nodesSkipped,
-		"clients_created": clientsCreated,
-		"clients_skipped": clientsSkipped,
-	})
+	if !result.DryRun {
+		s.audit.LogSuccess(c, "import", "gost_config", 0, fmt.Sprintf("node=%s conflict=%s %v unsupported=%d", gostOpts.NodeName, result.Conflict, result.Summary, len(result.Unsupported)))
+	}
+	c.JSON(http.StatusOK, result)
 }
 
 // ==================== 数据库备份/恢复 ====================
@@ -3369,38 +3724,19 @@ func (s *Server) backupDatabase(c *gin.Context) {
 		return
 	}
 
-	dbPath := s.cfg.DBPath
-
-	// 检查文件是否存在
-	if _, err := os.Stat(dbPath); os.IsNotExist(err) {
-		c.JSON(http.StatusNotFound, gin.H{"error": "database file not found"})
-		return
-	}
-
-	// 创建临时备份文件（避免读写冲突）
-	backupPath := dbPath + ".backup"
-
-	// 复制数据库文件
-	src, err := os.Open(dbPath)
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to open database"})
-		return
-	}
-	defer src.Close()
-
-	dst, err := os.Create(backupPath)
+	// 生成一致的快照（直接复制正在写入的数据库文件可能得到损坏的备份）
+	tmp, err := os.CreateTemp(filepath.Dir(s.cfg.DBPath), ".backup-*.db")
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to create backup"})
 		return
 	}
-	defer dst.Close()
-	defer os.Remove(backupPath) // 清理临时文件
-
-	if _, err := io.Copy(dst, src); err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to copy database"})
+	backupPath := tmp.Name()
+	tmp.Close()
+	if err := s.svc.SnapshotDatabase(backupPath); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to create backup: " + err.Error()})
 		return
 	}
-	dst.Close()
+	defer os.Remove(backupPath) // 清理临时文件
 
 	// 发送备份文件
 	filename := fmt.Sprintf("gost-panel-backup-%s.db", time.Now().Format("20060102-150405"))
@@ -3408,7 +3744,7 @@ func (s *Server) backupDatabase(c *gin.Context) {
 	c.File(backupPath)
 }
 
-// restoreDatabase 恢复数据库
+// restoreDatabase 在线恢复数据库 (支持加密备份)，完成后无需重启
 func (s *Server) restoreDatabase(c *gin.Context) {
 	_, isAdmin := getUserInfo(c)
 	if !isAdmin {
@@ -3428,64 +3764,48 @@ func (s *Server) restoreDatabase(c *gin.Context) {
 		return
 	}
 
-	// 保存上传的文件到临时位置
-	tempPath := s.cfg.DBPath + ".restore"
-	if err := c.SaveUploadedFile(file, tempPath); err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to save uploaded file"})
-		return
-	}
-	defer os.Remove(tempPath)
-
-	// 验证是 SQLite 数据库
-	testDB, err := model.InitDB(tempPath)
+	f, err := file.Open()
 	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid database file"})
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to read uploaded file"})
 		return
 	}
-	sqlDB, _ := testDB.DB()
-	sqlDB.Close()
-
-	// 备份当前数据库
-	currentBackup := s.cfg.DBPath + ".bak"
-	if err := copyFile(s.cfg.DBPath, currentBackup); err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to backup current database"})
+	data, err := io.ReadAll(f)
+	f.Close()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to read uploaded file"})
 		return
 	}
 
-	// 替换数据库文件
-	if err := copyFile(tempPath, s.cfg.DBPath); err != nil {
-		// 恢复失败，还原备份
-		copyFile(currentBackup, s.cfg.DBPath)
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to restore database"})
+	result, err := s.svc.RestoreDatabase(data)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
+	s.afterDatabaseRestore()
 
+	s.audit.LogSuccess(c, "restore", "database", 0, file.Filename)
 	c.JSON(http.StatusOK, gin.H{
-		"message": "Database restored successfully. Please restart the service.",
+		"message": "Database restored successfully",
+		"result":  result,
 	})
 }
 
-// copyFile 复制文件
-func copyFile(src, dst string) error {
-	sourceFile, err := os.Open(src)
-	if err != nil {
-		return err
-	}
-	defer sourceFile.Close()
-
-	// 确保目标目录存在
-	if err := os.MkdirAll(filepath.Dir(dst), 0755); err != nil {
-		return err
+// afterDatabaseRestore 通知所有实例清理恢复前的状态
+func (s *Server) afterDatabaseRestore() {
+	if err := s.publishClusterEvent(clusterEvent{Type: clusterEventRestored}); err != nil {
+		log.Printf("Failed to publish restore event, resetting locally: %v", err)
+		s.resetAfterRestore()
 	}
+}
 
-	destFile, err := os.Create(dst)
-	if err != nil {
-		return err
-	}
-	defer destFile.Close()
-
-	_, err = io.Copy(destFile, sourceFile)
-	return err
+// resetAfterRestore 恢复数据库后清理内存状态：限流记录、前端和 Agent 的长连接
+// Agent 会自动重连并按恢复后的数据重新认证、同步配置
+func (s *Server) resetAfterRestore() {
+	s.loginLimiter.Clear()
+	s.globalAPILimiter.Clear()
+	s.writeAPILimiter.Clear()
+	s.wsHub.CloseAll()
+	s.agentHub.CloseAll()
 }
 
 // ==================== 代理链/隧道转发 ====================
@@ -3712,7 +4032,26 @@ func (s *Server) getTunnel(c *gin.Context) {
 		c.JSON(http.StatusNotFound, gin.H{"error": "tunnel not found"})
 		return
 	}
-	c.JSON(http.StatusOK, tunnel)
+
+	// 附带完整路径上每一跳的延迟和健康状态
+	c.JSON(http.StatusOK, struct {
+		*model.Tunnel
+		Path []service.TunnelHopStatus `json:"path"`
+	}{tunnel, s.svc.GetTunnelPathStatus(tunnel)})
+}
+
+// checkTunnelHopAccess 检查用户是否可以使用中转节点 (管理员不限制)
+func (s *Server) checkTunnelHopAccess(c *gin.Context, userID uint, isAdmin bool, hops []model.TunnelHop) bool {
+	if isAdmin {
+		return true
+	}
+	for i, hop := range hops {
+		if allowed, msg := s.svc.CheckPlanNodeAccess(userID, hop.NodeID); !allowed {
+			c.JSON(http.StatusForbidden, gin.H{"error": fmt.Sprintf("第 %d 跳中转", i+1) + msg})
+			return false
+		}
+	}
+	return true
 }
 
 func (s *Server) createTunnel(c *gin.Context) {
@@ -3747,6 +4086,13 @@ func (s *Server) createTunnel(c *gin.Context) {
 		}
 	}
 
+	// 中转跳点单独保存
+	hops := tunnel.Hops
+	tunnel.Hops = nil
+	if !s.checkTunnelHopAccess(c, userID, isAdmin, hops) {
+		return
+	}
+
 	// 强制设置所有者 (防止用户指定任意 owner_id)
 	tunnel.OwnerID = &userID
 
@@ -3754,6 +4100,13 @@ func (s *Server) createTunnel(c *gin.Context) {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
+	if len(hops) > 0 {
+		if err := s.svc.SetTunnelHops(tunnel.ID, hops); err != nil {
+			s.svc.DeleteTunnel(tunnel.ID)
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+	}
 
 	// 重新加载以获取关联数据
 	result, _ := s.svc.GetTunnel(tunnel.ID)
@@ -3780,12 +4133,37 @@ func (s *Server) updateTunnel(c *gin.Context) {
 	delete(updates, "id")
 	delete(updates, "owner_id")
 	delete(updates, "created_at")
+	stripQuotaState(updates, isAdmin)
+
+	// 中转跳点单独更新 (传入即覆盖)
+	rawHops, hasHops := updates["hops"]
+	delete(updates, "hops")
+	var hops []model.TunnelHop
+	if hasHops {
+		data, _ := json.Marshal(rawHops)
+		if err := json.Unmarshal(data, &hops); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid hops"})
+			return
+		}
+		if !s.checkTunnelHopAccess(c, userID, isAdmin, hops) {
+			return
+		}
+	}
 
+	if hasHops {
+		if err := s.svc.SetTunnelHops(uint(id), hops); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+	}
 	if err := s.svc.UpdateTunnelMap(uint(id), updates); err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
 
+	// 配额调整后重新判断超限状态，状态变化时自动推送到 Agent
+	s.svc.SyncQuotaStates()
+
 	result, _ := s.svc.GetTunnel(uint(id))
 	c.JSON(http.StatusOK, result)
 }
@@ -3856,6 +4234,9 @@ func (s *Server) syncTunnel(c *gin.Context) {
 		return
 	}
 
+	// 入口节点的完整配置已包含该隧道，通过控制通道同步落盘
+	s.pushNodeConfig(tunnel.EntryNodeID)
+
 	c.JSON(http.StatusOK, gin.H{
 		"success": true,
 		"message": fmt.Sprintf("隧道配置已同步到入口节点 %s", tunnel.EntryNode.Name),
@@ -3902,6 +4283,7 @@ func (s *Server) getSiteConfigs(c *gin.Context) {
 	}
 
 	configs := s.svc.GetSiteConfigs()
+	delete(configs, model.ConfigPanelSigningKey)
 	c.JSON(http.StatusOK, configs)
 }
 
@@ -3917,12 +4299,59 @@ func (s *Server) updateSiteConfigs(c *gin.Context) {
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
+	delete(configs, model.ConfigPanelSigningKey)
+
+	// 校验定时任务调度表达式
+	for key, value := range configs {
+		if strings.HasPrefix(key, "job_schedule_") {
+			if err := validateJobSchedule(strings.TrimSpace(value)); err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("invalid schedule for %s: %v", key, err)})
+				return
+			}
+		}
+	}
+
+	if mode, ok := configs[model.ConfigProxyAuthMode]; ok && mode != "static" && mode != "plugin" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "proxy_auth_mode must be static or plugin"})
+		return
+	}
+
+	if err := s.validateBackupConfigs(configs); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if target := configs[model.ConfigHealthProbeTarget]; target != "" {
+		if err := probe.ValidateTarget(target); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+	}
+	for _, key := range []string{model.ConfigHealthProbeInterval, model.ConfigHealthProbeTimeout} {
+		if v, ok := configs[key]; ok && v != "" {
+			if n, err := strconv.Atoi(v); err != nil || n <= 0 {
+				c.JSON(http.StatusBadRequest, gin.H{"error": key + " must be a positive integer"})
+				return
+			}
+		}
+	}
+	if v, ok := configs[model.ConfigAgentRolloutPercent]; ok {
+		if n, err := strconv.Atoi(v); err != nil || n < 0 || n > 100 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "agent_rollout_percent must be between 0 and 100"})
+			return
+		}
+	}
 
 	if err := s.svc.SetSiteConfigs(configs); err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
 
+	// 切换凭据校验方式后更新所有节点配置
+	if _, ok := configs[model.ConfigProxyAuthMode]; ok {
+		s.requestAgentReconcile()
+	}
+
 	c.JSON(http.StatusOK, gin.H{"message": "配置已保存"})
 }
 
@@ -4256,6 +4685,7 @@ func (s *Server) listPlans(c *gin.Context) {
 			"description":       plan.Description,
 			"traffic_quota":     plan.TrafficQuota,
 			"speed_limit":       plan.SpeedLimit,
+			"conn_rate_limit":   plan.ConnRateLimit,
 			"duration":          plan.Duration,
 			"max_nodes":         plan.MaxNodes,
 			"max_clients":       plan.MaxClients,
@@ -4329,6 +4759,9 @@ func (s *Server) updatePlan(c *gin.Context) {
 		return
 	}
 
+	// 套餐限速变化后更新使用该套餐用户的节点配置
+	s.requestAgentReconcile()
+
 	c.JSON(http.StatusOK, gin.H{"success": true})
 }
 
@@ -5232,12 +5665,7 @@ func (s *Server) createConfigVersion(c *gin.Context) {
 	}
 
 	// 生成 YAML 配置
-	generator := gost.NewConfigGenerator()
-	bypasses, _ := s.svc.GetBypassesByNode(node.ID)
-	admissions, _ := s.svc.GetAdmissionsByNode(node.ID)
-	hostMappings, _ := s.svc.GetHostMappingsByNode(node.ID)
-	ingresses, _ := s.svc.GetIngressesByNode(node.ID)
-	config := generator.GenerateNodeConfigWithRules(node, bypasses, admissions, hostMappings, ingresses)
+	config := s.svc.GenerateNodeFullConfig(node)
 
 	// 将配置序列化为 YAML 字符串
 	configYAML, err := yaml.Marshal(config)
@@ -5247,7 +5675,8 @@ func (s *Server) createConfigVersion(c *gin.Context) {
 	}
 
 	// 保存版本
-	if err := s.svc.SaveConfigVersion(uint(id), string(configYAML), req.Comment); err != nil {
+	hash, _ := gost.ConfigHash(config)
+	if err := s.svc.SaveConfigVersion(uint(id), string(configYAML), hash, req.Comment); err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
@@ -0,0 +1,96 @@
+package api
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+
+	"github.com/AliceNetworks/gost-panel/internal/service"
+	"github.com/gin-gonic/gin"
+)
+
+// ==================== 定时任务 ====================
+
+// listJobs 获取定时任务列表及最近执行状态
+func (s *Server) listJobs(c *gin.Context) {
+	_, isAdmin := getUserInfo(c)
+	if !isAdmin {
+		c.JSON(http.StatusForbidden, gin.H{"error": "admin only"})
+		return
+	}
+
+	c.JSON(http.StatusOK, s.svc.Scheduler().ListJobs())
+}
+
+// runJob 立即执行定时任务
+func (s *Server) runJob(c *gin.Context) {
+	_, isAdmin := getUserInfo(c)
+	if !isAdmin {
+		c.JSON(http.StatusForbidden, gin.H{"error": "admin only"})
+		return
+	}
+
+	name := c.Param("name")
+	status, err := s.svc.Scheduler().RunNow(name)
+	if err != nil {
+		switch {
+		case errors.Is(err, service.ErrJobNotFound):
+			c.JSON(http.StatusNotFound, gin.H{"error": "job not found"})
+		case errors.Is(err, service.ErrJobAlreadyRunning):
+			c.JSON(http.StatusConflict, gin.H{"error": "任务正在执行中"})
+		default:
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		}
+		return
+	}
+
+	s.audit.LogSuccess(c, "run", "job", 0, name)
+	c.JSON(http.StatusOK, status)
+}
+
+// updateJobSchedule 修改定时任务的调度表达式 (留空或 off 表示停用)
+func (s *Server) updateJobSchedule(c *gin.Context) {
+	_, isAdmin := getUserInfo(c)
+	if !isAdmin {
+		c.JSON(http.StatusForbidden, gin.H{"error": "admin only"})
+		return
+	}
+
+	name := c.Param("name")
+	key, ok := s.svc.Scheduler().JobConfigKey(name)
+	if !ok {
+		c.JSON(http.StatusNotFound, gin.H{"error": "job not found"})
+		return
+	}
+
+	var req struct {
+		Schedule string `json:"schedule"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	schedule := strings.TrimSpace(req.Schedule)
+	if err := validateJobSchedule(schedule); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid schedule: " + err.Error()})
+		return
+	}
+
+	if err := s.svc.SetSiteConfig(key, schedule); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	s.audit.LogSuccess(c, "update", "job", 0, name+": "+schedule)
+	c.JSON(http.StatusOK, gin.H{"message": "调度已更新"})
+}
+
+// validateJobSchedule 校验调度表达式，空值和 off 表示停用
+func validateJobSchedule(schedule string) error {
+	if schedule == "" || schedule == "off" {
+		return nil
+	}
+	_, err := service.ParseCron(schedule)
+	return err
+}
@@ -2,71 +2,55 @@ package api
 
 import (
 	"fmt"
+	"log"
 	"net/http"
-	"sync"
 	"time"
 
+	"github.com/AliceNetworks/gost-panel/internal/cluster"
 	"github.com/gin-gonic/gin"
 )
 
-// APIRateLimiter 全局 API 限流器 (Token Bucket 算法)
+// APIRateLimiter API 限流器 (固定时间窗口计数，计数保存在共享存储中)
 type APIRateLimiter struct {
-	mu       sync.RWMutex
-	visitors map[string]*visitor
-	limit    int
-	window   time.Duration
-}
-
-type visitor struct {
-	tokens    int
-	lastReset time.Time
+	store  cluster.Store
+	prefix string
+	limit  int
+	window time.Duration
 }
 
 // NewAPIRateLimiter 创建 API 限流器
-func NewAPIRateLimiter(limit int, window time.Duration) *APIRateLimiter {
-	rl := &APIRateLimiter{
-		visitors: make(map[string]*visitor),
-		limit:    limit,
-		window:   window,
+func NewAPIRateLimiter(store cluster.Store, name string, limit int, window time.Duration) *APIRateLimiter {
+	return &APIRateLimiter{
+		store:  store,
+		prefix: "apilimit:" + name + ":",
+		limit:  limit,
+		window: window,
 	}
-	// 定期清理
-	go func() {
-		for range time.Tick(time.Minute) {
-			rl.cleanup()
-		}
-	}()
-	return rl
 }
 
-// Allow 检查是否允许请求，返回 (是否允许, 剩余配额, 重置时间)
+// Allow 检查是否允许请求，返回 (是否允许, 剩余配额, 重置时间)，存储不可用时放行
 func (rl *APIRateLimiter) Allow(key string) (bool, int, time.Time) {
-	rl.mu.Lock()
-	defer rl.mu.Unlock()
-
-	v, exists := rl.visitors[key]
 	now := time.Now()
-
-	if !exists || now.Sub(v.lastReset) > rl.window {
-		rl.visitors[key] = &visitor{tokens: rl.limit - 1, lastReset: now}
-		return true, rl.limit - 1, now.Add(rl.window)
+	count, ttl, err := rl.store.Incr(rl.prefix+key, rl.window)
+	if err != nil {
+		log.Printf("API rate limiter: store error: %v", err)
+		return true, rl.limit, now.Add(rl.window)
 	}
-
-	if v.tokens <= 0 {
-		return false, 0, v.lastReset.Add(rl.window)
+	if ttl <= 0 {
+		ttl = rl.window
 	}
+	reset := now.Add(ttl)
 
-	v.tokens--
-	return true, v.tokens, v.lastReset.Add(rl.window)
+	if count > int64(rl.limit) {
+		return false, 0, reset
+	}
+	return true, rl.limit - int(count), reset
 }
 
-// cleanup 定期清理过期记录
-func (rl *APIRateLimiter) cleanup() {
-	rl.mu.Lock()
-	defer rl.mu.Unlock()
-	for key, v := range rl.visitors {
-		if time.Since(v.lastReset) > rl.window*2 {
-			delete(rl.visitors, key)
-		}
+// Clear 清空所有限流状态
+func (rl *APIRateLimiter) Clear() {
+	if err := rl.store.DelPrefix(rl.prefix); err != nil {
+		log.Printf("API rate limiter: failed to clear: %v", err)
 	}
 }
 
@@ -96,3 +80,19 @@ func APIRateLimitMiddleware(limiter *APIRateLimiter) gin.HandlerFunc {
 		c.Next()
 	}
 }
+
+// restoreGuardMiddleware 数据库恢复期间拒绝请求，避免访问正在替换的数据库
+func (s *Server) restoreGuardMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if s.svc.Restoring() {
+			c.Header("Retry-After", "5")
+			c.JSON(http.StatusServiceUnavailable, gin.H{
+				"error": "数据库恢复中，请稍后再试",
+			})
+			c.Abort()
+			return
+		}
+
+		c.Next()
+	}
+}
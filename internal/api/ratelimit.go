@@ -1,17 +1,20 @@
 package api
 
 import (
+	"log"
 	"net/http"
 	"sync"
 	"time"
 
+	"github.com/AliceNetworks/gost-panel/internal/cluster"
 	"github.com/gin-gonic/gin"
 )
 
-// RateLimiter 基于内存的限流器
+// RateLimiter 登录限流器，计数保存在共享存储中 (多实例部署时共享)
 type RateLimiter struct {
-	mu       sync.RWMutex
-	attempts map[string]*attemptInfo
+	mu     sync.RWMutex
+	store  cluster.Store
+	prefix string // 存储键前缀
 	// 配置
 	maxAttempts int           // 最大尝试次数
 	window      time.Duration // 时间窗口
@@ -20,121 +23,82 @@ type RateLimiter struct {
 	onBlock func(ip string, attempts int)
 }
 
-type attemptInfo struct {
-	count     int
-	firstTime time.Time
-	blocked   bool
-	blockTime time.Time
-}
-
-// NewRateLimiter 创建限流器
-func NewRateLimiter(maxAttempts int, window, blockTime time.Duration) *RateLimiter {
-	rl := &RateLimiter{
-		attempts:    make(map[string]*attemptInfo),
+// NewRateLimiter 创建限流器，计数和封锁记录通过过期时间自动清理
+func NewRateLimiter(store cluster.Store, name string, maxAttempts int, window, blockTime time.Duration) *RateLimiter {
+	return &RateLimiter{
+		store:       store,
+		prefix:      "ratelimit:" + name + ":",
 		maxAttempts: maxAttempts,
 		window:      window,
 		blockTime:   blockTime,
 	}
-	// 启动清理协程
-	go rl.cleanup()
-	return rl
 }
 
-// Allow 检查是否允许请求
-func (rl *RateLimiter) Allow(key string) bool {
-	rl.mu.Lock()
-	defer rl.mu.Unlock()
-
-	now := time.Now()
-	info, exists := rl.attempts[key]
+func (rl *RateLimiter) attemptsKey(key string) string {
+	return rl.prefix + "attempts:" + key
+}
 
-	if !exists {
-		rl.attempts[key] = &attemptInfo{
-			count:     1,
-			firstTime: now,
-		}
-		return true
-	}
+func (rl *RateLimiter) blockKey(key string) string {
+	return rl.prefix + "block:" + key
+}
 
+// Allow 检查是否允许请求，存储不可用时放行
+func (rl *RateLimiter) Allow(key string) bool {
 	// 检查是否被封锁
-	if info.blocked {
-		if now.Sub(info.blockTime) > rl.blockTime {
-			// 解除封锁
-			info.blocked = false
-			info.count = 1
-			info.firstTime = now
-			return true
-		}
+	if blocked, err := rl.store.Get(rl.blockKey(key)); err != nil {
+		log.Printf("Rate limiter: store error: %v", err)
+		return true
+	} else if blocked != "" {
 		return false
 	}
 
-	// 检查时间窗口
-	if now.Sub(info.firstTime) > rl.window {
-		// 重置计数
-		info.count = 1
-		info.firstTime = now
+	// 时间窗口内计数
+	count, _, err := rl.store.Incr(rl.attemptsKey(key), rl.window)
+	if err != nil {
+		log.Printf("Rate limiter: store error: %v", err)
 		return true
 	}
-
-	// 增加计数
-	info.count++
-	if info.count > rl.maxAttempts {
-		info.blocked = true
-		info.blockTime = now
-		// 触发封锁回调
-		if rl.onBlock != nil {
-			go rl.onBlock(key, info.count)
-		}
-		return false
+	if count <= int64(rl.maxAttempts) {
+		return true
 	}
 
-	return true
+	// 超过次数，封锁并重置计数 (解除封锁后重新计数)
+	blocked, err := rl.store.SetNX(rl.blockKey(key), "1", rl.blockTime)
+	if err != nil {
+		log.Printf("Rate limiter: store error: %v", err)
+	}
+	rl.store.Del(rl.attemptsKey(key))
+	// 触发封锁回调 (多实例并发时只触发一次)
+	rl.mu.RLock()
+	onBlock := rl.onBlock
+	rl.mu.RUnlock()
+	if blocked && onBlock != nil {
+		go onBlock(key, int(count))
+	}
+	return false
 }
 
 // Reset 重置某个 key 的限流状态（登录成功后调用）
 func (rl *RateLimiter) Reset(key string) {
-	rl.mu.Lock()
-	defer rl.mu.Unlock()
-	delete(rl.attempts, key)
+	rl.store.Del(rl.attemptsKey(key), rl.blockKey(key))
 }
 
-// GetBlockTimeRemaining 获取剩余封锁时间
-func (rl *RateLimiter) GetBlockTimeRemaining(key string) time.Duration {
-	rl.mu.RLock()
-	defer rl.mu.RUnlock()
-
-	info, exists := rl.attempts[key]
-	if !exists || !info.blocked {
-		return 0
+// Clear 清空所有限流状态
+func (rl *RateLimiter) Clear() {
+	if err := rl.store.DelPrefix(rl.prefix); err != nil {
+		log.Printf("Rate limiter: failed to clear: %v", err)
 	}
+}
 
-	remaining := rl.blockTime - time.Since(info.blockTime)
-	if remaining < 0 {
+// GetBlockTimeRemaining 获取剩余封锁时间
+func (rl *RateLimiter) GetBlockTimeRemaining(key string) time.Duration {
+	remaining, err := rl.store.TTL(rl.blockKey(key))
+	if err != nil {
 		return 0
 	}
 	return remaining
 }
 
-// cleanup 定期清理过期记录
-func (rl *RateLimiter) cleanup() {
-	ticker := time.NewTicker(5 * time.Minute)
-	for range ticker.C {
-		rl.mu.Lock()
-		now := time.Now()
-		for key, info := range rl.attempts {
-			// 删除超过封锁时间的记录
-			if info.blocked && now.Sub(info.blockTime) > rl.blockTime {
-				delete(rl.attempts, key)
-			}
-			// 删除超过时间窗口且未被封锁的记录
-			if !info.blocked && now.Sub(info.firstTime) > rl.window*2 {
-				delete(rl.attempts, key)
-			}
-		}
-		rl.mu.Unlock()
-	}
-}
-
 // SetOnBlockCallback 设置 IP 被封锁时的回调函数
 func (rl *RateLimiter) SetOnBlockCallback(callback func(ip string, attempts int)) {
 	rl.mu.Lock()
@@ -0,0 +1,89 @@
+package api
+
+import (
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/AliceNetworks/gost-panel/internal/cluster"
+)
+
+// 多个实例共享存储时，登录尝试次数合并计算，封锁对所有实例生效
+func TestRateLimiterSharedStore(t *testing.T) {
+	store := cluster.NewMemoryStore()
+	defer store.Close()
+	a := NewRateLimiter(store, "login", 3, time.Minute, 200*time.Millisecond)
+	b := NewRateLimiter(store, "login", 3, time.Minute, 200*time.Millisecond)
+	var blocked atomic.Int32
+	a.SetOnBlockCallback(func(ip string, attempts int) { blocked.Add(1) })
+	b.SetOnBlockCallback(func(ip string, attempts int) { blocked.Add(1) })
+
+	for i, rl := range []*RateLimiter{a, b, a} {
+		if !rl.Allow("1.2.3.4") {
+			t.Fatalf("attempt %d rejected", i+1)
+		}
+	}
+	if b.Allow("1.2.3.4") {
+		t.Fatal("fourth attempt allowed")
+	}
+	if a.Allow("1.2.3.4") {
+		t.Fatal("blocked address allowed on another instance")
+	}
+	if !a.Allow("5.6.7.8") {
+		t.Fatal("another address rejected")
+	}
+	if remaining := a.GetBlockTimeRemaining("1.2.3.4"); remaining <= 0 || remaining > 200*time.Millisecond {
+		t.Fatalf("block time remaining = %v", remaining)
+	}
+	time.Sleep(50 * time.Millisecond)
+	if n := blocked.Load(); n != 1 {
+		t.Fatalf("block callback called %d times, want 1", n)
+	}
+
+	// 封锁过期后重新计数
+	time.Sleep(200 * time.Millisecond)
+	if !a.Allow("1.2.3.4") {
+		t.Fatal("address still blocked after block time")
+	}
+
+	// 登录成功后重置
+	b.Allow("1.2.3.4")
+	a.Reset("1.2.3.4")
+	for i := 0; i < 3; i++ {
+		if !b.Allow("1.2.3.4") {
+			t.Fatalf("attempt %d after reset rejected", i+1)
+		}
+	}
+}
+
+// API 限流的窗口计数在实例间共享
+func TestAPIRateLimiterSharedStore(t *testing.T) {
+	store := cluster.NewMemoryStore()
+	defer store.Close()
+	a := NewAPIRateLimiter(store, "api", 2, 200*time.Millisecond)
+	b := NewAPIRateLimiter(store, "api", 2, 200*time.Millisecond)
+
+	if ok, remaining, _ := a.Allow("user:1"); !ok || remaining != 1 {
+		t.Fatalf("first request = %v, %d; want allowed with 1 remaining", ok, remaining)
+	}
+	if ok, remaining, _ := b.Allow("user:1"); !ok || remaining != 0 {
+		t.Fatalf("second request = %v, %d; want allowed with 0 remaining", ok, remaining)
+	}
+	ok, _, reset := a.Allow("user:1")
+	if ok {
+		t.Fatal("third request allowed")
+	}
+	if until := time.Until(reset); until <= 0 || until > 200*time.Millisecond {
+		t.Fatalf("reset in %v, want within the window", until)
+	}
+
+	time.Sleep(250 * time.Millisecond)
+	if ok, _, _ := b.Allow("user:1"); !ok {
+		t.Fatal("request rejected in a new window")
+	}
+
+	a.Clear()
+	if keys, _ := store.Keys("apilimit:api:"); len(keys) != 0 {
+		t.Fatalf("keys after Clear = %v", keys)
+	}
+}
@@ -33,6 +33,9 @@ type Server struct {
 	loginLimiter *RateLimiter
 	audit        *AuditLogger
 	wsHub        *WSHub
+	agentHub     *AgentHub
+	// 配置核对请求 (超限状态变化等)
+	agentReconcileCh chan struct{}
 	// API rate limiters
 	globalAPILimiter *APIRateLimiter
 	writeAPILimiter  *APIRateLimiter
@@ -83,15 +86,19 @@ func NewServer(svc *service.Service, cfg *config.Config) *Server {
 	// 设置 WebSocket 允许的来源
 	SetWSOrigins(cfg.AllowedOrigins, cfg.Debug)
 
+	// 限流计数、WebSocket 广播和 Agent 在线记录保存在共享存储中，多实例部署时共享
+	store := svc.Store()
 	s := &Server{
 		svc:              svc,
 		cfg:              cfg,
 		router:           r,
-		loginLimiter:     NewRateLimiter(5, time.Minute, 5*time.Minute), // 每分钟5次，封锁5分钟
+		loginLimiter:     NewRateLimiter(store, "login", 5, time.Minute, 5*time.Minute), // 每分钟5次，封锁5分钟
 		audit:            NewAuditLogger(svc),
-		wsHub:            NewWSHub(),
-		globalAPILimiter: NewAPIRateLimiter(200, time.Minute),           // 全局 API 限流: 每分钟 200 次
-		writeAPILimiter:  NewAPIRateLimiter(30, time.Minute),            // 写操作限流: 每分钟 30 次
+		wsHub:            NewWSHub(store),
+		agentHub:         NewAgentHub(store, cfg.InstanceID),
+		agentReconcileCh: make(chan struct{}, 1),
+		globalAPILimiter: NewAPIRateLimiter(store, "global", 200, time.Minute), // 全局 API 限流: 每分钟 200 次
+		writeAPILimiter:  NewAPIRateLimiter(store, "write", 30, time.Minute),   // 写操作限流: 每分钟 30 次
 	}
 
 	// 设置登录限流回调，记录被封锁的 IP
@@ -104,6 +111,17 @@ func NewServer(svc *service.Service, cfg *config.Config) *Server {
 	// Start WebSocket hub
 	go s.wsHub.Run()
 
+	// 处理其他实例转发的事件
+	events, _ := store.Subscribe(clusterEventChannel)
+	go s.runClusterEvents(events)
+
+	// 流量超限状态变化时向在线 Agent 推送新配置
+	go s.runAgentReconciler()
+	s.svc.SetQuotaChangeHandler(s.requestAgentReconcile)
+
+	// 端到端探测可由其他节点的 Agent 发起
+	s.svc.SetProbeDispatcher(s.dispatchProbe)
+
 	// 初始化默认网站配置
 	s.svc.InitDefaultSiteConfigs()
 
@@ -113,6 +131,9 @@ func NewServer(svc *service.Service, cfg *config.Config) *Server {
 }
 
 func (s *Server) setupRoutes() {
+	// 数据库恢复期间暂停处理请求
+	s.router.Use(s.restoreGuardMiddleware())
+
 	// Prometheus 指标中间件
 	s.router.Use(PrometheusMiddleware())
 
@@ -164,11 +185,15 @@ func (s *Server) setupRoutes() {
 			auth.POST("/nodes/:id/apply", APIRateLimitMiddleware(s.writeAPILimiter), s.applyNodeConfig)
 			auth.POST("/nodes/:id/clone", APIRateLimitMiddleware(s.writeAPILimiter), s.cloneNode)
 			auth.POST("/nodes/:id/sync", APIRateLimitMiddleware(s.writeAPILimiter), s.syncNodeConfig)
+			auth.POST("/nodes/:id/agent-command", APIRateLimitMiddleware(s.writeAPILimiter), s.sendNodeAgentCommand)
+			auth.POST("/nodes/:id/join-token", APIRateLimitMiddleware(s.writeAPILimiter), s.issueNodeJoinToken)
+			auth.POST("/nodes/:id/revoke-agent", APIRateLimitMiddleware(s.writeAPILimiter), s.revokeNodeAgent)
 			auth.GET("/nodes/:id/gost-config", s.getNodeGostConfig)
 			auth.GET("/nodes/:id/proxy-uri", s.getNodeProxyURI)
 			auth.GET("/nodes/:id/install-script", s.getNodeInstallScript)
 			auth.GET("/nodes/:id/ping", s.pingNode)
 			auth.GET("/nodes/ping", s.pingAllNodes)
+			auth.POST("/nodes/:id/probe", APIRateLimitMiddleware(s.writeAPILimiter), s.probeNode)
 			auth.GET("/nodes/:id/health-logs", s.getNodeHealthLogs)
 			auth.GET("/health-summary", s.getHealthSummary)
 
@@ -184,6 +209,14 @@ func (s *Server) setupRoutes() {
 			auth.POST("/nodes/batch-disable", s.batchDisableNodes)
 			auth.POST("/nodes/batch-delete", s.batchDeleteNodes)
 			auth.POST("/nodes/batch-sync", s.batchSyncNodes)
+			auth.GET("/agent-channels", s.listAgentChannels)
+
+			// 用户代理凭据
+			auth.GET("/nodes/:id/credentials", s.listNodeCredentials)
+			auth.POST("/nodes/:id/credentials", s.createNodeCredential)
+			auth.PUT("/credentials/:id", s.updateCredential)
+			auth.POST("/credentials/:id/rotate", s.rotateCredential)
+			auth.DELETE("/credentials/:id", s.deleteCredential)
 
 			// 客户端管理
 			auth.GET("/clients", s.listClients)
@@ -196,6 +229,9 @@ func (s *Server) setupRoutes() {
 			auth.GET("/clients/:id/gost-config", s.getClientGostConfig)
 			auth.GET("/clients/:id/proxy-uri", s.getClientProxyURI)
 			auth.POST("/clients/:id/clone", s.cloneClient)
+			auth.POST("/clients/:id/agent-command", s.sendClientAgentCommand)
+			auth.POST("/clients/:id/join-token", s.issueClientJoinToken)
+			auth.POST("/clients/:id/revoke-agent", s.revokeClientAgent)
 
 			// 客户端批量操作
 			auth.POST("/clients/batch-enable", s.batchEnableClients)
@@ -219,6 +255,8 @@ func (s *Server) setupRoutes() {
 			auth.POST("/profile/2fa/enable", s.enable2FA)
 			auth.POST("/profile/2fa/verify", s.verify2FA)
 			auth.POST("/profile/2fa/disable", s.disable2FA)
+			auth.GET("/profile/credentials", s.listMyCredentials)
+			auth.POST("/profile/credentials", s.createMyCredential)
 
 			// 流量历史
 			auth.GET("/traffic-history", s.getTrafficHistory)
@@ -247,10 +285,17 @@ func (s *Server) setupRoutes() {
 			// 数据导出/导入
 			auth.GET("/export", s.exportData)
 			auth.POST("/import", s.importData)
+			auth.POST("/import/gost", s.importGOSTConfig)
 
 			// 数据库备份/恢复
 			auth.GET("/backup", s.backupDatabase)
 			auth.POST("/restore", s.restoreDatabase)
+			auth.GET("/backups", s.listBackups)
+			auth.POST("/backups", s.createBackup)
+			auth.POST("/backups/test", s.testBackupTarget)
+			auth.GET("/backups/:name", s.downloadBackup)
+			auth.DELETE("/backups/:name", s.deleteBackup)
+			auth.POST("/backups/:name/restore", s.restoreBackup)
 
 			// 端口转发
 			auth.GET("/port-forwards", s.listPortForwards)
@@ -310,6 +355,17 @@ func (s *Server) setupRoutes() {
 			auth.GET("/site-configs", s.getSiteConfigs)
 			auth.PUT("/site-configs", s.updateSiteConfigs)
 
+			// Agent 灰度更新状态 (仅管理员)
+			auth.GET("/agent-rollout", s.getAgentRollout)
+
+			// 定时任务 (仅管理员)
+			auth.GET("/jobs", s.listJobs)
+			auth.PUT("/jobs/:name", s.updateJobSchedule)
+			auth.POST("/jobs/:name/run", s.runJob)
+
+			// 多实例状态 (仅管理员)
+			auth.GET("/cluster", s.getClusterStatus)
+
 			// 节点标签管理
 			auth.GET("/tags", s.listTags)
 			auth.GET("/tags/:id", s.getTag)
@@ -399,12 +455,16 @@ func (s *Server) setupRoutes() {
 		}
 	}
 
-	// Agent 接口 (使用 Token 认证)
+	// Agent 接口 (签名或 Token 认证)
 	agent := s.router.Group("/agent")
 	{
 		agent.POST("/register", s.agentRegister)
 		agent.POST("/heartbeat", s.agentHeartbeat)
+		agent.POST("/stats", s.agentReplayStats)          // 补报离线期间的统计
+		agent.POST("/config-result", s.agentConfigResult) // 上报配置应用结果
+		agent.GET("/config", s.agentGetConfig)
 		agent.GET("/config/:token", s.agentGetConfig)
+		agent.POST("/auth", s.agentAuth)
 		agent.GET("/version", s.agentGetVersion)
 		agent.GET("/check-update", s.agentCheckUpdate)
 		agent.GET("/download/:os/:arch", s.agentDownload)
@@ -494,6 +554,9 @@ func (s *Server) Run() error {
 
 // RunWithContext starts the server and shuts down gracefully when ctx is cancelled.
 func (s *Server) RunWithContext(ctx context.Context) error {
+	// Agent 控制通道
+	go s.runAgentChannel(ctx)
+
 	srv := &http.Server{
 		Addr:    s.cfg.ListenAddr,
 		Handler: s.router,
@@ -506,7 +569,10 @@ func (s *Server) RunWithContext(ctx context.Context) error {
 		srv.Shutdown(shutdownCtx)
 	}()
 
-	if err := srv.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+	err := srv.ListenAndServe()
+	// 停止后台任务并释放主实例身份，其他实例可立即接替
+	s.svc.Close()
+	if err != nil && err != http.ErrServerClosed {
 		return err
 	}
 	return nil
@@ -1057,8 +1123,9 @@ func (s *Server) serveInstallScript(scriptName string) gin.HandlerFunc {
 func (s *Server) serveClientScript(c *gin.Context) {
 	token := c.Param("token")
 
+	// 客户端登记密钥后 (或要求密钥登记时) Token 不再可用
 	client, err := s.svc.GetClientByToken(token)
-	if err != nil {
+	if err != nil || !s.svc.AgentTokenUsable(token) {
 		c.JSON(http.StatusNotFound, gin.H{"error": "client not found"})
 		return
 	}
@@ -1182,7 +1249,7 @@ echo "Agent Mode Features:"
 echo "  - Built-in heartbeat (every 30s)"
 echo "  - Auto config reload"
 echo "  - Auto GOST download"
-echo "  - Auto uninstall when deleted from panel"
+echo "  - Uninstall when deleted from panel (signed command only)"
 echo ""
 echo "Commands:"
 echo "  $INSTALL_DIR/gost-agent service status   - Check status"
@@ -10,6 +10,8 @@ import (
 	"runtime"
 	"strings"
 
+	"github.com/AliceNetworks/gost-panel/internal/model"
+	"github.com/AliceNetworks/gost-panel/internal/signing"
 	"github.com/gin-gonic/gin"
 )
 
@@ -39,18 +41,32 @@ func (s *Server) agentGetVersion(c *gin.Context) {
 }
 
 // agentCheckUpdate checks if an update is available
+// Agent 通过签名或 Authorization: Bearer <token> 认证，用于灰度范围判断
 func (s *Server) agentCheckUpdate(c *gin.Context) {
 	clientVersion := c.Query("version")
 	clientOS := c.DefaultQuery("os", runtime.GOOS)
 	clientArch := c.DefaultQuery("arch", runtime.GOARCH)
 
+	caller, err := s.authenticateAgent(c, "")
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	kind, id := s.identifyAgent(caller.Token)
+	if id == 0 {
+		c.JSON(http.StatusUnauthorized, s.agentTokenRejection(caller.Credential))
+		return
+	}
+
 	// Check if update is available
-	needsUpdate := compareVersions(clientVersion, CurrentAgentVersion) < 0
+	newer := signing.CompareVersions(clientVersion, CurrentAgentVersion) < 0
+	needsUpdate := newer && s.svc.AgentUpdateEligible(kind, id, CurrentAgentVersion)
 
 	response := gin.H{
 		"current_version": clientVersion,
 		"latest_version":  CurrentAgentVersion,
 		"needs_update":    needsUpdate,
+		"deferred":        newer && !needsUpdate, // 有新版本但不在本次灰度范围内
 		"build_time":      AgentBuildTime,
 	}
 
@@ -61,14 +77,37 @@ func (s *Server) agentCheckUpdate(c *gin.Context) {
 			checksum, _ := getFileChecksum(binaryPath)
 			response["download_url"] = fmt.Sprintf("/agent/download/%s/%s", clientOS, clientArch)
 			response["checksum"] = checksum
+			response["signature"] = getAgentSignature(binaryPath)
+			response["os"] = clientOS
+			response["arch"] = clientArch
 		}
 	}
 
 	c.JSON(http.StatusOK, response)
 }
 
+// identifyAgent 根据 Agent Token 识别节点或客户端，无法识别时 id 为 0
+func (s *Server) identifyAgent(token string) (kind string, id uint) {
+	if token == "" {
+		return "", 0
+	}
+	if node, err := s.svc.GetNodeByToken(token); err == nil {
+		return "node", node.ID
+	}
+	if client, err := s.svc.GetClientByToken(token); err == nil {
+		return "client", client.ID
+	}
+	return "", 0
+}
+
 // agentDownload serves the agent binary for download
+// 需要 Agent 认证 (签名或 Token)，安装脚本可用未使用的加入令牌；
+// 开启 agent_public_download 后允许匿名下载
 func (s *Server) agentDownload(c *gin.Context) {
+	if !s.agentDownloadAllowed(c) {
+		return
+	}
+
 	osName := c.Param("os")
 	archName := c.Param("arch")
 
@@ -116,10 +155,71 @@ func (s *Server) agentDownload(c *gin.Context) {
 	if checksum, err := getFileChecksum(binaryPath); err == nil {
 		c.Header("X-Checksum-SHA256", checksum)
 	}
+	if sig := getAgentSignature(binaryPath); sig != "" {
+		c.Header("X-Agent-Signature", sig)
+	}
 
 	c.File(binaryPath)
 }
 
+// agentDownloadAllowed 校验下载 Agent 二进制的请求，拒绝时已写入响应
+func (s *Server) agentDownloadAllowed(c *gin.Context) bool {
+	caller, err := s.authenticateAgent(c, "")
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return false
+	}
+	if _, id := s.identifyAgent(caller.Token); id != 0 {
+		return true
+	}
+	if s.svc.JoinTokenValid(caller.Credential) || s.svc.GetSiteConfig(model.ConfigAgentPublicDownload) == "true" {
+		return true
+	}
+	c.JSON(http.StatusUnauthorized, s.agentTokenRejection(caller.Credential))
+	return false
+}
+
+// agentPlatforms 面板分发的 Agent 平台
+var agentPlatforms = []struct{ OS, Arch string }{
+	{"linux", "amd64"}, {"linux", "arm64"}, {"linux", "arm"}, {"linux", "386"},
+	{"darwin", "amd64"}, {"darwin", "arm64"},
+	{"windows", "amd64"}, {"windows", "386"},
+}
+
+// getAgentRollout 返回灰度更新设置、可分发的二进制及其签名状态和各 Agent 的更新进度
+func (s *Server) getAgentRollout(c *gin.Context) {
+	_, isAdmin := getUserInfo(c)
+	if !isAdmin {
+		c.JSON(http.StatusForbidden, gin.H{"error": "admin only"})
+		return
+	}
+
+	binaries := []gin.H{}
+	for _, p := range agentPlatforms {
+		binaryPath := getAgentBinaryPath(p.OS, p.Arch)
+		if _, err := os.Stat(binaryPath); err != nil {
+			continue
+		}
+		binaries = append(binaries, gin.H{
+			"os":     p.OS,
+			"arch":   p.Arch,
+			"signed": getAgentSignature(binaryPath) != "",
+		})
+	}
+
+	rollout := s.svc.GetAgentRollout()
+	if rollout.Tags == nil {
+		rollout.Tags = []string{}
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"latest_version": CurrentAgentVersion,
+		"percent":        rollout.Percent,
+		"tags":           rollout.Tags,
+		"binaries":       binaries,
+		"stats":          s.svc.GetAgentRolloutStats(CurrentAgentVersion),
+	})
+}
+
 // getAgentBinaryPath returns the path to the agent binary
 func getAgentBinaryPath(osName, archName string) string {
 	basePath := "/root/gost-panel/dist/agents"
@@ -130,6 +230,15 @@ func getAgentBinaryPath(osName, archName string) string {
 	return filepath.Join(basePath, fileName)
 }
 
+// getAgentSignature 读取二进制旁的发布签名 (由 gost-panel sign-agent 生成)，未签名时返回空
+func getAgentSignature(binaryPath string) string {
+	data, err := os.ReadFile(binaryPath + signing.SignatureExt)
+	if err != nil {
+		return ""
+	}
+	return strings.TrimSpace(string(data))
+}
+
 // getFileChecksum calculates SHA256 checksum of a file
 func getFileChecksum(path string) (string, error) {
 	file, err := os.Open(path)
@@ -146,41 +255,6 @@ func getFileChecksum(path string) (string, error) {
 	return fmt.Sprintf("%x", hash.Sum(nil)), nil
 }
 
-// compareVersions compares two semantic versions
-// Returns: -1 if v1 < v2, 0 if v1 == v2, 1 if v1 > v2
-func compareVersions(v1, v2 string) int {
-	// Remove 'v' prefix if present
-	v1 = strings.TrimPrefix(v1, "v")
-	v2 = strings.TrimPrefix(v2, "v")
-
-	parts1 := strings.Split(v1, ".")
-	parts2 := strings.Split(v2, ".")
-
-	maxLen := len(parts1)
-	if len(parts2) > maxLen {
-		maxLen = len(parts2)
-	}
-
-	for i := 0; i < maxLen; i++ {
-		var n1, n2 int
-		if i < len(parts1) {
-			fmt.Sscanf(parts1[i], "%d", &n1)
-		}
-		if i < len(parts2) {
-			fmt.Sscanf(parts2[i], "%d", &n2)
-		}
-
-		if n1 < n2 {
-			return -1
-		}
-		if n1 > n2 {
-			return 1
-		}
-	}
-
-	return 0
-}
-
 // clientHeartbeat handles client heartbeat requests
 func (s *Server) clientHeartbeat(c *gin.Context) {
 	token := c.Param("token")
@@ -188,8 +262,12 @@ func (s *Server) clientHeartbeat(c *gin.Context) {
 	// Update client status
 	err := s.svc.UpdateClientHeartbeat(token)
 	if err != nil {
-		// Client deleted or token invalid - signal remote to uninstall
-		c.JSON(http.StatusGone, gin.H{"error": "client not found", "uninstall": true})
+		// 只有由面板删除的客户端才通知卸载 (410)，未知 Token 不触发卸载
+		if s.svc.DecommissionCommandByToken(token) != nil {
+			c.JSON(http.StatusGone, gin.H{"error": "client deleted", "uninstall": true})
+			return
+		}
+		c.JSON(http.StatusNotFound, gin.H{"error": "client not found"})
 		return
 	}
 
@@ -8,10 +8,14 @@ import (
 	"sync"
 	"time"
 
+	"github.com/AliceNetworks/gost-panel/internal/cluster"
 	"github.com/gin-gonic/gin"
 	"github.com/gorilla/websocket"
 )
 
+// wsBroadcastChannel 跨实例转发 WebSocket 广播的频道
+const wsBroadcastChannel = "ws:broadcast"
+
 // allowedWSOrigins 存储允许的 WebSocket 来源
 var allowedWSOrigins []string
 var wsDebugMode bool
@@ -105,27 +109,38 @@ type WSClient struct {
 	userID uint
 }
 
-// WSHub maintains active WebSocket connections
+// WSHub maintains active WebSocket connections.
+// Broadcasts go through the cluster store so clients connected to other replicas receive them too.
 type WSHub struct {
 	clients    map[*WSClient]bool
 	broadcast  chan []byte
 	register   chan *WSClient
 	unregister chan *WSClient
+	store      cluster.Store
 	mu         sync.RWMutex
 }
 
 // NewWSHub creates a new WebSocket hub
-func NewWSHub() *WSHub {
+func NewWSHub(store cluster.Store) *WSHub {
 	return &WSHub{
 		clients:    make(map[*WSClient]bool),
 		broadcast:  make(chan []byte, 256),
 		register:   make(chan *WSClient),
 		unregister: make(chan *WSClient),
+		store:      store,
 	}
 }
 
 // Run starts the hub's main loop
 func (h *WSHub) Run() {
+	// 接收所有实例 (包括当前实例) 发布的广播
+	messages, _ := h.store.Subscribe(wsBroadcastChannel)
+	go func() {
+		for message := range messages {
+			h.deliver(message)
+		}
+	}()
+
 	for {
 		select {
 		case client := <-h.register:
@@ -170,8 +185,16 @@ func (h *WSHub) Broadcast(msgType string, data interface{}) {
 		return
 	}
 
+	if err := h.store.Publish(wsBroadcastChannel, jsonData); err != nil {
+		log.Printf("Failed to publish WebSocket message, delivering locally: %v", err)
+		h.deliver(jsonData)
+	}
+}
+
+// deliver queues a message for the clients connected to this instance
+func (h *WSHub) deliver(message []byte) {
 	select {
-	case h.broadcast <- jsonData:
+	case h.broadcast <- message:
 	default:
 		log.Println("WebSocket broadcast channel full, dropping message")
 	}
@@ -184,6 +207,15 @@ func (h *WSHub) ClientCount() int {
 	return len(h.clients)
 }
 
+// CloseAll closes all client connections (clients reconnect and re-authenticate)
+func (h *WSHub) CloseAll() {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	for client := range h.clients {
+		client.conn.Close()
+	}
+}
+
 // writePump pumps messages from the hub to the WebSocket connection
 func (c *WSClient) writePump() {
 	ticker := time.NewTicker(30 * time.Second)
@@ -0,0 +1,99 @@
+package backup
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+)
+
+// 备份存储类型
+const (
+	TargetLocal  = "local"
+	TargetS3     = "s3"
+	TargetWebDAV = "webdav"
+)
+
+// Object 已存储的备份文件
+type Object struct {
+	Name      string    `json:"name"`
+	Size      int64     `json:"size"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// Target 备份存储接口
+type Target interface {
+	// Put 上传备份文件，size 为内容长度
+	Put(name string, r io.Reader, size int64) error
+	// List 列出所有备份文件
+	List() ([]Object, error)
+	// Get 读取备份文件，调用方负责关闭
+	Get(name string) (io.ReadCloser, error)
+	// Delete 删除备份文件
+	Delete(name string) error
+}
+
+// LocalConfig 本地目录存储配置
+type LocalConfig struct {
+	Dir string `json:"dir"` // 为空时使用数据库所在目录下的 backups
+}
+
+// S3Config S3 兼容存储配置 (AWS S3 / MinIO / R2 等)
+type S3Config struct {
+	Endpoint  string `json:"endpoint"` // 例如 https://s3.amazonaws.com 或 http://127.0.0.1:9000
+	Region    string `json:"region"`   // 默认 us-east-1
+	Bucket    string `json:"bucket"`
+	Prefix    string `json:"prefix"` // 对象键前缀，例如 gost-panel/
+	AccessKey string `json:"access_key"`
+	SecretKey string `json:"secret_key"`
+	PathStyle bool   `json:"path_style"` // 使用路径风格 (MinIO 等自建服务通常需要)
+}
+
+// WebDAVConfig WebDAV 存储配置
+type WebDAVConfig struct {
+	URL      string `json:"url"` // 备份目录地址，例如 https://dav.example.com/backups/
+	Username string `json:"username"`
+	Password string `json:"password"`
+}
+
+// NewTarget 根据存储类型和 JSON 配置创建备份存储，defaultDir 为本地存储的默认目录
+func NewTarget(kind, config, defaultDir string) (Target, error) {
+	if strings.TrimSpace(config) == "" {
+		config = "{}"
+	}
+
+	switch kind {
+	case "", TargetLocal:
+		var cfg LocalConfig
+		if err := json.Unmarshal([]byte(config), &cfg); err != nil {
+			return nil, fmt.Errorf("parse local config failed: %w", err)
+		}
+		if cfg.Dir == "" {
+			cfg.Dir = defaultDir
+		}
+		return NewLocalTarget(cfg.Dir), nil
+
+	case TargetS3:
+		var cfg S3Config
+		if err := json.Unmarshal([]byte(config), &cfg); err != nil {
+			return nil, fmt.Errorf("parse s3 config failed: %w", err)
+		}
+		return NewS3Target(&cfg)
+
+	case TargetWebDAV:
+		var cfg WebDAVConfig
+		if err := json.Unmarshal([]byte(config), &cfg); err != nil {
+			return nil, fmt.Errorf("parse webdav config failed: %w", err)
+		}
+		return NewWebDAVTarget(&cfg)
+
+	default:
+		return nil, fmt.Errorf("unknown backup target: %s", kind)
+	}
+}
+
+// ValidName 检查备份文件名，防止路径穿越
+func ValidName(name string) bool {
+	return name != "" && name != "." && name != ".." && !strings.ContainsAny(name, `/\`)
+}
@@ -0,0 +1,267 @@
+// Package backuptest 提供用于测试备份存储的 S3 和 WebDAV 服务
+package backuptest
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"golang.org/x/net/webdav"
+)
+
+// S3Server 内存中的 S3 兼容服务 (路径风格)，校验 AWS Signature V4 签名
+type S3Server struct {
+	*httptest.Server
+	Bucket    string
+	AccessKey string
+	SecretKey string
+	Region    string
+	PageSize  int // ListObjectsV2 每页数量，用于测试分页
+
+	mu      sync.Mutex
+	objects map[string][]byte
+}
+
+// NewS3Server 启动 S3 服务，测试结束时关闭
+func NewS3Server(t *testing.T) *S3Server {
+	t.Helper()
+	s := &S3Server{
+		Bucket:    "backups",
+		AccessKey: "AKIDEXAMPLE",
+		SecretKey: "wJalrXUtnFEMI/K7MDENG+bPxRfiCYEXAMPLEKEY",
+		Region:    "us-east-1",
+		PageSize:  1000,
+		objects:   make(map[string][]byte),
+	}
+	s.Server = httptest.NewServer(http.HandlerFunc(s.handle))
+	t.Cleanup(s.Close)
+	return s
+}
+
+// Keys 返回已存储的对象键
+func (s *S3Server) Keys() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	keys := make([]string, 0, len(s.objects))
+	for k := range s.objects {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// PutObject 直接写入对象 (不经过签名请求)
+func (s *S3Server) PutObject(key string, data []byte) {
+	s.mu.Lock()
+	s.objects[key] = data
+	s.mu.Unlock()
+}
+
+func (s *S3Server) handle(w http.ResponseWriter, r *http.Request) {
+	if err := s.verify(r); err != nil {
+		http.Error(w, err.Error(), http.StatusForbidden)
+		return
+	}
+	prefix := "/" + s.Bucket
+	if r.URL.Path != prefix && !strings.HasPrefix(r.URL.Path, prefix+"/") {
+		http.Error(w, "NoSuchBucket", http.StatusNotFound)
+		return
+	}
+	key := strings.TrimPrefix(strings.TrimPrefix(r.URL.Path, prefix), "/")
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	switch {
+	case r.Method == http.MethodGet && key == "":
+		s.list(w, r.URL.Query())
+	case r.Method == http.MethodPut && key != "":
+		data, err := io.ReadAll(r.Body)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if r.ContentLength != int64(len(data)) {
+			http.Error(w, "content length mismatch", http.StatusBadRequest)
+			return
+		}
+		s.objects[key] = data
+	case r.Method == http.MethodGet && key != "":
+		data, ok := s.objects[key]
+		if !ok {
+			http.Error(w, "NoSuchKey", http.StatusNotFound)
+			return
+		}
+		w.Write(data)
+	case r.Method == http.MethodDelete && key != "":
+		delete(s.objects, key)
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		http.Error(w, "unsupported", http.StatusMethodNotAllowed)
+	}
+}
+
+type s3Contents struct {
+	Key          string `xml:"Key"`
+	Size         int64  `xml:"Size"`
+	LastModified string `xml:"LastModified"`
+}
+
+type s3ListBucketResult struct {
+	XMLName               xml.Name     `xml:"ListBucketResult"`
+	Contents              []s3Contents `xml:"Contents"`
+	IsTruncated           bool         `xml:"IsTruncated"`
+	NextContinuationToken string       `xml:"NextContinuationToken,omitempty"`
+}
+
+// list ListObjectsV2，continuation-token 为下一页的起始序号
+func (s *S3Server) list(w http.ResponseWriter, query url.Values) {
+	if query.Get("list-type") != "2" {
+		http.Error(w, "only ListObjectsV2 is supported", http.StatusBadRequest)
+		return
+	}
+	var keys []string
+	for k := range s.objects {
+		if strings.HasPrefix(k, query.Get("prefix")) {
+			keys = append(keys, k)
+		}
+	}
+	sort.Strings(keys)
+
+	start, _ := strconv.Atoi(query.Get("continuation-token"))
+	end := min(start+s.PageSize, len(keys))
+	result := s3ListBucketResult{}
+	for _, k := range keys[start:end] {
+		result.Contents = append(result.Contents, s3Contents{
+			Key:          k,
+			Size:         int64(len(s.objects[k])),
+			LastModified: "2024-01-02T03:04:05.000Z",
+		})
+	}
+	if end < len(keys) {
+		result.IsTruncated = true
+		result.NextContinuationToken = strconv.Itoa(end)
+	}
+	w.Header().Set("Content-Type", "application/xml")
+	xml.NewEncoder(w).Encode(result)
+}
+
+// verify 按服务端收到的请求重新计算 SigV4 签名
+func (s *S3Server) verify(r *http.Request) error {
+	auth := r.Header.Get("Authorization")
+	amzDate := r.Header.Get("X-Amz-Date")
+	payloadHash := r.Header.Get("X-Amz-Content-Sha256")
+	if !strings.HasPrefix(auth, "AWS4-HMAC-SHA256 ") || amzDate == "" || payloadHash == "" {
+		return fmt.Errorf("missing signature")
+	}
+	fields := map[string]string{}
+	for _, part := range strings.Split(strings.TrimPrefix(auth, "AWS4-HMAC-SHA256 "), ",") {
+		if k, v, ok := strings.Cut(strings.TrimSpace(part), "="); ok {
+			fields[k] = v
+		}
+	}
+
+	signedAt, err := time.Parse("20060102T150405Z", amzDate)
+	if err != nil || time.Since(signedAt).Abs() > 15*time.Minute {
+		return fmt.Errorf("invalid x-amz-date")
+	}
+	scope := signedAt.Format("20060102") + "/" + s.Region + "/s3/aws4_request"
+	if fields["Credential"] != s.AccessKey+"/"+scope {
+		return fmt.Errorf("invalid credential scope %q", fields["Credential"])
+	}
+
+	// 规范请求: 查询参数按键排序，使用 RFC 3986 编码
+	query := r.URL.Query()
+	keys := make([]string, 0, len(query))
+	for k := range query {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	var params []string
+	for _, k := range keys {
+		for _, v := range query[k] {
+			params = append(params, awsEscape(k)+"="+awsEscape(v))
+		}
+	}
+	var headers strings.Builder
+	signed := strings.Split(fields["SignedHeaders"], ";")
+	for _, h := range signed {
+		v := r.Header.Get(h)
+		if h == "host" {
+			v = r.Host
+		}
+		headers.WriteString(h + ":" + strings.TrimSpace(v) + "\n")
+	}
+	canonical := strings.Join([]string{
+		r.Method,
+		r.URL.EscapedPath(),
+		strings.Join(params, "&"),
+		headers.String(),
+		fields["SignedHeaders"],
+		payloadHash,
+	}, "\n")
+	hash := sha256.Sum256([]byte(canonical))
+	stringToSign := "AWS4-HMAC-SHA256\n" + amzDate + "\n" + scope + "\n" + hex.EncodeToString(hash[:])
+
+	key := []byte("AWS4" + s.SecretKey)
+	for _, part := range []string{signedAt.Format("20060102"), s.Region, "s3", "aws4_request"} {
+		key = hmacSHA256(key, part)
+	}
+	want := hex.EncodeToString(hmacSHA256(key, stringToSign))
+	if !hmac.Equal([]byte(fields["Signature"]), []byte(want)) {
+		return fmt.Errorf("SignatureDoesNotMatch")
+	}
+	return nil
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	h := hmac.New(sha256.New, key)
+	h.Write([]byte(data))
+	return h.Sum(nil)
+}
+
+// awsEscape RFC 3986 编码 (url.QueryEscape 把空格编码为 +，需要替换)
+func awsEscape(s string) string {
+	return strings.ReplaceAll(url.QueryEscape(s), "+", "%20")
+}
+
+// WebDAVServer 内存中的 WebDAV 服务，要求 Basic 认证
+type WebDAVServer struct {
+	*httptest.Server
+	Username string
+	Password string
+	FS       webdav.FileSystem
+}
+
+// NewWebDAVServer 启动 WebDAV 服务，测试结束时关闭
+func NewWebDAVServer(t *testing.T) *WebDAVServer {
+	t.Helper()
+	s := &WebDAVServer{
+		Username: "backup",
+		Password: "secret",
+		FS:       webdav.NewMemFS(),
+	}
+	handler := &webdav.Handler{FileSystem: s.FS, LockSystem: webdav.NewMemLS()}
+	s.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		user, pass, ok := r.BasicAuth()
+		if !ok || user != s.Username || pass != s.Password {
+			w.Header().Set("WWW-Authenticate", `Basic realm="webdav"`)
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+		handler.ServeHTTP(w, r)
+	}))
+	t.Cleanup(s.Close)
+	return s
+}
@@ -0,0 +1,87 @@
+package backup
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"errors"
+
+	"golang.org/x/crypto/pbkdf2"
+)
+
+// 加密备份格式: magic | salt(16) | nonce(12) | AES-256-GCM 密文
+// 密钥由口令经 PBKDF2-HMAC-SHA256 派生
+const (
+	encMagic      = "GPBKENC1"
+	encSaltSize   = 16
+	encIterations = 200000
+)
+
+// EncryptedExt 加密备份的文件扩展名
+const EncryptedExt = ".enc"
+
+var ErrDecrypt = errors.New("backup decryption failed (wrong key or corrupted file)")
+
+// IsEncrypted 检查数据是否为加密备份
+func IsEncrypted(data []byte) bool {
+	return bytes.HasPrefix(data, []byte(encMagic))
+}
+
+// Encrypt 使用口令加密备份数据
+func Encrypt(plaintext []byte, passphrase string) ([]byte, error) {
+	salt := make([]byte, encSaltSize)
+	if _, err := rand.Read(salt); err != nil {
+		return nil, err
+	}
+	gcm, err := newGCM(passphrase, salt)
+	if err != nil {
+		return nil, err
+	}
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+
+	out := make([]byte, 0, len(encMagic)+len(salt)+len(nonce)+len(plaintext)+gcm.Overhead())
+	out = append(out, encMagic...)
+	out = append(out, salt...)
+	out = append(out, nonce...)
+	return gcm.Seal(out, nonce, plaintext, []byte(encMagic)), nil
+}
+
+// Decrypt 解密备份数据
+func Decrypt(data []byte, passphrase string) ([]byte, error) {
+	if !IsEncrypted(data) {
+		return nil, errors.New("not an encrypted backup")
+	}
+	data = data[len(encMagic):]
+	if len(data) < encSaltSize {
+		return nil, ErrDecrypt
+	}
+	salt, data := data[:encSaltSize], data[encSaltSize:]
+
+	gcm, err := newGCM(passphrase, salt)
+	if err != nil {
+		return nil, err
+	}
+	if len(data) < gcm.NonceSize() {
+		return nil, ErrDecrypt
+	}
+	nonce, ciphertext := data[:gcm.NonceSize()], data[gcm.NonceSize():]
+
+	plaintext, err := gcm.Open(nil, nonce, ciphertext, []byte(encMagic))
+	if err != nil {
+		return nil, ErrDecrypt
+	}
+	return plaintext, nil
+}
+
+func newGCM(passphrase string, salt []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(pbkdf2.Key([]byte(passphrase), salt, encIterations, 32, sha256.New))
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
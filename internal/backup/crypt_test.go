@@ -0,0 +1,66 @@
+package backup
+
+import (
+	"bytes"
+	"encoding/base64"
+	"errors"
+	"testing"
+)
+
+func TestEncryptRoundTrip(t *testing.T) {
+	plain := []byte("SQLite format 3\x00backup data")
+	data, err := Encrypt(plain, "correct horse")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !IsEncrypted(data) || bytes.Contains(data, plain) {
+		t.Fatal("Encrypt output is not an encrypted backup")
+	}
+
+	got, err := Decrypt(data, "correct horse")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, plain) {
+		t.Fatalf("Decrypt() = %q, want %q", got, plain)
+	}
+}
+
+func TestDecryptRejectsWrongKeyAndTampering(t *testing.T) {
+	data, err := Encrypt([]byte("backup"), "correct horse")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := Decrypt(data, "wrong horse"); !errors.Is(err, ErrDecrypt) {
+		t.Fatalf("Decrypt() with wrong key = %v, want ErrDecrypt", err)
+	}
+
+	tampered := bytes.Clone(data)
+	tampered[len(tampered)-1] ^= 1
+	if _, err := Decrypt(tampered, "correct horse"); !errors.Is(err, ErrDecrypt) {
+		t.Fatalf("Decrypt() of tampered data = %v, want ErrDecrypt", err)
+	}
+
+	if _, err := Decrypt(data[:len(encMagic)+4], "correct horse"); !errors.Is(err, ErrDecrypt) {
+		t.Fatalf("Decrypt() of truncated data = %v, want ErrDecrypt", err)
+	}
+	if _, err := Decrypt([]byte("SQLite format 3\x00"), "correct horse"); err == nil {
+		t.Fatal("Decrypt() accepted an unencrypted backup")
+	}
+}
+
+// 更换 PBKDF2 实现前生成的加密备份仍可解密
+func TestDecryptExistingBackup(t *testing.T) {
+	data, err := base64.StdEncoding.DecodeString("R1BCS0VOQzGMpCXUtgXH6PcofwDvyUwVT628xdN8gHWe10PjcJb3MzgNeX7fhbvlvDvCGGXU1RUW/QJm+aD9Y3GRP37//nOoMFo=")
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := Decrypt(data, "correct horse")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "SQLite format 3\x00backup"; string(got) != want {
+		t.Fatalf("Decrypt() = %q, want %q", got, want)
+	}
+}
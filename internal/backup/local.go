@@ -0,0 +1,85 @@
+package backup
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+)
+
+// LocalTarget 本地目录存储
+type LocalTarget struct {
+	Dir string
+}
+
+func NewLocalTarget(dir string) *LocalTarget {
+	return &LocalTarget{Dir: dir}
+}
+
+func (t *LocalTarget) Put(name string, r io.Reader, size int64) error {
+	if !ValidName(name) {
+		return fmt.Errorf("invalid backup name: %s", name)
+	}
+	if err := os.MkdirAll(t.Dir, 0700); err != nil {
+		return err
+	}
+
+	// 先写入临时文件再重命名，避免留下不完整的备份
+	tmp, err := os.CreateTemp(t.Dir, "."+name+".*.tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := io.Copy(tmp, r); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), filepath.Join(t.Dir, name))
+}
+
+func (t *LocalTarget) List() ([]Object, error) {
+	entries, err := os.ReadDir(t.Dir)
+	if os.IsNotExist(err) {
+		return []Object{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	objects := make([]Object, 0, len(entries))
+	for _, e := range entries {
+		if e.IsDir() || e.Name()[0] == '.' {
+			continue
+		}
+		info, err := e.Info()
+		if err != nil {
+			continue
+		}
+		objects = append(objects, Object{Name: e.Name(), Size: info.Size(), CreatedAt: info.ModTime()})
+	}
+	sort.Slice(objects, func(i, j int) bool { return objects[i].Name < objects[j].Name })
+	return objects, nil
+}
+
+func (t *LocalTarget) Get(name string) (io.ReadCloser, error) {
+	if !ValidName(name) {
+		return nil, fmt.Errorf("invalid backup name: %s", name)
+	}
+	return os.Open(filepath.Join(t.Dir, name))
+}
+
+func (t *LocalTarget) Delete(name string) error {
+	if !ValidName(name) {
+		return fmt.Errorf("invalid backup name: %s", name)
+	}
+	return os.Remove(filepath.Join(t.Dir, name))
+}
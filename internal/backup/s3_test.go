@@ -0,0 +1,127 @@
+package backup
+
+import (
+	"bytes"
+	"io"
+	"reflect"
+	"testing"
+
+	"github.com/AliceNetworks/gost-panel/internal/backup/backuptest"
+)
+
+func newTestS3Target(t *testing.T, srv *backuptest.S3Server, prefix string) *S3Target {
+	t.Helper()
+	target, err := NewS3Target(&S3Config{
+		Endpoint:  srv.URL,
+		Region:    srv.Region,
+		Bucket:    srv.Bucket,
+		Prefix:    prefix,
+		AccessKey: srv.AccessKey,
+		SecretKey: srv.SecretKey,
+		PathStyle: true,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return target
+}
+
+func objectNames(objects []Object) []string {
+	names := make([]string, 0, len(objects))
+	for _, obj := range objects {
+		names = append(names, obj.Name)
+	}
+	return names
+}
+
+func readObject(t *testing.T, target Target, name string) []byte {
+	t.Helper()
+	rc, err := target.Get(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rc.Close()
+	data, err := io.ReadAll(rc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return data
+}
+
+// 上传、列出、下载和删除，服务端校验每个请求的签名
+func TestS3Target(t *testing.T) {
+	srv := backuptest.NewS3Server(t)
+	target := newTestS3Target(t, srv, "panel backups/")
+
+	data := []byte("SQLite format 3\x00backup")
+	if err := target.Put("gost-panel-backup-20240102-030405.db", bytes.NewReader(data), int64(len(data))); err != nil {
+		t.Fatal(err)
+	}
+	if err := target.Put("b c.db", bytes.NewReader(nil), 0); err != nil {
+		t.Fatal(err)
+	}
+	// 前缀之外和子目录中的对象不列出
+	srv.PutObject("other/x.db", []byte("x"))
+	srv.PutObject("panel backups/nested/y.db", []byte("y"))
+
+	objects, err := target.List()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := objectNames(objects), []string{"b c.db", "gost-panel-backup-20240102-030405.db"}; !reflect.DeepEqual(got, want) {
+		t.Fatalf("List() = %v, want %v", got, want)
+	}
+	if objects[1].Size != int64(len(data)) || objects[1].CreatedAt.IsZero() {
+		t.Fatalf("object = %+v, want size and modification time", objects[1])
+	}
+	if got := readObject(t, target, "gost-panel-backup-20240102-030405.db"); !bytes.Equal(got, data) {
+		t.Fatalf("Get() = %q, want %q", got, data)
+	}
+
+	if err := target.Delete("b c.db"); err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"other/x.db", "panel backups/gost-panel-backup-20240102-030405.db", "panel backups/nested/y.db"}
+	if got := srv.Keys(); !reflect.DeepEqual(got, want) {
+		t.Fatalf("keys after delete = %v, want %v", got, want)
+	}
+
+	if _, err := target.Get("missing.db"); err == nil {
+		t.Fatal("Get() of a missing object succeeded")
+	}
+}
+
+// 列表结果超过一页时跟随 continuation-token
+func TestS3TargetListPagination(t *testing.T) {
+	srv := backuptest.NewS3Server(t)
+	srv.PageSize = 2
+	target := newTestS3Target(t, srv, "")
+	for _, name := range []string{"a.db", "b.db", "c.db", "d.db", "e.db"} {
+		srv.PutObject(name, []byte(name))
+	}
+
+	objects, err := target.List()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := objectNames(objects), []string{"a.db", "b.db", "c.db", "d.db", "e.db"}; !reflect.DeepEqual(got, want) {
+		t.Fatalf("List() = %v, want %v", got, want)
+	}
+}
+
+// 签名错误时返回错误
+func TestS3TargetRejectedSignature(t *testing.T) {
+	srv := backuptest.NewS3Server(t)
+	target := newTestS3Target(t, srv, "")
+	target.cfg.SecretKey = "wrong-secret"
+
+	if err := target.Put("a.db", bytes.NewReader([]byte("a")), 1); err == nil {
+		t.Fatal("Put() succeeded with a wrong secret key")
+	}
+	if _, err := target.List(); err == nil {
+		t.Fatal("List() succeeded with a wrong secret key")
+	}
+	if len(srv.Keys()) != 0 {
+		t.Fatalf("objects stored with a wrong secret key: %v", srv.Keys())
+	}
+}
@@ -0,0 +1,173 @@
+package backup
+
+import (
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"path"
+	"sort"
+	"strings"
+	"time"
+)
+
+// WebDAVTarget WebDAV 存储
+type WebDAVTarget struct {
+	cfg    WebDAVConfig
+	base   *url.URL
+	client *http.Client
+}
+
+func NewWebDAVTarget(cfg *WebDAVConfig) (*WebDAVTarget, error) {
+	base, err := url.Parse(cfg.URL)
+	if err != nil || base.Host == "" || (base.Scheme != "http" && base.Scheme != "https") {
+		return nil, fmt.Errorf("invalid webdav url: %s", cfg.URL)
+	}
+	if !strings.HasSuffix(base.Path, "/") {
+		base.Path += "/"
+	}
+	return &WebDAVTarget{
+		cfg:    *cfg,
+		base:   base,
+		client: &http.Client{Timeout: 10 * time.Minute},
+	}, nil
+}
+
+func (t *WebDAVTarget) Put(name string, r io.Reader, size int64) error {
+	if !ValidName(name) {
+		return fmt.Errorf("invalid backup name: %s", name)
+	}
+
+	// 确保备份目录存在 (已存在时服务器返回 405)
+	if resp, err := t.request("MKCOL", "", nil, nil); err == nil {
+		resp.Body.Close()
+	}
+
+	resp, err := t.request("PUT", name, r, func(req *http.Request) {
+		req.ContentLength = size
+		req.Header.Set("Content-Type", "application/octet-stream")
+	})
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	return t.check(resp)
+}
+
+// davMultistatus PROPFIND 响应
+type davMultistatus struct {
+	Responses []struct {
+		Href     string `xml:"DAV: href"`
+		Propstat []struct {
+			Prop struct {
+				ContentLength int64  `xml:"DAV: getcontentlength"`
+				LastModified  string `xml:"DAV: getlastmodified"`
+				ResourceType  struct {
+					Collection *struct{} `xml:"DAV: collection"`
+				} `xml:"DAV: resourcetype"`
+			} `xml:"DAV: prop"`
+		} `xml:"DAV: propstat"`
+	} `xml:"DAV: response"`
+}
+
+func (t *WebDAVTarget) List() ([]Object, error) {
+	body := `<?xml version="1.0" encoding="utf-8"?>` +
+		`<propfind xmlns="DAV:"><prop><getcontentlength/><getlastmodified/><resourcetype/></prop></propfind>`
+	resp, err := t.request("PROPFIND", "", strings.NewReader(body), func(req *http.Request) {
+		req.Header.Set("Depth", "1")
+		req.Header.Set("Content-Type", "application/xml")
+	})
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode == http.StatusNotFound {
+		return []Object{}, nil
+	}
+	if err := t.check(resp); err != nil {
+		return nil, err
+	}
+
+	var result davMultistatus
+	if err := xml.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return nil, fmt.Errorf("parse webdav response failed: %w", err)
+	}
+
+	objects := []Object{}
+	for _, r := range result.Responses {
+		href, err := url.PathUnescape(r.Href)
+		if err != nil {
+			continue
+		}
+		name := path.Base(strings.TrimSuffix(href, "/"))
+		if !ValidName(name) || len(r.Propstat) == 0 {
+			continue
+		}
+		prop := r.Propstat[0].Prop
+		if prop.ResourceType.Collection != nil {
+			continue // 跳过目录 (包括备份目录本身)
+		}
+		obj := Object{Name: name, Size: prop.ContentLength}
+		if t, err := http.ParseTime(prop.LastModified); err == nil {
+			obj.CreatedAt = t
+		}
+		objects = append(objects, obj)
+	}
+	sort.Slice(objects, func(i, j int) bool { return objects[i].Name < objects[j].Name })
+	return objects, nil
+}
+
+func (t *WebDAVTarget) Get(name string) (io.ReadCloser, error) {
+	if !ValidName(name) {
+		return nil, fmt.Errorf("invalid backup name: %s", name)
+	}
+	resp, err := t.request("GET", name, nil, nil)
+	if err != nil {
+		return nil, err
+	}
+	if err := t.check(resp); err != nil {
+		resp.Body.Close()
+		return nil, err
+	}
+	return resp.Body, nil
+}
+
+func (t *WebDAVTarget) Delete(name string) error {
+	if !ValidName(name) {
+		return fmt.Errorf("invalid backup name: %s", name)
+	}
+	resp, err := t.request("DELETE", name, nil, nil)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	return t.check(resp)
+}
+
+// request 发送请求，name 为空表示备份目录本身
+func (t *WebDAVTarget) request(method, name string, body io.Reader, setup func(*http.Request)) (*http.Response, error) {
+	u := *t.base
+	u.Path += name
+	u.RawPath = ""
+
+	req, err := http.NewRequest(method, u.String(), body)
+	if err != nil {
+		return nil, err
+	}
+	if t.cfg.Username != "" {
+		req.SetBasicAuth(t.cfg.Username, t.cfg.Password)
+	}
+	if setup != nil {
+		setup(req)
+	}
+	return t.client.Do(req)
+}
+
+func (t *WebDAVTarget) check(resp *http.Response) error {
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return fmt.Errorf("webdav %s returned status %d: %s", resp.Request.Method, resp.StatusCode, strings.TrimSpace(string(msg)))
+	}
+	return nil
+}
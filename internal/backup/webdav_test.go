@@ -0,0 +1,92 @@
+package backup
+
+import (
+	"bytes"
+	"context"
+	"reflect"
+	"testing"
+
+	"github.com/AliceNetworks/gost-panel/internal/backup/backuptest"
+)
+
+func newTestWebDAVTarget(t *testing.T, srv *backuptest.WebDAVServer, password string) *WebDAVTarget {
+	t.Helper()
+	target, err := NewWebDAVTarget(&WebDAVConfig{
+		URL:      srv.URL + "/panel/backups",
+		Username: srv.Username,
+		Password: password,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return target
+}
+
+// 上传时创建备份目录，列出时跳过子目录
+func TestWebDAVTarget(t *testing.T) {
+	srv := backuptest.NewWebDAVServer(t)
+	target := newTestWebDAVTarget(t, srv, srv.Password)
+
+	// 备份目录不存在时为空
+	objects, err := target.List()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(objects) != 0 {
+		t.Fatalf("List() = %v, want empty", objects)
+	}
+
+	if err := srv.FS.Mkdir(context.Background(), "/panel", 0o755); err != nil {
+		t.Fatal(err)
+	}
+	data := []byte("SQLite format 3\x00backup")
+	for _, name := range []string{"gost-panel-backup-20240102-030405.db", "b c.db"} {
+		if err := target.Put(name, bytes.NewReader(data), int64(len(data))); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := srv.FS.Mkdir(context.Background(), "/panel/backups/nested", 0o755); err != nil {
+		t.Fatal(err)
+	}
+
+	objects, err = target.List()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := objectNames(objects), []string{"b c.db", "gost-panel-backup-20240102-030405.db"}; !reflect.DeepEqual(got, want) {
+		t.Fatalf("List() = %v, want %v", got, want)
+	}
+	if objects[1].Size != int64(len(data)) || objects[1].CreatedAt.IsZero() {
+		t.Fatalf("object = %+v, want size and modification time", objects[1])
+	}
+	if got := readObject(t, target, "gost-panel-backup-20240102-030405.db"); !bytes.Equal(got, data) {
+		t.Fatalf("Get() = %q, want %q", got, data)
+	}
+
+	if err := target.Delete("b c.db"); err != nil {
+		t.Fatal(err)
+	}
+	objects, err = target.List()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := objectNames(objects), []string{"gost-panel-backup-20240102-030405.db"}; !reflect.DeepEqual(got, want) {
+		t.Fatalf("List() after delete = %v, want %v", got, want)
+	}
+	if _, err := target.Get("b c.db"); err == nil {
+		t.Fatal("Get() of a deleted file succeeded")
+	}
+}
+
+// 认证失败时返回错误
+func TestWebDAVTargetUnauthorized(t *testing.T) {
+	srv := backuptest.NewWebDAVServer(t)
+	target := newTestWebDAVTarget(t, srv, "wrong")
+
+	if err := target.Put("a.db", bytes.NewReader([]byte("a")), 1); err == nil {
+		t.Fatal("Put() succeeded with a wrong password")
+	}
+	if _, err := target.List(); err == nil {
+		t.Fatal("List() succeeded with a wrong password")
+	}
+}
@@ -0,0 +1,102 @@
+package cluster
+
+import (
+	"log"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// leaderKey 主实例锁的键
+const leaderKey = "leader"
+
+// Elector 基于带过期时间的锁选举主实例：主实例定期续期，失联超过 ttl 后由其他实例接替
+type Elector struct {
+	store  Store
+	id     string
+	ttl    time.Duration
+	leader atomic.Bool
+	stopCh chan struct{}
+	wg     sync.WaitGroup
+}
+
+// NewElector 创建选举器
+func NewElector(store Store, instanceID string, ttl time.Duration) *Elector {
+	return &Elector{
+		store:  store,
+		id:     instanceID,
+		ttl:    ttl,
+		stopCh: make(chan struct{}),
+	}
+}
+
+// Start 立即参与一次选举，之后每 ttl/3 续期或重新竞选
+func (e *Elector) Start() {
+	e.campaign()
+	e.wg.Add(1)
+	go e.run()
+}
+
+// Stop 停止选举并主动释放主实例锁，其他实例无需等待过期即可接替
+func (e *Elector) Stop() {
+	close(e.stopCh)
+	e.wg.Wait()
+	if e.leader.Swap(false) {
+		if _, err := e.store.CompareAndDelete(leaderKey, e.id); err != nil {
+			log.Printf("Cluster: failed to release leadership: %v", err)
+		}
+	}
+}
+
+// IsLeader 当前实例是否为主实例
+func (e *Elector) IsLeader() bool {
+	return e.leader.Load()
+}
+
+// InstanceID 当前实例标识
+func (e *Elector) InstanceID() string {
+	return e.id
+}
+
+// Leader 当前主实例标识，无主实例时返回空
+func (e *Elector) Leader() string {
+	leader, _ := e.store.Get(leaderKey)
+	return leader
+}
+
+func (e *Elector) run() {
+	defer e.wg.Done()
+	ticker := time.NewTicker(e.ttl / 3)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			e.campaign()
+		case <-e.stopCh:
+			return
+		}
+	}
+}
+
+// campaign 主实例续期，其他实例尝试获取锁；存储不可用时放弃主实例身份，避免多个实例同时执行任务
+func (e *Elector) campaign() {
+	var ok bool
+	var err error
+	if e.leader.Load() {
+		ok, err = e.store.CompareAndExpire(leaderKey, e.id, e.ttl)
+	} else {
+		ok, err = e.store.SetNX(leaderKey, e.id, e.ttl)
+	}
+	if err != nil {
+		log.Printf("Cluster: leader election failed: %v", err)
+		ok = false
+	}
+
+	if was := e.leader.Swap(ok); was != ok {
+		if ok {
+			log.Printf("Cluster: instance %s became leader", e.id)
+		} else {
+			log.Printf("Cluster: instance %s lost leadership", e.id)
+		}
+	}
+}
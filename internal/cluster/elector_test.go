@@ -0,0 +1,82 @@
+package cluster
+
+import (
+	"testing"
+	"time"
+)
+
+func waitLeader(t *testing.T, e *Elector, want bool) {
+	t.Helper()
+	deadline := time.Now().Add(2 * time.Second)
+	for e.IsLeader() != want {
+		if time.Now().After(deadline) {
+			t.Fatalf("%s IsLeader() = %v, want %v", e.InstanceID(), !want, want)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+// 主实例按 ttl/3 续期，运行时间超过 ttl 仍保持主实例身份
+func TestElectorRenews(t *testing.T) {
+	store := newTestStore(t)
+	a := NewElector(store, "a", 150*time.Millisecond)
+	b := NewElector(store, "b", 150*time.Millisecond)
+	a.Start()
+	defer a.Stop()
+	b.Start()
+	defer b.Stop()
+
+	if !a.IsLeader() || b.IsLeader() {
+		t.Fatalf("leaders: a=%v b=%v, want only a", a.IsLeader(), b.IsLeader())
+	}
+	time.Sleep(500 * time.Millisecond)
+	if !a.IsLeader() || b.IsLeader() || b.Leader() != "a" {
+		t.Fatalf("after renewals: a=%v b=%v leader=%q, want a", a.IsLeader(), b.IsLeader(), b.Leader())
+	}
+}
+
+// 主实例失联 (不再续期) 超过 ttl 后由其他实例接替，恢复后不再认为自己是主实例
+func TestElectorFailoverOnExpiry(t *testing.T) {
+	store := newTestStore(t)
+	a := NewElector(store, "a", 150*time.Millisecond)
+	a.campaign() // 只竞选一次，模拟之后失联
+	if !a.IsLeader() {
+		t.Fatal("a did not become leader")
+	}
+
+	b := NewElector(store, "b", 150*time.Millisecond)
+	b.Start()
+	defer b.Stop()
+	if b.IsLeader() {
+		t.Fatal("b became leader while a's lock was still valid")
+	}
+	waitLeader(t, b, true)
+	if leader := b.Leader(); leader != "b" {
+		t.Fatalf("Leader() = %q, want b", leader)
+	}
+
+	// a 恢复后续期失败，放弃主实例身份
+	a.campaign()
+	if a.IsLeader() {
+		t.Fatal("a still leader after its lock expired")
+	}
+}
+
+// 主实例停止时释放锁，其他实例在下一次竞选时立即接替
+func TestElectorFailoverOnStop(t *testing.T) {
+	store := newTestStore(t)
+	a := NewElector(store, "a", time.Minute)
+	b := NewElector(store, "b", time.Minute)
+	a.Start()
+	b.Start()
+	defer b.Stop()
+
+	a.Stop()
+	if a.IsLeader() || b.Leader() != "" {
+		t.Fatalf("after stop: a=%v leader=%q, want lock released", a.IsLeader(), b.Leader())
+	}
+	b.campaign()
+	if !b.IsLeader() || b.Leader() != "b" {
+		t.Fatalf("b=%v leader=%q, want b", b.IsLeader(), b.Leader())
+	}
+}
@@ -0,0 +1,234 @@
+package cluster
+
+import (
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// MemoryStore 进程内存储，用于单实例部署 (也可作为测试替身)
+type MemoryStore struct {
+	mu     sync.Mutex
+	items  map[string]memoryItem
+	subs   map[string]map[chan []byte]struct{}
+	stopCh chan struct{}
+	once   sync.Once
+}
+
+type memoryItem struct {
+	value   string
+	expires time.Time // 零值表示不过期
+}
+
+func (i memoryItem) expired(now time.Time) bool {
+	return !i.expires.IsZero() && now.After(i.expires)
+}
+
+// NewMemoryStore 创建进程内存储
+func NewMemoryStore() *MemoryStore {
+	s := &MemoryStore{
+		items:  make(map[string]memoryItem),
+		subs:   make(map[string]map[chan []byte]struct{}),
+		stopCh: make(chan struct{}),
+	}
+	// 定期清理过期记录
+	go s.cleanup()
+	return s
+}
+
+func expiresAt(now time.Time, ttl time.Duration) time.Time {
+	if ttl <= 0 {
+		return time.Time{}
+	}
+	return now.Add(ttl)
+}
+
+// get 读取未过期的记录，调用方需持有锁
+func (s *MemoryStore) get(key string, now time.Time) (memoryItem, bool) {
+	item, ok := s.items[key]
+	if !ok {
+		return memoryItem{}, false
+	}
+	if item.expired(now) {
+		delete(s.items, key)
+		return memoryItem{}, false
+	}
+	return item, true
+}
+
+func (s *MemoryStore) Get(key string) (string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	item, _ := s.get(key, time.Now())
+	return item.value, nil
+}
+
+func (s *MemoryStore) Set(key, value string, ttl time.Duration) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.items[key] = memoryItem{value: value, expires: expiresAt(time.Now(), ttl)}
+	return nil
+}
+
+func (s *MemoryStore) SetNX(key, value string, ttl time.Duration) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	now := time.Now()
+	if _, ok := s.get(key, now); ok {
+		return false, nil
+	}
+	s.items[key] = memoryItem{value: value, expires: expiresAt(now, ttl)}
+	return true, nil
+}
+
+func (s *MemoryStore) Incr(key string, ttl time.Duration) (int64, time.Duration, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	now := time.Now()
+	item, ok := s.get(key, now)
+	if !ok {
+		item = memoryItem{value: "0", expires: expiresAt(now, ttl)}
+	}
+	n, _ := strconv.ParseInt(item.value, 10, 64)
+	n++
+	item.value = strconv.FormatInt(n, 10)
+	s.items[key] = item
+
+	var remaining time.Duration
+	if !item.expires.IsZero() {
+		remaining = item.expires.Sub(now)
+	}
+	return n, remaining, nil
+}
+
+func (s *MemoryStore) TTL(key string) (time.Duration, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	now := time.Now()
+	item, ok := s.get(key, now)
+	if !ok || item.expires.IsZero() {
+		return 0, nil
+	}
+	return item.expires.Sub(now), nil
+}
+
+func (s *MemoryStore) Del(keys ...string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, key := range keys {
+		delete(s.items, key)
+	}
+	return nil
+}
+
+func (s *MemoryStore) DelPrefix(prefix string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for key := range s.items {
+		if strings.HasPrefix(key, prefix) {
+			delete(s.items, key)
+		}
+	}
+	return nil
+}
+
+func (s *MemoryStore) Keys(prefix string) ([]string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	now := time.Now()
+	var keys []string
+	for key, item := range s.items {
+		if strings.HasPrefix(key, prefix) && !item.expired(now) {
+			keys = append(keys, key)
+		}
+	}
+	return keys, nil
+}
+
+func (s *MemoryStore) CompareAndExpire(key, value string, ttl time.Duration) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	now := time.Now()
+	item, ok := s.get(key, now)
+	if !ok || item.value != value {
+		return false, nil
+	}
+	item.expires = expiresAt(now, ttl)
+	s.items[key] = item
+	return true, nil
+}
+
+func (s *MemoryStore) CompareAndDelete(key, value string) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	item, ok := s.get(key, time.Now())
+	if !ok || item.value != value {
+		return false, nil
+	}
+	delete(s.items, key)
+	return true, nil
+}
+
+// Publish 投递给所有订阅者，订阅者缓冲区满时丢弃该消息
+func (s *MemoryStore) Publish(channel string, payload []byte) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for ch := range s.subs[channel] {
+		select {
+		case ch <- payload:
+		default:
+		}
+	}
+	return nil
+}
+
+func (s *MemoryStore) Subscribe(channel string) (<-chan []byte, func()) {
+	ch := make(chan []byte, 256)
+	s.mu.Lock()
+	if s.subs[channel] == nil {
+		s.subs[channel] = make(map[chan []byte]struct{})
+	}
+	s.subs[channel][ch] = struct{}{}
+	s.mu.Unlock()
+
+	var once sync.Once
+	return ch, func() {
+		once.Do(func() {
+			s.mu.Lock()
+			delete(s.subs[channel], ch)
+			s.mu.Unlock()
+			close(ch)
+		})
+	}
+}
+
+func (s *MemoryStore) Name() string {
+	return "memory"
+}
+
+func (s *MemoryStore) Close() error {
+	s.once.Do(func() { close(s.stopCh) })
+	return nil
+}
+
+// cleanup 定期清理过期记录
+func (s *MemoryStore) cleanup() {
+	ticker := time.NewTicker(time.Minute)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			s.mu.Lock()
+			now := time.Now()
+			for key, item := range s.items {
+				if item.expired(now) {
+					delete(s.items, key)
+				}
+			}
+			s.mu.Unlock()
+		case <-s.stopCh:
+			return
+		}
+	}
+}
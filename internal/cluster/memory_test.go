@@ -0,0 +1,184 @@
+package cluster
+
+import (
+	"sort"
+	"testing"
+	"time"
+)
+
+func newTestStore(t *testing.T) *MemoryStore {
+	t.Helper()
+	s := NewMemoryStore()
+	t.Cleanup(func() { s.Close() })
+	return s
+}
+
+func TestMemoryStoreExpiry(t *testing.T) {
+	s := newTestStore(t)
+
+	s.Set("short", "a", 50*time.Millisecond)
+	s.Set("forever", "b", 0)
+	if v, _ := s.Get("short"); v != "a" {
+		t.Fatalf("Get(short) = %q, want a", v)
+	}
+	if ttl, _ := s.TTL("short"); ttl <= 0 || ttl > 50*time.Millisecond {
+		t.Fatalf("TTL(short) = %v, want (0, 50ms]", ttl)
+	}
+	if ttl, _ := s.TTL("forever"); ttl != 0 {
+		t.Fatalf("TTL(forever) = %v, want 0", ttl)
+	}
+
+	time.Sleep(80 * time.Millisecond)
+	if v, _ := s.Get("short"); v != "" {
+		t.Fatalf("Get(short) after expiry = %q, want empty", v)
+	}
+	if keys, _ := s.Keys(""); len(keys) != 1 || keys[0] != "forever" {
+		t.Fatalf("Keys() = %v, want [forever]", keys)
+	}
+
+	// 过期后可以重新 SetNX
+	if ok, _ := s.SetNX("short", "c", time.Minute); !ok {
+		t.Fatal("SetNX() on an expired key failed")
+	}
+	if ok, _ := s.SetNX("short", "d", time.Minute); ok {
+		t.Fatal("SetNX() on an existing key succeeded")
+	}
+	if v, _ := s.Get("short"); v != "c" {
+		t.Fatalf("Get(short) = %q, want c", v)
+	}
+}
+
+// 计数的过期时间从第一次计数开始，之后的计数不延长窗口
+func TestMemoryStoreIncr(t *testing.T) {
+	s := newTestStore(t)
+
+	n, ttl, _ := s.Incr("counter", 100*time.Millisecond)
+	if n != 1 || ttl <= 0 || ttl > 100*time.Millisecond {
+		t.Fatalf("Incr() = %d, %v; want 1 with ttl", n, ttl)
+	}
+	time.Sleep(30 * time.Millisecond)
+	n, ttl2, _ := s.Incr("counter", 100*time.Millisecond)
+	if n != 2 || ttl2 >= ttl {
+		t.Fatalf("Incr() = %d, %v; want 2 with ttl below %v", n, ttl2, ttl)
+	}
+
+	time.Sleep(100 * time.Millisecond)
+	if n, _, _ := s.Incr("counter", 100*time.Millisecond); n != 1 {
+		t.Fatalf("Incr() after window = %d, want 1", n)
+	}
+}
+
+func TestMemoryStoreDelPrefix(t *testing.T) {
+	s := newTestStore(t)
+	for _, key := range []string{"a:1", "a:2", "b:1"} {
+		s.Set(key, "x", 0)
+	}
+
+	keys, _ := s.Keys("a:")
+	sort.Strings(keys)
+	if len(keys) != 2 || keys[0] != "a:1" || keys[1] != "a:2" {
+		t.Fatalf("Keys(a:) = %v", keys)
+	}
+	s.DelPrefix("a:")
+	if keys, _ := s.Keys(""); len(keys) != 1 || keys[0] != "b:1" {
+		t.Fatalf("Keys() after DelPrefix = %v, want [b:1]", keys)
+	}
+	s.Del("b:1")
+	if v, _ := s.Get("b:1"); v != "" {
+		t.Fatalf("Get(b:1) after Del = %q", v)
+	}
+}
+
+// 只有持有者可以续期和释放
+func TestMemoryStoreCompareAndExpire(t *testing.T) {
+	s := newTestStore(t)
+	s.Set("lock", "owner", 50*time.Millisecond)
+
+	if ok, _ := s.CompareAndExpire("lock", "other", time.Minute); ok {
+		t.Fatal("CompareAndExpire() succeeded for another holder")
+	}
+	if ok, _ := s.CompareAndExpire("lock", "owner", 200*time.Millisecond); !ok {
+		t.Fatal("CompareAndExpire() failed for the holder")
+	}
+	time.Sleep(80 * time.Millisecond)
+	if v, _ := s.Get("lock"); v != "owner" {
+		t.Fatalf("renewed lock expired: %q", v)
+	}
+
+	if ok, _ := s.CompareAndDelete("lock", "other"); ok {
+		t.Fatal("CompareAndDelete() succeeded for another holder")
+	}
+	if ok, _ := s.CompareAndDelete("lock", "owner"); !ok {
+		t.Fatal("CompareAndDelete() failed for the holder")
+	}
+	if ok, _ := s.CompareAndExpire("lock", "owner", time.Minute); ok {
+		t.Fatal("CompareAndExpire() succeeded on a released lock")
+	}
+}
+
+func receive(t *testing.T, ch <-chan []byte) string {
+	t.Helper()
+	select {
+	case msg := <-ch:
+		return string(msg)
+	case <-time.After(time.Second):
+		t.Fatal("timed out waiting for message")
+		return ""
+	}
+}
+
+// 广播给频道的所有订阅者，取消订阅后关闭通道
+func TestMemoryStorePubSub(t *testing.T) {
+	s := newTestStore(t)
+	a, cancelA := s.Subscribe("events")
+	b, cancelB := s.Subscribe("events")
+	other, cancelOther := s.Subscribe("other")
+	defer cancelB()
+	defer cancelOther()
+
+	s.Publish("events", []byte("hello"))
+	if got := receive(t, a); got != "hello" {
+		t.Fatalf("subscriber a got %q", got)
+	}
+	if got := receive(t, b); got != "hello" {
+		t.Fatalf("subscriber b got %q", got)
+	}
+	select {
+	case msg := <-other:
+		t.Fatalf("subscriber of another channel got %q", msg)
+	default:
+	}
+
+	cancelA()
+	cancelA() // 重复取消不会 panic
+	if _, ok := <-a; ok {
+		t.Fatal("channel not closed after unsubscribe")
+	}
+	s.Publish("events", []byte("again"))
+	if got := receive(t, b); got != "again" {
+		t.Fatalf("subscriber b got %q", got)
+	}
+}
+
+// 订阅者不读取时丢弃消息，不阻塞发布方
+func TestMemoryStorePublishDoesNotBlock(t *testing.T) {
+	s := newTestStore(t)
+	ch, cancel := s.Subscribe("events")
+	defer cancel()
+
+	done := make(chan struct{})
+	go func() {
+		for i := 0; i < 1000; i++ {
+			s.Publish("events", []byte("x"))
+		}
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("Publish blocked on a slow subscriber")
+	}
+	if n := len(ch); n != cap(ch) {
+		t.Fatalf("buffered %d messages, want %d", n, cap(ch))
+	}
+}
@@ -0,0 +1,199 @@
+package cluster
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// redisKeyPrefix 所有键和频道的前缀，便于与其他应用共用一个 Redis
+const redisKeyPrefix = "gost-panel:"
+
+// redisTimeout 单次操作超时
+const redisTimeout = 3 * time.Second
+
+var (
+	// 计数加一，新建时设置过期时间，返回 {计数, 剩余毫秒}
+	incrScript = redis.NewScript(`
+local n = redis.call('INCR', KEYS[1])
+if n == 1 and tonumber(ARGV[1]) > 0 then
+	redis.call('PEXPIRE', KEYS[1], ARGV[1])
+end
+return {n, redis.call('PTTL', KEYS[1])}`)
+
+	compareAndExpireScript = redis.NewScript(`
+if redis.call('GET', KEYS[1]) == ARGV[1] then
+	return redis.call('PEXPIRE', KEYS[1], ARGV[2])
+end
+return 0`)
+
+	compareAndDeleteScript = redis.NewScript(`
+if redis.call('GET', KEYS[1]) == ARGV[1] then
+	return redis.call('DEL', KEYS[1])
+end
+return 0`)
+)
+
+// RedisStore 基于 Redis 的共享存储，兼容 Valkey/KeyDB/Dragonfly 等协议兼容实现
+type RedisStore struct {
+	client *redis.Client
+}
+
+// NewRedisStore 连接 Redis，地址格式: redis://[:password@]host:port/db 或 rediss://...
+func NewRedisStore(url string) (*RedisStore, error) {
+	opts, err := redis.ParseURL(url)
+	if err != nil {
+		return nil, fmt.Errorf("invalid REDIS_URL: %w", err)
+	}
+	client := redis.NewClient(opts)
+
+	ctx, cancel := context.WithTimeout(context.Background(), redisTimeout)
+	defer cancel()
+	if err := client.Ping(ctx).Err(); err != nil {
+		client.Close()
+		return nil, fmt.Errorf("connect redis: %w", err)
+	}
+	return &RedisStore{client: client}, nil
+}
+
+func redisContext() (context.Context, context.CancelFunc) {
+	return context.WithTimeout(context.Background(), redisTimeout)
+}
+
+func (s *RedisStore) Get(key string) (string, error) {
+	ctx, cancel := redisContext()
+	defer cancel()
+	value, err := s.client.Get(ctx, redisKeyPrefix+key).Result()
+	if err == redis.Nil {
+		return "", nil
+	}
+	return value, err
+}
+
+func (s *RedisStore) Set(key, value string, ttl time.Duration) error {
+	ctx, cancel := redisContext()
+	defer cancel()
+	return s.client.Set(ctx, redisKeyPrefix+key, value, ttl).Err()
+}
+
+func (s *RedisStore) SetNX(key, value string, ttl time.Duration) (bool, error) {
+	ctx, cancel := redisContext()
+	defer cancel()
+	return s.client.SetNX(ctx, redisKeyPrefix+key, value, ttl).Result()
+}
+
+func (s *RedisStore) Incr(key string, ttl time.Duration) (int64, time.Duration, error) {
+	ctx, cancel := redisContext()
+	defer cancel()
+	result, err := incrScript.Run(ctx, s.client, []string{redisKeyPrefix + key}, ttl.Milliseconds()).Int64Slice()
+	if err != nil {
+		return 0, 0, err
+	}
+	var remaining time.Duration
+	if result[1] > 0 {
+		remaining = time.Duration(result[1]) * time.Millisecond
+	}
+	return result[0], remaining, nil
+}
+
+func (s *RedisStore) TTL(key string) (time.Duration, error) {
+	ctx, cancel := redisContext()
+	defer cancel()
+	ttl, err := s.client.PTTL(ctx, redisKeyPrefix+key).Result()
+	if err != nil || ttl < 0 {
+		return 0, err
+	}
+	return ttl, nil
+}
+
+func (s *RedisStore) Del(keys ...string) error {
+	if len(keys) == 0 {
+		return nil
+	}
+	full := make([]string, len(keys))
+	for i, key := range keys {
+		full[i] = redisKeyPrefix + key
+	}
+	ctx, cancel := redisContext()
+	defer cancel()
+	return s.client.Del(ctx, full...).Err()
+}
+
+func (s *RedisStore) DelPrefix(prefix string) error {
+	keys, err := s.Keys(prefix)
+	if err != nil {
+		return err
+	}
+	for len(keys) > 0 {
+		n := min(len(keys), 500)
+		if err := s.Del(keys[:n]...); err != nil {
+			return err
+		}
+		keys = keys[n:]
+	}
+	return nil
+}
+
+func (s *RedisStore) Keys(prefix string) ([]string, error) {
+	ctx, cancel := redisContext()
+	defer cancel()
+	var keys []string
+	iter := s.client.Scan(ctx, 0, redisKeyPrefix+prefix+"*", 500).Iterator()
+	for iter.Next(ctx) {
+		keys = append(keys, iter.Val()[len(redisKeyPrefix):])
+	}
+	return keys, iter.Err()
+}
+
+func (s *RedisStore) CompareAndExpire(key, value string, ttl time.Duration) (bool, error) {
+	ctx, cancel := redisContext()
+	defer cancel()
+	n, err := compareAndExpireScript.Run(ctx, s.client, []string{redisKeyPrefix + key}, value, ttl.Milliseconds()).Int()
+	return n == 1, err
+}
+
+func (s *RedisStore) CompareAndDelete(key, value string) (bool, error) {
+	ctx, cancel := redisContext()
+	defer cancel()
+	n, err := compareAndDeleteScript.Run(ctx, s.client, []string{redisKeyPrefix + key}, value).Int()
+	return n == 1, err
+}
+
+func (s *RedisStore) Publish(channel string, payload []byte) error {
+	ctx, cancel := redisContext()
+	defer cancel()
+	return s.client.Publish(ctx, redisKeyPrefix+channel, payload).Err()
+}
+
+// Subscribe 订阅频道，连接断开后自动重连 (重连期间的消息会丢失)
+func (s *RedisStore) Subscribe(channel string) (<-chan []byte, func()) {
+	pubsub := s.client.Subscribe(context.Background(), redisKeyPrefix+channel)
+	ch := make(chan []byte, 256)
+	go func() {
+		defer close(ch)
+		for msg := range pubsub.Channel() {
+			select {
+			case ch <- []byte(msg.Payload):
+			default:
+				log.Printf("Cluster: subscriber of %s is too slow, dropping message", channel)
+			}
+		}
+	}()
+
+	var once sync.Once
+	return ch, func() {
+		once.Do(func() { pubsub.Close() })
+	}
+}
+
+func (s *RedisStore) Name() string {
+	return "redis"
+}
+
+func (s *RedisStore) Close() error {
+	return s.client.Close()
+}
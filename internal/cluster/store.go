@@ -0,0 +1,67 @@
+// Package cluster 提供多实例部署时共享的状态存储、主节点选举和跨实例消息广播。
+//
+// 未配置 REDIS_URL 时使用进程内存储，行为与单实例部署相同；
+// 多个面板实例共享同一个 Redis (或兼容协议的 Valkey/KeyDB/Dragonfly) 时：
+//   - 登录限流和 API 限流的计数在所有实例间共享
+//   - 只有选举出的主实例运行健康检查和定时任务
+//   - WebSocket 推送和 Agent 控制消息通过发布/订阅转发到其他实例
+package cluster
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"os"
+	"time"
+)
+
+// Store 共享状态存储
+type Store interface {
+	// Get 读取键值，不存在时返回空字符串
+	Get(key string) (string, error)
+	// Set 写入键值，ttl 为 0 表示不过期
+	Set(key, value string, ttl time.Duration) error
+	// SetNX 键不存在时写入，返回是否写入成功
+	SetNX(key, value string, ttl time.Duration) (bool, error)
+	// Incr 计数加一，键新建时设置过期时间，返回计数和剩余过期时间
+	Incr(key string, ttl time.Duration) (int64, time.Duration, error)
+	// TTL 剩余过期时间，键不存在或不过期时返回 0
+	TTL(key string) (time.Duration, error)
+	// Del 删除键
+	Del(keys ...string) error
+	// DelPrefix 删除指定前缀的所有键
+	DelPrefix(prefix string) error
+	// Keys 列出指定前缀的所有键
+	Keys(prefix string) ([]string, error)
+	// CompareAndExpire 键的值等于 value 时刷新过期时间
+	CompareAndExpire(key, value string, ttl time.Duration) (bool, error)
+	// CompareAndDelete 键的值等于 value 时删除
+	CompareAndDelete(key, value string) (bool, error)
+
+	// Publish 向频道广播消息 (包括当前实例的订阅者)
+	Publish(channel string, payload []byte) error
+	// Subscribe 订阅频道，返回消息通道和取消订阅函数
+	Subscribe(channel string) (<-chan []byte, func())
+
+	// Name 存储类型: memory / redis
+	Name() string
+	Close() error
+}
+
+// NewStore 根据地址创建存储，地址为空时使用进程内存储
+func NewStore(redisURL string) (Store, error) {
+	if redisURL == "" {
+		return NewMemoryStore(), nil
+	}
+	return NewRedisStore(redisURL)
+}
+
+// DefaultInstanceID 生成实例标识: 主机名-随机后缀
+func DefaultInstanceID() string {
+	host, err := os.Hostname()
+	if err != nil || host == "" {
+		host = "panel"
+	}
+	b := make([]byte, 4)
+	rand.Read(b)
+	return host + "-" + hex.EncodeToString(b)
+}
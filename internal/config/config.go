@@ -17,14 +17,19 @@ const (
 )
 
 type Config struct {
-	ListenAddr     string   // 面板监听地址
-	DBPath         string   // 数据库路径
-	JWTSecret      string   // JWT 密钥
-	AgentGRPCAddr  string   // Agent gRPC 监听地址
-	Debug          bool     // 调试模式
-	AllowedOrigins []string // 允许的 CORS 来源
-	GitHubRawURL   string   // GitHub Raw 文件 URL
-	GOSTVersion    string   // GOST 版本号
+	ListenAddr      string   // 面板监听地址
+	DBPath          string   // 数据库路径 (SQLite)，其所在目录同时用于本地备份和临时文件
+	DBDriver        string   // 数据库类型: sqlite/postgres/mysql
+	DBDSN           string   // 数据库连接串 (postgres/mysql)
+	JWTSecret       string   // JWT 密钥
+	AgentGRPCAddr   string   // Agent 控制通道监听地址 (WebSocket)
+	AgentChannelURL string   // Agent 控制通道对外地址 (为空时根据请求自动推导)
+	Debug           bool     // 调试模式
+	AllowedOrigins  []string // 允许的 CORS 来源
+	GitHubRawURL    string   // GitHub Raw 文件 URL
+	GOSTVersion     string   // GOST 版本号
+	RedisURL        string   // 多实例共享状态的 Redis 地址 (为空时使用进程内存储，仅支持单实例)
+	InstanceID      string   // 实例标识 (为空时根据主机名生成)
 }
 
 func Load() *Config {
@@ -49,17 +54,30 @@ func Load() *Config {
 	allowedOrigins := parseAllowedOrigins(getEnv("ALLOWED_ORIGINS", ""))
 
 	return &Config{
-		ListenAddr:     getEnv("LISTEN_ADDR", ":8080"),
-		DBPath:         getEnv("DB_PATH", "./data/panel.db"),
-		JWTSecret:      jwtSecret,
-		AgentGRPCAddr:  getEnv("AGENT_GRPC_ADDR", ":9090"),
-		Debug:          getEnv("DEBUG", "false") == "true",
-		AllowedOrigins: allowedOrigins,
-		GitHubRawURL:   getEnv("GITHUB_RAW_URL", DefaultGitHubRawURL),
-		GOSTVersion:    getEnv("GOST_VERSION", DefaultGOSTVersion),
+		ListenAddr:      getEnv("LISTEN_ADDR", ":8080"),
+		DBPath:          getEnv("DB_PATH", "./data/panel.db"),
+		DBDriver:        getEnv("DB_DRIVER", "sqlite"),
+		DBDSN:           getEnv("DB_DSN", ""),
+		JWTSecret:       jwtSecret,
+		AgentGRPCAddr:   getEnv("AGENT_GRPC_ADDR", ":9090"),
+		AgentChannelURL: getEnv("AGENT_CHANNEL_URL", ""),
+		Debug:           getEnv("DEBUG", "false") == "true",
+		AllowedOrigins:  allowedOrigins,
+		GitHubRawURL:    getEnv("GITHUB_RAW_URL", DefaultGitHubRawURL),
+		GOSTVersion:     getEnv("GOST_VERSION", DefaultGOSTVersion),
+		RedisURL:        getEnv("REDIS_URL", ""),
+		InstanceID:      getEnv("INSTANCE_ID", ""),
 	}
 }
 
+// DatabaseDSN 返回当前数据库类型的连接串 (SQLite 为数据库文件路径)
+func (c *Config) DatabaseDSN() string {
+	if c.DBDriver == "sqlite" || c.DBDriver == "" {
+		return c.DBPath
+	}
+	return c.DBDSN
+}
+
 // parseAllowedOrigins 解析允许的 CORS 来源
 func parseAllowedOrigins(origins string) []string {
 	if origins == "" {
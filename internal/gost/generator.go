@@ -1,11 +1,16 @@
 package gost
 
 import (
+	"crypto/sha256"
+	"encoding/hex"
 	"encoding/json"
 	"fmt"
+	"net"
+	"net/url"
 	"strings"
 
 	"github.com/AliceNetworks/gost-panel/internal/model"
+	"github.com/goccy/go-yaml"
 )
 
 // ConfigGenerator GOST 配置生成器
@@ -102,6 +107,279 @@ func (g *ConfigGenerator) GenerateNodeConfigWithRules(node *model.Node, bypasses
 	return config
 }
 
+// NodeResources 绑定到节点的全部资源 (用于生成完整合并配置)
+type NodeResources struct {
+	Bypasses          []model.Bypass
+	Admissions        []model.Admission
+	HostMappings      []model.HostMapping
+	Ingresses         []model.Ingress
+	Recorders         []model.Recorder
+	Routers           []model.Router
+	SDs               []model.SD
+	Tunnels           []model.Tunnel                 // 以该节点为入口的隧道 (需预加载 ExitNode)
+	PortForwards      []model.PortForward            // 该节点上的端口转发
+	PortForwardChains map[uint][]model.ProxyChainHop // 端口转发引用的代理链跳点 (key: ChainID)
+
+	// 用户代理凭据 (共享节点上每个用户独立的用户名/密码，仅包含可用的凭据)
+	Credentials []model.ProxyCredential
+	// 凭据通过 HTTP 认证插件实时校验 (Agent 转发到面板)，此时 Credentials 为空
+	CredentialAuthPlugin bool
+
+	// 用户套餐限制 (key: 用户ID)，与资源自身限速取更严格者
+	UserLimits map[uint]UserLimit
+
+	// 流量超限 (资源自身或其所有者超出配额)
+	QuotaPolicy      QuotaPolicy
+	QuotaExceeded    bool          // 节点整体超限，所有服务受限
+	ExceededTunnels  map[uint]bool // 超限的隧道
+	ExceededForwards map[uint]bool // 所有者超限的端口转发
+}
+
+// GenerateNodeFullConfig 生成节点完整合并配置
+// 包含主服务、规则、隧道入口、端口转发、路由、记录器和服务发现，节点重启或重装 Agent 后可完整还原
+func (g *ConfigGenerator) GenerateNodeFullConfig(node *model.Node, res *NodeResources) map[string]interface{} {
+	if res == nil {
+		res = &NodeResources{}
+	}
+
+	config := g.GenerateNodeConfigWithRules(node, res.Bypasses, res.Admissions, res.HostMappings, res.Ingresses)
+
+	// 节点所有者的套餐限速
+	if services, ok := config["services"].([]map[string]interface{}); ok && len(services) > 0 {
+		applyUserLimits(config, services[:1], node.OwnerID, node.SpeedLimit, node.ConnRateLimit, res.UserLimits)
+
+		// 多用户认证
+		if len(res.Credentials) > 0 || res.CredentialAuthPlugin {
+			g.applyCredentials(config, services[0], node, res.Credentials, res.CredentialAuthPlugin)
+		}
+	}
+
+	// Recorder 配置，挂载到主服务
+	if recorders := g.generateRecorderConfigs(res.Recorders); len(recorders) > 0 {
+		config["recorders"] = recorders
+		if services, ok := config["services"].([]map[string]interface{}); ok && len(services) > 0 {
+			refs := make([]map[string]interface{}, 0, len(recorders))
+			for _, r := range recorders {
+				refs = append(refs, map[string]interface{}{
+					"name":   r["name"],
+					"record": "recorder.service.handler",
+				})
+			}
+			services[0]["recorders"] = refs
+		}
+	}
+
+	// Router 配置
+	if routers := g.generateRouterConfigs(node.ID, res.Routers); len(routers) > 0 {
+		config["routers"] = routers
+	}
+
+	// SD 配置
+	if sds := g.generateSDConfigs(res.SDs); len(sds) > 0 {
+		config["sds"] = sds
+	}
+
+	// 隧道入口服务
+	for i := range res.Tunnels {
+		tunnel := &res.Tunnels[i]
+		if tunnelConfig := g.GenerateTunnelEntryConfig(tunnel); tunnelConfig != nil {
+			services, _ := tunnelConfig["services"].([]map[string]interface{})
+			applyUserLimits(config, services, tunnel.OwnerID, tunnel.SpeedLimit, 0, res.UserLimits)
+			if res.ExceededTunnels[tunnel.ID] {
+				restrictServices(config, services, res.QuotaPolicy)
+			}
+			mergeConfigSections(config, tunnelConfig)
+		}
+	}
+
+	// 端口转发服务
+	addedChains := map[uint]bool{}
+	for i := range res.PortForwards {
+		pf := &res.PortForwards[i]
+		if !pf.Enabled {
+			continue
+		}
+
+		service := g.GeneratePortForwardConfig(pf)
+		applyUserLimits(config, []map[string]interface{}{service}, pf.OwnerID, 0, 0, res.UserLimits)
+		if res.ExceededForwards[pf.ID] {
+			restrictServices(config, []map[string]interface{}{service}, res.QuotaPolicy)
+		}
+		chains := []map[string]interface{}{}
+
+		// 远程转发引用的代理链
+		if listener, ok := service["listener"].(map[string]interface{}); ok {
+			if _, hasChain := listener["chain"]; hasChain {
+				hops := res.PortForwardChains[*pf.ChainID]
+				if len(hops) == 0 {
+					delete(listener, "chain")
+				} else if !addedChains[*pf.ChainID] {
+					chain := g.GenerateProxyChainConfig(&model.ProxyChain{ID: *pf.ChainID}, hops)
+					chain["name"] = fmt.Sprintf("chain-pf-%d", *pf.ChainID)
+					chains = append(chains, chain)
+					addedChains[*pf.ChainID] = true
+				}
+			}
+		}
+
+		mergeConfigSections(config, map[string]interface{}{
+			"services": []map[string]interface{}{service},
+			"chains":   chains,
+		})
+	}
+
+	if res.QuotaExceeded {
+		ApplyQuotaPolicy(config, res.QuotaPolicy)
+	}
+
+	return config
+}
+
+// UserLimit 用户套餐的限速设置
+type UserLimit struct {
+	SpeedLimit    int64 // bytes/s, 0=不限
+	ConnRateLimit int   // 每秒最大连接数, 0=不限
+}
+
+// applyUserLimits 套餐限制比资源自身限制更严格 (或资源未限制) 时，服务改用用户级限速器
+// 同一用户的服务引用同名限速器，带宽按用户整体计算
+func applyUserLimits(config map[string]interface{}, services []map[string]interface{}, ownerID *uint, speedLimit int64, connRateLimit int, limits map[uint]UserLimit) {
+	if ownerID == nil || len(services) == 0 {
+		return
+	}
+	limit, ok := limits[*ownerID]
+	if !ok {
+		return
+	}
+
+	if limit.SpeedLimit > 0 && (speedLimit <= 0 || limit.SpeedLimit < speedLimit) {
+		name := fmt.Sprintf("user-limiter-%d", *ownerID)
+		for _, service := range services {
+			service["limiter"] = name
+		}
+		appendConfigItem(config, "limiters", map[string]interface{}{
+			"name":   name,
+			"limits": []string{"$ " + formatSpeedLimit(limit.SpeedLimit)},
+		})
+	}
+
+	if limit.ConnRateLimit > 0 && (connRateLimit <= 0 || limit.ConnRateLimit < connRateLimit) {
+		name := fmt.Sprintf("user-rlimiter-%d", *ownerID)
+		for _, service := range services {
+			service["rlimiter"] = name
+		}
+		appendConfigItem(config, "rlimiters", map[string]interface{}{
+			"name":   name,
+			"limits": []string{fmt.Sprintf("$ %d/s", limit.ConnRateLimit)},
+		})
+	}
+}
+
+// 流量超限处理方式
+const (
+	QuotaActionBlock    = "block"    // 拒绝所有连接
+	QuotaActionThrottle = "throttle" // 限速到 ThrottleSpeed
+)
+
+const (
+	quotaAdmissionName = "quota-exceeded"
+	quotaLimiterName   = "quota-throttle"
+)
+
+// QuotaPolicy 流量超限时的数据面处理策略
+type QuotaPolicy struct {
+	Action        string // block/throttle，默认 block
+	ThrottleSpeed int64  // throttle 模式下的限速 (bytes/s)
+}
+
+// ApplyQuotaPolicy 对配置中的全部服务应用超限策略 (节点或客户端整体超限)
+func ApplyQuotaPolicy(config map[string]interface{}, policy QuotaPolicy) {
+	services, _ := config["services"].([]map[string]interface{})
+	restrictServices(config, services, policy)
+}
+
+// restrictServices 为服务挂载拒绝全部来源的 admission 或极低速率的 limiter
+// 超限状态变化会改变配置哈希，Agent 据此自动重新加载；配额重置或调整后恢复原配置
+func restrictServices(config map[string]interface{}, services []map[string]interface{}, policy QuotaPolicy) {
+	if len(services) == 0 {
+		return
+	}
+
+	if policy.Action == QuotaActionThrottle && policy.ThrottleSpeed > 0 {
+		for _, service := range services {
+			service["limiter"] = quotaLimiterName
+		}
+		appendConfigItem(config, "limiters", map[string]interface{}{
+			"name":   quotaLimiterName,
+			"limits": []string{"$ " + formatSpeedLimit(policy.ThrottleSpeed)},
+		})
+		return
+	}
+
+	for _, service := range services {
+		service["admission"] = quotaAdmissionName
+	}
+	appendConfigItem(config, "admissions", map[string]interface{}{
+		"name":     quotaAdmissionName,
+		"matchers": []string{"0.0.0.0/0", "::/0"},
+	})
+}
+
+// appendConfigItem 向配置列表追加一项，同名项已存在时跳过
+func appendConfigItem(config map[string]interface{}, key string, item map[string]interface{}) {
+	items, _ := config[key].([]map[string]interface{})
+	for _, existing := range items {
+		if existing["name"] == item["name"] {
+			return
+		}
+	}
+	config[key] = append(items, item)
+}
+
+// formatSpeedLimit 将 bytes/s 转换为 GOST limiter 使用的单位
+func formatSpeedLimit(speed int64) string {
+	limit := fmt.Sprintf("%dB", speed)
+	if speed >= 1024*1024*1024 {
+		limit = fmt.Sprintf("%.2fGB", float64(speed)/(1024*1024*1024))
+	} else if speed >= 1024*1024 {
+		limit = fmt.Sprintf("%.2fMB", float64(speed)/(1024*1024))
+	} else if speed >= 1024 {
+		limit = fmt.Sprintf("%.2fKB", float64(speed)/1024)
+	}
+	return limit
+}
+
+// mergeConfigSections 将配置片段中的列表项 (services/chains/limiters 等) 追加到目标配置
+func mergeConfigSections(dst, src map[string]interface{}) {
+	for key, value := range src {
+		items, ok := value.([]map[string]interface{})
+		if !ok || len(items) == 0 {
+			continue
+		}
+		if existing, ok := dst[key].([]map[string]interface{}); ok {
+			dst[key] = append(existing, items...)
+		} else {
+			dst[key] = items
+		}
+	}
+}
+
+// MarshalConfig 将配置序列化为 YAML (map 键有序，输出确定)
+// Agent 下载后按原样写入文件，面板与 Agent 对同一份字节计算哈希
+func MarshalConfig(config map[string]interface{}) ([]byte, error) {
+	return yaml.Marshal(config)
+}
+
+// ConfigHash 计算配置内容的 SHA-256 哈希 (与 Agent 对配置文件的计算方式一致)
+func ConfigHash(config map[string]interface{}) (string, error) {
+	data, err := MarshalConfig(config)
+	if err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:]), nil
+}
+
 // generateAPIConfig 生成 API 配置
 func (g *ConfigGenerator) generateAPIConfig(node *model.Node) map[string]interface{} {
 	api := map[string]interface{}{
@@ -545,6 +823,95 @@ func (g *ConfigGenerator) generateAuthers(node *model.Node) []map[string]interfa
 	}
 }
 
+// DefaultAuthPluginListen Agent 认证插件的默认监听地址 (未上报地址的旧 Agent 使用)
+const DefaultAuthPluginListen = "127.0.0.1:18079"
+
+// AuthPluginURL 根据 Agent 上报的 -auth-listen 地址生成 GOST 认证插件地址，
+// Agent 未启用认证插件时返回 false。Agent 在本地短时缓存校验结果并转发到面板
+func AuthPluginURL(listen string) (string, bool) {
+	switch listen {
+	case "":
+		listen = DefaultAuthPluginListen
+	case "off":
+		return "", false
+	}
+	host, port, err := net.SplitHostPort(listen)
+	if err != nil {
+		return "", false
+	}
+	// 监听所有地址时 GOST 通过本机回环地址访问
+	if ip := net.ParseIP(host); host == "" || (ip != nil && ip.IsUnspecified()) {
+		host = "127.0.0.1"
+	}
+	return "http://" + net.JoinHostPort(host, port) + "/auth", true
+}
+
+// IsAuthPluginURL 是否为面板生成的 Agent 认证插件地址
+func IsAuthPluginURL(addr string) bool {
+	u, err := url.Parse(addr)
+	return err == nil && u.Scheme == "http" && u.Path == "/auth" && u.Port() != ""
+}
+
+// applyCredentials 将用户代理凭据合并到主服务的认证器
+// 节点自身的代理账号保留 (客户端和隧道使用)，每个用户一条独立记录，轮换或吊销单个用户不影响其他用户
+// usePlugin 为 true 时用户凭据不写入配置，由认证插件实时校验，节点自身账号仍使用静态认证器
+func (g *ConfigGenerator) applyCredentials(config map[string]interface{}, mainService map[string]interface{}, node *model.Node, credentials []model.ProxyCredential, usePlugin bool) {
+	handler, ok := mainService["handler"].(map[string]interface{})
+	if !ok {
+		return
+	}
+	switch handler["type"] {
+	case "http", "socks5", "sshd":
+	default:
+		return // 协议不支持用户名/密码认证
+	}
+
+	// 处理器级观察器按认证用户上报流量，用于统计每个用户的实际用量
+	handler["observer"] = "stats-observer"
+
+	pluginURL, pluginOK := AuthPluginURL(node.AgentAuthListen)
+	if usePlugin && pluginOK {
+		authers := []map[string]interface{}{}
+		names := []string{}
+		if node.ProxyUser != "" {
+			authers = append(authers, g.generateAuthers(node)...)
+			names = append(names, "main-auth")
+		}
+		authers = append(authers, map[string]interface{}{
+			"name": "user-auth",
+			"plugin": map[string]interface{}{
+				"type":    "http",
+				"addr":    pluginURL,
+				"token":   node.AgentToken,
+				"timeout": "5s",
+			},
+		})
+		names = append(names, "user-auth")
+
+		// 认证器组: 任一认证器通过即可
+		delete(handler, "auther")
+		handler["authers"] = names
+		config["authers"] = authers
+		return
+	}
+
+	auths := []map[string]string{}
+	if node.ProxyUser != "" {
+		auths = append(auths, map[string]string{"username": node.ProxyUser, "password": node.ProxyPass})
+	}
+	for _, cred := range credentials {
+		auths = append(auths, map[string]string{"username": cred.Username, "password": cred.Password})
+	}
+
+	handler["auther"] = "main-auth"
+	config["authers"] = []map[string]interface{}{
+		{
+			"name":  "main-auth",
+			"auths": auths,
+		},
+	}
+}
+
 // generateLimiters 生成限速器配置
 func (g *ConfigGenerator) generateLimiters(node *model.Node) []map[string]interface{} {
 	if node.SpeedLimit <= 0 {
@@ -552,14 +919,7 @@ func (g *ConfigGenerator) generateLimiters(node *model.Node) []map[string]interf
 	}
 
 	// 转换为合适的单位
-	limit := fmt.Sprintf("%dB", node.SpeedLimit)
-	if node.SpeedLimit >= 1024*1024*1024 {
-		limit = fmt.Sprintf("%.2fGB", float64(node.SpeedLimit)/(1024*1024*1024))
-	} else if node.SpeedLimit >= 1024*1024 {
-		limit = fmt.Sprintf("%.2fMB", float64(node.SpeedLimit)/(1024*1024))
-	} else if node.SpeedLimit >= 1024 {
-		limit = fmt.Sprintf("%.2fKB", float64(node.SpeedLimit)/1024)
-	}
+	limit := formatSpeedLimit(node.SpeedLimit)
 
 	return []map[string]interface{}{
 		{
@@ -621,9 +981,11 @@ func (g *ConfigGenerator) GeneratePortForwardConfig(pf *model.PortForward) map[s
 		listener["chain"] = fmt.Sprintf("chain-pf-%d", *pf.ChainID)
 	}
 
+	// 服务名使用 ID，便于按服务上报的流量统计关联到端口转发
 	service := map[string]interface{}{
-		"name":     pf.Name,
+		"name":     fmt.Sprintf("forward-%d", pf.ID),
 		"addr":     pf.LocalAddr,
+		"observer": "stats-observer",
 		"handler":  handler,
 		"listener": listener,
 		"forwarder": map[string]interface{}{
@@ -811,39 +1173,25 @@ func (g *ConfigGenerator) GenerateTunnelEntryConfig(tunnel *model.Tunnel) map[st
 
 	chainName := fmt.Sprintf("tunnel-chain-%d", tunnel.ID)
 
-	// 转发链配置 - 连接到出口节点
-	connector := map[string]interface{}{
-		"type": exitNode.Protocol,
-	}
-	if exitNode.ProxyUser != "" {
-		connector["auth"] = map[string]string{
-			"username": exitNode.ProxyUser,
-			"password": exitNode.ProxyPass,
+	// 转发链配置 - 依次经过中转节点，最后连接到出口节点
+	hops := []map[string]interface{}{}
+	for _, hop := range tunnel.Hops {
+		if hop.Node == nil {
+			continue
 		}
+		hops = append(hops, map[string]interface{}{
+			"name":  fmt.Sprintf("hop-%d", len(hops)),
+			"nodes": []map[string]interface{}{g.generateTunnelHopNode(fmt.Sprintf("relay-%d", hop.Node.ID), hop.Node, hop.Transport)},
+		})
 	}
-
-	dialer := map[string]interface{}{
-		"type": normalizeTransport(exitNode.Transport),
-	}
-	if exitNode.TLSEnabled {
-		dialer["tls"] = g.generateTLSConfig(exitNode)
-	}
+	hops = append(hops, map[string]interface{}{
+		"name":  fmt.Sprintf("hop-%d", len(hops)),
+		"nodes": []map[string]interface{}{g.generateTunnelHopNode(fmt.Sprintf("exit-%d", exitNode.ID), exitNode, "")},
+	})
 
 	chain := map[string]interface{}{
 		"name": chainName,
-		"hops": []map[string]interface{}{
-			{
-				"name": "hop-0",
-				"nodes": []map[string]interface{}{
-					{
-						"name":      fmt.Sprintf("exit-%d", exitNode.ID),
-						"addr":      fmt.Sprintf("%s:%d", exitNode.Host, exitNode.Port),
-						"connector": connector,
-						"dialer":    dialer,
-					},
-				},
-			},
-		},
+		"hops": hops,
 	}
 
 	// 生成服务列表 - 支持端口复用 (tcp+udp)
@@ -852,8 +1200,9 @@ func (g *ConfigGenerator) GenerateTunnelEntryConfig(tunnel *model.Tunnel) map[st
 
 	for _, proto := range protocols {
 		service := map[string]interface{}{
-			"name": fmt.Sprintf("tunnel-%d-%s", tunnel.ID, proto),
-			"addr": fmt.Sprintf(":%d", tunnel.EntryPort),
+			"name":     fmt.Sprintf("tunnel-%d-%s", tunnel.ID, proto),
+			"addr":     fmt.Sprintf(":%d", tunnel.EntryPort),
+			"observer": "stats-observer",
 			"handler": map[string]interface{}{
 				"type":  proto,
 				"chain": chainName,
@@ -874,7 +1223,7 @@ func (g *ConfigGenerator) GenerateTunnelEntryConfig(tunnel *model.Tunnel) map[st
 
 		// 限速配置
 		if tunnel.SpeedLimit > 0 {
-			service["limiter"] = "tunnel-limiter"
+			service["limiter"] = fmt.Sprintf("tunnel-limiter-%d", tunnel.ID)
 		}
 
 		services = append(services, service)
@@ -887,17 +1236,10 @@ func (g *ConfigGenerator) GenerateTunnelEntryConfig(tunnel *model.Tunnel) map[st
 
 	// 添加限速器
 	if tunnel.SpeedLimit > 0 {
-		limit := fmt.Sprintf("%dB", tunnel.SpeedLimit)
-		if tunnel.SpeedLimit >= 1024*1024*1024 {
-			limit = fmt.Sprintf("%.2fGB", float64(tunnel.SpeedLimit)/(1024*1024*1024))
-		} else if tunnel.SpeedLimit >= 1024*1024 {
-			limit = fmt.Sprintf("%.2fMB", float64(tunnel.SpeedLimit)/(1024*1024))
-		} else if tunnel.SpeedLimit >= 1024 {
-			limit = fmt.Sprintf("%.2fKB", float64(tunnel.SpeedLimit)/1024)
-		}
+		limit := formatSpeedLimit(tunnel.SpeedLimit)
 		config["limiters"] = []map[string]interface{}{
 			{
-				"name":   "tunnel-limiter",
+				"name":   fmt.Sprintf("tunnel-limiter-%d", tunnel.ID),
 				"limits": []string{"$ " + limit},
 			},
 		}
@@ -906,6 +1248,36 @@ func (g *ConfigGenerator) GenerateTunnelEntryConfig(tunnel *model.Tunnel) map[st
 	return config
 }
 
+// generateTunnelHopNode 生成隧道转发链中的单跳节点，transport 为空时使用节点自身的传输层
+func (g *ConfigGenerator) generateTunnelHopNode(name string, node *model.Node, transport string) map[string]interface{} {
+	connector := map[string]interface{}{
+		"type": node.Protocol,
+	}
+	if node.ProxyUser != "" {
+		connector["auth"] = map[string]string{
+			"username": node.ProxyUser,
+			"password": node.ProxyPass,
+		}
+	}
+
+	if transport == "" {
+		transport = node.Transport
+	}
+	dialer := map[string]interface{}{
+		"type": normalizeTransport(transport),
+	}
+	if node.TLSEnabled {
+		dialer["tls"] = g.generateTLSConfig(node)
+	}
+
+	return map[string]interface{}{
+		"name":      name,
+		"addr":      fmt.Sprintf("%s:%d", node.Host, node.Port),
+		"connector": connector,
+		"dialer":    dialer,
+	}
+}
+
 // parseProtocols 解析协议字符串，支持 tcp+udp 格式
 func (g *ConfigGenerator) parseProtocols(protocol string) []string {
 	switch protocol {
@@ -1105,3 +1477,66 @@ func (g *ConfigGenerator) generateRouterConfigs(nodeID uint, routers []model.Rou
 		},
 	}
 }
+
+// generateRecorderConfigs 生成 Recorder 流量记录器配置
+func (g *ConfigGenerator) generateRecorderConfigs(recorders []model.Recorder) []map[string]interface{} {
+	configs := []map[string]interface{}{}
+
+	for _, r := range recorders {
+		if r.Type != "file" && r.Type != "redis" && r.Type != "http" {
+			continue
+		}
+
+		var opts map[string]interface{}
+		if err := json.Unmarshal([]byte(r.Config), &opts); err != nil || len(opts) == 0 {
+			continue
+		}
+
+		// 超时时间以秒为单位填写，GOST 需要 duration 格式
+		if timeout, ok := opts["timeout"].(float64); ok {
+			opts["timeout"] = fmt.Sprintf("%ds", int(timeout))
+		}
+
+		configs = append(configs, map[string]interface{}{
+			"name": fmt.Sprintf("recorder-%d", r.ID),
+			r.Type: opts,
+		})
+	}
+
+	return configs
+}
+
+// generateSDConfigs 生成 SD 服务发现配置
+// GOST 仅支持通过 HTTP 插件接入服务发现，consul/etcd/redis 需借助外部插件，此处不生成
+func (g *ConfigGenerator) generateSDConfigs(sds []model.SD) []map[string]interface{} {
+	configs := []map[string]interface{}{}
+
+	for _, sd := range sds {
+		if sd.Type != "http" {
+			continue
+		}
+
+		var opts struct {
+			URL     string `json:"url"`
+			Timeout int    `json:"timeout"`
+		}
+		if err := json.Unmarshal([]byte(sd.Config), &opts); err != nil || opts.URL == "" {
+			continue
+		}
+
+		plugin := map[string]interface{}{
+			"type": "http",
+			"addr": opts.URL,
+		}
+		if opts.Timeout > 0 {
+			plugin["timeout"] = fmt.Sprintf("%ds", opts.Timeout)
+		}
+
+		configs = append(configs, map[string]interface{}{
+			"name":   fmt.Sprintf("sd-%d", sd.ID),
+			"plugin": plugin,
+		})
+	}
+
+	return configs
+}
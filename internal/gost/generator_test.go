@@ -0,0 +1,263 @@
+package gost
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/AliceNetworks/gost-panel/internal/model"
+)
+
+func TestAuthPluginURL(t *testing.T) {
+	tests := []struct {
+		listen string
+		want   string
+		ok     bool
+	}{
+		{"", "http://127.0.0.1:18079/auth", true},
+		{"127.0.0.1:28079", "http://127.0.0.1:28079/auth", true},
+		{":28079", "http://127.0.0.1:28079/auth", true},
+		{"0.0.0.0:28079", "http://127.0.0.1:28079/auth", true},
+		{"[::]:28079", "http://127.0.0.1:28079/auth", true},
+		{"[::1]:28079", "http://[::1]:28079/auth", true},
+		{"off", "", false},
+		{"invalid", "", false},
+	}
+	for _, tt := range tests {
+		got, ok := AuthPluginURL(tt.listen)
+		if got != tt.want || ok != tt.ok {
+			t.Errorf("AuthPluginURL(%q) = %q, %v; want %q, %v", tt.listen, got, ok, tt.want, tt.ok)
+		}
+		if ok && !IsAuthPluginURL(got) {
+			t.Errorf("IsAuthPluginURL(%q) = false", got)
+		}
+	}
+}
+
+func pluginAddr(t *testing.T, config map[string]interface{}) (string, bool) {
+	t.Helper()
+	authers, _ := config["authers"].([]map[string]interface{})
+	for _, a := range authers {
+		if plugin, ok := a["plugin"].(map[string]interface{}); ok {
+			return plugin["addr"].(string), true
+		}
+	}
+	return "", false
+}
+
+// 认证插件地址使用 Agent 上报的 -auth-listen
+func TestGenerateNodeConfigAuthPluginAddr(t *testing.T) {
+	g := NewConfigGenerator()
+	node := &model.Node{ID: 1, Protocol: "socks5", Transport: "tcp", Port: 1080, AgentToken: "token", AgentAuthListen: "127.0.0.1:28079"}
+	res := &NodeResources{CredentialAuthPlugin: true}
+
+	addr, ok := pluginAddr(t, g.GenerateNodeFullConfig(node, res))
+	if !ok || addr != "http://127.0.0.1:28079/auth" {
+		t.Fatalf("plugin addr = %q, %v; want reported address", addr, ok)
+	}
+
+	// Agent 未启用认证插件时不生成插件认证器
+	node.AgentAuthListen = "off"
+	res.Credentials = []model.ProxyCredential{{Username: "u", Password: "p"}}
+	if addr, ok := pluginAddr(t, g.GenerateNodeFullConfig(node, res)); ok {
+		t.Fatalf("plugin auther generated for agent without auth plugin: %q", addr)
+	}
+}
+
+func findService(t *testing.T, config map[string]interface{}, name string) map[string]interface{} {
+	t.Helper()
+	services, _ := config["services"].([]map[string]interface{})
+	for _, s := range services {
+		if s["name"] == name {
+			return s
+		}
+	}
+	t.Fatalf("service %s not found", name)
+	return nil
+}
+
+// configItems 配置列表 (limiters/rlimiters/admissions) 中各项的名称和规则
+func configItems(config map[string]interface{}, key, field string) map[string][]string {
+	items, _ := config[key].([]map[string]interface{})
+	got := map[string][]string{}
+	for _, item := range items {
+		got[item["name"].(string)], _ = item[field].([]string)
+	}
+	return got
+}
+
+// 套餐限制比资源自身更严格 (或资源未限制) 时改用用户级限速器，同一用户的服务共用
+func TestApplyUserLimits(t *testing.T) {
+	owner, other := uint(7), uint(8)
+	tests := []struct {
+		name          string
+		owner         *uint
+		speedLimit    int64
+		connRateLimit int
+		limits        map[uint]UserLimit
+		// 主服务和端口转发 (没有自身限速) 引用的限速器
+		main, forward [2]interface{}
+		limiters      map[string][]string
+		rlimiters     map[string][]string
+	}{
+		{
+			name: "plan stricter", owner: &owner, speedLimit: 10 << 20, connRateLimit: 100,
+			limits:    map[uint]UserLimit{owner: {SpeedLimit: 1 << 20, ConnRateLimit: 5}},
+			main:      [2]interface{}{"user-limiter-7", "user-rlimiter-7"},
+			forward:   [2]interface{}{"user-limiter-7", "user-rlimiter-7"},
+			limiters:  map[string][]string{"speed-limiter": {"$ 10.00MB"}, "user-limiter-7": {"$ 1.00MB"}},
+			rlimiters: map[string][]string{"rate-limiter": {"$ 100/s"}, "user-rlimiter-7": {"$ 5/s"}},
+		},
+		{
+			name: "node stricter", owner: &owner, speedLimit: 1 << 20, connRateLimit: 5,
+			limits:    map[uint]UserLimit{owner: {SpeedLimit: 10 << 20, ConnRateLimit: 100}},
+			main:      [2]interface{}{"speed-limiter", "rate-limiter"},
+			forward:   [2]interface{}{"user-limiter-7", "user-rlimiter-7"},
+			limiters:  map[string][]string{"speed-limiter": {"$ 1.00MB"}, "user-limiter-7": {"$ 10.00MB"}},
+			rlimiters: map[string][]string{"rate-limiter": {"$ 5/s"}, "user-rlimiter-7": {"$ 100/s"}},
+		},
+		{
+			name: "speed only", owner: &owner, connRateLimit: 5,
+			limits:    map[uint]UserLimit{owner: {SpeedLimit: 512 << 10}},
+			main:      [2]interface{}{"user-limiter-7", "rate-limiter"},
+			forward:   [2]interface{}{"user-limiter-7", nil},
+			limiters:  map[string][]string{"user-limiter-7": {"$ 512.00KB"}},
+			rlimiters: map[string][]string{"rate-limiter": {"$ 5/s"}},
+		},
+		{
+			name: "no plan", owner: &owner, speedLimit: 1 << 20,
+			limits:    map[uint]UserLimit{other: {SpeedLimit: 1024, ConnRateLimit: 1}},
+			main:      [2]interface{}{"speed-limiter", nil},
+			limiters:  map[string][]string{"speed-limiter": {"$ 1.00MB"}},
+			rlimiters: map[string][]string{},
+		},
+		{
+			name:      "no owner",
+			limits:    map[uint]UserLimit{owner: {SpeedLimit: 1024, ConnRateLimit: 1}},
+			limiters:  map[string][]string{},
+			rlimiters: map[string][]string{},
+		},
+	}
+	g := NewConfigGenerator()
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			node := &model.Node{ID: 1, Protocol: "socks5", Transport: "tcp", Port: 1080, OwnerID: tt.owner, SpeedLimit: tt.speedLimit, ConnRateLimit: tt.connRateLimit}
+			res := &NodeResources{
+				UserLimits: tt.limits,
+				PortForwards: []model.PortForward{
+					{ID: 1, Type: "tcp", LocalAddr: ":8080", RemoteAddr: "10.0.0.1:80", Enabled: true, OwnerID: tt.owner},
+					{ID: 2, Type: "udp", LocalAddr: ":5353", RemoteAddr: "10.0.0.1:53", Enabled: true, OwnerID: tt.owner},
+				},
+			}
+			config := g.GenerateNodeFullConfig(node, res)
+
+			for name, want := range map[string][2]interface{}{"main-service": tt.main, "forward-1": tt.forward, "forward-2": tt.forward} {
+				s := findService(t, config, name)
+				if got := [2]interface{}{s["limiter"], s["rlimiter"]}; got != want {
+					t.Errorf("%s limiter, rlimiter = %v, want %v", name, got, want)
+				}
+			}
+			if got := configItems(config, "limiters", "limits"); !reflect.DeepEqual(got, tt.limiters) {
+				t.Errorf("limiters = %v, want %v", got, tt.limiters)
+			}
+			if got := configItems(config, "rlimiters", "limits"); !reflect.DeepEqual(got, tt.rlimiters) {
+				t.Errorf("rlimiters = %v, want %v", got, tt.rlimiters)
+			}
+		})
+	}
+}
+
+// 超限的服务按策略挂载拒绝全部来源的 admission 或降速 limiter，未超限的服务不受影响
+func TestQuotaPolicy(t *testing.T) {
+	owner := uint(7)
+	block := map[string][]string{"quota-exceeded": {"0.0.0.0/0", "::/0"}}
+	tests := []struct {
+		name       string
+		res        NodeResources
+		admission  map[string]interface{} // 各服务的 admission，未列出的服务为 nil
+		limiter    map[string]interface{}
+		admissions map[string][]string
+		limiters   map[string][]string
+	}{
+		{
+			name:       "node exhausted, block",
+			res:        NodeResources{QuotaExceeded: true, QuotaPolicy: QuotaPolicy{Action: QuotaActionBlock}},
+			admission:  map[string]interface{}{"main-service": "quota-exceeded", "forward-1": "quota-exceeded", "tunnel-3-tcp": "quota-exceeded"},
+			limiter:    map[string]interface{}{"main-service": "user-limiter-7"},
+			admissions: block,
+			limiters:   map[string][]string{"user-limiter-7": {"$ 1.00MB"}},
+		},
+		{
+			// 默认策略为拒绝
+			name:       "node exhausted, default",
+			res:        NodeResources{QuotaExceeded: true},
+			admission:  map[string]interface{}{"main-service": "quota-exceeded", "forward-1": "quota-exceeded", "tunnel-3-tcp": "quota-exceeded"},
+			limiter:    map[string]interface{}{"main-service": "user-limiter-7"},
+			admissions: block,
+			limiters:   map[string][]string{"user-limiter-7": {"$ 1.00MB"}},
+		},
+		{
+			// 降速覆盖套餐限速
+			name:       "node exhausted, throttle",
+			res:        NodeResources{QuotaExceeded: true, QuotaPolicy: QuotaPolicy{Action: QuotaActionThrottle, ThrottleSpeed: 64 << 10}},
+			limiter:    map[string]interface{}{"main-service": "quota-throttle", "forward-1": "quota-throttle", "tunnel-3-tcp": "quota-throttle"},
+			admissions: map[string][]string{},
+			limiters:   map[string][]string{"user-limiter-7": {"$ 1.00MB"}, "quota-throttle": {"$ 64.00KB"}},
+		},
+		{
+			// 没有设置降速速率时按拒绝处理
+			name:       "throttle without speed",
+			res:        NodeResources{QuotaExceeded: true, QuotaPolicy: QuotaPolicy{Action: QuotaActionThrottle}},
+			admission:  map[string]interface{}{"main-service": "quota-exceeded", "forward-1": "quota-exceeded", "tunnel-3-tcp": "quota-exceeded"},
+			limiter:    map[string]interface{}{"main-service": "user-limiter-7"},
+			admissions: block,
+			limiters:   map[string][]string{"user-limiter-7": {"$ 1.00MB"}},
+		},
+		{
+			name:       "forward exhausted",
+			res:        NodeResources{ExceededForwards: map[uint]bool{1: true}, QuotaPolicy: QuotaPolicy{Action: QuotaActionBlock}},
+			admission:  map[string]interface{}{"forward-1": "quota-exceeded"},
+			limiter:    map[string]interface{}{"main-service": "user-limiter-7"},
+			admissions: block,
+			limiters:   map[string][]string{"user-limiter-7": {"$ 1.00MB"}},
+		},
+		{
+			name:       "tunnel exhausted, throttle",
+			res:        NodeResources{ExceededTunnels: map[uint]bool{3: true}, QuotaPolicy: QuotaPolicy{Action: QuotaActionThrottle, ThrottleSpeed: 2 << 20}},
+			limiter:    map[string]interface{}{"main-service": "user-limiter-7", "tunnel-3-tcp": "quota-throttle"},
+			admissions: map[string][]string{},
+			limiters:   map[string][]string{"user-limiter-7": {"$ 1.00MB"}, "quota-throttle": {"$ 2.00MB"}},
+		},
+		{
+			name:       "within quota",
+			res:        NodeResources{QuotaPolicy: QuotaPolicy{Action: QuotaActionBlock}},
+			limiter:    map[string]interface{}{"main-service": "user-limiter-7"},
+			admissions: map[string][]string{},
+			limiters:   map[string][]string{"user-limiter-7": {"$ 1.00MB"}},
+		},
+	}
+	g := NewConfigGenerator()
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			node := &model.Node{ID: 1, Protocol: "socks5", Transport: "tcp", Port: 1080, OwnerID: &owner}
+			exit := &model.Node{ID: 2, Host: "10.0.0.2", Port: 1080, Protocol: "relay", Transport: "tcp"}
+			res := tt.res
+			res.UserLimits = map[uint]UserLimit{owner: {SpeedLimit: 1 << 20}}
+			res.Tunnels = []model.Tunnel{{ID: 3, EntryNodeID: 1, EntryPort: 9000, Protocol: "tcp", ExitNode: exit, TargetAddr: "10.0.0.3:80"}}
+			res.PortForwards = []model.PortForward{{ID: 1, Type: "tcp", LocalAddr: ":8080", RemoteAddr: "10.0.0.1:80", Enabled: true}}
+			config := g.GenerateNodeFullConfig(node, &res)
+
+			for _, name := range []string{"main-service", "forward-1", "tunnel-3-tcp"} {
+				s := findService(t, config, name)
+				if s["admission"] != tt.admission[name] || s["limiter"] != tt.limiter[name] {
+					t.Errorf("%s admission %v limiter %v, want %v %v", name, s["admission"], s["limiter"], tt.admission[name], tt.limiter[name])
+				}
+			}
+			if got := configItems(config, "admissions", "matchers"); !reflect.DeepEqual(got, tt.admissions) {
+				t.Errorf("admissions = %v, want %v", got, tt.admissions)
+			}
+			if got := configItems(config, "limiters", "limits"); !reflect.DeepEqual(got, tt.limiters) {
+				t.Errorf("limiters = %v, want %v", got, tt.limiters)
+			}
+		})
+	}
+}
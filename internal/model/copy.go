@@ -0,0 +1,78 @@
+package model
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"gorm.io/gorm/schema"
+)
+
+// copyBatchSize 每批复制的记录数 (受各数据库单条语句参数数量限制)
+const copyBatchSize = 200
+
+// CopyDatabase 将 src 中所有数据表的记录复制到 dst，dst 中的已有记录会先被清空。
+// 两端的表结构都必须已迁移到当前版本；需要原子性时由调用方在 dst 的事务中执行。
+// 返回各表复制的记录数。
+func CopyDatabase(src, dst *gorm.DB) (map[string]int64, error) {
+	counts := make(map[string]int64)
+	for _, m := range Models() {
+		stmt := &gorm.Statement{DB: dst}
+		if err := stmt.Parse(m); err != nil {
+			return nil, err
+		}
+		sch := stmt.Schema
+
+		if err := dst.Session(&gorm.Session{AllowGlobalUpdate: true}).Delete(m).Error; err != nil {
+			return nil, fmt.Errorf("clear %s: %w", sch.Table, err)
+		}
+		if !src.Migrator().HasTable(m) {
+			continue
+		}
+
+		// 按模型读取 (统一各驱动的类型)，按表名以 map 写入：避免零值被字段默认值替换，也不回填主键
+		rows := reflect.New(reflect.SliceOf(sch.ModelType))
+		var n int64
+		err := src.Model(m).FindInBatches(rows.Interface(), copyBatchSize, func(tx *gorm.DB, batch int) error {
+			list := rows.Elem()
+			values := make([]map[string]interface{}, list.Len())
+			for i := range values {
+				values[i] = columnValues(sch, list.Index(i))
+			}
+			n += int64(len(values))
+			return dst.Table(sch.Table).Create(values).Error
+		}).Error
+		if err != nil {
+			return nil, fmt.Errorf("copy %s: %w", sch.Table, err)
+		}
+		counts[sch.Table] = n
+
+		if err := resetSequence(dst, sch); err != nil {
+			return nil, fmt.Errorf("reset sequence of %s: %w", sch.Table, err)
+		}
+	}
+	return counts, nil
+}
+
+// columnValues 取出一条记录的所有列值
+func columnValues(sch *schema.Schema, rv reflect.Value) map[string]interface{} {
+	values := make(map[string]interface{}, len(sch.DBNames))
+	for _, name := range sch.DBNames {
+		field := sch.FieldsByDBName[name]
+		v, _ := field.ValueOf(context.Background(), rv)
+		values[name] = v
+	}
+	return values
+}
+
+// resetSequence 显式写入主键后，PostgreSQL 需要把自增序列推进到当前最大值之后
+func resetSequence(db *gorm.DB, sch *schema.Schema) error {
+	pk := sch.PrioritizedPrimaryField
+	if db.Dialector.Name() != DriverPostgres || pk == nil || !pk.AutoIncrement {
+		return nil
+	}
+	return db.Exec("SELECT setval(pg_get_serial_sequence(?, ?), COALESCE(MAX(?), 0) + 1, false) FROM ?",
+		sch.Table, pk.DBName, clause.Column{Name: pk.DBName}, clause.Table{Name: sch.Table}).Error
+}
@@ -0,0 +1,234 @@
+package model
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+
+	"gorm.io/gorm"
+)
+
+var updateSchema = flag.Bool("update-schema", false, "update testdata/schema.txt after adding a migration")
+
+func openEmptyDB(t *testing.T) *gorm.DB {
+	t.Helper()
+	db, err := OpenDB(DriverSQLite, filepath.Join(t.TempDir(), "panel.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		if sqlDB, err := db.DB(); err == nil {
+			sqlDB.Close()
+		}
+	})
+	return db
+}
+
+// dumpSchema 按名称排序输出 SQLite 表结构和索引 (不含迁移记录表)，列顺序不影响结果
+func dumpSchema(t *testing.T, db *gorm.DB) string {
+	t.Helper()
+	var tables []string
+	if err := db.Raw("SELECT name FROM sqlite_master WHERE type = 'table' AND name NOT LIKE 'sqlite_%' AND name <> 'schema_migrations' ORDER BY name").
+		Scan(&tables).Error; err != nil {
+		t.Fatal(err)
+	}
+	var b strings.Builder
+	for _, table := range tables {
+		var columns []struct {
+			Name      string
+			Type      string
+			NotNull   bool
+			DfltValue *string
+			PK        int
+		}
+		if err := db.Raw(fmt.Sprintf("SELECT name, type, \"notnull\" AS not_null, dflt_value, pk FROM pragma_table_info('%s') ORDER BY name", table)).
+			Scan(&columns).Error; err != nil {
+			t.Fatal(err)
+		}
+		fmt.Fprintf(&b, "table %s\n", table)
+		for _, col := range columns {
+			fmt.Fprintf(&b, "  %s %s", col.Name, col.Type)
+			if col.PK > 0 {
+				b.WriteString(" pk")
+			}
+			if col.NotNull {
+				b.WriteString(" not null")
+			}
+			if col.DfltValue != nil {
+				fmt.Fprintf(&b, " default %s", *col.DfltValue)
+			}
+			b.WriteString("\n")
+		}
+	}
+	var indexes []struct {
+		Name    string
+		TblName string
+	}
+	if err := db.Raw("SELECT name, tbl_name FROM sqlite_master WHERE type = 'index' AND sql IS NOT NULL ORDER BY name").
+		Scan(&indexes).Error; err != nil {
+		t.Fatal(err)
+	}
+	for _, idx := range indexes {
+		fmt.Fprintf(&b, "index %s on %s\n", idx.Name, idx.TblName)
+	}
+	return b.String()
+}
+
+// 数据库版本高于当前程序时拒绝启动和迁移
+func TestMigrateRefusesNewerSchema(t *testing.T) {
+	db := openEmptyDB(t)
+	if err := MigrateDB(db); err != nil {
+		t.Fatal(err)
+	}
+	newer := LatestSchemaVersion() + 1
+	if err := db.Create(&SchemaMigration{Version: newer, Name: "from_the_future"}).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	if err := MigrateDB(db); !errors.Is(err, ErrSchemaTooNew) {
+		t.Fatalf("MigrateDB() = %v, want ErrSchemaTooNew", err)
+	}
+	if _, err := MigrateDown(db, 1); !errors.Is(err, ErrSchemaTooNew) {
+		t.Fatalf("MigrateDown() = %v, want ErrSchemaTooNew", err)
+	}
+	if version, err := SchemaVersion(db); err != nil || version != newer {
+		t.Fatalf("SchemaVersion() = %d, %v; want %d", version, err, newer)
+	}
+	statuses, err := MigrationStatuses(db)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if last := statuses[len(statuses)-1]; last.Version != newer || !last.Unknown || !last.Applied {
+		t.Fatalf("last status = %+v, want unknown applied version %d", last, newer)
+	}
+}
+
+// 迁移到指定版本后只执行到该版本，之后继续迁移到最新版本
+func TestMigrateUpToTarget(t *testing.T) {
+	db := openEmptyDB(t)
+
+	done, err := MigrateUp(db, 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(done) != 3 || done[2].Version != 3 {
+		t.Fatalf("MigrateUp(3) applied %d migrations, want versions 1-3", len(done))
+	}
+	if version, _ := SchemaVersion(db); version != 3 {
+		t.Fatalf("SchemaVersion() = %d, want 3", version)
+	}
+	if done, err := MigrateUp(db, 3); err != nil || len(done) != 0 {
+		t.Fatalf("MigrateUp(3) again = %d migrations, %v; want none", len(done), err)
+	}
+
+	done, err = MigrateUp(db, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(done) != LatestSchemaVersion()-3 || done[0].Version != 4 {
+		t.Fatalf("MigrateUp(0) applied %d migrations starting at %d, want 4-%d", len(done), done[0].Version, LatestSchemaVersion())
+	}
+	if version, _ := SchemaVersion(db); version != LatestSchemaVersion() {
+		t.Fatalf("SchemaVersion() = %d, want %d", version, LatestSchemaVersion())
+	}
+}
+
+// 回滚最近的若干个迁移 (直到 baseline) 后重新迁移，表结构与新建的数据库一致
+func TestMigrateDownUpRoundTrip(t *testing.T) {
+	db := openEmptyDB(t)
+	if _, err := MigrateUp(db, 0); err != nil {
+		t.Fatal(err)
+	}
+	fresh := dumpSchema(t, db)
+
+	for steps := 1; steps < LatestSchemaVersion(); steps++ {
+		done, err := MigrateDown(db, steps)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(done) != steps || done[0].Version != LatestSchemaVersion() {
+			t.Fatalf("MigrateDown(%d) rolled back %d migrations", steps, len(done))
+		}
+		if version, _ := SchemaVersion(db); version != LatestSchemaVersion()-steps {
+			t.Fatalf("SchemaVersion() after MigrateDown(%d) = %d, want %d", steps, version, LatestSchemaVersion()-steps)
+		}
+		if schema := dumpSchema(t, db); schema == fresh {
+			t.Fatalf("MigrateDown(%d) did not change the schema", steps)
+		}
+
+		if _, err := MigrateUp(db, 0); err != nil {
+			t.Fatal(err)
+		}
+		if schema := dumpSchema(t, db); schema != fresh {
+			t.Fatalf("schema after MigrateDown(%d) and MigrateUp differs from a fresh database:\n%s", steps, diffLines(fresh, schema))
+		}
+	}
+
+	// baseline 不可回滚
+	if _, err := MigrateDown(db, LatestSchemaVersion()); err == nil {
+		t.Fatal("MigrateDown() of the baseline succeeded")
+	}
+}
+
+// 已发布版本的表结构记录在 testdata/schema.txt 中。模型的表结构变更必须新增编号迁移
+// (baseline 只在新库和引入版本化迁移之前的数据库上执行，已迁移的数据库不会再执行)，
+// 新增迁移后用 go test ./internal/model -run TestSchemaSnapshot -update-schema 更新记录
+func TestSchemaSnapshot(t *testing.T) {
+	db := openEmptyDB(t)
+	if _, err := MigrateUp(db, 0); err != nil {
+		t.Fatal(err)
+	}
+	schema := dumpSchema(t, db)
+	latest := LatestSchemaVersion()
+
+	path := filepath.Join("testdata", "schema.txt")
+	data, err := os.ReadFile(path)
+	if err != nil && !os.IsNotExist(err) {
+		t.Fatal(err)
+	}
+	header, recorded, _ := strings.Cut(string(data), "\n")
+	version, _ := strconv.Atoi(strings.TrimPrefix(header, "version "))
+
+	if recorded == schema && version == latest {
+		return
+	}
+	if version == latest {
+		t.Fatalf("schema of released migration %d changed, add migration %d for the model change:\n%s", latest, latest+1, diffLines(recorded, schema))
+	}
+	if !*updateSchema {
+		t.Fatalf("%s records version %d, run with -update-schema after adding migration %d", path, version, latest)
+	}
+	if err := os.MkdirAll("testdata", 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, []byte(fmt.Sprintf("version %d\n%s", latest, schema)), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// diffLines 列出只在其中一边出现的行
+func diffLines(want, got string) string {
+	wantLines := make(map[string]bool)
+	for _, line := range strings.Split(want, "\n") {
+		wantLines[line] = true
+	}
+	gotLines := make(map[string]bool)
+	var b strings.Builder
+	for _, line := range strings.Split(got, "\n") {
+		gotLines[line] = true
+		if !wantLines[line] {
+			fmt.Fprintf(&b, "+ %s\n", line)
+		}
+	}
+	for _, line := range strings.Split(want, "\n") {
+		if !gotLines[line] {
+			fmt.Fprintf(&b, "- %s\n", line)
+		}
+	}
+	return b.String()
+}
@@ -0,0 +1,295 @@
+package model
+
+import (
+	"fmt"
+
+	"gorm.io/gorm"
+)
+
+// migrations 所有迁移，按版本号升序排列，已发布的迁移不能修改或删除。
+//
+// 新库由 baseline 按最新的模型建表，之后的迁移仍会在新库上执行一次，
+// 因此新增的迁移必须可重复执行 (例如添加列前先用 HasColumn 检查)。
+//
+// baseline 只在新库和引入版本化迁移之前的数据库上执行，已迁移的数据库不会再执行，
+// 所以模型的任何表结构变更 (新增模型、字段、索引) 都必须同时新增编号迁移，否则新库和升级的库结构不一致。
+// testdata/schema.txt 记录最新版本的表结构，TestSchemaSnapshot 在结构变化而没有新增迁移时失败。
+var migrations = []Migration{
+	{
+		Version: 1,
+		Name:    "baseline",
+		// 按模型创建/补齐表结构，兼容引入版本化迁移之前的数据库
+		Up: func(tx *gorm.DB) error {
+			return tx.AutoMigrate(Models()...)
+		},
+	},
+	{
+		Version: 2,
+		Name:    "composite_indexes",
+		Up: func(tx *gorm.DB) error {
+			for _, idx := range compositeIndexes {
+				if tx.Migrator().HasIndex(idx.table, idx.name) {
+					continue
+				}
+				if err := tx.Exec(fmt.Sprintf("CREATE INDEX %s ON %s(%s)", idx.name, idx.table, idx.columns)).Error; err != nil {
+					return err
+				}
+			}
+			return nil
+		},
+		Down: func(tx *gorm.DB) error {
+			for _, idx := range compositeIndexes {
+				if !tx.Migrator().HasIndex(idx.table, idx.name) {
+					continue
+				}
+				if err := tx.Migrator().DropIndex(idx.table, idx.name); err != nil {
+					return err
+				}
+			}
+			return nil
+		},
+	},
+	{
+		Version: 3,
+		Name:    "health_probes",
+		Up: func(tx *gorm.DB) error {
+			return addColumns(tx, healthProbeColumns)
+		},
+		Down: func(tx *gorm.DB) error {
+			return dropColumns(tx, healthProbeColumns)
+		},
+	},
+	{
+		Version: 4,
+		Name:    "agent_versions",
+		Up: func(tx *gorm.DB) error {
+			return addColumns(tx, agentVersionColumns)
+		},
+		Down: func(tx *gorm.DB) error {
+			return dropColumns(tx, agentVersionColumns)
+		},
+	},
+	{
+		Version: 5,
+		Name:    "decommissioned_agents",
+		Up: func(tx *gorm.DB) error {
+			if tx.Migrator().HasTable(&DecommissionedAgent{}) {
+				return nil
+			}
+			return tx.Migrator().CreateTable(&DecommissionedAgent{})
+		},
+		Down: func(tx *gorm.DB) error {
+			return tx.Migrator().DropTable(&DecommissionedAgent{})
+		},
+	},
+	{
+		Version: 6,
+		Name:    "agent_enrollment",
+		Up: func(tx *gorm.DB) error {
+			if err := addColumns(tx, agentEnrollmentColumns); err != nil {
+				return err
+			}
+			for _, m := range []interface{}{&Node{}, &Client{}} {
+				if !tx.Migrator().HasIndex(m, "AgentPublicKey") {
+					if err := tx.Migrator().CreateIndex(m, "AgentPublicKey"); err != nil {
+						return err
+					}
+				}
+			}
+			if tx.Migrator().HasTable(&AgentJoinToken{}) {
+				return nil
+			}
+			return tx.Migrator().CreateTable(&AgentJoinToken{})
+		},
+		Down: func(tx *gorm.DB) error {
+			if err := tx.Migrator().DropTable(&AgentJoinToken{}); err != nil {
+				return err
+			}
+			return dropColumns(tx, agentEnrollmentColumns)
+		},
+	},
+	{
+		Version: 7,
+		Name:    "agent_stats_seq",
+		Up: func(tx *gorm.DB) error {
+			return addColumns(tx, agentStatsColumns)
+		},
+		Down: func(tx *gorm.DB) error {
+			return dropColumns(tx, agentStatsColumns)
+		},
+	},
+	{
+		Version: 8,
+		Name:    "agent_config_status",
+		Up: func(tx *gorm.DB) error {
+			return addColumns(tx, agentConfigStatusColumns)
+		},
+		Down: func(tx *gorm.DB) error {
+			return dropColumns(tx, agentConfigStatusColumns)
+		},
+	},
+	{
+		Version: 9,
+		Name:    "agent_auth_listen",
+		Up: func(tx *gorm.DB) error {
+			return addColumns(tx, agentAuthListenColumns)
+		},
+		Down: func(tx *gorm.DB) error {
+			return dropColumns(tx, agentAuthListenColumns)
+		},
+	},
+}
+
+// modelColumn 迁移中增删的模型字段
+type modelColumn struct {
+	model interface{}
+	field string
+}
+
+// addColumns 添加缺失的列
+func addColumns(tx *gorm.DB, columns []modelColumn) error {
+	for _, col := range columns {
+		if tx.Migrator().HasColumn(col.model, col.field) {
+			continue
+		}
+		if err := tx.Migrator().AddColumn(col.model, col.field); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// dropColumns 删除存在的列
+func dropColumns(tx *gorm.DB, columns []modelColumn) error {
+	for _, col := range columns {
+		if !tx.Migrator().HasColumn(col.model, col.field) {
+			continue
+		}
+		// SQLite 删除列时重建表，表上的其他索引随之丢失，删除后按原定义重建
+		var indexes []sqliteIndex
+		if tx.Dialector.Name() == DriverSQLite {
+			var err error
+			if indexes, err = tableIndexes(tx, col.model); err != nil {
+				return err
+			}
+		}
+		if err := tx.Migrator().DropColumn(col.model, col.field); err != nil {
+			return err
+		}
+		for _, idx := range indexes {
+			if err := idx.restore(tx, col.model); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// sqliteIndex SQLite 索引定义
+type sqliteIndex struct {
+	Name    string
+	SQL     string
+	columns []string
+}
+
+// tableIndexes 读取模型对应表上显式创建的索引
+func tableIndexes(tx *gorm.DB, model interface{}) ([]sqliteIndex, error) {
+	stmt := &gorm.Statement{DB: tx}
+	if err := stmt.Parse(model); err != nil {
+		return nil, err
+	}
+	var indexes []sqliteIndex
+	if err := tx.Raw("SELECT name, sql FROM sqlite_master WHERE type = 'index' AND tbl_name = ? AND sql IS NOT NULL", stmt.Schema.Table).
+		Scan(&indexes).Error; err != nil {
+		return nil, err
+	}
+	for i := range indexes {
+		if err := tx.Raw("SELECT name FROM pragma_index_info(?)", indexes[i].Name).Scan(&indexes[i].columns).Error; err != nil {
+			return nil, err
+		}
+	}
+	return indexes, nil
+}
+
+// restore 重建丢失的索引，引用已删除列的索引不再重建
+func (idx sqliteIndex) restore(tx *gorm.DB, model interface{}) error {
+	if tx.Migrator().HasIndex(model, idx.Name) {
+		return nil
+	}
+	for _, column := range idx.columns {
+		if !tx.Migrator().HasColumn(model, column) {
+			return nil
+		}
+	}
+	return tx.Exec(idx.SQL).Error
+}
+
+// healthProbeColumns 端到端探测相关的列
+var healthProbeColumns = []modelColumn{
+	{&Node{}, "ProbeTarget"},
+	{&Node{}, "ProbeFromNodeID"},
+	{&HealthCheckLog{}, "Type"},
+	{&HealthCheckLog{}, "Source"},
+	{&HealthCheckLog{}, "Target"},
+	{&HealthCheckLog{}, "ConnectLatency"},
+	{&HealthCheckLog{}, "TLSLatency"},
+	{&HealthCheckLog{}, "FirstByteLatency"},
+}
+
+// agentVersionColumns Agent 上报版本 (用于灰度更新统计)
+var agentVersionColumns = []modelColumn{
+	{&Node{}, "AgentVersion"},
+	{&Client{}, "AgentVersion"},
+}
+
+// agentEnrollmentColumns Agent 密钥登记
+var agentEnrollmentColumns = []modelColumn{
+	{&Node{}, "AgentPublicKey"},
+	{&Node{}, "AgentEnrolledAt"},
+	{&Client{}, "AgentPublicKey"},
+	{&Client{}, "AgentEnrolledAt"},
+	{&DecommissionedAgent{}, "KeyHash"},
+}
+
+// agentStatsColumns Agent 统计序号 (离线统计补报去重)
+var agentStatsColumns = []modelColumn{
+	{&Node{}, "StatsEpoch"},
+	{&Node{}, "StatsSeq"},
+	{&Client{}, "StatsEpoch"},
+	{&Client{}, "StatsSeq"},
+}
+
+// agentConfigStatusColumns Agent 应用配置的结果
+var agentConfigStatusColumns = []modelColumn{
+	{&Node{}, "ConfigStatus"},
+	{&Node{}, "ConfigStatusHash"},
+	{&Node{}, "ConfigError"},
+	{&Node{}, "ConfigReportedAt"},
+	{&Client{}, "ConfigStatus"},
+	{&Client{}, "ConfigStatusHash"},
+	{&Client{}, "ConfigError"},
+	{&Client{}, "ConfigReportedAt"},
+	{&ConfigVersion{}, "Hash"},
+	{&ConfigVersion{}, "ApplyStatus"},
+	{&ConfigVersion{}, "ApplyError"},
+	{&ConfigVersion{}, "AppliedAt"},
+}
+
+// agentAuthListenColumns Agent 上报的认证插件地址
+var agentAuthListenColumns = []modelColumn{
+	{&Node{}, "AgentAuthListen"},
+}
+
+// compositeIndexes 优化查询性能的组合索引
+var compositeIndexes = []struct {
+	name, table, columns string
+}{
+	{"idx_nodes_owner_status", "nodes", "owner_id, status"},
+	{"idx_clients_node_status", "clients", "node_id, status"},
+	{"idx_operation_logs_user_time", "operation_logs", "user_id, created_at"},
+	{"idx_config_versions_node", "config_versions", "node_id, created_at"},
+	{"idx_users_email", "users", "email"},
+	{"idx_plan_resources_plan", "plan_resources", "plan_id, resource_type"},
+	{"idx_port_forwards_node", "port_forwards", "node_id, enabled"},
+	{"idx_tunnels_entry_exit", "tunnels", "entry_node_id, exit_node_id"},
+}
@@ -1,12 +1,17 @@
 package model
 
 import (
+	"database/sql"
+	"fmt"
 	"log"
 	"os"
 	"path/filepath"
 	"time"
 
+	mysqldriver "github.com/go-sql-driver/mysql"
 	"golang.org/x/crypto/bcrypt"
+	"gorm.io/driver/mysql"
+	"gorm.io/driver/postgres"
 	"gorm.io/driver/sqlite"
 	"gorm.io/gorm"
 	"gorm.io/gorm/logger"
@@ -28,6 +33,19 @@ type Node struct {
 	TrafficIn   int64     `gorm:"default:0" json:"traffic_in"`          // 入站流量 (bytes)
 	TrafficOut  int64     `gorm:"default:0" json:"traffic_out"`         // 出站流量 (bytes)
 	Connections int       `gorm:"default:0" json:"connections"`         // 当前连接数
+	AgentVersion string   `gorm:"size:50" json:"agent_version"`         // Agent 上报的版本
+	AgentAuthListen string `gorm:"size:100" json:"agent_auth_listen,omitempty"` // Agent 本地认证插件地址 (-auth-listen，"off" 表示未启用)
+	// Agent 登记 (登记后 Agent 用私钥签名请求，不再接受 AgentToken)
+	AgentPublicKey  string     `gorm:"size:100;index" json:"-"`
+	AgentEnrolledAt *time.Time `json:"agent_enrolled_at,omitempty"`
+	// 已入账的 Agent 统计序号 (离线补报时跳过重复的统计)
+	StatsEpoch string `gorm:"size:32" json:"-"`
+	StatsSeq   uint64 `gorm:"default:0" json:"-"`
+	// Agent 最近一次应用配置的结果 (校验失败或 GOST 异常时 Agent 回滚到上一版本)
+	ConfigStatus     string     `gorm:"size:20" json:"config_status,omitempty"` // applied/rejected/rolled_back
+	ConfigStatusHash string     `gorm:"size:64" json:"config_status_hash,omitempty"`
+	ConfigError      string     `gorm:"type:text" json:"config_error,omitempty"`
+	ConfigReportedAt *time.Time `json:"config_reported_at,omitempty"`
 	// 协议配置
 	Protocol      string `gorm:"size:50;default:socks5" json:"protocol"`    // socks5/http/ss/socks4/http2/ssu/auto/relay/tcp/udp/sni/dns/sshd/redirect/redu/tun/tap
 	Transport     string `gorm:"size:50;default:tcp" json:"transport"`      // tcp/tls/ws/wss/h2/h2c/quic/kcp/grpc/mtls/mtcp/h3/wt/ftcp/icmp 等
@@ -54,6 +72,9 @@ type Node struct {
 	ProbeResist      string `gorm:"size:50" json:"probe_resist"`            // 探测抵抗类型: code/web/host/file
 	ProbeResistValue string `gorm:"size:255" json:"probe_resist_value"`     // 探测抵抗值 (状态码/URL/主机名/文件路径)
 	PluginConfig     string `gorm:"type:text" json:"plugin_config"`         // Plugin 配置 JSON
+	// 端到端探测
+	ProbeTarget     string `gorm:"size:255" json:"probe_target"`           // 探测目标 (http(s):// 或 host:port)，留空使用全局设置
+	ProbeFromNodeID *uint  `json:"probe_from_node_id,omitempty"`           // 由该节点的 Agent 发起探测，为空表示由面板发起
 	// 流量配额
 	TrafficQuota   int64  `gorm:"default:0" json:"traffic_quota"`       // 流量配额 (bytes), 0=无限制
 	QuotaResetDay  int    `gorm:"default:1" json:"quota_reset_day"`     // 每月重置日 (1-28)
@@ -81,6 +102,18 @@ type Client struct {
 	Status      string    `gorm:"size:20;default:offline" json:"status"` // connected/disconnected
 	TrafficIn   int64     `gorm:"default:0" json:"traffic_in"`
 	TrafficOut  int64     `gorm:"default:0" json:"traffic_out"`
+	AgentVersion string   `gorm:"size:50" json:"agent_version"`          // Agent 上报的版本
+	// Agent 登记 (登记后 Agent 用私钥签名请求，不再接受 Token)
+	AgentPublicKey  string     `gorm:"size:100;index" json:"-"`
+	AgentEnrolledAt *time.Time `json:"agent_enrolled_at,omitempty"`
+	// 已入账的 Agent 统计序号 (离线补报时跳过重复的统计)
+	StatsEpoch string `gorm:"size:32" json:"-"`
+	StatsSeq   uint64 `gorm:"default:0" json:"-"`
+	// Agent 最近一次应用配置的结果 (校验失败或 GOST 异常时 Agent 回滚到上一版本)
+	ConfigStatus     string     `gorm:"size:20" json:"config_status,omitempty"` // applied/rejected/rolled_back
+	ConfigStatusHash string     `gorm:"size:64" json:"config_status_hash,omitempty"`
+	ConfigError      string     `gorm:"type:text" json:"config_error,omitempty"`
+	ConfigReportedAt *time.Time `json:"config_reported_at,omitempty"`
 	// 流量配额
 	TrafficQuota   int64  `gorm:"default:0" json:"traffic_quota"`        // 流量配额 (bytes), 0=无限制
 	QuotaResetDay  int    `gorm:"default:1" json:"quota_reset_day"`      // 每月重置日 (1-28)
@@ -120,6 +153,8 @@ type PortForward struct {
 	ChainID     *uint     `gorm:"index" json:"chain_id,omitempty"`        // 使用的转发链
 	Enabled     bool      `gorm:"default:true" json:"enabled"`
 	OwnerID     *uint     `gorm:"index" json:"owner_id,omitempty"`
+	TrafficIn   int64     `gorm:"default:0" json:"traffic_in"`
+	TrafficOut  int64     `gorm:"default:0" json:"traffic_out"`
 	CreatedAt   time.Time `json:"created_at"`
 	UpdatedAt   time.Time `json:"updated_at"`
 }
@@ -163,6 +198,8 @@ type Tunnel struct {
 	ExitNodeID  uint      `gorm:"index" json:"exit_node_id"`               // 出口节点ID
 	ExitNode    *Node     `gorm:"foreignKey:ExitNodeID" json:"exit_node,omitempty"`
 	TargetAddr  string    `gorm:"size:255" json:"target_addr"`             // 目标地址 (如 google.com:443)
+	// 中转跳点 (入口与出口之间依次经过的节点)
+	Hops        []TunnelHop `gorm:"foreignKey:TunnelID" json:"hops"`
 	// 状态
 	Enabled     bool      `gorm:"default:true" json:"enabled"`
 	TrafficIn   int64     `gorm:"default:0" json:"traffic_in"`
@@ -170,6 +207,9 @@ type Tunnel struct {
 	// 流量配额
 	TrafficQuota  int64   `gorm:"default:0" json:"traffic_quota"`          // 流量配额 (bytes), 0=无限制
 	QuotaResetDay int     `gorm:"default:1" json:"quota_reset_day"`
+	QuotaUsed     int64     `gorm:"default:0" json:"quota_used"`           // 本周期已用流量
+	QuotaResetAt  time.Time `json:"quota_reset_at"`                        // 上次重置时间
+	QuotaExceeded bool      `gorm:"default:false" json:"quota_exceeded"`   // 是否超限
 	// 限速
 	SpeedLimit    int64   `gorm:"default:0" json:"speed_limit"`            // 限速 (bytes/s), 0=不限
 	// 所有者
@@ -178,6 +218,16 @@ type Tunnel struct {
 	UpdatedAt   time.Time `json:"updated_at"`
 }
 
+// TunnelHop 隧道中转跳点
+type TunnelHop struct {
+	ID        uint   `gorm:"primaryKey" json:"id"`
+	TunnelID  uint   `gorm:"index" json:"tunnel_id"`
+	NodeID    uint   `gorm:"index" json:"node_id"`
+	Node      *Node  `gorm:"foreignKey:NodeID" json:"node,omitempty"`
+	HopOrder  int    `gorm:"default:0" json:"hop_order"` // 跳点顺序 (0=入口之后的第一跳)
+	Transport string `gorm:"size:50" json:"transport"`   // 连接该跳使用的传输层 (留空使用节点自身配置)
+}
+
 // ProxyChain 代理链 (多跳顺序转发，保留用于高级场景)
 type ProxyChain struct {
 	ID          uint      `gorm:"primaryKey" json:"id"`
@@ -261,6 +311,7 @@ type User struct {
 	QuotaResetDay  int       `gorm:"default:1" json:"quota_reset_day"`     // 每月重置日 (1-28)
 	QuotaResetAt   time.Time `json:"quota_reset_at"`                       // 上次重置时间
 	QuotaExceeded  bool      `gorm:"default:false" json:"quota_exceeded"`  // 是否超限
+	QuotaBaseline  int64     `gorm:"default:0" json:"-"`                   // 上次重置时的累计流量 (用于计算本周期用量)
 	CreatedAt         time.Time  `json:"created_at"`
 	UpdatedAt         time.Time  `json:"updated_at"`
 }
@@ -284,6 +335,7 @@ type Plan struct {
 	Description   string    `gorm:"size:255" json:"description"`             // 套餐描述
 	TrafficQuota  int64     `gorm:"default:0" json:"traffic_quota"`          // 流量配额 (bytes), 0=无限制
 	SpeedLimit    int64     `gorm:"default:0" json:"speed_limit"`            // 速度限制 (bytes/s), 0=不限速
+	ConnRateLimit int       `gorm:"default:0" json:"conn_rate_limit"`        // 每秒最大连接数, 0=不限制
 	Duration      int       `gorm:"default:30" json:"duration"`              // 有效期 (天), 0=永久
 	MaxNodes      int       `gorm:"default:0" json:"max_nodes"`              // 最大节点数, 0=无限制
 	MaxClients    int       `gorm:"default:0" json:"max_clients"`            // 最大客户端数, 0=无限制
@@ -305,16 +357,39 @@ type PlanResource struct {
 	ResourceID   uint   `gorm:"not null" json:"resource_id"`
 }
 
-// TrafficHistory 流量历史记录
-type TrafficHistory struct {
-	ID         uint      `gorm:"primaryKey" json:"id"`
-	NodeID     *uint     `gorm:"index" json:"node_id,omitempty"`
-	TrafficIn  int64     `gorm:"default:0" json:"traffic_in"`
-	TrafficOut int64     `gorm:"default:0" json:"traffic_out"`
-	Connections int      `gorm:"default:0" json:"connections"`
-	RecordedAt time.Time `gorm:"index" json:"recorded_at"`
+// TrafficSeries 分层流量时间序列，每个点为该时间段内的增量 (非累计值)
+// minute 保留 48 小时，hour 保留 90 天，day 保留 2 年
+type TrafficSeries struct {
+	ID           uint      `gorm:"primaryKey" json:"-"`
+	ResourceType string    `gorm:"size:20;uniqueIndex:idx_traffic_series_point,priority:1" json:"resource_type"` // total/node/tunnel/client/user
+	ResourceID   uint      `gorm:"uniqueIndex:idx_traffic_series_point,priority:2" json:"resource_id"`           // total 时为 0
+	Resolution   string    `gorm:"size:10;uniqueIndex:idx_traffic_series_point,priority:3;index:idx_traffic_series_bucket,priority:1" json:"resolution"`
+	BucketAt     time.Time `gorm:"uniqueIndex:idx_traffic_series_point,priority:4;index:idx_traffic_series_bucket,priority:2" json:"bucket_at"`
+	TrafficIn    int64     `gorm:"default:0" json:"traffic_in"`  // 时间段内的入站增量
+	TrafficOut   int64     `gorm:"default:0" json:"traffic_out"` // 时间段内的出站增量
+	Connections  int       `gorm:"default:0" json:"connections"` // 时间段内的峰值连接数
 }
 
+// TrafficCounter 各资源上次采样时的累计流量，用于计算时间序列增量
+type TrafficCounter struct {
+	ResourceType string    `gorm:"primaryKey;size:20"`
+	ResourceID   uint      `gorm:"primaryKey;autoIncrement:false"`
+	TrafficIn    int64     `gorm:"default:0"`
+	TrafficOut   int64     `gorm:"default:0"`
+	SampledAt    time.Time
+}
+
+// 流量时间序列资源类型
+const (
+	TrafficResourceTotal       = "total"
+	TrafficResourceNode        = "node"
+	TrafficResourceTunnel      = "tunnel"
+	TrafficResourceClient      = "client"
+	TrafficResourcePortForward = "port_forward"
+	TrafficResourceUser        = "user"
+	TrafficResourceCredential  = "credential" // 仅用于采样计数，流量计入凭据持有人
+)
+
 // NotifyChannel 通知渠道配置
 type NotifyChannel struct {
 	ID        uint      `gorm:"primaryKey" json:"id"`
@@ -354,7 +429,7 @@ type SMTPConfig struct {
 type AlertRule struct {
 	ID          uint      `gorm:"primaryKey" json:"id"`
 	Name        string    `gorm:"size:100;not null" json:"name"`
-	Type        string    `gorm:"size:50;not null" json:"type"`          // node_offline/quota_exceeded/traffic_spike
+	Type        string    `gorm:"size:50;not null" json:"type"`          // node_offline/quota_exceeded/traffic_spike/node_probe_failed
 	Condition   string    `gorm:"type:text" json:"condition"`            // JSON 条件配置
 	ChannelIDs  string    `gorm:"size:255" json:"channel_ids"`           // 通知渠道 ID，逗号分隔
 	Enabled     bool      `gorm:"default:true" json:"enabled"`
@@ -480,17 +555,83 @@ type ConfigVersion struct {
 	NodeID    uint      `gorm:"index;not null" json:"node_id"`
 	Config    string    `gorm:"type:text;not null" json:"config"` // YAML 配置快照
 	Comment   string    `gorm:"size:255" json:"comment"`          // 版本说明
-	CreatedAt time.Time `json:"created_at"`
+	Hash      string    `gorm:"size:64" json:"hash"`              // 配置哈希 (与 Agent 上报的一致)
+	// Agent 应用该版本的结果
+	ApplyStatus string     `gorm:"size:20" json:"apply_status,omitempty"` // applied/rejected/rolled_back
+	ApplyError  string     `gorm:"type:text" json:"apply_error,omitempty"`
+	AppliedAt   *time.Time `json:"applied_at,omitempty"`
+	CreatedAt   time.Time  `json:"created_at"`
 }
 
 // HealthCheckLog 健康检查日志
 type HealthCheckLog struct {
+	ID               uint      `gorm:"primaryKey" json:"id"`
+	NodeID           uint      `gorm:"index" json:"node_id"`
+	Type             string    `gorm:"size:20" json:"type"`    // heartbeat, api, probe
+	Source           string    `gorm:"size:50" json:"source"`  // 探测发起方: panel / node-<id>
+	Target           string    `gorm:"size:255" json:"target"` // 探测目标
+	Status           string    `gorm:"size:20" json:"status"`  // healthy, unhealthy, unknown
+	Latency          int       `json:"latency"`                // ms
+	ConnectLatency   int       `json:"connect_latency"`        // 端到端探测: TCP 连接节点 (ms)
+	TLSLatency       int       `json:"tls_latency"`            // 端到端探测: TLS 握手 (ms)
+	FirstByteLatency int       `json:"first_byte_latency"`     // 端到端探测: 目标首字节 (ms)
+	ErrorMsg         string    `gorm:"size:500" json:"error_msg"`
+	CheckedAt        time.Time `gorm:"index" json:"checked_at"`
+}
+
+// JobStatus 定时任务运行状态
+type JobStatus struct {
+	ID           uint       `gorm:"primaryKey" json:"id"`
+	Name         string     `gorm:"size:50;uniqueIndex;not null" json:"name"`
+	LastRunAt    *time.Time `json:"last_run_at,omitempty"`
+	LastDuration int64      `gorm:"default:0" json:"last_duration"` // ms
+	LastError    string     `gorm:"type:text" json:"last_error"`
+	LastSuccess  bool       `gorm:"default:false" json:"last_success"`
+	RunCount     int64      `gorm:"default:0" json:"run_count"`
+	FailCount    int64      `gorm:"default:0" json:"fail_count"`
+	UpdatedAt    time.Time  `json:"updated_at"`
+}
+
+// DecommissionedAgent 已删除的节点/客户端，其 Agent 之后上报时会收到签名的卸载命令
+// (未知 Token 不会触发卸载，只有确实由面板删除的 Agent 才会卸载)
+type DecommissionedAgent struct {
 	ID        uint      `gorm:"primaryKey" json:"id"`
-	NodeID    uint      `gorm:"index" json:"node_id"`
-	Status    string    `gorm:"size:20" json:"status"`     // healthy, unhealthy
-	Latency   int       `json:"latency"`                   // ms
-	ErrorMsg  string    `gorm:"size:500" json:"error_msg"`
-	CheckedAt time.Time `gorm:"index" json:"checked_at"`
+	Kind      string    `gorm:"size:20;not null" json:"kind"` // node/client
+	TargetID  uint      `gorm:"not null" json:"target_id"`
+	Name      string    `gorm:"size:100" json:"name"`
+	TokenHash string    `gorm:"size:64;uniqueIndex;not null" json:"-"` // Agent Token 的 SHA-256
+	KeyHash   string    `gorm:"size:64" json:"-"`                      // 已登记的 Agent 公钥的 SHA-256
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// AgentJoinToken 一次性加入令牌，Agent 用它登记自己的公钥
+type AgentJoinToken struct {
+	ID        uint       `gorm:"primaryKey" json:"id"`
+	Kind      string     `gorm:"size:20;not null" json:"kind"` // node/client
+	TargetID  uint       `gorm:"not null;index" json:"target_id"`
+	TokenHash string     `gorm:"size:64;uniqueIndex;not null" json:"-"` // 令牌的 SHA-256
+	ExpiresAt time.Time  `json:"expires_at"`
+	UsedAt    *time.Time `json:"used_at,omitempty"`
+	CreatedBy uint       `json:"created_by"`
+	CreatedAt time.Time  `json:"created_at"`
+}
+
+// ProxyCredential 用户在节点上的代理凭据 (共享节点多用户认证)
+type ProxyCredential struct {
+	ID         uint       `gorm:"primaryKey" json:"id"`
+	NodeID     uint       `gorm:"uniqueIndex:idx_credential_node_user;uniqueIndex:idx_credential_node_username;not null" json:"node_id"`
+	Node       *Node      `gorm:"foreignKey:NodeID" json:"node,omitempty"`
+	UserID     uint       `gorm:"uniqueIndex:idx_credential_node_user;index;not null" json:"user_id"`
+	User       *User      `gorm:"foreignKey:UserID" json:"user,omitempty"`
+	Username   string     `gorm:"size:100;uniqueIndex:idx_credential_node_username;not null" json:"username"`
+	Password   string     `gorm:"size:100;not null" json:"password"`
+	Enabled    bool       `gorm:"default:true" json:"enabled"`
+	TrafficIn  int64      `gorm:"default:0" json:"traffic_in"`  // 入站流量 (bytes)
+	TrafficOut int64      `gorm:"default:0" json:"traffic_out"` // 出站流量 (bytes)
+	LastUsedAt *time.Time `json:"last_used_at,omitempty"`       // 最近一次产生流量的时间
+	RotatedAt  *time.Time `json:"rotated_at,omitempty"`         // 最近一次轮换密码的时间
+	CreatedAt  time.Time  `json:"created_at"`
+	UpdatedAt  time.Time  `json:"updated_at"`
 }
 
 // SiteConfig 网站配置
@@ -501,41 +642,90 @@ type SiteConfig struct {
 	UpdatedAt time.Time `json:"updated_at"`
 }
 
-// InitDB 初始化数据库
-func InitDB(dbPath string) (*gorm.DB, error) {
-	// 确保目录存在
-	dir := filepath.Dir(dbPath)
-	if err := os.MkdirAll(dir, 0755); err != nil {
+// 数据库类型
+const (
+	DriverSQLite   = "sqlite"
+	DriverPostgres = "postgres"
+	DriverMySQL    = "mysql"
+)
+
+// InitDB 初始化数据库，dsn 对 SQLite 为数据库文件路径
+func InitDB(driver, dsn string) (*gorm.DB, error) {
+	db, err := OpenDB(driver, dsn)
+	if err != nil {
 		return nil, err
 	}
+	if err := MigrateDB(db); err != nil {
+		return nil, err
+	}
+	return db, nil
+}
+
+// OpenDB 打开数据库连接 (不执行迁移)
+func OpenDB(driver, dsn string) (*gorm.DB, error) {
+	var dialector gorm.Dialector
+	switch driver {
+	case DriverSQLite, "":
+		// 确保目录存在
+		dir := filepath.Dir(dsn)
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			return nil, err
+		}
+		conn, err := sql.Open(sqlite.DriverName, dsn)
+		if err != nil {
+			return nil, err
+		}
+		// 在线恢复时替换数据库文件，需要能在运行中替换连接池
+		dialector = sqlite.New(sqlite.Config{DSN: dsn, Conn: NewSwitchablePool(conn)})
+	case DriverPostgres:
+		dialector = postgres.Open(dsn)
+	case DriverMySQL:
+		cfg, err := mysqldriver.ParseDSN(dsn)
+		if err != nil {
+			return nil, fmt.Errorf("invalid mysql dsn: %w", err)
+		}
+		cfg.ParseTime = true // 时间字段需要解析为 time.Time
+		// 影响行数按匹配行计算 (与 SQLite/PostgreSQL 一致)，否则值未变化的更新返回 0，
+		// 依赖影响行数判断记录是否存在的逻辑 (如流量时间段累加) 会重复插入
+		cfg.ClientFoundRows = true
+		if _, ok := cfg.Params["sql_mode"]; !ok {
+			// 未设置的时间字段以零值保存，默认的严格模式 (NO_ZERO_DATE) 会拒绝写入
+			if cfg.Params == nil {
+				cfg.Params = make(map[string]string)
+			}
+			cfg.Params["sql_mode"] = "'STRICT_TRANS_TABLES,ERROR_FOR_DIVISION_BY_ZERO,NO_ENGINE_SUBSTITUTION'"
+		}
+		dialector = mysql.Open(cfg.FormatDSN())
+	default:
+		return nil, fmt.Errorf("unsupported database driver: %s", driver)
+	}
 
-	db, err := gorm.Open(sqlite.Open(dbPath), &gorm.Config{
+	return gorm.Open(dialector, &gorm.Config{
 		Logger: logger.New(log.New(os.Stdout, "\r\n", log.LstdFlags), logger.Config{
 			SlowThreshold:             200 * time.Millisecond,
 			LogLevel:                  logger.Warn,
 			IgnoreRecordNotFoundError: true,
 		}),
+		// SQLite 未启用外键检查，已有数据可能引用已删除的记录，其他数据库保持一致
+		DisableForeignKeyConstraintWhenMigrating: true,
 	})
+}
+
+// Models 所有数据表模型
+func Models() []interface{} {
+	return []interface{}{&Node{}, &Client{}, &Service{}, &User{}, &UserSession{}, &Plan{}, &PlanResource{}, &TrafficSeries{}, &TrafficCounter{}, &NotifyChannel{}, &AlertRule{}, &AlertLog{}, &PortForward{}, &NodeGroup{}, &NodeGroupMember{}, &DNSConfig{}, &OperationLog{}, &ProxyChain{}, &ProxyChainHop{}, &Tunnel{}, &TunnelHop{}, &SiteConfig{}, &Tag{}, &NodeTag{}, &Bypass{}, &Admission{}, &HostMapping{}, &Ingress{}, &Recorder{}, &Router{}, &SD{}, &ConfigVersion{}, &HealthCheckLog{}, &JobStatus{}, &ProxyCredential{}, &DecommissionedAgent{}, &AgentJoinToken{}}
+}
+
+// MigrateDB 执行未执行的版本化迁移，然后创建默认管理员和默认系统配置
+func MigrateDB(db *gorm.DB) error {
+	applied, err := MigrateUp(db, 0)
 	if err != nil {
-		return nil, err
+		return err
 	}
-
-	// 自动迁移
-	if err := db.AutoMigrate(&Node{}, &Client{}, &Service{}, &User{}, &UserSession{}, &Plan{}, &PlanResource{}, &TrafficHistory{}, &NotifyChannel{}, &AlertRule{}, &AlertLog{}, &PortForward{}, &NodeGroup{}, &NodeGroupMember{}, &DNSConfig{}, &OperationLog{}, &ProxyChain{}, &ProxyChainHop{}, &Tunnel{}, &SiteConfig{}, &Tag{}, &NodeTag{}, &Bypass{}, &Admission{}, &HostMapping{}, &Ingress{}, &Recorder{}, &Router{}, &SD{}, &ConfigVersion{}, &HealthCheckLog{}); err != nil {
-		return nil, err
+	for _, m := range applied {
+		log.Printf("Applied database migration %d (%s)", m.Version, m.Name)
 	}
 
-	// 创建索引优化查询性能
-	db.Exec("CREATE INDEX IF NOT EXISTS idx_nodes_owner_status ON nodes(owner_id, status)")
-	db.Exec("CREATE INDEX IF NOT EXISTS idx_clients_node_status ON clients(node_id, status)")
-	db.Exec("CREATE INDEX IF NOT EXISTS idx_operation_logs_user_time ON operation_logs(user_id, created_at)")
-	db.Exec("CREATE INDEX IF NOT EXISTS idx_traffic_histories_node_time ON traffic_histories(node_id, recorded_at)")
-	db.Exec("CREATE INDEX IF NOT EXISTS idx_config_versions_node ON config_versions(node_id, created_at)")
-	db.Exec("CREATE INDEX IF NOT EXISTS idx_users_email ON users(email)")
-	db.Exec("CREATE INDEX IF NOT EXISTS idx_plan_resources_plan ON plan_resources(plan_id, resource_type)")
-	db.Exec("CREATE INDEX IF NOT EXISTS idx_port_forwards_node ON port_forwards(node_id, enabled)")
-	db.Exec("CREATE INDEX IF NOT EXISTS idx_tunnels_entry_exit ON tunnels(entry_node_id, exit_node_id)")
-
 	// 创建默认管理员
 	var count int64
 	db.Model(&User{}).Count(&count)
@@ -553,7 +743,7 @@ func InitDB(dbPath string) (*gorm.DB, error) {
 	// 初始化默认系统配置
 	initDefaultSiteConfigs(db)
 
-	return db, nil
+	return nil
 }
 
 func hashPassword(password string) string {
@@ -683,6 +873,37 @@ const (
 	ConfigSiteURL                = "site_url"                 // 站点 URL（用于邮件链接）
 	ConfigAgentAutoUpdate        = "agent_auto_update"        // Agent 自动更新开关
 	ConfigAgentForceUpdate       = "agent_force_update"       // 强制所有 Agent 更新
+	ConfigAlertLogRetentionDays  = "alert_log_retention_days" // 告警日志保留天数
+	ConfigNodeOfflineTimeout     = "node_offline_timeout"     // 节点心跳超时 (分钟)
+	ConfigQuotaExceededAction    = "quota_exceeded_action"    // 流量超限处理方式: block (拒绝连接) / throttle (限速)
+	ConfigQuotaThrottleSpeed     = "quota_throttle_speed"     // throttle 模式下的限速 (bytes/s)
+	ConfigProxyAuthMode          = "proxy_auth_mode"          // 用户代理凭据校验方式: static (写入配置) / plugin (由面板实时校验)
+	ConfigBackupTarget           = "backup_target"            // 备份存储: local / s3 / webdav
+	ConfigBackupTargetConfig     = "backup_target_config"     // 备份存储配置 (JSON)
+	ConfigBackupRetention        = "backup_retention"         // 保留的备份数量，0 表示不限
+	ConfigBackupEncryptionKey    = "backup_encryption_key"    // 备份加密口令，留空表示不加密
+	ConfigHealthProbeTarget      = "health_probe_target"      // 默认端到端探测目标，留空表示只探测设置了目标的节点
+	ConfigHealthProbeInterval    = "health_probe_interval"    // 端到端探测间隔 (秒)
+	ConfigHealthProbeTimeout     = "health_probe_timeout"     // 端到端探测超时 (秒)
+	ConfigAgentRolloutPercent    = "agent_rollout_percent"    // Agent 更新灰度比例 (0-100)
+	ConfigAgentRolloutTags       = "agent_rollout_tags"       // Agent 更新只下发给带这些标签的节点 (逗号分隔)，留空表示不限
+	ConfigPanelSigningKey        = "panel_signing_key"        // 面板签名私钥 (签发 Agent 卸载命令，自动生成，不通过接口读写)
+	ConfigAgentJoinTokenTTL      = "agent_join_token_ttl"     // 加入令牌有效期 (分钟)
+	ConfigAgentRequireEnrollment = "agent_require_enrollment" // 只接受已登记密钥的 Agent (关闭 Token 认证)
+	ConfigAgentPublicDownload    = "agent_public_download"    // 允许未认证下载 Agent 二进制 (安装脚本无有效 Token 时)
+)
+
+// 定时任务调度表达式配置键 (cron 格式，留空或 off 表示停用)
+const (
+	ConfigJobTrafficHistory  = "job_schedule_traffic_history"   // 流量历史记录
+	ConfigJobSessionCleanup  = "job_schedule_session_cleanup"   // 过期会话清理
+	ConfigJobQuotaReset      = "job_schedule_quota_reset"       // 节点/客户端配额重置
+	ConfigJobUserQuotaReset  = "job_schedule_user_quota_reset"  // 用户配额重置
+	ConfigJobPlanExpiry      = "job_schedule_plan_expiry"       // 套餐到期处理
+	ConfigJobOfflineCheck    = "job_schedule_offline_check"     // 离线节点检测
+	ConfigJobAlertLogCleanup = "job_schedule_alert_log_cleanup" // 告警日志清理
+	ConfigJobQuotaCheck      = "job_schedule_quota_check"       // 流量超限状态同步
+	ConfigJobBackup          = "job_schedule_backup"            // 数据库定时备份
 )
 
 // initDefaultSiteConfigs 初始化默认系统配置
@@ -695,11 +916,38 @@ func initDefaultSiteConfigs(db *gorm.DB) {
 		ConfigSiteURL:                   "",
 		ConfigAgentAutoUpdate:           "true",
 		ConfigAgentForceUpdate:          "false",
+		ConfigAlertLogRetentionDays:     "30",
+		ConfigNodeOfflineTimeout:        "3",
+		ConfigQuotaExceededAction:       "block",
+		ConfigQuotaThrottleSpeed:        "1024",
+		ConfigProxyAuthMode:             "static",
+		ConfigBackupTarget:              "local",
+		ConfigBackupTargetConfig:        "",
+		ConfigBackupRetention:           "7",
+		ConfigBackupEncryptionKey:       "",
+		ConfigHealthProbeTarget:         "",
+		ConfigHealthProbeInterval:       "60",
+		ConfigHealthProbeTimeout:        "10",
+		ConfigAgentRolloutPercent:       "100",
+		ConfigAgentRolloutTags:          "",
+		ConfigAgentJoinTokenTTL:         "60",
+		ConfigAgentRequireEnrollment:    "false",
+		ConfigAgentPublicDownload:       "false",
+		ConfigJobTrafficHistory:         "* * * * *",
+		ConfigJobSessionCleanup:         "0 * * * *",
+		ConfigJobQuotaReset:             "5 0 * * *",
+		ConfigJobUserQuotaReset:         "10 0 * * *",
+		ConfigJobPlanExpiry:             "*/5 * * * *",
+		ConfigJobOfflineCheck:           "* * * * *",
+		ConfigJobAlertLogCleanup:        "30 3 * * *",
+		ConfigJobQuotaCheck:             "* * * * *",
+		ConfigJobBackup:                 "0 4 * * *",
 	}
 
 	for key, value := range defaultConfigs {
 		var config SiteConfig
-		if db.Where("key = ?", key).First(&config).Error != nil {
+		// key 是 MySQL 保留字，使用 map 条件由 GORM 加引号
+		if db.Where(map[string]interface{}{"key": key}).First(&config).Error != nil {
 			db.Create(&SiteConfig{Key: key, Value: value})
 		}
 	}
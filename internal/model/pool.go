@@ -0,0 +1,155 @@
+package model
+
+import (
+	"context"
+	"database/sql"
+	"sync"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// SwitchablePool 可以在运行中替换底层 *sql.DB 的连接池 (SQLite 在线恢复时替换数据库文件)。
+// 共享的 gorm.DB 始终持有同一个 SwitchablePool，替换时不修改 gorm.DB 的字段。
+// Switch 期间新的查询和事务等待替换完成，后台任务随之暂停
+type SwitchablePool struct {
+	mu     sync.Mutex
+	cond   *sync.Cond
+	db     *sql.DB
+	paused bool
+	active int // 进行中的查询和未结束的事务
+}
+
+// NewSwitchablePool 包装 *sql.DB
+func NewSwitchablePool(db *sql.DB) *SwitchablePool {
+	p := &SwitchablePool{db: db}
+	p.cond = sync.NewCond(&p.mu)
+	return p
+}
+
+// acquire 等待替换完成后取得当前连接池，调用方结束后必须调用 release
+func (p *SwitchablePool) acquire() *sql.DB {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	for p.paused {
+		p.cond.Wait()
+	}
+	p.active++
+	return p.db
+}
+
+func (p *SwitchablePool) release() {
+	p.mu.Lock()
+	p.active--
+	p.cond.Broadcast()
+	p.mu.Unlock()
+}
+
+// Switch 暂停新的查询和事务，等待进行中的操作结束 (最多 drain)，然后调用 fn 替换连接池。
+// fn 负责关闭旧连接池，返回 nil 时保留旧连接池。
+// 超过 drain 仍未结束的事务 (例如在事务中又通过共享 gorm.DB 查询) 不再等待，之后的操作会失败
+func (p *SwitchablePool) Switch(drain time.Duration, fn func(old *sql.DB) *sql.DB) {
+	p.mu.Lock()
+	for p.paused {
+		p.cond.Wait()
+	}
+	p.paused = true
+	deadline := time.Now().Add(drain)
+	timer := time.AfterFunc(drain, func() {
+		p.mu.Lock()
+		p.cond.Broadcast()
+		p.mu.Unlock()
+	})
+	for p.active > 0 && time.Now().Before(deadline) {
+		p.cond.Wait()
+	}
+	timer.Stop()
+	old := p.db
+	p.mu.Unlock()
+
+	fresh := fn(old)
+
+	p.mu.Lock()
+	if fresh != nil {
+		p.db = fresh
+	}
+	p.paused = false
+	p.cond.Broadcast()
+	p.mu.Unlock()
+}
+
+// GetDBConn 返回当前的 *sql.DB (gorm.DB.DB() 使用)
+func (p *SwitchablePool) GetDBConn() (*sql.DB, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.db, nil
+}
+
+// Ping 检查当前连接池
+func (p *SwitchablePool) Ping() error {
+	db := p.acquire()
+	defer p.release()
+	return db.Ping()
+}
+
+func (p *SwitchablePool) PrepareContext(ctx context.Context, query string) (*sql.Stmt, error) {
+	db := p.acquire()
+	defer p.release()
+	return db.PrepareContext(ctx, query)
+}
+
+func (p *SwitchablePool) ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error) {
+	db := p.acquire()
+	defer p.release()
+	return db.ExecContext(ctx, query, args...)
+}
+
+// QueryContext 返回的 Rows 在替换后仍可读取完 (旧连接在归还时关闭)
+func (p *SwitchablePool) QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error) {
+	db := p.acquire()
+	defer p.release()
+	return db.QueryContext(ctx, query, args...)
+}
+
+func (p *SwitchablePool) QueryRowContext(ctx context.Context, query string, args ...interface{}) *sql.Row {
+	db := p.acquire()
+	defer p.release()
+	return db.QueryRowContext(ctx, query, args...)
+}
+
+// BeginTx 开始事务，事务提交或回滚前替换会等待
+func (p *SwitchablePool) BeginTx(ctx context.Context, opts *sql.TxOptions) (gorm.ConnPool, error) {
+	db := p.acquire()
+	tx, err := db.BeginTx(ctx, opts)
+	if err != nil {
+		p.release()
+		return nil, err
+	}
+	return &switchableTx{Tx: tx, pool: p}, nil
+}
+
+// switchableTx 事务结束时通知连接池
+type switchableTx struct {
+	*sql.Tx
+	pool *SwitchablePool
+	once sync.Once
+}
+
+func (t *switchableTx) Commit() error {
+	defer t.done()
+	return t.Tx.Commit()
+}
+
+func (t *switchableTx) Rollback() error {
+	defer t.done()
+	return t.Tx.Rollback()
+}
+
+func (t *switchableTx) done() {
+	t.once.Do(t.pool.release)
+}
+
+// GetDBConn 事务中调用 gorm.DB.DB() 时返回当前连接池
+func (t *switchableTx) GetDBConn() (*sql.DB, error) {
+	return t.pool.GetDBConn()
+}
@@ -0,0 +1,138 @@
+package model
+
+import (
+	"context"
+	"database/sql"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+func openTestDB(t *testing.T) (*gorm.DB, *SwitchablePool) {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "test.db")
+	db, err := OpenDB(DriverSQLite, path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := db.Exec("CREATE TABLE items (id INTEGER PRIMARY KEY, name TEXT)").Error; err != nil {
+		t.Fatal(err)
+	}
+	pool, ok := db.ConnPool.(*SwitchablePool)
+	if !ok {
+		t.Fatalf("sqlite ConnPool is %T, want *SwitchablePool", db.ConnPool)
+	}
+	t.Cleanup(func() {
+		if sqlDB, err := db.DB(); err == nil {
+			sqlDB.Close()
+		}
+	})
+	return db, pool
+}
+
+// 替换前等待已开始的事务结束，替换期间的新查询等待替换完成
+func TestSwitchablePoolWaitsForTransaction(t *testing.T) {
+	db, pool := openTestDB(t)
+
+	tx := db.Begin()
+	if tx.Error != nil {
+		t.Fatal(tx.Error)
+	}
+	if err := tx.Exec("INSERT INTO items (name) VALUES ('a')").Error; err != nil {
+		t.Fatal(err)
+	}
+
+	var switched atomic.Bool
+	release := make(chan struct{})
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		pool.Switch(5*time.Second, func(old *sql.DB) *sql.DB {
+			switched.Store(true)
+			<-release
+			return nil
+		})
+	}()
+
+	time.Sleep(100 * time.Millisecond)
+	if switched.Load() {
+		t.Fatal("switched while a transaction was still open")
+	}
+	if err := tx.Commit().Error; err != nil {
+		t.Fatal(err)
+	}
+	waitFor(t, switched.Load)
+
+	// 替换进行中，新的查询等待
+	queried := make(chan int64)
+	go func() {
+		var n int64
+		db.Table("items").Count(&n)
+		queried <- n
+	}()
+	select {
+	case <-queried:
+		t.Fatal("query ran while the pool was switching")
+	case <-time.After(100 * time.Millisecond):
+	}
+
+	close(release)
+	<-done
+	if n := <-queried; n != 1 {
+		t.Fatalf("count = %d, want 1", n)
+	}
+}
+
+// 超过等待时间仍未结束的事务不再阻塞替换
+func TestSwitchablePoolDrainTimeout(t *testing.T) {
+	_, pool := openTestDB(t)
+
+	tx, err := pool.BeginTx(context.Background(), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer tx.(interface{ Rollback() error }).Rollback()
+
+	start := time.Now()
+	pool.Switch(200*time.Millisecond, func(old *sql.DB) *sql.DB { return nil })
+	if elapsed := time.Since(start); elapsed < 200*time.Millisecond || elapsed > 2*time.Second {
+		t.Fatalf("Switch returned after %v, want about 200ms", elapsed)
+	}
+}
+
+// 替换后的查询使用新的连接池
+func TestSwitchablePoolReplacesDB(t *testing.T) {
+	_, pool := openTestDB(t)
+	_, other := openTestDB(t)
+	otherDB, _ := other.GetDBConn()
+	if _, err := otherDB.Exec("INSERT INTO items (name) VALUES ('b'), ('c')"); err != nil {
+		t.Fatal(err)
+	}
+
+	pool.Switch(time.Second, func(old *sql.DB) *sql.DB {
+		old.Close()
+		return otherDB
+	})
+
+	var n int
+	if err := pool.QueryRowContext(context.Background(), "SELECT COUNT(*) FROM items").Scan(&n); err != nil {
+		t.Fatal(err)
+	}
+	if n != 2 {
+		t.Fatalf("count = %d, want 2", n)
+	}
+}
+
+func waitFor(t *testing.T, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatal("timed out waiting for condition")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
@@ -114,6 +114,8 @@ func targetTypeToName(targetType string) string {
 		return "节点"
 	case "client":
 		return "客户端"
+	case "tunnel":
+		return "隧道"
 	default:
 		return targetType
 	}
@@ -141,6 +143,28 @@ func (a *AlertService) CheckClientQuota(client *model.Client) {
 	}
 }
 
+// CheckTunnelQuota 检查隧道流量配额
+func (a *AlertService) CheckTunnelQuota(tunnel *model.Tunnel) {
+	if tunnel.TrafficQuota <= 0 {
+		return
+	}
+
+	totalUsed := tunnel.QuotaUsed
+	usagePercent := float64(totalUsed) / float64(tunnel.TrafficQuota) * 100
+
+	// 检查预警阈值
+	a.checkQuotaWarning(tunnel.ID, "tunnel", tunnel.Name, totalUsed, tunnel.TrafficQuota, usagePercent)
+
+	if totalUsed >= tunnel.TrafficQuota && !tunnel.QuotaExceeded {
+		a.db.Model(tunnel).Update("quota_exceeded", true)
+		a.TriggerAlert("quota_exceeded", "tunnel", tunnel.ID, tunnel.Name,
+			fmt.Sprintf("隧道 %s 流量已超限\n已用: %s / 配额: %s",
+				tunnel.Name,
+				formatBytes(totalUsed),
+				formatBytes(tunnel.TrafficQuota)))
+	}
+}
+
 // CheckNodeOffline 检查节点离线
 func (a *AlertService) CheckNodeOffline(node *model.Node, previousStatus string) {
 	if previousStatus == "online" && node.Status == "offline" {
@@ -218,13 +242,15 @@ func (a *AlertService) TriggerAlert(alertType, targetType string, targetID uint,
 }
 
 // ResetQuotas 重置流量配额（每天检查一次）
-func (a *AlertService) ResetQuotas() {
+func (a *AlertService) ResetQuotas() error {
 	today := time.Now().Day()
 
 	// 重置节点配额
 	var nodes []model.Node
-	a.db.Where("quota_reset_day = ? AND (quota_reset_at IS NULL OR quota_reset_at < ?)",
-		today, time.Now().AddDate(0, 0, -28)).Find(&nodes)
+	if err := a.db.Where("quota_reset_day = ? AND (quota_reset_at IS NULL OR quota_reset_at < ?)",
+		today, time.Now().AddDate(0, 0, -28)).Find(&nodes).Error; err != nil {
+		return err
+	}
 
 	for _, node := range nodes {
 		a.db.Model(&node).Updates(map[string]interface{}{
@@ -236,8 +262,10 @@ func (a *AlertService) ResetQuotas() {
 
 	// 重置客户端配额
 	var clients []model.Client
-	a.db.Where("quota_reset_day = ? AND (quota_reset_at IS NULL OR quota_reset_at < ?)",
-		today, time.Now().AddDate(0, 0, -28)).Find(&clients)
+	if err := a.db.Where("quota_reset_day = ? AND (quota_reset_at IS NULL OR quota_reset_at < ?)",
+		today, time.Now().AddDate(0, 0, -28)).Find(&clients).Error; err != nil {
+		return err
+	}
 
 	for _, client := range clients {
 		a.db.Model(&client).Updates(map[string]interface{}{
@@ -246,14 +274,33 @@ func (a *AlertService) ResetQuotas() {
 			"quota_reset_at": time.Now(),
 		})
 	}
+
+	// 重置隧道配额
+	var tunnels []model.Tunnel
+	if err := a.db.Where("quota_reset_day = ? AND (quota_reset_at IS NULL OR quota_reset_at < ?)",
+		today, time.Now().AddDate(0, 0, -28)).Find(&tunnels).Error; err != nil {
+		return err
+	}
+
+	for _, tunnel := range tunnels {
+		a.db.Model(&tunnel).Updates(map[string]interface{}{
+			"quota_used":     0,
+			"quota_exceeded": false,
+			"quota_reset_at": time.Now(),
+		})
+	}
+
+	return nil
 }
 
 // CheckOfflineNodes 检查离线节点（心跳超时）
-func (a *AlertService) CheckOfflineNodes(timeoutMinutes int) {
+func (a *AlertService) CheckOfflineNodes(timeoutMinutes int) error {
 	threshold := time.Now().Add(-time.Duration(timeoutMinutes) * time.Minute)
 
 	var nodes []model.Node
-	a.db.Where("status = ? AND last_seen < ?", "online", threshold).Find(&nodes)
+	if err := a.db.Where("status = ? AND last_seen < ?", "online", threshold).Find(&nodes).Error; err != nil {
+		return err
+	}
 
 	for _, node := range nodes {
 		a.db.Model(&node).Update("status", "offline")
@@ -262,12 +309,14 @@ func (a *AlertService) CheckOfflineNodes(timeoutMinutes int) {
 				node.Name,
 				node.LastSeen.Format("2006-01-02 15:04:05")))
 	}
+
+	return nil
 }
 
 // CleanupAlertLogs 清理旧的告警日志
-func (a *AlertService) CleanupAlertLogs(retentionDays int) {
+func (a *AlertService) CleanupAlertLogs(retentionDays int) error {
 	threshold := time.Now().AddDate(0, 0, -retentionDays)
-	a.db.Where("created_at < ?", threshold).Delete(&model.AlertLog{})
+	return a.db.Where("created_at < ?", threshold).Delete(&model.AlertLog{}).Error
 }
 
 // GetAlertLogs 获取告警日志
@@ -295,6 +344,10 @@ func alertTypeToTitle(alertType string) string {
 		return "流量异常"
 	case "agent_update":
 		return "Agent 更新"
+	case "config_apply":
+		return "配置应用失败"
+	case "node_probe_failed":
+		return "节点探测失败"
 	default:
 		return "告警"
 	}
@@ -442,6 +495,27 @@ func (a *AlertService) CreateDefaultRules() error {
 			Enabled:     true,
 			CooldownMin: 30,
 		},
+		{
+			Name:        "节点探测失败告警",
+			Type:        "node_probe_failed",
+			Condition:   "{}",
+			Enabled:     true,
+			CooldownMin: 30,
+		},
+		{
+			Name:        "Agent 更新回滚告警",
+			Type:        "agent_update",
+			Condition:   "{}",
+			Enabled:     true,
+			CooldownMin: 60,
+		},
+		{
+			Name:        "配置应用失败告警",
+			Type:        "config_apply",
+			Condition:   "{}",
+			Enabled:     true,
+			CooldownMin: 30,
+		},
 	}
 
 	for _, rule := range rules {
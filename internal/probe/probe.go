@@ -0,0 +1,230 @@
+// Package probe 通过代理节点拨号到目标地址，测量端到端的连接、TLS 握手和首字节延迟。
+// 面板和 Agent 共用，Agent 可以替面板从其他网络位置探测节点。
+package probe
+
+import (
+	"bufio"
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// DefaultTimeout 默认探测超时
+const DefaultTimeout = 10 * time.Second
+
+// ErrUnsupported 节点的协议或传输层不支持探测
+var ErrUnsupported = errors.New("protocol or transport not supported by probe")
+
+// 失败阶段
+const (
+	StageConnect   = "connect"   // TCP 连接节点
+	StageTLS       = "tls"       // 传输层 TLS 握手
+	StageTransport = "transport" // WebSocket 等传输层握手
+	StageProxy     = "proxy"     // 代理协议握手
+	StageTarget    = "target"    // 经代理访问目标
+)
+
+// Proxy 被探测的代理服务
+type Proxy struct {
+	Addr       string `json:"addr"`      // host:port
+	Protocol   string `json:"protocol"`  // socks5/socks4/http/auto
+	Transport  string `json:"transport"` // tcp/tls/ws/wss
+	Username   string `json:"username,omitempty"`
+	Password   string `json:"password,omitempty"`
+	ServerName string `json:"server_name,omitempty"` // TLS SNI
+	WSPath     string `json:"ws_path,omitempty"`
+	WSHost     string `json:"ws_host,omitempty"`
+}
+
+// Result 探测结果，耗时单位为毫秒
+type Result struct {
+	Success   bool   `json:"success"`
+	Connect   int64  `json:"connect_ms"`    // TCP 连接节点
+	TLS       int64  `json:"tls_ms"`        // TLS 握手 (传输层 TLS 与 https 目标的握手之和)
+	FirstByte int64  `json:"first_byte_ms"` // 发出请求到收到目标首字节，tcp 目标为 0
+	Total     int64  `json:"total_ms"`
+	Stage     string `json:"stage,omitempty"` // 失败阶段
+	Error     string `json:"error,omitempty"`
+}
+
+// Request 面板下发给 Agent 的探测请求
+type Request struct {
+	NodeID  uint   `json:"node_id"` // 被探测的节点
+	Proxy   Proxy  `json:"proxy"`
+	Target  string `json:"target"`
+	Timeout int    `json:"timeout"` // 秒
+}
+
+// Report Agent 上报的探测结果
+type Report struct {
+	NodeID uint   `json:"node_id"`
+	Target string `json:"target"`
+	Result Result `json:"result"`
+}
+
+// Supported 是否支持探测该协议和传输层
+func Supported(protocol, transport string) bool {
+	switch protocol {
+	case "socks5", "socks", "auto", "socks4", "socks4a", "http", "":
+	default:
+		return false
+	}
+	switch transport {
+	case "tcp", "", "tcp+udp", "tls", "ws", "wss":
+		return true
+	}
+	return false
+}
+
+// ValidateTarget 校验探测目标: http(s):// URL 或 tcp://host:port (也可省略 tcp://)
+func ValidateTarget(target string) error {
+	_, _, err := parseTarget(target)
+	return err
+}
+
+// parseTarget 返回目标地址 host:port 和 URL (tcp 目标为 nil)
+func parseTarget(target string) (string, *url.URL, error) {
+	if !strings.Contains(target, "://") {
+		target = "tcp://" + target
+	}
+	u, err := url.Parse(target)
+	if err != nil || u.Hostname() == "" {
+		return "", nil, fmt.Errorf("invalid probe target %q", target)
+	}
+	port := u.Port()
+	switch u.Scheme {
+	case "http":
+		if port == "" {
+			port = "80"
+		}
+	case "https":
+		if port == "" {
+			port = "443"
+		}
+	case "tcp":
+		if port == "" {
+			return "", nil, fmt.Errorf("probe target %q requires a port", target)
+		}
+		return net.JoinHostPort(u.Hostname(), port), nil, nil
+	default:
+		return "", nil, fmt.Errorf("unsupported probe target scheme %q", u.Scheme)
+	}
+	return net.JoinHostPort(u.Hostname(), port), u, nil
+}
+
+// Run 经代理访问目标并记录各阶段耗时
+func Run(p Proxy, target string, timeout time.Duration) Result {
+	if timeout <= 0 {
+		timeout = DefaultTimeout
+	}
+	start := time.Now()
+	var r Result
+	fail := func(stage string, err error) Result {
+		r.Stage = stage
+		r.Error = err.Error()
+		r.Total = time.Since(start).Milliseconds()
+		return r
+	}
+
+	if !Supported(p.Protocol, p.Transport) {
+		return fail(StageProxy, ErrUnsupported)
+	}
+	targetAddr, targetURL, err := parseTarget(target)
+	if err != nil {
+		return fail(StageTarget, err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	deadline, _ := ctx.Deadline()
+
+	// TCP 连接节点
+	t := time.Now()
+	var d net.Dialer
+	raw, err := d.DialContext(ctx, "tcp", p.Addr)
+	if err != nil {
+		return fail(StageConnect, err)
+	}
+	r.Connect = time.Since(t).Milliseconds()
+	raw.SetDeadline(deadline)
+	var conn net.Conn = raw
+	defer func() { conn.Close() }()
+
+	// 传输层
+	host, _, _ := net.SplitHostPort(p.Addr)
+	serverName := p.ServerName
+	if serverName == "" {
+		serverName = host
+	}
+	if p.Transport == "tls" || p.Transport == "wss" {
+		t = time.Now()
+		// 节点证书通常为自签名，探测只关心连通性
+		tlsConn := tls.Client(conn, &tls.Config{ServerName: serverName, InsecureSkipVerify: true})
+		if err := tlsConn.HandshakeContext(ctx); err != nil {
+			return fail(StageTLS, err)
+		}
+		r.TLS += time.Since(t).Milliseconds()
+		conn = tlsConn
+	}
+	if p.Transport == "ws" || p.Transport == "wss" {
+		wsConn, err := dialWebSocket(ctx, conn, p, serverName)
+		if err != nil {
+			return fail(StageTransport, err)
+		}
+		conn = wsConn
+	}
+
+	// 代理协议握手
+	switch p.Protocol {
+	case "socks4", "socks4a":
+		err = socks4Connect(conn, p.Username, targetAddr)
+	case "http":
+		err = httpConnect(conn, p.Username, p.Password, targetAddr)
+	default:
+		err = socks5Connect(conn, p.Username, p.Password, targetAddr)
+	}
+	if err != nil {
+		return fail(StageProxy, err)
+	}
+
+	// 访问目标
+	if targetURL != nil {
+		if targetURL.Scheme == "https" {
+			t = time.Now()
+			tlsConn := tls.Client(conn, &tls.Config{ServerName: targetURL.Hostname()})
+			if err := tlsConn.HandshakeContext(ctx); err != nil {
+				return fail(StageTarget, err)
+			}
+			r.TLS += time.Since(t).Milliseconds()
+			conn = tlsConn
+		}
+
+		req, _ := http.NewRequest(http.MethodGet, targetURL.String(), nil)
+		req.Header.Set("User-Agent", "gost-panel-probe")
+		req.Close = true
+		t = time.Now()
+		if err := req.Write(conn); err != nil {
+			return fail(StageTarget, err)
+		}
+		br := bufio.NewReader(conn)
+		if _, err := br.Peek(1); err != nil {
+			return fail(StageTarget, err)
+		}
+		r.FirstByte = time.Since(t).Milliseconds()
+		resp, err := http.ReadResponse(br, req)
+		if err != nil {
+			return fail(StageTarget, err)
+		}
+		resp.Body.Close()
+	}
+
+	r.Success = true
+	r.Total = time.Since(start).Milliseconds()
+	return r
+}
@@ -0,0 +1,80 @@
+package probe
+
+import (
+	"context"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// dialWebSocket 在已建立的连接 (wss 时已完成 TLS) 上进行 WebSocket 握手
+func dialWebSocket(ctx context.Context, conn net.Conn, p Proxy, serverName string) (net.Conn, error) {
+	path := p.WSPath
+	if path == "" {
+		path = "/ws" // gost 默认路径
+	}
+	host := p.WSHost
+	if host == "" {
+		host = serverName
+	}
+
+	dialer := websocket.Dialer{
+		NetDialContext: func(context.Context, string, string) (net.Conn, error) {
+			return conn, nil
+		},
+		HandshakeTimeout: DefaultTimeout,
+	}
+	// TLS 已在底层连接上完成，这里始终使用 ws://
+	u := url.URL{Scheme: "ws", Host: host, Path: path}
+	ws, resp, err := dialer.DialContext(ctx, u.String(), http.Header{})
+	if resp != nil && resp.Body != nil {
+		resp.Body.Close()
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &wsConn{Conn: ws, raw: conn}, nil
+}
+
+// wsConn 将 WebSocket 二进制消息包装为字节流 (与 gost ws 传输一致)
+type wsConn struct {
+	*websocket.Conn
+	raw    net.Conn
+	reader io.Reader
+}
+
+func (c *wsConn) Read(b []byte) (int, error) {
+	for {
+		if c.reader == nil {
+			_, r, err := c.NextReader()
+			if err != nil {
+				return 0, err
+			}
+			c.reader = r
+		}
+		n, err := c.reader.Read(b)
+		if err == io.EOF {
+			c.reader = nil
+			if n > 0 {
+				return n, nil
+			}
+			continue
+		}
+		return n, err
+	}
+}
+
+func (c *wsConn) Write(b []byte) (int, error) {
+	if err := c.WriteMessage(websocket.BinaryMessage, b); err != nil {
+		return 0, err
+	}
+	return len(b), nil
+}
+
+func (c *wsConn) SetDeadline(t time.Time) error {
+	return c.raw.SetDeadline(t)
+}
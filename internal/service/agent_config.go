@@ -0,0 +1,81 @@
+package service
+
+import (
+	"net"
+	"time"
+
+	"github.com/AliceNetworks/gost-panel/internal/model"
+)
+
+// ==================== Agent 配置应用结果 ====================
+//
+// Agent 先在临时文件中校验新配置 (解析和端口占用检查)，通过后替换配置并观察 GOST 运行状态，
+// GOST 拒绝配置或退出时恢复上一版本，并把结果和错误信息上报面板。
+
+// Agent 应用配置的结果
+const (
+	AgentConfigApplied    = "applied"     // GOST 已使用新配置正常运行
+	AgentConfigRejected   = "rejected"    // 校验失败，未替换配置
+	AgentConfigRolledBack = "rolled_back" // 替换后 GOST 异常，已恢复上一版本
+)
+
+// ValidAgentConfigStatus 是否为有效的配置应用结果
+func ValidAgentConfigStatus(status string) bool {
+	switch status {
+	case AgentConfigApplied, AgentConfigRejected, AgentConfigRolledBack:
+		return true
+	}
+	return false
+}
+
+// AgentConfigFailed 配置应用失败 (Agent 仍在使用上一版本)
+func AgentConfigFailed(status string) bool {
+	return status == AgentConfigRejected || status == AgentConfigRolledBack
+}
+
+// SetAgentAuthListen 记录节点 Agent 上报的认证插件地址，生成配置时据此填写 GOST 插件地址。
+// 注册后 Agent 才下载配置，新地址随之生效
+func (s *Service) SetAgentAuthListen(nodeID uint, current, listen string) {
+	if listen == "" || listen == current || len(listen) > 100 {
+		return
+	}
+	if listen != "off" {
+		if _, _, err := net.SplitHostPort(listen); err != nil {
+			return
+		}
+	}
+	s.db.Model(&model.Node{}).Where("id = ?", nodeID).UpdateColumn("agent_auth_listen", listen)
+}
+
+// ReportAgentConfig 记录 Agent 应用配置的结果，节点同时更新相同哈希的配置版本。
+// 返回结果相对上次上报是否变化 (用于只告警一次)
+func (s *Service) ReportAgentConfig(kind string, id uint, hash, status, errText string) (bool, error) {
+	now := time.Now()
+	// 不更新 updated_at (只记录用户的修改)
+	result := s.db.Model(agentTable(kind)).
+		Where("id = ? AND (config_status IS NULL OR config_status <> ? OR config_status_hash IS NULL OR config_status_hash <> ?)", id, status, hash).
+		UpdateColumns(map[string]interface{}{
+			"config_status":      status,
+			"config_status_hash": hash,
+			"config_error":       errText,
+			"config_reported_at": now,
+		})
+	if result.Error != nil {
+		return false, result.Error
+	}
+	changed := result.RowsAffected == 1
+
+	if kind == "node" {
+		err := s.db.Model(&model.ConfigVersion{}).
+			Where("node_id = ? AND hash = ?", id, hash).
+			UpdateColumns(map[string]interface{}{
+				"apply_status": status,
+				"apply_error":  errText,
+				"applied_at":   now,
+			}).Error
+		if err != nil {
+			return changed, err
+		}
+	}
+	return changed, nil
+}
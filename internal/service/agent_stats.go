@@ -0,0 +1,277 @@
+package service
+
+import (
+	"time"
+
+	"github.com/AliceNetworks/gost-panel/internal/model"
+	"gorm.io/gorm"
+)
+
+// ==================== Agent 统计入账 ====================
+//
+// Agent 为每次心跳的增量统计分配递增序号，面板不可达时写入本地磁盘，恢复后按序补报。
+// 面板只入账序号大于已入账序号的统计，响应丢失后的重复补报不会重复计费。
+// epoch 在 Agent 丢失本地状态 (重新安装) 后变化，此时序号重新开始。
+
+// claimAgentStats 登记统计序号，返回 true 表示该统计尚未入账，调用方应当入账
+func claimAgentStats(tx *gorm.DB, kind string, id uint, epoch string, seq uint64) (bool, error) {
+	// 条件更新保证多个实例同时处理时只有一个入账；不更新 updated_at (只记录用户的修改)
+	result := tx.Model(agentTable(kind)).
+		Where("id = ? AND (stats_epoch IS NULL OR stats_epoch <> ? OR stats_seq < ?)", id, epoch, seq).
+		UpdateColumns(map[string]interface{}{
+			"stats_epoch": epoch,
+			"stats_seq":   seq,
+		})
+	if result.Error != nil {
+		return false, result.Error
+	}
+	return result.RowsAffected == 1, nil
+}
+
+// ResourceTraffic 节点上按服务统计的隧道、客户端或端口转发流量
+type ResourceTraffic struct {
+	Type       string // model.TrafficResourceTunnel / TrafficResourceClient / TrafficResourcePortForward
+	ID         uint
+	TrafficIn  int64
+	TrafficOut int64
+}
+
+// AgentStats Agent 上报或补报的一次心跳统计 (增量)
+type AgentStats struct {
+	At         time.Time                   // Agent 记录统计的时间，流量历史计入该时间段；为零时按当前时间
+	TrafficIn  int64                       // 节点/客户端总流量
+	TrafficOut int64                       // 节点/客户端总流量
+	Resources  []ResourceTraffic           // 仅节点: 按服务统计
+	UserStats  map[string]map[string]int64 // 仅节点: 按认证用户名统计
+}
+
+// ApplyAgentStats 在同一事务中登记序号并入账统计，返回 false 表示该序号已入账。
+// 入账失败时序号不登记，Agent 重试时重新入账。
+// 流量历史写入统计发生的时间段，并相应调整采样基准，避免下次采样再计入当前时间段
+func (s *Service) ApplyAgentStats(kind string, id uint, epoch string, seq uint64, stats *AgentStats) (bool, error) {
+	s.trafficMu.Lock()
+	defer s.trafficMu.Unlock()
+
+	at := stats.At
+	if now := time.Now(); at.IsZero() || at.After(now) {
+		at = now
+	}
+
+	var charged []uint // 流量计入凭据的用户，入账后重新判断配额
+	var tunnels []uint
+	var fresh bool
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		var err error
+		if fresh, err = claimAgentStats(tx, kind, id, epoch, seq); err != nil || !fresh {
+			return err
+		}
+
+		deltas := map[trafficKey]*trafficDelta{}
+		addPoint := func(key trafficKey, in, out int64) {
+			d, ok := deltas[key]
+			if !ok {
+				d = &trafficDelta{}
+				deltas[key] = d
+			}
+			d.in += in
+			d.out += out
+		}
+		// rebase 调整资源的采样基准，下次采样不再把这部分流量计入当前时间段。
+		// 尚无采样基准时，下次采样以包含本次流量的累计值为基准，无需调整
+		rebase := func(key trafficKey, in, out int64) error {
+			return tx.Model(&model.TrafficCounter{}).
+				Where("resource_type = ? AND resource_id = ?", key.resourceType, key.resourceID).
+				Updates(map[string]interface{}{
+					"traffic_in":  gorm.Expr("traffic_in + ?", in),
+					"traffic_out": gorm.Expr("traffic_out + ?", out),
+				}).Error
+		}
+		// 节点上的资源流量已包含在节点中，只有在他人节点上的部分计入资源所有者 (与 RecordTrafficHistory 一致)
+		nodeOwners := map[uint]*uint{}
+		addOwnerOnNode := func(nodeID uint, ownerID *uint, in, out int64) error {
+			if ownerID == nil {
+				return nil
+			}
+			owner, ok := nodeOwners[nodeID]
+			if !ok {
+				var node model.Node
+				if err := tx.Select("id", "owner_id").Limit(1).Find(&node, nodeID).Error; err != nil {
+					return err
+				}
+				owner = node.OwnerID
+				nodeOwners[nodeID] = owner
+			}
+			if owner == nil || *owner != *ownerID {
+				addPoint(trafficKey{model.TrafficResourceUser, *ownerID}, in, out)
+			}
+			return nil
+		}
+
+		if stats.TrafficIn != 0 || stats.TrafficOut != 0 {
+			if err := tx.Model(agentTable(kind)).Where("id = ?", id).UpdateColumns(map[string]interface{}{
+				"traffic_in":  gorm.Expr("traffic_in + ?", stats.TrafficIn),
+				"traffic_out": gorm.Expr("traffic_out + ?", stats.TrafficOut),
+				"quota_used":  gorm.Expr("quota_used + ?", stats.TrafficIn+stats.TrafficOut),
+			}).Error; err != nil {
+				return err
+			}
+			if kind == "client" {
+				var client model.Client
+				if err := tx.Select("id", "node_id", "owner_id").First(&client, id).Error; err != nil {
+					return err
+				}
+				key := trafficKey{model.TrafficResourceClient, id}
+				addPoint(key, stats.TrafficIn, stats.TrafficOut)
+				if err := rebase(key, stats.TrafficIn, stats.TrafficOut); err != nil {
+					return err
+				}
+				if err := addOwnerOnNode(client.NodeID, client.OwnerID, stats.TrafficIn, stats.TrafficOut); err != nil {
+					return err
+				}
+			} else {
+				var node model.Node
+				if err := tx.Select("id", "owner_id").First(&node, id).Error; err != nil {
+					return err
+				}
+				key := trafficKey{model.TrafficResourceNode, id}
+				addPoint(key, stats.TrafficIn, stats.TrafficOut)
+				if err := rebase(key, stats.TrafficIn, stats.TrafficOut); err != nil {
+					return err
+				}
+				addPoint(trafficKey{model.TrafficResourceTotal, 0}, stats.TrafficIn, stats.TrafficOut)
+				if node.OwnerID != nil {
+					addPoint(trafficKey{model.TrafficResourceUser, *node.OwnerID}, stats.TrafficIn, stats.TrafficOut)
+				}
+			}
+		}
+
+		for _, r := range stats.Resources {
+			if kind != "node" || (r.TrafficIn == 0 && r.TrafficOut == 0) {
+				continue
+			}
+			updates := map[string]interface{}{
+				"traffic_in":  gorm.Expr("traffic_in + ?", r.TrafficIn),
+				"traffic_out": gorm.Expr("traffic_out + ?", r.TrafficOut),
+			}
+			var nodeID uint
+			var ownerID *uint
+			var table interface{}
+			var result *gorm.DB
+			switch r.Type {
+			case model.TrafficResourceTunnel:
+				var tunnel model.Tunnel
+				table = &model.Tunnel{}
+				result = tx.Select("id", "entry_node_id", "owner_id").Limit(1).Find(&tunnel, r.ID)
+				nodeID, ownerID = tunnel.EntryNodeID, tunnel.OwnerID
+				updates["quota_used"] = gorm.Expr("quota_used + ?", r.TrafficIn+r.TrafficOut)
+			case model.TrafficResourceClient:
+				var client model.Client
+				table = &model.Client{}
+				result = tx.Select("id", "node_id", "owner_id").Limit(1).Find(&client, r.ID)
+				nodeID, ownerID = client.NodeID, client.OwnerID
+			case model.TrafficResourcePortForward:
+				var forward model.PortForward
+				table = &model.PortForward{}
+				result = tx.Select("id", "node_id", "owner_id").Limit(1).Find(&forward, r.ID)
+				nodeID, ownerID = forward.NodeID, forward.OwnerID
+			default:
+				continue
+			}
+			if result.Error != nil {
+				return result.Error
+			}
+			if result.RowsAffected == 0 {
+				continue // 资源已删除
+			}
+			if err := tx.Model(table).Where("id = ?", r.ID).UpdateColumns(updates).Error; err != nil {
+				return err
+			}
+			if r.Type == model.TrafficResourceTunnel {
+				tunnels = append(tunnels, r.ID)
+			}
+
+			key := trafficKey{r.Type, r.ID}
+			addPoint(key, r.TrafficIn, r.TrafficOut)
+			if err := rebase(key, r.TrafficIn, r.TrafficOut); err != nil {
+				return err
+			}
+			if err := addOwnerOnNode(nodeID, ownerID, r.TrafficIn, r.TrafficOut); err != nil {
+				return err
+			}
+		}
+
+		// 共享节点上按认证用户名统计的流量计入凭据持有人 (未匹配到凭据的用户名只计入节点)
+		for username, userStats := range stats.UserStats {
+			in, out := userStats["traffic_in"], userStats["traffic_out"]
+			if kind != "node" || (in <= 0 && out <= 0) {
+				continue
+			}
+			var cred model.ProxyCredential
+			result := tx.Select("id", "user_id").Where("node_id = ? AND username = ?", id, username).Limit(1).Find(&cred)
+			if result.Error != nil {
+				return result.Error
+			}
+			if result.RowsAffected == 0 {
+				continue
+			}
+			if err := tx.Model(&model.ProxyCredential{}).Where("id = ?", cred.ID).Updates(map[string]interface{}{
+				"traffic_in":   gorm.Expr("traffic_in + ?", in),
+				"traffic_out":  gorm.Expr("traffic_out + ?", out),
+				"last_used_at": time.Now(),
+			}).Error; err != nil {
+				return err
+			}
+			// 凭据只有采样基准，流量以持有人的时间序列体现
+			if err := rebase(trafficKey{model.TrafficResourceCredential, cred.ID}, in, out); err != nil {
+				return err
+			}
+			userID := cred.UserID
+			if err := addOwnerOnNode(id, &userID, in, out); err != nil {
+				return err
+			}
+			charged = append(charged, cred.UserID)
+		}
+
+		return addTrafficPoints(tx, at, deltas)
+	})
+	if err != nil || !fresh {
+		return false, err
+	}
+
+	s.checkReplayedQuotas(kind, id, tunnels, charged)
+	return true, nil
+}
+
+// checkReplayedQuotas 补报入账后检查相关资源和用户的流量配额
+func (s *Service) checkReplayedQuotas(kind string, id uint, tunnels, users []uint) {
+	if kind == "client" {
+		var client model.Client
+		if err := s.db.First(&client, id).Error; err == nil {
+			s.alertService.CheckClientQuota(&client)
+		}
+		return
+	}
+	if node, err := s.GetNode(id); err == nil {
+		s.alertService.CheckNodeQuota(node)
+	}
+	for _, tunnelID := range tunnels {
+		var tunnel model.Tunnel
+		if err := s.db.First(&tunnel, tunnelID).Error; err == nil {
+			s.alertService.CheckTunnelQuota(&tunnel)
+		}
+	}
+
+	changed := false
+	for _, userID := range users {
+		var user model.User
+		if err := s.db.Select("id", "quota_exceeded").First(&user, userID).Error; err != nil {
+			continue
+		}
+		if exceeded, err := s.CheckUserQuota(userID); err == nil && exceeded != user.QuotaExceeded {
+			changed = true
+		}
+	}
+	if changed {
+		s.notifyQuotaChange()
+	}
+}
@@ -0,0 +1,126 @@
+package service
+
+import (
+	"testing"
+	"time"
+
+	"github.com/AliceNetworks/gost-panel/internal/model"
+	"github.com/AliceNetworks/gost-panel/internal/notify"
+)
+
+func seriesAt(t *testing.T, s *Service, resourceType string, resourceID uint, bucket time.Time) int64 {
+	t.Helper()
+	var total int64
+	s.db.Model(&model.TrafficSeries{}).
+		Where("resource_type = ? AND resource_id = ? AND resolution = ? AND bucket_at = ?", resourceType, resourceID, ResolutionMinute, bucket).
+		Select("COALESCE(SUM(traffic_in + traffic_out), 0)").Scan(&total)
+	return total
+}
+
+// 补报的统计计入 Agent 记录时的时间段，之后的采样不再计入当前时间段
+func TestApplyAgentStatsHistoryBucket(t *testing.T) {
+	s := newTestDBService(t)
+	s.alertService = notify.NewAlertService(s.db)
+	owner, other := uint(1), uint(2)
+
+	node := model.Node{Name: "node", Host: "127.0.0.1", AgentToken: "node", OwnerID: &owner}
+	if err := s.db.Create(&node).Error; err != nil {
+		t.Fatal(err)
+	}
+	tunnel := model.Tunnel{Name: "tunnel", EntryNodeID: node.ID, ExitNodeID: node.ID, OwnerID: &owner}
+	cred := model.ProxyCredential{NodeID: node.ID, UserID: other, Username: "alice", Password: "secret"}
+	for _, r := range []interface{}{&tunnel, &cred} {
+		if err := s.db.Create(r).Error; err != nil {
+			t.Fatal(err)
+		}
+	}
+	// 建立采样基准
+	if err := s.RecordTrafficHistory(); err != nil {
+		t.Fatal(err)
+	}
+
+	at := time.Now().Add(-3 * time.Hour)
+	stats := &AgentStats{
+		At:         at,
+		TrafficIn:  600,
+		TrafficOut: 400,
+		Resources:  []ResourceTraffic{{Type: model.TrafficResourceTunnel, ID: tunnel.ID, TrafficIn: 100}},
+		UserStats:  map[string]map[string]int64{"alice": {"traffic_in": 30, "traffic_out": 20}},
+	}
+	fresh, err := s.ApplyAgentStats("node", node.ID, "epoch", 1, stats)
+	if err != nil || !fresh {
+		t.Fatalf("ApplyAgentStats() = %v, %v; want true", fresh, err)
+	}
+	// 重复补报不再入账
+	if fresh, err := s.ApplyAgentStats("node", node.ID, "epoch", 1, stats); err != nil || fresh {
+		t.Fatalf("duplicate ApplyAgentStats() = %v, %v; want false", fresh, err)
+	}
+	if err := s.RecordTrafficHistory(); err != nil {
+		t.Fatal(err)
+	}
+
+	bucket := trafficBucket(at, ResolutionMinute)
+	tests := []struct {
+		resourceType string
+		resourceID   uint
+		want         int64
+	}{
+		{model.TrafficResourceNode, node.ID, 1000},
+		{model.TrafficResourceTotal, 0, 1000},
+		{model.TrafficResourceTunnel, tunnel.ID, 100},
+		{model.TrafficResourceUser, owner, 1000},
+		{model.TrafficResourceUser, other, 50},
+	}
+	for _, tt := range tests {
+		if got := seriesAt(t, s, tt.resourceType, tt.resourceID, bucket); got != tt.want {
+			t.Errorf("%s %d at %v = %d, want %d", tt.resourceType, tt.resourceID, bucket, got, tt.want)
+		}
+	}
+	if got := userTraffic(t, s, owner); got != 1000 {
+		t.Errorf("owner traffic in all buckets = %d, want 1000", got)
+	}
+
+	var updated model.Node
+	s.db.First(&updated, node.ID)
+	if updated.TrafficIn != 600 || updated.TrafficOut != 400 || updated.QuotaUsed != 1000 {
+		t.Errorf("node traffic = %d/%d quota %d, want 600/400 quota 1000", updated.TrafficIn, updated.TrafficOut, updated.QuotaUsed)
+	}
+	s.db.First(&cred, cred.ID)
+	if cred.TrafficIn != 30 || cred.TrafficOut != 20 {
+		t.Errorf("credential traffic = %d/%d, want 30/20", cred.TrafficIn, cred.TrafficOut)
+	}
+}
+
+// 入账失败时序号不登记，重试时重新入账
+func TestApplyAgentStatsFailureNotClaimed(t *testing.T) {
+	s := newTestDBService(t)
+	s.alertService = notify.NewAlertService(s.db)
+	node := model.Node{Name: "node", Host: "127.0.0.1", AgentToken: "node"}
+	if err := s.db.Create(&node).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	if err := s.db.Migrator().DropTable(&model.TrafficSeries{}); err != nil {
+		t.Fatal(err)
+	}
+	stats := &AgentStats{At: time.Now(), TrafficIn: 100}
+	if _, err := s.ApplyAgentStats("node", node.ID, "epoch", 1, stats); err == nil {
+		t.Fatal("ApplyAgentStats() succeeded without the traffic_series table")
+	}
+	var updated model.Node
+	s.db.First(&updated, node.ID)
+	if updated.StatsSeq != 0 || updated.TrafficIn != 0 {
+		t.Fatalf("after failure stats_seq = %d, traffic_in = %d; want nothing applied", updated.StatsSeq, updated.TrafficIn)
+	}
+
+	if err := s.db.AutoMigrate(&model.TrafficSeries{}); err != nil {
+		t.Fatal(err)
+	}
+	if fresh, err := s.ApplyAgentStats("node", node.ID, "epoch", 1, stats); err != nil || !fresh {
+		t.Fatalf("retry ApplyAgentStats() = %v, %v; want true", fresh, err)
+	}
+	s.db.First(&updated, node.ID)
+	if updated.StatsSeq != 1 || updated.TrafficIn != 100 {
+		t.Fatalf("after retry stats_seq = %d, traffic_in = %d; want 1, 100", updated.StatsSeq, updated.TrafficIn)
+	}
+}
@@ -0,0 +1,231 @@
+package service
+
+import (
+	"bytes"
+	"database/sql"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/AliceNetworks/gost-panel/internal/backup"
+	"github.com/AliceNetworks/gost-panel/internal/model"
+	"gorm.io/gorm"
+)
+
+// 备份文件名格式: gost-panel-backup-20060102-150405.db[.enc]
+const backupPrefix = "gost-panel-backup-"
+
+// BackupList 备份列表
+type BackupList struct {
+	Target  string          `json:"target"`
+	Backups []backup.Object `json:"backups"`
+}
+
+// BackupTarget 根据站点配置创建备份存储
+func (s *Service) BackupTarget() (backup.Target, error) {
+	return s.NewBackupTarget(s.GetSiteConfig(model.ConfigBackupTarget), s.GetSiteConfig(model.ConfigBackupTargetConfig))
+}
+
+// NewBackupTarget 创建指定类型的备份存储，本地存储默认使用数据库所在目录下的 backups
+func (s *Service) NewBackupTarget(kind, config string) (backup.Target, error) {
+	return backup.NewTarget(kind, config, filepath.Join(filepath.Dir(s.cfg.DBPath), "backups"))
+}
+
+// SnapshotDatabase 生成一致的数据库快照 (SQLite 文件)，写入期间不会产生不完整的副本。
+// SQLite 使用 VACUUM INTO；PostgreSQL/MySQL 在只读的可重复读事务中把所有表复制到新的 SQLite 文件，
+// 因此备份格式与数据库类型无关，可以恢复到任意类型的数据库。
+func (s *Service) SnapshotDatabase(path string) error {
+	os.Remove(path) // VACUUM INTO 要求目标文件不存在
+	if s.isSQLite() {
+		return s.db.Exec("VACUUM INTO ?", path).Error
+	}
+
+	snapshot, err := model.InitDB(model.DriverSQLite, path)
+	if err != nil {
+		return err
+	}
+	defer closeDB(snapshot)
+
+	return s.db.Transaction(func(tx *gorm.DB) error {
+		return snapshot.Transaction(func(stx *gorm.DB) error {
+			_, err := model.CopyDatabase(tx, stx)
+			return err
+		})
+	}, &sql.TxOptions{Isolation: sql.LevelRepeatableRead, ReadOnly: true})
+}
+
+// CreateBackup 生成数据库快照 (按配置加密) 并上传到备份存储，然后按保留数量清理旧备份
+func (s *Service) CreateBackup() (*backup.Object, error) {
+	s.backupMu.Lock()
+	defer s.backupMu.Unlock()
+
+	target, err := s.BackupTarget()
+	if err != nil {
+		return nil, err
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(s.cfg.DBPath), ".snapshot-*.db")
+	if err != nil {
+		return nil, err
+	}
+	tmpPath := tmp.Name()
+	tmp.Close()
+	defer os.Remove(tmpPath)
+
+	if err := s.SnapshotDatabase(tmpPath); err != nil {
+		return nil, fmt.Errorf("snapshot failed: %w", err)
+	}
+	data, err := os.ReadFile(tmpPath)
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	name := backupPrefix + now.Format("20060102-150405") + ".db"
+	if key := s.GetSiteConfig(model.ConfigBackupEncryptionKey); key != "" {
+		if data, err = backup.Encrypt(data, key); err != nil {
+			return nil, fmt.Errorf("encrypt failed: %w", err)
+		}
+		name += backup.EncryptedExt
+	}
+
+	if err := target.Put(name, bytes.NewReader(data), int64(len(data))); err != nil {
+		return nil, fmt.Errorf("upload failed: %w", err)
+	}
+	log.Printf("Backup created: %s (%d bytes)", name, len(data))
+
+	if err := s.pruneBackups(target); err != nil {
+		log.Printf("Backup: failed to prune old backups: %v", err)
+	}
+
+	return &backup.Object{Name: name, Size: int64(len(data)), CreatedAt: now}, nil
+}
+
+// RunScheduledBackup 定时备份任务
+func (s *Service) RunScheduledBackup() error {
+	_, err := s.CreateBackup()
+	return err
+}
+
+// pruneBackups 只保留最新的若干个备份
+func (s *Service) pruneBackups(target backup.Target) error {
+	retention := s.siteConfigInt(model.ConfigBackupRetention, 0)
+	if retention <= 0 {
+		return nil
+	}
+
+	backups, err := listPanelBackups(target)
+	if err != nil {
+		return err
+	}
+	for i := 0; i < len(backups)-retention; i++ {
+		if err := target.Delete(backups[i].Name); err != nil {
+			return err
+		}
+		log.Printf("Backup removed by retention: %s", backups[i].Name)
+	}
+	return nil
+}
+
+// listPanelBackups 列出面板生成的备份，按时间从旧到新排序 (文件名包含时间戳)
+func listPanelBackups(target backup.Target) ([]backup.Object, error) {
+	objects, err := target.List()
+	if err != nil {
+		return nil, err
+	}
+	backups := make([]backup.Object, 0, len(objects))
+	for _, obj := range objects {
+		if strings.HasPrefix(obj.Name, backupPrefix) {
+			backups = append(backups, obj)
+		}
+	}
+	sort.Slice(backups, func(i, j int) bool { return backups[i].Name < backups[j].Name })
+	return backups, nil
+}
+
+// ListBackups 获取已存储的备份
+func (s *Service) ListBackups() (*BackupList, error) {
+	target, err := s.BackupTarget()
+	if err != nil {
+		return nil, err
+	}
+	backups, err := listPanelBackups(target)
+	if err != nil {
+		return nil, err
+	}
+
+	// 最新的在前
+	for i, j := 0, len(backups)-1; i < j; i, j = i+1, j-1 {
+		backups[i], backups[j] = backups[j], backups[i]
+	}
+	kind := s.GetSiteConfig(model.ConfigBackupTarget)
+	if kind == "" {
+		kind = backup.TargetLocal
+	}
+	return &BackupList{Target: kind, Backups: backups}, nil
+}
+
+// OpenBackup 读取已存储的备份，调用方负责关闭
+func (s *Service) OpenBackup(name string) (io.ReadCloser, error) {
+	if !isPanelBackupName(name) {
+		return nil, fmt.Errorf("invalid backup name")
+	}
+	target, err := s.BackupTarget()
+	if err != nil {
+		return nil, err
+	}
+	return target.Get(name)
+}
+
+// DeleteBackup 删除已存储的备份
+func (s *Service) DeleteBackup(name string) error {
+	if !isPanelBackupName(name) {
+		return fmt.Errorf("invalid backup name")
+	}
+	target, err := s.BackupTarget()
+	if err != nil {
+		return err
+	}
+	return target.Delete(name)
+}
+
+// TestBackupTarget 上传、读取并删除一个测试文件，检查备份存储是否可用
+func (s *Service) TestBackupTarget(kind, config string) error {
+	target, err := s.NewBackupTarget(kind, config)
+	if err != nil {
+		return err
+	}
+
+	name := fmt.Sprintf(".gost-panel-test-%d", time.Now().UnixNano())
+	payload := []byte("gost-panel backup target test")
+	if err := target.Put(name, bytes.NewReader(payload), int64(len(payload))); err != nil {
+		return fmt.Errorf("upload failed: %w", err)
+	}
+	defer target.Delete(name)
+
+	r, err := target.Get(name)
+	if err != nil {
+		return fmt.Errorf("download failed: %w", err)
+	}
+	defer r.Close()
+	got, err := io.ReadAll(r)
+	if err != nil {
+		return fmt.Errorf("download failed: %w", err)
+	}
+	if !bytes.Equal(got, payload) {
+		return fmt.Errorf("downloaded content mismatch")
+	}
+	if _, err := target.List(); err != nil {
+		return fmt.Errorf("list failed: %w", err)
+	}
+	return nil
+}
+
+func isPanelBackupName(name string) bool {
+	return backup.ValidName(name) && strings.HasPrefix(name, backupPrefix)
+}
@@ -0,0 +1,106 @@
+package service
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/AliceNetworks/gost-panel/internal/backup"
+	"github.com/AliceNetworks/gost-panel/internal/backup/backuptest"
+	"github.com/AliceNetworks/gost-panel/internal/model"
+)
+
+func setBackupTarget(t *testing.T, s *Service, kind string, config interface{}) backup.Target {
+	t.Helper()
+	data, err := json.Marshal(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := s.SetSiteConfigs(map[string]string{
+		model.ConfigBackupTarget:       kind,
+		model.ConfigBackupTargetConfig: string(data),
+		model.ConfigBackupRetention:    "2",
+	}); err != nil {
+		t.Fatal(err)
+	}
+	target, err := s.BackupTarget()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return target
+}
+
+// 创建备份后只保留最新的若干个面板备份，其他文件不受影响
+func testBackupRetention(t *testing.T, s *Service, target backup.Target) {
+	t.Helper()
+	for _, name := range []string{
+		"gost-panel-backup-20200101-000000.db",
+		"gost-panel-backup-20200102-000000.db.enc",
+		"gost-panel-backup-20200103-000000.db",
+		"notes.txt",
+	} {
+		if err := target.Put(name, bytes.NewReader([]byte(name)), int64(len(name))); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	created, err := s.CreateBackup()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(created.Name, backupPrefix) {
+		t.Fatalf("backup name = %q", created.Name)
+	}
+
+	objects, err := target.List()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	for _, obj := range objects {
+		names = append(names, obj.Name)
+	}
+	want := []string{"gost-panel-backup-20200103-000000.db", created.Name, "notes.txt"}
+	if !reflect.DeepEqual(names, want) {
+		t.Fatalf("objects after retention = %v, want %v", names, want)
+	}
+
+	rc, err := s.OpenBackup(created.Name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rc.Close()
+	header := make([]byte, len(sqliteHeader))
+	if _, err := io.ReadFull(rc, header); err != nil || string(header) != sqliteHeader {
+		t.Fatalf("uploaded backup header = %q, %v", header, err)
+	}
+}
+
+func TestBackupRetentionS3(t *testing.T) {
+	s := newTestDBService(t)
+	srv := backuptest.NewS3Server(t)
+	target := setBackupTarget(t, s, backup.TargetS3, backup.S3Config{
+		Endpoint:  srv.URL,
+		Region:    srv.Region,
+		Bucket:    srv.Bucket,
+		Prefix:    "panel/",
+		AccessKey: srv.AccessKey,
+		SecretKey: srv.SecretKey,
+		PathStyle: true,
+	})
+	testBackupRetention(t, s, target)
+}
+
+func TestBackupRetentionWebDAV(t *testing.T) {
+	s := newTestDBService(t)
+	srv := backuptest.NewWebDAVServer(t)
+	target := setBackupTarget(t, s, backup.TargetWebDAV, backup.WebDAVConfig{
+		URL:      srv.URL + "/backups/",
+		Username: srv.Username,
+		Password: srv.Password,
+	})
+	testBackupRetention(t, s, target)
+}
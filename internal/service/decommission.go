@@ -0,0 +1,101 @@
+package service
+
+import (
+	"crypto/ed25519"
+	"log"
+
+	"github.com/AliceNetworks/gost-panel/internal/model"
+	"github.com/AliceNetworks/gost-panel/internal/signing"
+	"gorm.io/gorm"
+)
+
+// ==================== Agent 卸载命令 ====================
+
+// panelKey 面板签名密钥，首次使用时生成并保存在系统配置中 (多实例共享同一个数据库)
+func (s *Service) panelKey() (ed25519.PrivateKey, error) {
+	s.panelKeyMu.Lock()
+	defer s.panelKeyMu.Unlock()
+	if s.panelKeyCache != nil {
+		return s.panelKeyCache, nil
+	}
+
+	encoded := s.GetSiteConfig(model.ConfigPanelSigningKey)
+	if encoded == "" {
+		_, generated, err := signing.GenerateKey()
+		if err != nil {
+			return nil, err
+		}
+		// 其他实例可能同时生成，创建失败时使用已保存的密钥
+		if err := s.db.Create(&model.SiteConfig{Key: model.ConfigPanelSigningKey, Value: generated}).Error; err != nil {
+			log.Printf("Panel signing key created concurrently: %v", err)
+		}
+		encoded = s.GetSiteConfig(model.ConfigPanelSigningKey)
+	}
+
+	key, err := signing.ParsePrivateKey(encoded)
+	if err != nil {
+		return nil, err
+	}
+	s.panelKeyCache = key
+	return key, nil
+}
+
+// PanelPublicKey 面板签名公钥，Agent 首次注册时记录，用于校验卸载命令
+func (s *Service) PanelPublicKey() string {
+	key, err := s.panelKey()
+	if err != nil {
+		log.Printf("Failed to load panel signing key: %v", err)
+		return ""
+	}
+	return signing.PublicKey(key)
+}
+
+// recordDecommission 在删除节点/客户端的事务中记录其 Agent (Token 和已登记的公钥)
+func recordDecommission(tx *gorm.DB, kind string, id uint, name, token, publicKey string) error {
+	if token == "" {
+		return nil
+	}
+	agent := &model.DecommissionedAgent{
+		Kind:      kind,
+		TargetID:  id,
+		Name:      name,
+		TokenHash: signing.TokenHash(token),
+	}
+	if publicKey != "" {
+		agent.KeyHash = signing.TokenHash(publicKey)
+	}
+	return tx.Create(agent).Error
+}
+
+// DecommissionCommand 为已删除的节点/客户端签发卸载命令，未删除时返回 nil。
+// 已登记密钥的 Agent 以公钥为凭据，命令绑定公钥
+func (s *Service) DecommissionCommand(kind string, id uint) *signing.Decommission {
+	var agent model.DecommissionedAgent
+	if err := s.db.Where("kind = ? AND target_id = ?", kind, id).Order("id DESC").First(&agent).Error; err != nil {
+		return nil
+	}
+	if agent.KeyHash != "" {
+		return s.signDecommission(&agent, agent.KeyHash)
+	}
+	return s.signDecommission(&agent, agent.TokenHash)
+}
+
+// DecommissionCommandByToken 凭据 (Token 或已登记的公钥) 属于已删除的节点/客户端时签发卸载命令，
+// 未知凭据 (例如面板恢复了旧备份或 Agent 连错了面板) 返回 nil
+func (s *Service) DecommissionCommandByToken(credential string) *signing.Decommission {
+	hash := signing.TokenHash(credential)
+	var agent model.DecommissionedAgent
+	if err := s.db.Where("token_hash = ? OR key_hash = ?", hash, hash).First(&agent).Error; err != nil {
+		return nil
+	}
+	return s.signDecommission(&agent, hash)
+}
+
+func (s *Service) signDecommission(agent *model.DecommissionedAgent, credentialHash string) *signing.Decommission {
+	key, err := s.panelKey()
+	if err != nil {
+		log.Printf("Failed to load panel signing key: %v", err)
+		return nil
+	}
+	return signing.SignDecommission(key, agent.Kind, agent.TargetID, credentialHash)
+}
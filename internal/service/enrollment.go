@@ -0,0 +1,187 @@
+package service
+
+import (
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/AliceNetworks/gost-panel/internal/model"
+	"github.com/AliceNetworks/gost-panel/internal/signing"
+	"gorm.io/gorm"
+)
+
+// ==================== Agent 登记 ====================
+//
+// 管理员为节点/客户端签发一次性加入令牌，Agent 生成密钥对并用加入令牌登记公钥，
+// 之后所有请求都用私钥签名。尚未登记的旧 Agent 可以用自己的 Token 登记一次
+// (关闭 agent_require_enrollment 时)，登记后该 Token 不再被接受。
+
+// JoinTokenPrefix 加入令牌前缀，用于和节点/客户端的 Token 区分
+const JoinTokenPrefix = "join_"
+
+var (
+	ErrJoinTokenInvalid   = errors.New("invalid or expired join token")
+	ErrAgentEnrolled      = errors.New("agent already enrolled, use a join token to enroll a new key")
+	ErrEnrollmentRequired = errors.New("token authentication is disabled, use a join token")
+	ErrAgentKeyInUse      = errors.New("agent key already enrolled")
+	ErrAgentTokenUnknown  = errors.New("invalid token")
+)
+
+// agentTable 节点/客户端对应的模型
+func agentTable(kind string) interface{} {
+	if kind == "client" {
+		return &model.Client{}
+	}
+	return &model.Node{}
+}
+
+// RequireAgentEnrollment 是否只接受已登记密钥的 Agent
+func (s *Service) RequireAgentEnrollment() bool {
+	return s.GetSiteConfig(model.ConfigAgentRequireEnrollment) == "true"
+}
+
+// JoinTokenValid 加入令牌是否未使用且未过期 (不消耗令牌，安装脚本登记前用它下载 Agent)
+func (s *Service) JoinTokenValid(token string) bool {
+	if !strings.HasPrefix(token, JoinTokenPrefix) {
+		return false
+	}
+	var count int64
+	s.db.Model(&model.AgentJoinToken{}).
+		Where("token_hash = ? AND used_at IS NULL AND expires_at > ?", signing.TokenHash(token), time.Now()).
+		Count(&count)
+	return count > 0
+}
+
+// CreateJoinToken 为节点/客户端签发一次性加入令牌，返回令牌原文 (只在签发时可见)
+func (s *Service) CreateJoinToken(kind string, id uint, createdBy uint) (string, *model.AgentJoinToken, error) {
+	if err := s.db.First(agentTable(kind), id).Error; err != nil {
+		return "", nil, err
+	}
+	token := JoinTokenPrefix + generateToken()
+	ttl := time.Duration(s.siteConfigInt(model.ConfigAgentJoinTokenTTL, 60)) * time.Minute
+	jt := &model.AgentJoinToken{
+		Kind:      kind,
+		TargetID:  id,
+		TokenHash: signing.TokenHash(token),
+		ExpiresAt: time.Now().Add(ttl),
+		CreatedBy: createdBy,
+	}
+	if err := s.db.Create(jt).Error; err != nil {
+		return "", nil, err
+	}
+	return token, jt, nil
+}
+
+// EnrollAgent 用加入令牌 (或尚未登记密钥的节点/客户端 Token) 登记 Agent 公钥。
+// 无法识别的 Token 返回 ErrAgentTokenUnknown
+func (s *Service) EnrollAgent(token, publicKey string) (kind string, id uint, err error) {
+	if _, _, err := s.GetAgentByKey(publicKey); err == nil {
+		return "", 0, ErrAgentKeyInUse
+	}
+
+	if strings.HasPrefix(token, JoinTokenPrefix) {
+		err = s.db.Transaction(func(tx *gorm.DB) error {
+			now := time.Now()
+			// 条件更新保证令牌只能使用一次 (多个实例同时登记时只有一个成功)
+			result := tx.Model(&model.AgentJoinToken{}).
+				Where("token_hash = ? AND used_at IS NULL AND expires_at > ?", signing.TokenHash(token), now).
+				Update("used_at", now)
+			if result.Error != nil {
+				return result.Error
+			}
+			if result.RowsAffected != 1 {
+				return ErrJoinTokenInvalid
+			}
+			var jt model.AgentJoinToken
+			if err := tx.Where("token_hash = ?", signing.TokenHash(token)).First(&jt).Error; err != nil {
+				return err
+			}
+			kind, id = jt.Kind, jt.TargetID
+			return setAgentKey(tx, kind, id, publicKey)
+		})
+		return kind, id, err
+	}
+
+	// 旧 Agent 用节点/客户端 Token 登记 (只能登记一次)
+	if s.RequireAgentEnrollment() {
+		return "", 0, ErrEnrollmentRequired
+	}
+	var current string
+	if node, err := s.GetNodeByToken(token); err == nil {
+		kind, id, current = "node", node.ID, node.AgentPublicKey
+	} else if client, err := s.GetClientByToken(token); err == nil {
+		kind, id, current = "client", client.ID, client.AgentPublicKey
+	} else {
+		return "", 0, ErrAgentTokenUnknown
+	}
+	if current != "" {
+		return "", 0, ErrAgentEnrolled
+	}
+	return kind, id, setAgentKey(s.db, kind, id, publicKey)
+}
+
+func setAgentKey(tx *gorm.DB, kind string, id uint, publicKey string) error {
+	return tx.Model(agentTable(kind)).Where("id = ?", id).Updates(map[string]interface{}{
+		"agent_public_key":  publicKey,
+		"agent_enrolled_at": time.Now(),
+	}).Error
+}
+
+// GetAgentByKey 根据已登记的公钥查找节点/客户端，返回其 Token (内部仍按 Token 关联)
+func (s *Service) GetAgentByKey(publicKey string) (kind, token string, err error) {
+	if publicKey == "" {
+		return "", "", gorm.ErrRecordNotFound
+	}
+	var node model.Node
+	if err := s.db.Select("id", "agent_token").Where("agent_public_key = ?", publicKey).First(&node).Error; err == nil {
+		return "node", node.AgentToken, nil
+	}
+	var client model.Client
+	if err := s.db.Select("id", "token").Where("agent_public_key = ?", publicKey).First(&client).Error; err != nil {
+		return "", "", err
+	}
+	return "client", client.Token, nil
+}
+
+// AgentTokenUsable 节点/客户端 Token 是否仍可直接用于认证 (登记密钥后不再接受)
+func (s *Service) AgentTokenUsable(token string) bool {
+	if token == "" || strings.HasPrefix(token, JoinTokenPrefix) || s.RequireAgentEnrollment() {
+		return false
+	}
+	var count int64
+	s.db.Model(&model.Node{}).Where("agent_token = ? AND (agent_public_key IS NULL OR agent_public_key = '')", token).Count(&count)
+	if count > 0 {
+		return true
+	}
+	s.db.Model(&model.Client{}).Where("token = ? AND (agent_public_key IS NULL OR agent_public_key = '')", token).Count(&count)
+	return count > 0
+}
+
+// RevokeAgentCredentials 吊销节点/客户端的 Agent 凭据: 清除已登记的公钥、
+// 更换 Token 并作废未使用的加入令牌。Agent 之后被拒绝并进入孤立状态，需用新的加入令牌重新登记
+func (s *Service) RevokeAgentCredentials(kind string, id uint) error {
+	return s.db.Transaction(func(tx *gorm.DB) error {
+		tokenColumn := "agent_token"
+		if kind == "client" {
+			tokenColumn = "token"
+		}
+		result := tx.Model(agentTable(kind)).Where("id = ?", id).Updates(map[string]interface{}{
+			tokenColumn:         generateToken(),
+			"agent_public_key":  "",
+			"agent_enrolled_at": nil,
+			"updated_at":        time.Now(),
+		})
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return gorm.ErrRecordNotFound
+		}
+		return tx.Where("kind = ? AND target_id = ? AND used_at IS NULL", kind, id).Delete(&model.AgentJoinToken{}).Error
+	})
+}
+
+// cleanupJoinTokens 删除过期一天以上的加入令牌
+func (s *Service) cleanupJoinTokens() error {
+	return s.db.Where("expires_at < ?", time.Now().Add(-24*time.Hour)).Delete(&model.AgentJoinToken{}).Error
+}
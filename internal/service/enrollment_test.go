@@ -0,0 +1,181 @@
+package service
+
+import (
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/AliceNetworks/gost-panel/internal/model"
+	"github.com/AliceNetworks/gost-panel/internal/signing"
+)
+
+func testAgentKey(t *testing.T) string {
+	t.Helper()
+	publicKey, _, err := signing.GenerateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return publicKey
+}
+
+// 加入令牌只能使用一次 (并发登记时只有一个成功)，过期的令牌无效
+func TestJoinTokenSingleUse(t *testing.T) {
+	s := newTestDBService(t)
+	node := model.Node{Name: "node", Host: "127.0.0.1", AgentToken: "node-token"}
+	if err := s.db.Create(&node).Error; err != nil {
+		t.Fatal(err)
+	}
+	token, _, err := s.CreateJoinToken("node", node.ID, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !s.JoinTokenValid(token) {
+		t.Fatal("new join token is not valid")
+	}
+	if s.AgentTokenUsable(token) {
+		t.Fatal("join token accepted as an agent token")
+	}
+
+	var wg sync.WaitGroup
+	errs := make([]error, 5)
+	for i := range errs {
+		key := testAgentKey(t)
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			_, _, errs[i] = s.EnrollAgent(token, key)
+		}(i)
+	}
+	wg.Wait()
+	enrolled := 0
+	for _, err := range errs {
+		switch {
+		case err == nil:
+			enrolled++
+		case !errors.Is(err, ErrJoinTokenInvalid):
+			t.Fatalf("EnrollAgent() = %v, want ErrJoinTokenInvalid", err)
+		}
+	}
+	if enrolled != 1 {
+		t.Fatalf("join token enrolled %d keys, want 1", enrolled)
+	}
+	if s.JoinTokenValid(token) {
+		t.Fatal("used join token still valid")
+	}
+
+	expired, jt, err := s.CreateJoinToken("node", node.ID, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := s.db.Model(jt).Update("expires_at", time.Now().Add(-time.Minute)).Error; err != nil {
+		t.Fatal(err)
+	}
+	if s.JoinTokenValid(expired) {
+		t.Fatal("expired join token valid")
+	}
+	if _, _, err := s.EnrollAgent(expired, testAgentKey(t)); !errors.Is(err, ErrJoinTokenInvalid) {
+		t.Fatalf("EnrollAgent() with expired token = %v, want ErrJoinTokenInvalid", err)
+	}
+}
+
+// 登记密钥后 Token 不再可用，也不能再用 Token 登记其他密钥；加入令牌可以为其登记新密钥
+func TestAgentTokenRejectedAfterEnrollment(t *testing.T) {
+	s := newTestDBService(t)
+	node := model.Node{Name: "node", Host: "127.0.0.1", AgentToken: "node-token"}
+	client := model.Client{Name: "client", NodeID: 1, Token: "client-token"}
+	for _, v := range []interface{}{&node, &client} {
+		if err := s.db.Create(v).Error; err != nil {
+			t.Fatal(err)
+		}
+	}
+	for _, token := range []string{"node-token", "client-token"} {
+		if !s.AgentTokenUsable(token) {
+			t.Fatalf("AgentTokenUsable(%q) = false before enrollment", token)
+		}
+	}
+	if s.AgentTokenUsable("") || s.AgentTokenUsable("unknown") {
+		t.Fatal("empty or unknown token usable")
+	}
+
+	key := testAgentKey(t)
+	kind, id, err := s.EnrollAgent("node-token", key)
+	if err != nil || kind != "node" || id != node.ID {
+		t.Fatalf("EnrollAgent() = %s %d, %v; want node %d", kind, id, err, node.ID)
+	}
+	if s.AgentTokenUsable("node-token") {
+		t.Fatal("token usable after enrollment")
+	}
+	if kind, token, err := s.GetAgentByKey(key); err != nil || kind != "node" || token != "node-token" {
+		t.Fatalf("GetAgentByKey() = %s %q, %v", kind, token, err)
+	}
+	if _, _, err := s.EnrollAgent("node-token", testAgentKey(t)); !errors.Is(err, ErrAgentEnrolled) {
+		t.Fatalf("second EnrollAgent() with token = %v, want ErrAgentEnrolled", err)
+	}
+	if _, _, err := s.EnrollAgent("client-token", key); !errors.Is(err, ErrAgentKeyInUse) {
+		t.Fatalf("EnrollAgent() with a key in use = %v, want ErrAgentKeyInUse", err)
+	}
+	if _, _, err := s.EnrollAgent("unknown", testAgentKey(t)); !errors.Is(err, ErrAgentTokenUnknown) {
+		t.Fatalf("EnrollAgent() with unknown token = %v, want ErrAgentTokenUnknown", err)
+	}
+
+	join, _, err := s.CreateJoinToken("node", node.ID, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	newKey := testAgentKey(t)
+	if _, _, err := s.EnrollAgent(join, newKey); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := s.GetAgentByKey(key); err == nil {
+		t.Fatal("replaced key still resolves")
+	}
+
+	// 要求登记密钥时不再接受未登记的 Token
+	if err := s.SetSiteConfig(model.ConfigAgentRequireEnrollment, "true"); err != nil {
+		t.Fatal(err)
+	}
+	if s.AgentTokenUsable("client-token") {
+		t.Fatal("token usable while enrollment is required")
+	}
+	if _, _, err := s.EnrollAgent("client-token", testAgentKey(t)); !errors.Is(err, ErrEnrollmentRequired) {
+		t.Fatalf("EnrollAgent() with token = %v, want ErrEnrollmentRequired", err)
+	}
+}
+
+// 吊销凭据后公钥和原 Token 失效，未使用的加入令牌作废
+func TestRevokeAgentCredentials(t *testing.T) {
+	s := newTestDBService(t)
+	node := model.Node{Name: "node", Host: "127.0.0.1", AgentToken: "node-token"}
+	if err := s.db.Create(&node).Error; err != nil {
+		t.Fatal(err)
+	}
+	key := testAgentKey(t)
+	if _, _, err := s.EnrollAgent("node-token", key); err != nil {
+		t.Fatal(err)
+	}
+	join, _, err := s.CreateJoinToken("node", node.ID, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := s.RevokeAgentCredentials("node", node.ID); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := s.GetAgentByKey(key); err == nil {
+		t.Fatal("revoked key still resolves")
+	}
+	if s.JoinTokenValid(join) {
+		t.Fatal("join token valid after revocation")
+	}
+	var revoked model.Node
+	if err := s.db.First(&revoked, node.ID).Error; err != nil {
+		t.Fatal(err)
+	}
+	if revoked.AgentToken == "node-token" || revoked.AgentToken == "" || s.AgentTokenUsable("node-token") {
+		t.Fatalf("token after revocation = %q, want a new token", revoked.AgentToken)
+	}
+	if err := s.RevokeAgentCredentials("node", node.ID+1); err == nil {
+		t.Fatal("RevokeAgentCredentials() of a missing node succeeded")
+	}
+}
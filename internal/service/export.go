@@ -0,0 +1,1605 @@
+package service
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/AliceNetworks/gost-panel/internal/model"
+	"github.com/goccy/go-yaml"
+	"gorm.io/gorm"
+)
+
+// ExportVersion 导出格式版本
+// 1.0 仅包含节点和客户端；2.0 覆盖全部配置资源，资源之间的引用使用名称而不是 ID
+const ExportVersion = "2.0"
+
+// 导入冲突策略 (按资源类型 + 名称判断冲突)
+const (
+	ConflictSkip      = "skip"      // 跳过同名资源，引用解析到已有资源
+	ConflictOverwrite = "overwrite" // 用导入内容覆盖同名资源
+	ConflictRename    = "rename"    // 以新名称创建，例如 "name (2)"
+)
+
+// ExportSections 可导出的数据分区，顺序即导入顺序 (被引用的资源在前)
+var ExportSections = []string{
+	"tags", "nodes", "clients", "node_groups", "proxy_chains", "tunnels", "port_forwards",
+	"bypasses", "admissions", "host_mappings", "ingresses", "routers", "recorders", "sds",
+	"plans", "notify_channels", "alert_rules",
+}
+
+// ExportData 导出数据结构
+type ExportData struct {
+	Version        string                `json:"version" yaml:"version"`
+	ExportAt       string                `json:"export_at" yaml:"export_at"`
+	Tags           []ExportTag           `json:"tags,omitempty" yaml:"tags,omitempty"`
+	Nodes          []ExportNode          `json:"nodes,omitempty" yaml:"nodes,omitempty"`
+	Clients        []ExportClient        `json:"clients,omitempty" yaml:"clients,omitempty"`
+	NodeGroups     []ExportNodeGroup     `json:"node_groups,omitempty" yaml:"node_groups,omitempty"`
+	ProxyChains    []ExportProxyChain    `json:"proxy_chains,omitempty" yaml:"proxy_chains,omitempty"`
+	Tunnels        []ExportTunnel        `json:"tunnels,omitempty" yaml:"tunnels,omitempty"`
+	PortForwards   []ExportPortForward   `json:"port_forwards,omitempty" yaml:"port_forwards,omitempty"`
+	Bypasses       []ExportBypass        `json:"bypasses,omitempty" yaml:"bypasses,omitempty"`
+	Admissions     []ExportAdmission     `json:"admissions,omitempty" yaml:"admissions,omitempty"`
+	HostMappings   []ExportHostMapping   `json:"host_mappings,omitempty" yaml:"host_mappings,omitempty"`
+	Ingresses      []ExportIngress       `json:"ingresses,omitempty" yaml:"ingresses,omitempty"`
+	Routers        []ExportRouter        `json:"routers,omitempty" yaml:"routers,omitempty"`
+	Recorders      []ExportRecorder      `json:"recorders,omitempty" yaml:"recorders,omitempty"`
+	SDs            []ExportSD            `json:"sds,omitempty" yaml:"sds,omitempty"`
+	Plans          []ExportPlan          `json:"plans,omitempty" yaml:"plans,omitempty"`
+	NotifyChannels []ExportNotifyChannel `json:"notify_channels,omitempty" yaml:"notify_channels,omitempty"`
+	AlertRules     []ExportAlertRule     `json:"alert_rules,omitempty" yaml:"alert_rules,omitempty"`
+}
+
+// ExportTag 标签
+type ExportTag struct {
+	Name  string `json:"name" yaml:"name"`
+	Color string `json:"color,omitempty" yaml:"color,omitempty"`
+}
+
+// ExportNode 节点 (不含 Agent 令牌、状态和流量统计)
+type ExportNode struct {
+	Name             string   `json:"name" yaml:"name"`
+	Host             string   `json:"host" yaml:"host"`
+	Port             int      `json:"port" yaml:"port"`
+	APIPort          int      `json:"api_port" yaml:"api_port"`
+	APIUser          string   `json:"api_user,omitempty" yaml:"api_user,omitempty"`
+	APIPass          string   `json:"api_pass,omitempty" yaml:"api_pass,omitempty"`
+	Protocol         string   `json:"protocol" yaml:"protocol"`
+	Transport        string   `json:"transport" yaml:"transport"`
+	TransportOpts    string   `json:"transport_opts,omitempty" yaml:"transport_opts,omitempty"`
+	ProxyUser        string   `json:"proxy_user,omitempty" yaml:"proxy_user,omitempty"`
+	ProxyPass        string   `json:"proxy_pass,omitempty" yaml:"proxy_pass,omitempty"`
+	SSMethod         string   `json:"ss_method,omitempty" yaml:"ss_method,omitempty"`
+	SSPassword       string   `json:"ss_password,omitempty" yaml:"ss_password,omitempty"`
+	TLSEnabled       bool     `json:"tls_enabled" yaml:"tls_enabled"`
+	TLSCertFile      string   `json:"tls_cert_file,omitempty" yaml:"tls_cert_file,omitempty"`
+	TLSKeyFile       string   `json:"tls_key_file,omitempty" yaml:"tls_key_file,omitempty"`
+	TLSSNI           string   `json:"tls_sni,omitempty" yaml:"tls_sni,omitempty"`
+	TLSALPN          string   `json:"tls_alpn,omitempty" yaml:"tls_alpn,omitempty"`
+	WSPath           string   `json:"ws_path,omitempty" yaml:"ws_path,omitempty"`
+	WSHost           string   `json:"ws_host,omitempty" yaml:"ws_host,omitempty"`
+	SpeedLimit       int64    `json:"speed_limit,omitempty" yaml:"speed_limit,omitempty"`
+	ConnRateLimit    int      `json:"conn_rate_limit,omitempty" yaml:"conn_rate_limit,omitempty"`
+	DNSServer        string   `json:"dns_server,omitempty" yaml:"dns_server,omitempty"`
+	ProxyProtocol    int      `json:"proxy_protocol,omitempty" yaml:"proxy_protocol,omitempty"`
+	ProbeResist      string   `json:"probe_resist,omitempty" yaml:"probe_resist,omitempty"`
+	ProbeResistValue string   `json:"probe_resist_value,omitempty" yaml:"probe_resist_value,omitempty"`
+	PluginConfig     string   `json:"plugin_config,omitempty" yaml:"plugin_config,omitempty"`
+	ProbeTarget      string   `json:"probe_target,omitempty" yaml:"probe_target,omitempty"`
+	ProbeFrom        string   `json:"probe_from,omitempty" yaml:"probe_from,omitempty"` // 发起探测的节点名称
+	TrafficQuota     int64    `json:"traffic_quota,omitempty" yaml:"traffic_quota,omitempty"`
+	QuotaResetDay    int      `json:"quota_reset_day" yaml:"quota_reset_day"`
+	Tags             []string `json:"tags,omitempty" yaml:"tags,omitempty"`
+	Owner            string   `json:"owner,omitempty" yaml:"owner,omitempty"`
+}
+
+// ExportClient 客户端
+type ExportClient struct {
+	Name          string `json:"name" yaml:"name"`
+	NodeName      string `json:"node_name" yaml:"node_name"`
+	LocalPort     int    `json:"local_port" yaml:"local_port"`
+	RemotePort    int    `json:"remote_port" yaml:"remote_port"`
+	ProxyUser     string `json:"proxy_user,omitempty" yaml:"proxy_user,omitempty"`
+	ProxyPass     string `json:"proxy_pass,omitempty" yaml:"proxy_pass,omitempty"`
+	TrafficQuota  int64  `json:"traffic_quota,omitempty" yaml:"traffic_quota,omitempty"`
+	QuotaResetDay int    `json:"quota_reset_day" yaml:"quota_reset_day"`
+	Owner         string `json:"owner,omitempty" yaml:"owner,omitempty"`
+}
+
+// ExportNodeGroup 节点组
+type ExportNodeGroup struct {
+	Name          string              `json:"name" yaml:"name"`
+	Strategy      string              `json:"strategy" yaml:"strategy"`
+	Selector      string              `json:"selector,omitempty" yaml:"selector,omitempty"`
+	FailTimeout   int                 `json:"fail_timeout" yaml:"fail_timeout"`
+	MaxFails      int                 `json:"max_fails" yaml:"max_fails"`
+	HealthCheck   bool                `json:"health_check" yaml:"health_check"`
+	CheckInterval int                 `json:"check_interval" yaml:"check_interval"`
+	Members       []ExportGroupMember `json:"members,omitempty" yaml:"members,omitempty"`
+	Owner         string              `json:"owner,omitempty" yaml:"owner,omitempty"`
+}
+
+// ExportGroupMember 节点组成员
+type ExportGroupMember struct {
+	NodeName string `json:"node_name" yaml:"node_name"`
+	Weight   int    `json:"weight" yaml:"weight"`
+	Priority int    `json:"priority" yaml:"priority"`
+	Enabled  bool   `json:"enabled" yaml:"enabled"`
+}
+
+// ExportProxyChain 代理链
+type ExportProxyChain struct {
+	Name        string           `json:"name" yaml:"name"`
+	Description string           `json:"description,omitempty" yaml:"description,omitempty"`
+	ListenAddr  string           `json:"listen_addr" yaml:"listen_addr"`
+	ListenType  string           `json:"listen_type" yaml:"listen_type"`
+	TargetAddr  string           `json:"target_addr,omitempty" yaml:"target_addr,omitempty"`
+	Enabled     bool             `json:"enabled" yaml:"enabled"`
+	Hops        []ExportChainHop `json:"hops,omitempty" yaml:"hops,omitempty"` // 按跳点顺序
+	Owner       string           `json:"owner,omitempty" yaml:"owner,omitempty"`
+}
+
+// ExportChainHop 代理链跳点
+type ExportChainHop struct {
+	NodeName string `json:"node_name" yaml:"node_name"`
+	Enabled  bool   `json:"enabled" yaml:"enabled"`
+}
+
+// ExportTunnel 隧道
+type ExportTunnel struct {
+	Name          string            `json:"name" yaml:"name"`
+	Description   string            `json:"description,omitempty" yaml:"description,omitempty"`
+	EntryNode     string            `json:"entry_node" yaml:"entry_node"`
+	EntryPort     int               `json:"entry_port" yaml:"entry_port"`
+	Protocol      string            `json:"protocol" yaml:"protocol"`
+	ExitNode      string            `json:"exit_node" yaml:"exit_node"`
+	TargetAddr    string            `json:"target_addr" yaml:"target_addr"`
+	Hops          []ExportTunnelHop `json:"hops,omitempty" yaml:"hops,omitempty"` // 按跳点顺序
+	Enabled       bool              `json:"enabled" yaml:"enabled"`
+	TrafficQuota  int64             `json:"traffic_quota,omitempty" yaml:"traffic_quota,omitempty"`
+	QuotaResetDay int               `json:"quota_reset_day" yaml:"quota_reset_day"`
+	SpeedLimit    int64             `json:"speed_limit,omitempty" yaml:"speed_limit,omitempty"`
+	Owner         string            `json:"owner,omitempty" yaml:"owner,omitempty"`
+}
+
+// ExportTunnelHop 隧道中转跳点
+type ExportTunnelHop struct {
+	NodeName  string `json:"node_name" yaml:"node_name"`
+	Transport string `json:"transport,omitempty" yaml:"transport,omitempty"`
+}
+
+// ExportPortForward 端口转发
+type ExportPortForward struct {
+	Name       string `json:"name" yaml:"name"`
+	NodeName   string `json:"node_name" yaml:"node_name"`
+	Type       string `json:"type" yaml:"type"`
+	LocalAddr  string `json:"local_addr" yaml:"local_addr"`
+	RemoteAddr string `json:"remote_addr" yaml:"remote_addr"`
+	ChainName  string `json:"chain_name,omitempty" yaml:"chain_name,omitempty"` // 使用的代理链
+	Enabled    bool   `json:"enabled" yaml:"enabled"`
+	Owner      string `json:"owner,omitempty" yaml:"owner,omitempty"`
+}
+
+// ExportBypass 分流规则
+type ExportBypass struct {
+	Name      string `json:"name" yaml:"name"`
+	Whitelist bool   `json:"whitelist" yaml:"whitelist"`
+	Matchers  string `json:"matchers" yaml:"matchers"`
+	NodeName  string `json:"node_name,omitempty" yaml:"node_name,omitempty"` // 为空表示全局
+	Owner     string `json:"owner,omitempty" yaml:"owner,omitempty"`
+}
+
+// ExportAdmission 准入控制
+type ExportAdmission struct {
+	Name      string `json:"name" yaml:"name"`
+	Whitelist bool   `json:"whitelist" yaml:"whitelist"`
+	Matchers  string `json:"matchers" yaml:"matchers"`
+	NodeName  string `json:"node_name,omitempty" yaml:"node_name,omitempty"`
+	Owner     string `json:"owner,omitempty" yaml:"owner,omitempty"`
+}
+
+// ExportHostMapping 主机映射
+type ExportHostMapping struct {
+	Name     string `json:"name" yaml:"name"`
+	Mappings string `json:"mappings" yaml:"mappings"`
+	NodeName string `json:"node_name,omitempty" yaml:"node_name,omitempty"`
+	Owner    string `json:"owner,omitempty" yaml:"owner,omitempty"`
+}
+
+// ExportIngress 反向代理域名路由
+type ExportIngress struct {
+	Name     string `json:"name" yaml:"name"`
+	Rules    string `json:"rules" yaml:"rules"`
+	NodeName string `json:"node_name,omitempty" yaml:"node_name,omitempty"`
+	Owner    string `json:"owner,omitempty" yaml:"owner,omitempty"`
+}
+
+// ExportRouter 路由
+type ExportRouter struct {
+	Name     string `json:"name" yaml:"name"`
+	Routes   string `json:"routes" yaml:"routes"`
+	NodeName string `json:"node_name,omitempty" yaml:"node_name,omitempty"`
+	Owner    string `json:"owner,omitempty" yaml:"owner,omitempty"`
+}
+
+// ExportRecorder 流量记录器
+type ExportRecorder struct {
+	Name     string `json:"name" yaml:"name"`
+	Type     string `json:"type" yaml:"type"`
+	Config   string `json:"config" yaml:"config"`
+	NodeName string `json:"node_name,omitempty" yaml:"node_name,omitempty"`
+	Owner    string `json:"owner,omitempty" yaml:"owner,omitempty"`
+}
+
+// ExportSD 服务发现
+type ExportSD struct {
+	Name     string `json:"name" yaml:"name"`
+	Type     string `json:"type" yaml:"type"`
+	Config   string `json:"config" yaml:"config"`
+	NodeName string `json:"node_name,omitempty" yaml:"node_name,omitempty"`
+	Owner    string `json:"owner,omitempty" yaml:"owner,omitempty"`
+}
+
+// ExportPlan 套餐
+type ExportPlan struct {
+	Name            string               `json:"name" yaml:"name"`
+	Description     string               `json:"description,omitempty" yaml:"description,omitempty"`
+	TrafficQuota    int64                `json:"traffic_quota" yaml:"traffic_quota"`
+	SpeedLimit      int64                `json:"speed_limit" yaml:"speed_limit"`
+	ConnRateLimit   int                  `json:"conn_rate_limit" yaml:"conn_rate_limit"`
+	Duration        int                  `json:"duration" yaml:"duration"`
+	MaxNodes        int                  `json:"max_nodes" yaml:"max_nodes"`
+	MaxClients      int                  `json:"max_clients" yaml:"max_clients"`
+	MaxTunnels      int                  `json:"max_tunnels" yaml:"max_tunnels"`
+	MaxPortForwards int                  `json:"max_port_forwards" yaml:"max_port_forwards"`
+	MaxProxyChains  int                  `json:"max_proxy_chains" yaml:"max_proxy_chains"`
+	MaxNodeGroups   int                  `json:"max_node_groups" yaml:"max_node_groups"`
+	Enabled         bool                 `json:"enabled" yaml:"enabled"`
+	SortOrder       int                  `json:"sort_order" yaml:"sort_order"`
+	Resources       []ExportPlanResource `json:"resources,omitempty" yaml:"resources,omitempty"`
+}
+
+// ExportPlanResource 套餐可使用的资源
+type ExportPlanResource struct {
+	Type string `json:"type" yaml:"type"` // node/tunnel/port_forward/proxy_chain/node_group
+	Name string `json:"name" yaml:"name"`
+}
+
+// ExportNotifyChannel 通知渠道
+type ExportNotifyChannel struct {
+	Name    string `json:"name" yaml:"name"`
+	Type    string `json:"type" yaml:"type"`
+	Config  string `json:"config" yaml:"config"`
+	Enabled bool   `json:"enabled" yaml:"enabled"`
+}
+
+// ExportAlertRule 告警规则
+type ExportAlertRule struct {
+	Name        string   `json:"name" yaml:"name"`
+	Type        string   `json:"type" yaml:"type"`
+	Condition   string   `json:"condition,omitempty" yaml:"condition,omitempty"`
+	Channels    []string `json:"channels,omitempty" yaml:"channels,omitempty"` // 通知渠道名称
+	Enabled     bool     `json:"enabled" yaml:"enabled"`
+	CooldownMin int      `json:"cooldown_min" yaml:"cooldown_min"`
+}
+
+// planResourceModels 套餐资源类型对应的模型
+var planResourceModels = map[string]interface{}{
+	"node":         &model.Node{},
+	"tunnel":       &model.Tunnel{},
+	"port_forward": &model.PortForward{},
+	"proxy_chain":  &model.ProxyChain{},
+	"node_group":   &model.NodeGroup{},
+}
+
+// ==================== 导出 ====================
+
+// ExportConfig 导出配置数据，sections 为空时导出全部分区
+func (s *Service) ExportConfig(sections []string) (*ExportData, error) {
+	want := make(map[string]bool)
+	for _, sec := range sections {
+		want[sec] = true
+	}
+	all := len(want) == 0
+	include := func(sec string) bool { return all || want[sec] }
+
+	data := &ExportData{
+		Version:  ExportVersion,
+		ExportAt: time.Now().Format(time.RFC3339),
+	}
+
+	users, err := s.exportNames(&model.User{}, "username")
+	if err != nil {
+		return nil, err
+	}
+	nodes, err := s.exportNames(&model.Node{}, "name")
+	if err != nil {
+		return nil, err
+	}
+	owner := func(id *uint) string {
+		if id == nil {
+			return ""
+		}
+		return users[*id]
+	}
+	nodeName := func(id *uint) string {
+		if id == nil {
+			return ""
+		}
+		return nodes[*id]
+	}
+
+	if include("tags") {
+		var tags []model.Tag
+		if err := s.db.Order("id").Find(&tags).Error; err != nil {
+			return nil, err
+		}
+		for _, t := range tags {
+			data.Tags = append(data.Tags, ExportTag{Name: t.Name, Color: t.Color})
+		}
+	}
+
+	if include("nodes") {
+		var list []model.Node
+		if err := s.db.Order("id").Find(&list).Error; err != nil {
+			return nil, err
+		}
+		var nodeTags []model.NodeTag
+		if err := s.db.Preload("Tag").Order("id").Find(&nodeTags).Error; err != nil {
+			return nil, err
+		}
+		tagsByNode := make(map[uint][]string)
+		for _, nt := range nodeTags {
+			if nt.Tag != nil {
+				tagsByNode[nt.NodeID] = append(tagsByNode[nt.NodeID], nt.Tag.Name)
+			}
+		}
+		for _, n := range list {
+			data.Nodes = append(data.Nodes, ExportNode{
+				Name:             n.Name,
+				Host:             n.Host,
+				Port:             n.Port,
+				APIPort:          n.APIPort,
+				APIUser:          n.APIUser,
+				APIPass:          n.APIPass,
+				Protocol:         n.Protocol,
+				Transport:        n.Transport,
+				TransportOpts:    n.TransportOpts,
+				ProxyUser:        n.ProxyUser,
+				ProxyPass:        n.ProxyPass,
+				SSMethod:         n.SSMethod,
+				SSPassword:       n.SSPassword,
+				TLSEnabled:       n.TLSEnabled,
+				TLSCertFile:      n.TLSCertFile,
+				TLSKeyFile:       n.TLSKeyFile,
+				TLSSNI:           n.TLSSNI,
+				TLSALPN:          n.TLSALPN,
+				WSPath:           n.WSPath,
+				WSHost:           n.WSHost,
+				SpeedLimit:       n.SpeedLimit,
+				ConnRateLimit:    n.ConnRateLimit,
+				DNSServer:        n.DNSServer,
+				ProxyProtocol:    n.ProxyProtocol,
+				ProbeResist:      n.ProbeResist,
+				ProbeResistValue: n.ProbeResistValue,
+				PluginConfig:     n.PluginConfig,
+				ProbeTarget:      n.ProbeTarget,
+				ProbeFrom:        nodeName(n.ProbeFromNodeID),
+				TrafficQuota:     n.TrafficQuota,
+				QuotaResetDay:    n.QuotaResetDay,
+				Tags:             tagsByNode[n.ID],
+				Owner:            owner(n.OwnerID),
+			})
+		}
+	}
+
+	if include("clients") {
+		var list []model.Client
+		if err := s.db.Order("id").Find(&list).Error; err != nil {
+			return nil, err
+		}
+		for _, cl := range list {
+			data.Clients = append(data.Clients, ExportClient{
+				Name:          cl.Name,
+				NodeName:      nodes[cl.NodeID],
+				LocalPort:     cl.LocalPort,
+				RemotePort:    cl.RemotePort,
+				ProxyUser:     cl.ProxyUser,
+				ProxyPass:     cl.ProxyPass,
+				TrafficQuota:  cl.TrafficQuota,
+				QuotaResetDay: cl.QuotaResetDay,
+				Owner:         owner(cl.OwnerID),
+			})
+		}
+	}
+
+	if include("node_groups") {
+		var list []model.NodeGroup
+		if err := s.db.Order("id").Find(&list).Error; err != nil {
+			return nil, err
+		}
+		for _, g := range list {
+			var members []model.NodeGroupMember
+			if err := s.db.Where("group_id = ?", g.ID).Order("priority asc, id asc").Find(&members).Error; err != nil {
+				return nil, err
+			}
+			item := ExportNodeGroup{
+				Name:          g.Name,
+				Strategy:      g.Strategy,
+				Selector:      g.Selector,
+				FailTimeout:   g.FailTimeout,
+				MaxFails:      g.MaxFails,
+				HealthCheck:   g.HealthCheck,
+				CheckInterval: g.CheckInterval,
+				Owner:         owner(g.OwnerID),
+			}
+			for _, m := range members {
+				item.Members = append(item.Members, ExportGroupMember{
+					NodeName: nodes[m.NodeID],
+					Weight:   m.Weight,
+					Priority: m.Priority,
+					Enabled:  m.Enabled,
+				})
+			}
+			data.NodeGroups = append(data.NodeGroups, item)
+		}
+	}
+
+	chains, err := s.exportNames(&model.ProxyChain{}, "name")
+	if err != nil {
+		return nil, err
+	}
+
+	if include("proxy_chains") {
+		var list []model.ProxyChain
+		if err := s.db.Order("id").Find(&list).Error; err != nil {
+			return nil, err
+		}
+		for _, ch := range list {
+			hops, err := s.GetProxyChainHops(ch.ID)
+			if err != nil {
+				return nil, err
+			}
+			item := ExportProxyChain{
+				Name:        ch.Name,
+				Description: ch.Description,
+				ListenAddr:  ch.ListenAddr,
+				ListenType:  ch.ListenType,
+				TargetAddr:  ch.TargetAddr,
+				Enabled:     ch.Enabled,
+				Owner:       owner(ch.OwnerID),
+			}
+			for _, h := range hops {
+				item.Hops = append(item.Hops, ExportChainHop{NodeName: nodes[h.NodeID], Enabled: h.Enabled})
+			}
+			data.ProxyChains = append(data.ProxyChains, item)
+		}
+	}
+
+	if include("tunnels") {
+		var list []model.Tunnel
+		if err := preloadTunnelHops(s.db).Order("id").Find(&list).Error; err != nil {
+			return nil, err
+		}
+		for _, t := range list {
+			item := ExportTunnel{
+				Name:          t.Name,
+				Description:   t.Description,
+				EntryNode:     nodes[t.EntryNodeID],
+				EntryPort:     t.EntryPort,
+				Protocol:      t.Protocol,
+				ExitNode:      nodes[t.ExitNodeID],
+				TargetAddr:    t.TargetAddr,
+				Enabled:       t.Enabled,
+				TrafficQuota:  t.TrafficQuota,
+				QuotaResetDay: t.QuotaResetDay,
+				SpeedLimit:    t.SpeedLimit,
+				Owner:         owner(t.OwnerID),
+			}
+			for _, h := range t.Hops {
+				item.Hops = append(item.Hops, ExportTunnelHop{NodeName: nodes[h.NodeID], Transport: h.Transport})
+			}
+			data.Tunnels = append(data.Tunnels, item)
+		}
+	}
+
+	if include("port_forwards") {
+		var list []model.PortForward
+		if err := s.db.Order("id").Find(&list).Error; err != nil {
+			return nil, err
+		}
+		for _, pf := range list {
+			chainName := ""
+			if pf.ChainID != nil {
+				chainName = chains[*pf.ChainID]
+			}
+			data.PortForwards = append(data.PortForwards, ExportPortForward{
+				Name:       pf.Name,
+				NodeName:   nodes[pf.NodeID],
+				Type:       pf.Type,
+				LocalAddr:  pf.LocalAddr,
+				RemoteAddr: pf.RemoteAddr,
+				ChainName:  chainName,
+				Enabled:    pf.Enabled,
+				Owner:      owner(pf.OwnerID),
+			})
+		}
+	}
+
+	if include("bypasses") {
+		var list []model.Bypass
+		if err := s.db.Order("id").Find(&list).Error; err != nil {
+			return nil, err
+		}
+		for _, b := range list {
+			data.Bypasses = append(data.Bypasses, ExportBypass{
+				Name: b.Name, Whitelist: b.Whitelist, Matchers: b.Matchers,
+				NodeName: nodeName(b.NodeID), Owner: owner(b.OwnerID),
+			})
+		}
+	}
+
+	if include("admissions") {
+		var list []model.Admission
+		if err := s.db.Order("id").Find(&list).Error; err != nil {
+			return nil, err
+		}
+		for _, a := range list {
+			data.Admissions = append(data.Admissions, ExportAdmission{
+				Name: a.Name, Whitelist: a.Whitelist, Matchers: a.Matchers,
+				NodeName: nodeName(a.NodeID), Owner: owner(a.OwnerID),
+			})
+		}
+	}
+
+	if include("host_mappings") {
+		var list []model.HostMapping
+		if err := s.db.Order("id").Find(&list).Error; err != nil {
+			return nil, err
+		}
+		for _, h := range list {
+			data.HostMappings = append(data.HostMappings, ExportHostMapping{
+				Name: h.Name, Mappings: h.Mappings,
+				NodeName: nodeName(h.NodeID), Owner: owner(h.OwnerID),
+			})
+		}
+	}
+
+	if include("ingresses") {
+		var list []model.Ingress
+		if err := s.db.Order("id").Find(&list).Error; err != nil {
+			return nil, err
+		}
+		for _, in := range list {
+			data.Ingresses = append(data.Ingresses, ExportIngress{
+				Name: in.Name, Rules: in.Rules,
+				NodeName: nodeName(in.NodeID), Owner: owner(in.OwnerID),
+			})
+		}
+	}
+
+	if include("routers") {
+		var list []model.Router
+		if err := s.db.Order("id").Find(&list).Error; err != nil {
+			return nil, err
+		}
+		for _, r := range list {
+			data.Routers = append(data.Routers, ExportRouter{
+				Name: r.Name, Routes: r.Routes,
+				NodeName: nodeName(r.NodeID), Owner: owner(r.OwnerID),
+			})
+		}
+	}
+
+	if include("recorders") {
+		var list []model.Recorder
+		if err := s.db.Order("id").Find(&list).Error; err != nil {
+			return nil, err
+		}
+		for _, r := range list {
+			data.Recorders = append(data.Recorders, ExportRecorder{
+				Name: r.Name, Type: r.Type, Config: r.Config,
+				NodeName: nodeName(r.NodeID), Owner: owner(r.OwnerID),
+			})
+		}
+	}
+
+	if include("sds") {
+		var list []model.SD
+		if err := s.db.Order("id").Find(&list).Error; err != nil {
+			return nil, err
+		}
+		for _, sd := range list {
+			data.SDs = append(data.SDs, ExportSD{
+				Name: sd.Name, Type: sd.Type, Config: sd.Config,
+				NodeName: nodeName(sd.NodeID), Owner: owner(sd.OwnerID),
+			})
+		}
+	}
+
+	if include("plans") {
+		var list []model.Plan
+		if err := s.db.Order("id").Find(&list).Error; err != nil {
+			return nil, err
+		}
+		resourceNames := make(map[string]map[uint]string)
+		for kind, m := range planResourceModels {
+			if resourceNames[kind], err = s.exportNames(m, "name"); err != nil {
+				return nil, err
+			}
+		}
+		for _, p := range list {
+			resources, err := s.GetPlanResources(p.ID)
+			if err != nil {
+				return nil, err
+			}
+			item := ExportPlan{
+				Name:            p.Name,
+				Description:     p.Description,
+				TrafficQuota:    p.TrafficQuota,
+				SpeedLimit:      p.SpeedLimit,
+				ConnRateLimit:   p.ConnRateLimit,
+				Duration:        p.Duration,
+				MaxNodes:        p.MaxNodes,
+				MaxClients:      p.MaxClients,
+				MaxTunnels:      p.MaxTunnels,
+				MaxPortForwards: p.MaxPortForwards,
+				MaxProxyChains:  p.MaxProxyChains,
+				MaxNodeGroups:   p.MaxNodeGroups,
+				Enabled:         p.Enabled,
+				SortOrder:       p.SortOrder,
+			}
+			for _, r := range resources {
+				if name, ok := resourceNames[r.ResourceType][r.ResourceID]; ok {
+					item.Resources = append(item.Resources, ExportPlanResource{Type: r.ResourceType, Name: name})
+				}
+			}
+			data.Plans = append(data.Plans, item)
+		}
+	}
+
+	channels, err := s.exportNames(&model.NotifyChannel{}, "name")
+	if err != nil {
+		return nil, err
+	}
+
+	if include("notify_channels") {
+		var list []model.NotifyChannel
+		if err := s.db.Order("id").Find(&list).Error; err != nil {
+			return nil, err
+		}
+		for _, ch := range list {
+			data.NotifyChannels = append(data.NotifyChannels, ExportNotifyChannel{
+				Name: ch.Name, Type: ch.Type, Config: ch.Config, Enabled: ch.Enabled,
+			})
+		}
+	}
+
+	if include("alert_rules") {
+		var list []model.AlertRule
+		if err := s.db.Order("id").Find(&list).Error; err != nil {
+			return nil, err
+		}
+		for _, r := range list {
+			item := ExportAlertRule{
+				Name:        r.Name,
+				Type:        r.Type,
+				Condition:   r.Condition,
+				Enabled:     r.Enabled,
+				CooldownMin: r.CooldownMin,
+			}
+			for _, idStr := range strings.Split(r.ChannelIDs, ",") {
+				id, err := strconv.ParseUint(strings.TrimSpace(idStr), 10, 32)
+				if err != nil {
+					continue
+				}
+				if name, ok := channels[uint(id)]; ok {
+					item.Channels = append(item.Channels, name)
+				}
+			}
+			data.AlertRules = append(data.AlertRules, item)
+		}
+	}
+
+	return data, nil
+}
+
+// exportNames 查询资源 ID 到名称的映射
+func (s *Service) exportNames(m interface{}, column string) (map[uint]string, error) {
+	var rows []struct {
+		ID   uint
+		Name string
+	}
+	if err := s.db.Model(m).Select("id, " + column + " AS name").Find(&rows).Error; err != nil {
+		return nil, err
+	}
+	names := make(map[uint]string, len(rows))
+	for _, r := range rows {
+		names[r.ID] = r.Name
+	}
+	return names, nil
+}
+
+// ==================== 导入 ====================
+
+// ImportOptions 导入选项
+type ImportOptions struct {
+	DryRun   bool   // 只校验并返回结果，不写入数据库
+	Conflict string // 同名资源的处理策略: skip/overwrite/rename
+}
+
+// ImportItemResult 单个资源的导入结果
+type ImportItemResult struct {
+	Type    string `json:"type"`
+	Name    string `json:"name"`
+	Action  string `json:"action"`             // created/updated/renamed/skipped/failed
+	NewName string `json:"new_name,omitempty"` // rename 策略下实际使用的名称
+	Warning string `json:"warning,omitempty"`
+	Error   string `json:"error,omitempty"`
+}
+
+// ImportResult 导入结果
+type ImportResult struct {
+	Version  string             `json:"version"` // 导入文件的格式版本
+	DryRun   bool               `json:"dry_run"`
+	Conflict string             `json:"conflict"`
+	Summary  map[string]int     `json:"summary"` // 各动作的数量
+	Items    []ImportItemResult `json:"items"`
+}
+
+// errImportDryRun 用于回滚试运行的事务
+var errImportDryRun = errors.New("import dry run")
+
+// ParseExportData 解析导出文件 (JSON 或 YAML)，兼容 1.0 格式
+func ParseExportData(content []byte) (*ExportData, error) {
+	var data ExportData
+	if err := json.Unmarshal(content, &data); err != nil {
+		if err := yaml.Unmarshal(content, &data); err != nil {
+			return nil, fmt.Errorf("invalid file format (expected JSON or YAML)")
+		}
+	}
+
+	major, _, _ := strings.Cut(data.Version, ".")
+	switch major {
+	case "1":
+		// 1.0 没有导出以下字段，补上与新建时一致的默认值
+		for i := range data.Nodes {
+			if data.Nodes[i].APIPort == 0 {
+				data.Nodes[i].APIPort = 18080
+			}
+			if data.Nodes[i].QuotaResetDay == 0 {
+				data.Nodes[i].QuotaResetDay = 1
+			}
+		}
+		for i := range data.Clients {
+			if data.Clients[i].QuotaResetDay == 0 {
+				data.Clients[i].QuotaResetDay = 1
+			}
+		}
+	case "2":
+	default:
+		return nil, fmt.Errorf("unsupported export version: %q", data.Version)
+	}
+	return &data, nil
+}
+
+// ImportConfig 按名称导入配置数据
+// 所有写入在同一事务中完成，试运行时最后回滚；单个资源失败只回滚该资源，不影响其他资源
+func (s *Service) ImportConfig(data *ExportData, opts ImportOptions) (*ImportResult, error) {
+	switch opts.Conflict {
+	case "":
+		opts.Conflict = ConflictSkip
+	case ConflictSkip, ConflictOverwrite, ConflictRename:
+	default:
+		return nil, fmt.Errorf("invalid conflict strategy: %s", opts.Conflict)
+	}
+
+	result := &ImportResult{
+		Version:  data.Version,
+		DryRun:   opts.DryRun,
+		Conflict: opts.Conflict,
+		Summary:  make(map[string]int),
+		Items:    []ImportItemResult{},
+	}
+
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		im := &importer{
+			tx:       tx,
+			conflict: opts.Conflict,
+			ids:      make(map[string]map[string]uint),
+			users:    make(map[string]uint),
+		}
+		var users []model.User
+		if err := tx.Select("id, username").Find(&users).Error; err != nil {
+			return err
+		}
+		for _, u := range users {
+			im.users[u.Username] = u.ID
+		}
+
+		im.run(data)
+		result.Items = im.results
+		if opts.DryRun {
+			return errImportDryRun
+		}
+		return nil
+	})
+	if err != nil && !errors.Is(err, errImportDryRun) {
+		return nil, err
+	}
+
+	for _, item := range result.Items {
+		result.Summary[item.Action]++
+	}
+	return result, nil
+}
+
+// importer 一次导入的状态
+type importer struct {
+	tx       *gorm.DB
+	conflict string
+	ids      map[string]map[string]uint // 资源类型 -> 文件中的名称 -> 导入后的资源 ID
+	users    map[string]uint            // 用户名 -> 用户 ID
+	warnings []string                   // 当前资源的警告
+	results  []ImportItemResult
+
+	probeSources []pendingProbeSource // 节点全部导入后再解析的探测来源
+}
+
+// pendingProbeSource 探测来源可能引用文件中排在后面的节点，导入完所有节点后再关联
+type pendingProbeSource struct {
+	nodeID uint
+	from   string
+	result int // 对应 results 中的下标，用于记录警告
+}
+
+func (im *importer) run(data *ExportData) {
+	for _, e := range data.Tags {
+		im.importTag(e)
+	}
+	for _, e := range data.Nodes {
+		im.importNode(e)
+	}
+	im.linkProbeSources()
+	for _, e := range data.Clients {
+		im.importClient(e)
+	}
+	for _, e := range data.NodeGroups {
+		im.importNodeGroup(e)
+	}
+	for _, e := range data.ProxyChains {
+		im.importProxyChain(e)
+	}
+	for _, e := range data.Tunnels {
+		im.importTunnel(e)
+	}
+	for _, e := range data.PortForwards {
+		im.importPortForward(e)
+	}
+	for _, e := range data.Bypasses {
+		im.importBypass(e)
+	}
+	for _, e := range data.Admissions {
+		im.importAdmission(e)
+	}
+	for _, e := range data.HostMappings {
+		im.importHostMapping(e)
+	}
+	for _, e := range data.Ingresses {
+		im.importIngress(e)
+	}
+	for _, e := range data.Routers {
+		im.importRouter(e)
+	}
+	for _, e := range data.Recorders {
+		im.importRecorder(e)
+	}
+	for _, e := range data.SDs {
+		im.importSD(e)
+	}
+	for _, e := range data.Plans {
+		im.importPlan(e)
+	}
+	for _, e := range data.NotifyChannels {
+		im.importNotifyChannel(e)
+	}
+	for _, e := range data.AlertRules {
+		im.importAlertRule(e)
+	}
+}
+
+// item 按冲突策略导入单个资源
+// apply 写入资源并返回其 ID：id 为 0 时以 name 新建，否则覆盖该 ID 的已有资源
+func (im *importer) item(kind, name string, m interface{}, apply func(id uint, name string) (uint, error)) {
+	res := ImportItemResult{Type: kind, Name: name}
+	im.warnings = nil
+
+	var id uint
+	var err error
+	if strings.TrimSpace(name) == "" {
+		err = errors.New("name is required")
+	} else {
+		existing := im.lookup(m, name)
+		im.tx.SavePoint("import_item")
+		switch {
+		case existing == 0:
+			res.Action = "created"
+			id, err = apply(0, name)
+		case im.conflict == ConflictOverwrite:
+			res.Action = "updated"
+			id, err = apply(existing, name)
+		case im.conflict == ConflictRename:
+			res.Action = "renamed"
+			res.NewName = im.uniqueName(m, name)
+			id, err = apply(0, res.NewName)
+		default:
+			res.Action = "skipped"
+			id = existing
+		}
+		if err != nil {
+			im.tx.RollbackTo("import_item")
+		}
+	}
+
+	if err != nil {
+		res.Action = "failed"
+		res.Error = err.Error()
+	} else {
+		if im.ids[kind] == nil {
+			im.ids[kind] = make(map[string]uint)
+		}
+		im.ids[kind][name] = id
+	}
+	res.Warning = strings.Join(im.warnings, "; ")
+	im.results = append(im.results, res)
+}
+
+// load 覆盖已有资源前读取原记录，保留令牌、状态、流量等未导出的字段
+func (im *importer) load(record interface{}, id uint) error {
+	if id == 0 {
+		return nil
+	}
+	return im.tx.First(record, id).Error
+}
+
+// persist 保存记录：id 为 0 时新建
+// Create 会把带 default 标签字段的零值 (例如 enabled=false) 替换为默认值并写回记录，
+// 因此先保留导入的内容，新建后带上生成的 ID 和时间戳再整体保存一次
+func (im *importer) persist(id uint, record interface{}) error {
+	if id == 0 {
+		v := reflect.ValueOf(record).Elem()
+		want := reflect.New(v.Type()).Elem()
+		want.Set(v)
+		if err := im.tx.Create(record).Error; err != nil {
+			return err
+		}
+		for _, field := range []string{"ID", "CreatedAt", "UpdatedAt"} {
+			if f := v.FieldByName(field); f.IsValid() {
+				want.FieldByName(field).Set(f)
+			}
+		}
+		v.Set(want)
+	}
+	return im.tx.Save(record).Error
+}
+
+// lookup 按名称查找已有资源，不存在时返回 0
+func (im *importer) lookup(m interface{}, name string) uint {
+	var ids []uint
+	im.tx.Model(m).Where("name = ?", name).Order("id").Limit(1).Pluck("id", &ids)
+	if len(ids) == 0 {
+		return 0
+	}
+	return ids[0]
+}
+
+// uniqueName 生成不与已有资源重名的名称
+func (im *importer) uniqueName(m interface{}, name string) string {
+	for i := 2; ; i++ {
+		candidate := fmt.Sprintf("%s (%d)", name, i)
+		if im.lookup(m, candidate) == 0 {
+			return candidate
+		}
+	}
+}
+
+// ref 解析按名称引用的资源，优先使用本次导入的结果
+func (im *importer) ref(kind string, m interface{}, name string) (uint, error) {
+	if id, ok := im.ids[kind][name]; ok {
+		return id, nil
+	}
+	if name != "" {
+		if id := im.lookup(m, name); id != 0 {
+			return id, nil
+		}
+	}
+	return 0, fmt.Errorf("%s not found: %q", kind, name)
+}
+
+// nodeRef 解析必填的节点引用
+func (im *importer) nodeRef(name string) (uint, error) {
+	return im.ref("node", &model.Node{}, name)
+}
+
+// optionalNodeRef 解析可选的节点引用，名称为空时返回 nil
+func (im *importer) optionalNodeRef(name string) (*uint, error) {
+	if name == "" {
+		return nil, nil
+	}
+	id, err := im.nodeRef(name)
+	if err != nil {
+		return nil, err
+	}
+	return &id, nil
+}
+
+// owner 解析所有者用户名，用户不存在时导入为无所有者并记录警告
+func (im *importer) owner(username string) *uint {
+	if username == "" {
+		return nil
+	}
+	id, ok := im.users[username]
+	if !ok {
+		im.warn("owner %q not found, imported without owner", username)
+		return nil
+	}
+	return &id
+}
+
+func (im *importer) warn(format string, args ...interface{}) {
+	im.warnings = append(im.warnings, fmt.Sprintf(format, args...))
+}
+
+func (im *importer) importTag(e ExportTag) {
+	im.item("tag", e.Name, &model.Tag{}, func(id uint, name string) (uint, error) {
+		var tag model.Tag
+		if err := im.load(&tag, id); err != nil {
+			return 0, err
+		}
+		tag.Name = name
+		if e.Color != "" {
+			tag.Color = e.Color
+		} else if tag.Color == "" {
+			tag.Color = "#3b82f6"
+		}
+		if err := im.persist(id, &tag); err != nil {
+			return 0, err
+		}
+		return tag.ID, nil
+	})
+}
+
+func (im *importer) importNode(e ExportNode) {
+	im.item("node", e.Name, &model.Node{}, func(id uint, name string) (uint, error) {
+		var node model.Node
+		if err := im.load(&node, id); err != nil {
+			return 0, err
+		}
+		if id == 0 {
+			node.AgentToken = generateToken()
+			node.Status = "offline"
+		}
+		node.Name = name
+		node.Host = e.Host
+		node.Port = e.Port
+		node.APIPort = e.APIPort
+		node.APIUser = e.APIUser
+		node.APIPass = e.APIPass
+		node.Protocol = e.Protocol
+		node.Transport = e.Transport
+		node.TransportOpts = e.TransportOpts
+		node.ProxyUser = e.ProxyUser
+		node.ProxyPass = e.ProxyPass
+		node.SSMethod = e.SSMethod
+		node.SSPassword = e.SSPassword
+		node.TLSEnabled = e.TLSEnabled
+		node.TLSCertFile = e.TLSCertFile
+		node.TLSKeyFile = e.TLSKeyFile
+		node.TLSSNI = e.TLSSNI
+		node.TLSALPN = e.TLSALPN
+		node.WSPath = e.WSPath
+		node.WSHost = e.WSHost
+		node.SpeedLimit = e.SpeedLimit
+		node.ConnRateLimit = e.ConnRateLimit
+		node.DNSServer = e.DNSServer
+		node.ProxyProtocol = e.ProxyProtocol
+		node.ProbeResist = e.ProbeResist
+		node.ProbeResistValue = e.ProbeResistValue
+		node.PluginConfig = e.PluginConfig
+		node.ProbeTarget = e.ProbeTarget
+		node.ProbeFromNodeID = nil
+		node.TrafficQuota = e.TrafficQuota
+		node.QuotaResetDay = e.QuotaResetDay
+		node.OwnerID = im.owner(e.Owner)
+		if err := im.persist(id, &node); err != nil {
+			return 0, err
+		}
+		if e.ProbeFrom != "" {
+			im.probeSources = append(im.probeSources, pendingProbeSource{nodeID: node.ID, from: e.ProbeFrom, result: len(im.results)})
+		}
+
+		// 标签按名称关联，缺失的标签只记录警告
+		if err := im.tx.Where("node_id = ?", node.ID).Delete(&model.NodeTag{}).Error; err != nil {
+			return 0, err
+		}
+		for _, tagName := range e.Tags {
+			tagID, err := im.ref("tag", &model.Tag{}, tagName)
+			if err != nil {
+				im.warn("%v", err)
+				continue
+			}
+			if err := im.tx.Create(&model.NodeTag{NodeID: node.ID, TagID: tagID}).Error; err != nil {
+				return 0, err
+			}
+		}
+		return node.ID, nil
+	})
+}
+
+// linkProbeSources 关联节点的探测来源，来源节点不存在时由面板探测并记录警告
+func (im *importer) linkProbeSources() {
+	for _, p := range im.probeSources {
+		fromID, err := im.nodeRef(p.from)
+		if err == nil && fromID == p.nodeID {
+			err = errors.New("a node cannot be its own probe source")
+		}
+		if err == nil {
+			err = im.tx.Model(&model.Node{}).Where("id = ?", p.nodeID).Update("probe_from_node_id", fromID).Error
+		}
+		if err != nil {
+			res := &im.results[p.result]
+			warning := fmt.Sprintf("probe source: %v, probing from panel", err)
+			if res.Warning != "" {
+				warning = res.Warning + "; " + warning
+			}
+			res.Warning = warning
+		}
+	}
+	im.probeSources = nil
+}
+
+func (im *importer) importClient(e ExportClient) {
+	im.item("client", e.Name, &model.Client{}, func(id uint, name string) (uint, error) {
+		nodeID, err := im.nodeRef(e.NodeName)
+		if err != nil {
+			return 0, err
+		}
+		var client model.Client
+		if err := im.load(&client, id); err != nil {
+			return 0, err
+		}
+		if id == 0 {
+			client.Token = generateToken()
+			client.Status = "offline"
+		}
+		client.Name = name
+		client.NodeID = nodeID
+		client.LocalPort = e.LocalPort
+		client.RemotePort = e.RemotePort
+		client.ProxyUser = e.ProxyUser
+		client.ProxyPass = e.ProxyPass
+		client.TrafficQuota = e.TrafficQuota
+		client.QuotaResetDay = e.QuotaResetDay
+		client.OwnerID = im.owner(e.Owner)
+		if err := im.persist(id, &client); err != nil {
+			return 0, err
+		}
+		return client.ID, nil
+	})
+}
+
+func (im *importer) importNodeGroup(e ExportNodeGroup) {
+	im.item("node_group", e.Name, &model.NodeGroup{}, func(id uint, name string) (uint, error) {
+		members := make([]model.NodeGroupMember, 0, len(e.Members))
+		for _, m := range e.Members {
+			nodeID, err := im.nodeRef(m.NodeName)
+			if err != nil {
+				return 0, err
+			}
+			members = append(members, model.NodeGroupMember{NodeID: nodeID, Weight: m.Weight, Priority: m.Priority, Enabled: m.Enabled})
+		}
+
+		var group model.NodeGroup
+		if err := im.load(&group, id); err != nil {
+			return 0, err
+		}
+		group.Name = name
+		group.Strategy = e.Strategy
+		group.Selector = e.Selector
+		group.FailTimeout = e.FailTimeout
+		group.MaxFails = e.MaxFails
+		group.HealthCheck = e.HealthCheck
+		group.CheckInterval = e.CheckInterval
+		group.OwnerID = im.owner(e.Owner)
+		if err := im.persist(id, &group); err != nil {
+			return 0, err
+		}
+
+		if err := im.tx.Where("group_id = ?", group.ID).Delete(&model.NodeGroupMember{}).Error; err != nil {
+			return 0, err
+		}
+		for i := range members {
+			members[i].GroupID = group.ID
+			if err := im.persist(0, &members[i]); err != nil {
+				return 0, err
+			}
+		}
+		return group.ID, nil
+	})
+}
+
+func (im *importer) importProxyChain(e ExportProxyChain) {
+	im.item("proxy_chain", e.Name, &model.ProxyChain{}, func(id uint, name string) (uint, error) {
+		hops := make([]model.ProxyChainHop, 0, len(e.Hops))
+		for i, h := range e.Hops {
+			nodeID, err := im.nodeRef(h.NodeName)
+			if err != nil {
+				return 0, err
+			}
+			hops = append(hops, model.ProxyChainHop{NodeID: nodeID, HopOrder: i, Enabled: h.Enabled})
+		}
+
+		var chain model.ProxyChain
+		if err := im.load(&chain, id); err != nil {
+			return 0, err
+		}
+		chain.Name = name
+		chain.Description = e.Description
+		chain.ListenAddr = e.ListenAddr
+		chain.ListenType = e.ListenType
+		chain.TargetAddr = e.TargetAddr
+		chain.Enabled = e.Enabled
+		chain.OwnerID = im.owner(e.Owner)
+		if err := im.persist(id, &chain); err != nil {
+			return 0, err
+		}
+
+		if err := im.tx.Where("chain_id = ?", chain.ID).Delete(&model.ProxyChainHop{}).Error; err != nil {
+			return 0, err
+		}
+		for i := range hops {
+			hops[i].ChainID = chain.ID
+			if err := im.persist(0, &hops[i]); err != nil {
+				return 0, err
+			}
+		}
+		return chain.ID, nil
+	})
+}
+
+func (im *importer) importTunnel(e ExportTunnel) {
+	im.item("tunnel", e.Name, &model.Tunnel{}, func(id uint, name string) (uint, error) {
+		entryID, err := im.nodeRef(e.EntryNode)
+		if err != nil {
+			return 0, err
+		}
+		exitID, err := im.nodeRef(e.ExitNode)
+		if err != nil {
+			return 0, err
+		}
+		hops := make([]model.TunnelHop, 0, len(e.Hops))
+		for i, h := range e.Hops {
+			nodeID, err := im.nodeRef(h.NodeName)
+			if err != nil {
+				return 0, err
+			}
+			hops = append(hops, model.TunnelHop{NodeID: nodeID, HopOrder: i, Transport: h.Transport})
+		}
+
+		var tunnel model.Tunnel
+		if err := im.load(&tunnel, id); err != nil {
+			return 0, err
+		}
+		tunnel.Name = name
+		tunnel.Description = e.Description
+		tunnel.EntryNodeID = entryID
+		tunnel.EntryPort = e.EntryPort
+		tunnel.Protocol = e.Protocol
+		tunnel.ExitNodeID = exitID
+		tunnel.TargetAddr = e.TargetAddr
+		tunnel.Enabled = e.Enabled
+		tunnel.TrafficQuota = e.TrafficQuota
+		tunnel.QuotaResetDay = e.QuotaResetDay
+		tunnel.SpeedLimit = e.SpeedLimit
+		tunnel.OwnerID = im.owner(e.Owner)
+		if err := im.persist(id, &tunnel); err != nil {
+			return 0, err
+		}
+
+		if err := im.tx.Where("tunnel_id = ?", tunnel.ID).Delete(&model.TunnelHop{}).Error; err != nil {
+			return 0, err
+		}
+		for i := range hops {
+			hops[i].TunnelID = tunnel.ID
+			if err := im.tx.Create(&hops[i]).Error; err != nil {
+				return 0, err
+			}
+		}
+		return tunnel.ID, nil
+	})
+}
+
+func (im *importer) importPortForward(e ExportPortForward) {
+	im.item("port_forward", e.Name, &model.PortForward{}, func(id uint, name string) (uint, error) {
+		nodeID, err := im.nodeRef(e.NodeName)
+		if err != nil {
+			return 0, err
+		}
+		var chainID *uint
+		if e.ChainName != "" {
+			cid, err := im.ref("proxy_chain", &model.ProxyChain{}, e.ChainName)
+			if err != nil {
+				return 0, err
+			}
+			chainID = &cid
+		}
+
+		var forward model.PortForward
+		if err := im.load(&forward, id); err != nil {
+			return 0, err
+		}
+		forward.Name = name
+		forward.NodeID = nodeID
+		forward.Type = e.Type
+		forward.LocalAddr = e.LocalAddr
+		forward.RemoteAddr = e.RemoteAddr
+		forward.ChainID = chainID
+		forward.Enabled = e.Enabled
+		forward.OwnerID = im.owner(e.Owner)
+		if err := im.persist(id, &forward); err != nil {
+			return 0, err
+		}
+		return forward.ID, nil
+	})
+}
+
+func (im *importer) importBypass(e ExportBypass) {
+	im.item("bypass", e.Name, &model.Bypass{}, func(id uint, name string) (uint, error) {
+		nodeID, err := im.optionalNodeRef(e.NodeName)
+		if err != nil {
+			return 0, err
+		}
+		var bypass model.Bypass
+		if err := im.load(&bypass, id); err != nil {
+			return 0, err
+		}
+		bypass.Name = name
+		bypass.Whitelist = e.Whitelist
+		bypass.Matchers = e.Matchers
+		bypass.NodeID = nodeID
+		bypass.OwnerID = im.owner(e.Owner)
+		if err := im.persist(id, &bypass); err != nil {
+			return 0, err
+		}
+		return bypass.ID, nil
+	})
+}
+
+func (im *importer) importAdmission(e ExportAdmission) {
+	im.item("admission", e.Name, &model.Admission{}, func(id uint, name string) (uint, error) {
+		nodeID, err := im.optionalNodeRef(e.NodeName)
+		if err != nil {
+			return 0, err
+		}
+		var admission model.Admission
+		if err := im.load(&admission, id); err != nil {
+			return 0, err
+		}
+		admission.Name = name
+		admission.Whitelist = e.Whitelist
+		admission.Matchers = e.Matchers
+		admission.NodeID = nodeID
+		admission.OwnerID = im.owner(e.Owner)
+		if err := im.persist(id, &admission); err != nil {
+			return 0, err
+		}
+		return admission.ID, nil
+	})
+}
+
+func (im *importer) importHostMapping(e ExportHostMapping) {
+	im.item("host_mapping", e.Name, &model.HostMapping{}, func(id uint, name string) (uint, error) {
+		nodeID, err := im.optionalNodeRef(e.NodeName)
+		if err != nil {
+			return 0, err
+		}
+		var mapping model.HostMapping
+		if err := im.load(&mapping, id); err != nil {
+			return 0, err
+		}
+		mapping.Name = name
+		mapping.Mappings = e.Mappings
+		mapping.NodeID = nodeID
+		mapping.OwnerID = im.owner(e.Owner)
+		if err := im.persist(id, &mapping); err != nil {
+			return 0, err
+		}
+		return mapping.ID, nil
+	})
+}
+
+func (im *importer) importIngress(e ExportIngress) {
+	im.item("ingress", e.Name, &model.Ingress{}, func(id uint, name string) (uint, error) {
+		nodeID, err := im.optionalNodeRef(e.NodeName)
+		if err != nil {
+			return 0, err
+		}
+		var ingress model.Ingress
+		if err := im.load(&ingress, id); err != nil {
+			return 0, err
+		}
+		ingress.Name = name
+		ingress.Rules = e.Rules
+		ingress.NodeID = nodeID
+		ingress.OwnerID = im.owner(e.Owner)
+		if err := im.persist(id, &ingress); err != nil {
+			return 0, err
+		}
+		return ingress.ID, nil
+	})
+}
+
+func (im *importer) importRouter(e ExportRouter) {
+	im.item("router", e.Name, &model.Router{}, func(id uint, name string) (uint, error) {
+		nodeID, err := im.optionalNodeRef(e.NodeName)
+		if err != nil {
+			return 0, err
+		}
+		var router model.Router
+		if err := im.load(&router, id); err != nil {
+			return 0, err
+		}
+		router.Name = name
+		router.Routes = e.Routes
+		router.NodeID = nodeID
+		router.OwnerID = im.owner(e.Owner)
+		if err := im.persist(id, &router); err != nil {
+			return 0, err
+		}
+		return router.ID, nil
+	})
+}
+
+func (im *importer) importRecorder(e ExportRecorder) {
+	im.item("recorder", e.Name, &model.Recorder{}, func(id uint, name string) (uint, error) {
+		nodeID, err := im.optionalNodeRef(e.NodeName)
+		if err != nil {
+			return 0, err
+		}
+		var recorder model.Recorder
+		if err := im.load(&recorder, id); err != nil {
+			return 0, err
+		}
+		recorder.Name = name
+		recorder.Type = e.Type
+		recorder.Config = e.Config
+		recorder.NodeID = nodeID
+		recorder.OwnerID = im.owner(e.Owner)
+		if err := im.persist(id, &recorder); err != nil {
+			return 0, err
+		}
+		return recorder.ID, nil
+	})
+}
+
+func (im *importer) importSD(e ExportSD) {
+	im.item("sd", e.Name, &model.SD{}, func(id uint, name string) (uint, error) {
+		nodeID, err := im.optionalNodeRef(e.NodeName)
+		if err != nil {
+			return 0, err
+		}
+		var sd model.SD
+		if err := im.load(&sd, id); err != nil {
+			return 0, err
+		}
+		sd.Name = name
+		sd.Type = e.Type
+		sd.Config = e.Config
+		sd.NodeID = nodeID
+		sd.OwnerID = im.owner(e.Owner)
+		if err := im.persist(id, &sd); err != nil {
+			return 0, err
+		}
+		return sd.ID, nil
+	})
+}
+
+func (im *importer) importPlan(e ExportPlan) {
+	im.item("plan", e.Name, &model.Plan{}, func(id uint, name string) (uint, error) {
+		var plan model.Plan
+		if err := im.load(&plan, id); err != nil {
+			return 0, err
+		}
+		plan.Name = name
+		plan.Description = e.Description
+		plan.TrafficQuota = e.TrafficQuota
+		plan.SpeedLimit = e.SpeedLimit
+		plan.ConnRateLimit = e.ConnRateLimit
+		plan.Duration = e.Duration
+		plan.MaxNodes = e.MaxNodes
+		plan.MaxClients = e.MaxClients
+		plan.MaxTunnels = e.MaxTunnels
+		plan.MaxPortForwards = e.MaxPortForwards
+		plan.MaxProxyChains = e.MaxProxyChains
+		plan.MaxNodeGroups = e.MaxNodeGroups
+		plan.Enabled = e.Enabled
+		plan.SortOrder = e.SortOrder
+		if err := im.persist(id, &plan); err != nil {
+			return 0, err
+		}
+
+		// 资源按名称关联，缺失的资源只记录警告
+		if err := im.tx.Where("plan_id = ?", plan.ID).Delete(&model.PlanResource{}).Error; err != nil {
+			return 0, err
+		}
+		for _, r := range e.Resources {
+			m, ok := planResourceModels[r.Type]
+			if !ok {
+				im.warn("unknown resource type: %s", r.Type)
+				continue
+			}
+			resourceID, err := im.ref(r.Type, m, r.Name)
+			if err != nil {
+				im.warn("%v", err)
+				continue
+			}
+			resource := model.PlanResource{PlanID: plan.ID, ResourceType: r.Type, ResourceID: resourceID}
+			if err := im.tx.Create(&resource).Error; err != nil {
+				return 0, err
+			}
+		}
+		return plan.ID, nil
+	})
+}
+
+func (im *importer) importNotifyChannel(e ExportNotifyChannel) {
+	im.item("notify_channel", e.Name, &model.NotifyChannel{}, func(id uint, name string) (uint, error) {
+		var channel model.NotifyChannel
+		if err := im.load(&channel, id); err != nil {
+			return 0, err
+		}
+		channel.Name = name
+		channel.Type = e.Type
+		channel.Config = e.Config
+		channel.Enabled = e.Enabled
+		if err := im.persist(id, &channel); err != nil {
+			return 0, err
+		}
+		return channel.ID, nil
+	})
+}
+
+func (im *importer) importAlertRule(e ExportAlertRule) {
+	im.item("alert_rule", e.Name, &model.AlertRule{}, func(id uint, name string) (uint, error) {
+		// 通知渠道按名称关联，缺失的渠道只记录警告
+		var channelIDs []string
+		for _, channelName := range e.Channels {
+			channelID, err := im.ref("notify_channel", &model.NotifyChannel{}, channelName)
+			if err != nil {
+				im.warn("%v", err)
+				continue
+			}
+			channelIDs = append(channelIDs, strconv.FormatUint(uint64(channelID), 10))
+		}
+
+		var rule model.AlertRule
+		if err := im.load(&rule, id); err != nil {
+			return 0, err
+		}
+		rule.Name = name
+		rule.Type = e.Type
+		rule.Condition = e.Condition
+		rule.ChannelIDs = strings.Join(channelIDs, ",")
+		rule.Enabled = e.Enabled
+		rule.CooldownMin = e.CooldownMin
+		if err := im.persist(id, &rule); err != nil {
+			return 0, err
+		}
+		return rule.ID, nil
+	})
+}
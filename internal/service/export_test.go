@@ -0,0 +1,228 @@
+package service
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+
+	"github.com/AliceNetworks/gost-panel/internal/model"
+)
+
+// newExportSource 创建包含节点、标签、客户端、隧道和端口转发的数据库并导出
+func newExportSource(t *testing.T) *ExportData {
+	t.Helper()
+	s := newTestDBService(t)
+	tag := model.Tag{Name: "prod", Color: "#ff0000"}
+	if err := s.db.Create(&tag).Error; err != nil {
+		t.Fatal(err)
+	}
+	nodes := []model.Node{
+		{Name: "entry", Host: "10.0.0.1", Port: 1080, APIPort: 18080, AgentToken: "entry", Protocol: "socks5", Transport: "tcp", QuotaResetDay: 1},
+		{Name: "relay", Host: "10.0.0.2", Port: 1080, APIPort: 18080, AgentToken: "relay", Protocol: "relay", Transport: "tls", QuotaResetDay: 1},
+		{Name: "exit", Host: "10.0.0.3", Port: 1080, APIPort: 18080, AgentToken: "exit", Protocol: "socks5", Transport: "tcp", QuotaResetDay: 1},
+	}
+	for i := range nodes {
+		if err := s.db.Create(&nodes[i]).Error; err != nil {
+			t.Fatal(err)
+		}
+	}
+	tunnel := model.Tunnel{Name: "game", EntryNodeID: nodes[0].ID, EntryPort: 9000, Protocol: "tcp", ExitNodeID: nodes[2].ID, TargetAddr: "10.1.1.1:27015", Enabled: true, QuotaResetDay: 1}
+	for _, v := range []interface{}{
+		&model.NodeTag{NodeID: nodes[0].ID, TagID: tag.ID},
+		&model.Client{Name: "office", NodeID: nodes[0].ID, Token: "office", LocalPort: 1080, RemotePort: 20000, QuotaResetDay: 1},
+		&tunnel,
+		&model.PortForward{Name: "web", NodeID: nodes[0].ID, Type: "tcp", LocalAddr: ":8080", RemoteAddr: "10.1.1.2:80", Enabled: true},
+	} {
+		if err := s.db.Create(v).Error; err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := s.db.Create(&model.TunnelHop{TunnelID: tunnel.ID, NodeID: nodes[1].ID, Transport: "wss"}).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	exported, err := s.ExportConfig(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// 经过导出文件再解析，与实际导入一致
+	content, err := json.Marshal(exported)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := ParseExportData(content)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return data
+}
+
+func countRows(t *testing.T, s *Service, m interface{}) int64 {
+	t.Helper()
+	var n int64
+	if err := s.db.Model(m).Count(&n).Error; err != nil {
+		t.Fatal(err)
+	}
+	return n
+}
+
+// 导出后导入到新数据库再导出，内容不变；试运行不写入数据库
+func TestExportImportRoundTrip(t *testing.T) {
+	data := newExportSource(t)
+	s := newTestDBService(t)
+
+	result, err := s.ImportConfig(data, ImportOptions{DryRun: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !result.DryRun || result.Summary["created"] != 7 || len(result.Items) != 7 {
+		t.Fatalf("dry run summary = %v, want 7 created", result.Summary)
+	}
+	if n := countRows(t, s, &model.Node{}); n != 0 {
+		t.Fatalf("dry run created %d nodes", n)
+	}
+
+	result, err = s.ImportConfig(data, ImportOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Summary["created"] != 7 {
+		t.Fatalf("import summary = %v (%+v), want 7 created", result.Summary, result.Items)
+	}
+	exported, err := s.ExportConfig(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	exported.ExportAt = data.ExportAt
+	if !reflect.DeepEqual(exported, data) {
+		got, _ := json.Marshal(exported)
+		want, _ := json.Marshal(data)
+		t.Fatalf("re-exported data differs:\n%s\nwant:\n%s", got, want)
+	}
+}
+
+// 同名资源按冲突策略跳过、覆盖 (保留令牌等未导出的字段) 或以新名称创建 (引用指向新资源)
+func TestImportConflictStrategies(t *testing.T) {
+	data := newExportSource(t)
+	s := newTestDBService(t)
+	if _, err := s.ImportConfig(data, ImportOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	var entry model.Node
+	if err := s.db.Where("name = ?", "entry").First(&entry).Error; err != nil {
+		t.Fatal(err)
+	}
+	data.Nodes[0].Host = "10.0.0.9"
+
+	result, err := s.ImportConfig(data, ImportOptions{Conflict: ConflictSkip})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Summary["skipped"] != 7 {
+		t.Fatalf("skip summary = %v, want 7 skipped", result.Summary)
+	}
+	var node model.Node
+	if err := s.db.First(&node, entry.ID).Error; err != nil || node.Host != "10.0.0.1" {
+		t.Fatalf("skipped node host = %q, %v; want unchanged", node.Host, err)
+	}
+
+	result, err = s.ImportConfig(data, ImportOptions{Conflict: ConflictOverwrite})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Summary["updated"] != 7 {
+		t.Fatalf("overwrite summary = %v, want 7 updated", result.Summary)
+	}
+	if err := s.db.First(&node, entry.ID).Error; err != nil {
+		t.Fatal(err)
+	}
+	if node.Host != "10.0.0.9" || node.AgentToken != entry.AgentToken {
+		t.Fatalf("overwritten node host %q token %q, want new host and kept token %q", node.Host, node.AgentToken, entry.AgentToken)
+	}
+	if n := countRows(t, s, &model.TunnelHop{}); n != 1 {
+		t.Fatalf("got %d tunnel hops after overwrite, want 1", n)
+	}
+
+	result, err = s.ImportConfig(data, ImportOptions{Conflict: ConflictRename})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Summary["renamed"] != 7 {
+		t.Fatalf("rename summary = %v, want 7 renamed", result.Summary)
+	}
+	var renamed model.Node
+	if err := s.db.Where("name = ?", "entry (2)").First(&renamed).Error; err != nil {
+		t.Fatal(err)
+	}
+	var tunnel model.Tunnel
+	if err := s.db.Where("name = ?", "game (2)").First(&tunnel).Error; err != nil {
+		t.Fatal(err)
+	}
+	if tunnel.EntryNodeID != renamed.ID {
+		t.Fatalf("renamed tunnel entry node = %d, want renamed node %d", tunnel.EntryNodeID, renamed.ID)
+	}
+	var tagged int64
+	s.db.Model(&model.NodeTag{}).Joins("JOIN tags ON tags.id = node_tags.tag_id").
+		Where("node_tags.node_id = ? AND tags.name = ?", renamed.ID, "prod (2)").Count(&tagged)
+	if tagged != 1 {
+		t.Fatal("renamed node not tagged with the renamed tag")
+	}
+
+	if _, err := s.ImportConfig(data, ImportOptions{Conflict: "merge"}); err == nil {
+		t.Fatal("unknown conflict strategy accepted")
+	}
+}
+
+// 单个资源失败 (包括已写入部分数据后失败) 只回滚该资源，其他资源照常导入
+func TestImportFailedItemRollsBackAlone(t *testing.T) {
+	data := newExportSource(t)
+	s := newTestDBService(t)
+	if _, err := s.ImportConfig(data, ImportOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	// 写入隧道记录后，写入跳点时失败
+	if err := s.db.Exec(`CREATE TRIGGER reject_hop BEFORE INSERT ON tunnel_hops WHEN NEW.transport = 'broken'
+		BEGIN SELECT RAISE(ABORT, 'hop rejected'); END`).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	data.Nodes[0].Host = "10.0.0.9"
+	data.Tunnels[0].Hops[0].Transport = "broken"
+	added := data.Tunnels[0]
+	added.Name = "added"
+	data.Tunnels = append(data.Tunnels, added)
+	data.Clients = append(data.Clients, ExportClient{Name: "orphan", NodeName: "missing", QuotaResetDay: 1})
+
+	result, err := s.ImportConfig(data, ImportOptions{Conflict: ConflictOverwrite})
+	if err != nil {
+		t.Fatal(err)
+	}
+	failed := map[string]bool{}
+	for _, item := range result.Items {
+		if item.Action == "failed" {
+			failed[item.Type+"/"+item.Name] = true
+		}
+	}
+	want := map[string]bool{"tunnel/game": true, "tunnel/added": true, "client/orphan": true}
+	if !reflect.DeepEqual(failed, want) || result.Summary["updated"] != 6 {
+		t.Fatalf("failed %v, summary %v; want %v failed and 6 updated", failed, result.Summary, want)
+	}
+
+	var node model.Node
+	if err := s.db.Where("name = ?", "entry").First(&node).Error; err != nil || node.Host != "10.0.0.9" {
+		t.Fatalf("node host = %q, %v; want updated", node.Host, err)
+	}
+	var hops []model.TunnelHop
+	if err := s.db.Find(&hops).Error; err != nil {
+		t.Fatal(err)
+	}
+	if len(hops) != 1 || hops[0].Transport != "wss" {
+		t.Fatalf("tunnel hops = %+v, want the original hop kept", hops)
+	}
+	if n := countRows(t, s, &model.Tunnel{}); n != 1 {
+		t.Fatalf("got %d tunnels, want the failed new tunnel rolled back", n)
+	}
+	if n := countRows(t, s, &model.Client{}); n != 1 {
+		t.Fatalf("got %d clients, want 1", n)
+	}
+}
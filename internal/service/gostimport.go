@@ -0,0 +1,966 @@
+package service
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/AliceNetworks/gost-panel/internal/gost"
+	"github.com/AliceNetworks/gost-panel/internal/model"
+	"github.com/goccy/go-yaml"
+	"gorm.io/gorm"
+)
+
+// ==================== 原生 GOST 配置导入 ====================
+//
+// 将手写的 GOST v3 配置 (gost.yml) 转换为面板导入数据，是 ConfigGenerator 的逆过程：
+// 主服务映射为节点，转发服务映射为端口转发/隧道，带转发链的代理服务映射为代理链，
+// 分流/准入/主机映射/反向代理/路由/记录器/服务发现映射为绑定到该节点的规则。
+// 转换结果交给 ImportConfig 导入 (支持试运行和冲突策略)，无法表示的配置项逐项报告。
+
+// GOSTImportOptions 原生 GOST 配置导入选项
+type GOSTImportOptions struct {
+	NodeName string // 配置所属节点的名称，已存在时按冲突策略处理
+	Host     string // 节点公网地址 (GOST 配置中不包含)，为空时沿用同名节点的地址
+}
+
+// GOSTImportIssue 无法映射到面板资源的配置项
+type GOSTImportIssue struct {
+	Path    string `json:"path"` // 配置项路径，例如 services[1].handler.metadata
+	Message string `json:"message"`
+}
+
+// GOSTImportResult 原生 GOST 配置导入结果
+type GOSTImportResult struct {
+	*ImportResult
+	Unsupported []GOSTImportIssue `json:"unsupported"`
+}
+
+// ImportGOSTConfig 导入原生 GOST v3 配置 (YAML 或 JSON)
+func (s *Service) ImportGOSTConfig(content []byte, gostOpts GOSTImportOptions, opts ImportOptions) (*GOSTImportResult, error) {
+	data, issues, err := s.ConvertGOSTConfig(content, gostOpts)
+	if err != nil {
+		return nil, err
+	}
+	result, err := s.ImportConfig(data, opts)
+	if err != nil {
+		return nil, err
+	}
+	return &GOSTImportResult{ImportResult: result, Unsupported: issues}, nil
+}
+
+// ConvertGOSTConfig 将 GOST v3 配置转换为面板导入数据，同时返回无法表示的配置项
+func (s *Service) ConvertGOSTConfig(content []byte, opts GOSTImportOptions) (*ExportData, []GOSTImportIssue, error) {
+	opts.NodeName = strings.TrimSpace(opts.NodeName)
+	if opts.NodeName == "" {
+		return nil, nil, errors.New("node_name is required")
+	}
+	if opts.Host == "" {
+		var node model.Node
+		err := s.db.Where("name = ?", opts.NodeName).Order("id").First(&node).Error
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, nil, errors.New("host is required when importing into a new node")
+		} else if err != nil {
+			return nil, nil, err
+		}
+		opts.Host = node.Host
+	}
+
+	var raw map[string]interface{}
+	if err := yaml.Unmarshal(content, &raw); err != nil || raw == nil {
+		return nil, nil, errors.New("invalid GOST config (expected YAML or JSON)")
+	}
+
+	c := &gostConverter{
+		svc:        s,
+		opts:       opts,
+		data:       &ExportData{Version: ExportVersion, ExportAt: time.Now().Format(time.RFC3339)},
+		issues:     []GOSTImportIssue{},
+		named:      make(map[string]map[string]*gostObject),
+		referenced: make(map[*gostObject]bool),
+		authers:    make(map[string]bool),
+		speeds:     make(map[string]int64),
+		rates:      make(map[string]int),
+		chains:     make(map[string][]string),
+		stubs:      make(map[string]string),
+		tunnels:    make(map[string]int),
+	}
+	c.convert(c.object("", raw))
+	return c.data, c.issues, nil
+}
+
+// gostConverter 一次转换的状态
+type gostConverter struct {
+	svc    *Service
+	opts   GOSTImportOptions
+	data   *ExportData
+	issues []GOSTImportIssue
+
+	objects    []*gostObject                     // 所有已访问的配置对象，最后报告其中未处理的字段
+	named      map[string]map[string]*gostObject // 顶层命名配置: 分区 -> 名称 -> 配置
+	referenced map[*gostObject]bool              // 被服务引用过的命名配置
+
+	authers map[string]bool     // 已处理的认证器
+	speeds  map[string]int64    // 已解析的限速器
+	rates   map[string]int      // 已解析的连接速率限制器
+	chains  map[string][]string // 已解析的转发链 -> 各跳节点名称
+	stubs   map[string]string   // 转发链节点地址 -> 面板节点名称
+	tunnels map[string]int      // 隧道入口 (地址/转发链/目标) -> data.Tunnels 下标，用于合并 tcp+udp
+}
+
+// gostObject 带路径的配置对象，记录已处理的字段
+type gostObject struct {
+	path string
+	data map[string]interface{}
+	used map[string]bool
+}
+
+func (c *gostConverter) issue(path, format string, args ...interface{}) {
+	c.issues = append(c.issues, GOSTImportIssue{Path: path, Message: fmt.Sprintf(format, args...)})
+}
+
+// object 包装配置对象，非对象时报告并返回 nil
+func (c *gostConverter) object(path string, v interface{}) *gostObject {
+	m, ok := v.(map[string]interface{})
+	if !ok {
+		c.issue(path, "expected an object")
+		return nil
+	}
+	o := &gostObject{path: path, data: m, used: make(map[string]bool)}
+	c.objects = append(c.objects, o)
+	return o
+}
+
+// reject 整体跳过一个配置对象并报告原因
+func (c *gostConverter) reject(o *gostObject, format string, args ...interface{}) {
+	if o == nil {
+		return
+	}
+	o.discard()
+	c.issue(o.path, format, args...)
+}
+
+func joinPath(path, key string) string {
+	if path == "" {
+		return key
+	}
+	return path + "." + key
+}
+
+func (o *gostObject) has(key string) bool {
+	_, ok := o.data[key]
+	return ok
+}
+
+// peek 读取字段但不标记为已处理
+func (o *gostObject) peek(key string) string {
+	if v, ok := o.data[key]; ok && v != nil {
+		return fmt.Sprint(v)
+	}
+	return ""
+}
+
+func (o *gostObject) get(key string) (interface{}, bool) {
+	v, ok := o.data[key]
+	if ok {
+		o.used[key] = true
+	}
+	return v, ok && v != nil
+}
+
+func (o *gostObject) str(key string) string {
+	if v, ok := o.get(key); ok {
+		return fmt.Sprint(v)
+	}
+	return ""
+}
+
+func (o *gostObject) flag(key string) bool {
+	v, _ := o.get(key)
+	switch b := v.(type) {
+	case bool:
+		return b
+	case string:
+		parsed, _ := strconv.ParseBool(b)
+		return parsed
+	}
+	return false
+}
+
+func (o *gostObject) stringList(key string) []string {
+	v, ok := o.get(key)
+	if !ok {
+		return nil
+	}
+	items, _ := v.([]interface{})
+	list := make([]string, 0, len(items))
+	for _, item := range items {
+		list = append(list, fmt.Sprint(item))
+	}
+	return list
+}
+
+// skip 标记字段已处理 (面板会自动生成等价配置)
+func (o *gostObject) skip(keys ...string) {
+	for _, key := range keys {
+		if o.has(key) {
+			o.used[key] = true
+		}
+	}
+}
+
+// discard 标记全部字段已处理
+func (o *gostObject) discard() {
+	for key := range o.data {
+		o.used[key] = true
+	}
+}
+
+func (c *gostConverter) child(o *gostObject, key string) *gostObject {
+	v, ok := o.get(key)
+	if !ok {
+		return nil
+	}
+	return c.object(joinPath(o.path, key), v)
+}
+
+func (c *gostConverter) children(o *gostObject, key string) []*gostObject {
+	v, ok := o.get(key)
+	if !ok {
+		return nil
+	}
+	items, isList := v.([]interface{})
+	if !isList {
+		c.issue(joinPath(o.path, key), "expected a list")
+		return nil
+	}
+	list := make([]*gostObject, 0, len(items))
+	for i, item := range items {
+		if obj := c.object(fmt.Sprintf("%s[%d]", joinPath(o.path, key), i), item); obj != nil {
+			list = append(list, obj)
+		}
+	}
+	return list
+}
+
+// index 建立顶层命名配置的索引
+func (c *gostConverter) index(root *gostObject, section string) {
+	c.named[section] = make(map[string]*gostObject)
+	for _, item := range c.children(root, section) {
+		name := item.str("name")
+		if name == "" {
+			c.reject(item, "unnamed %s entry cannot be referenced", section)
+			continue
+		}
+		c.named[section][name] = item
+	}
+}
+
+// lookup 按名称查找顶层命名配置
+func (c *gostConverter) lookup(section, name, path string) *gostObject {
+	item, ok := c.named[section][name]
+	if !ok {
+		c.issue(path, "%s %q not found", section, name)
+		return nil
+	}
+	c.referenced[item] = true
+	return item
+}
+
+func (c *gostConverter) convert(root *gostObject) {
+	if root == nil {
+		return
+	}
+	for _, section := range []string{"authers", "limiters", "rlimiters", "resolvers", "chains", "hops"} {
+		c.index(root, section)
+	}
+
+	node := ExportNode{
+		Name:          c.opts.NodeName,
+		Host:          c.opts.Host,
+		APIPort:       18080,
+		Protocol:      "socks5",
+		Transport:     "tcp",
+		QuotaResetDay: 1,
+	}
+
+	if api := c.child(root, "api"); api != nil {
+		node.APIPort = c.port(api, "addr")
+		if auth := c.child(api, "auth"); auth != nil {
+			node.APIUser = auth.str("username")
+			node.APIPass = auth.str("password")
+		}
+	}
+	// 面板总是生成 metrics 和 stats-observer
+	if metrics := c.child(root, "metrics"); metrics != nil {
+		metrics.skip("addr")
+	}
+	for _, observer := range c.children(root, "observers") {
+		if observer.peek("name") == "stats-observer" {
+			observer.discard()
+		} else {
+			c.reject(observer, "custom observers are not supported")
+		}
+	}
+
+	hasMain := false
+	for i, svc := range c.children(root, "services") {
+		handler := c.child(svc, "handler")
+		if handler == nil {
+			c.reject(svc, "service without handler is skipped")
+			continue
+		}
+		listener := c.child(svc, "listener")
+		if listener == nil {
+			listener = c.object(joinPath(svc.path, "listener"), map[string]interface{}{})
+		}
+		hType := handler.peek("type")
+		forwarding := svc.has("forwarder")
+
+		switch {
+		case forwarding && (hType == "tcp" || hType == "udp") && handler.has("chain"):
+			c.convertTunnel(svc, handler, listener)
+		case forwarding && (hType == "tcp" || hType == "udp" || hType == "rtcp" || hType == "rudp"):
+			c.convertPortForward(i, svc, handler, listener)
+		case handler.has("chain"):
+			c.convertProxyChain(i, svc, handler, listener)
+		case !hasMain:
+			c.convertMainService(&node, svc, handler, listener)
+			hasMain = true
+		default:
+			handler.discard()
+			listener.discard()
+			c.reject(svc, "only one proxy service per node is supported, additional service skipped")
+		}
+	}
+	if !hasMain {
+		c.issue("services", "no proxy service found, node uses the default socks5 service")
+	}
+	c.data.Nodes = append([]ExportNode{node}, c.data.Nodes...)
+
+	c.convertRules(root)
+
+	// 未被任何服务引用的命名配置无法单独表示
+	for _, section := range []string{"authers", "limiters", "rlimiters", "resolvers", "chains", "hops"} {
+		names := make([]string, 0, len(c.named[section]))
+		for name := range c.named[section] {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			if item := c.named[section][name]; !c.referenced[item] {
+				c.reject(item, "not referenced by any imported service, skipped")
+			}
+		}
+	}
+
+	// 报告所有未处理的字段
+	for _, o := range c.objects {
+		keys := make([]string, 0, len(o.data))
+		for key := range o.data {
+			if !o.used[key] {
+				keys = append(keys, key)
+			}
+		}
+		sort.Strings(keys)
+		for _, key := range keys {
+			c.issue(joinPath(o.path, key), "not supported by the panel, skipped")
+		}
+	}
+}
+
+// convertMainService 主服务映射为节点配置 (generateMainService 的逆过程)
+func (c *gostConverter) convertMainService(node *ExportNode, svc, handler, listener *gostObject) {
+	svc.skip("name", "observer", "recorders") // 记录器引用由面板按节点记录器生成
+	node.Port = c.port(svc, "addr")
+
+	node.Protocol = handler.str("type")
+	handler.skip("observer")
+	if auth := c.child(handler, "auth"); auth != nil {
+		if node.Protocol == "ss" || node.Protocol == "ssu" {
+			node.SSMethod = auth.str("username")
+			node.SSPassword = auth.str("password")
+		} else {
+			node.ProxyUser = auth.str("username")
+			node.ProxyPass = auth.str("password")
+		}
+	}
+	if name := handler.str("auther"); name != "" {
+		c.applyAuther(node, name, joinPath(handler.path, "auther"))
+	}
+	for _, name := range handler.stringList("authers") {
+		c.applyAuther(node, name, joinPath(handler.path, "authers"))
+	}
+	if md := c.child(handler, "metadata"); md != nil {
+		switch node.Protocol {
+		case "socks5":
+			md.skip("bind", "udp", "udpBufferSize")
+		case "tun", "tap":
+			if md.peek("net") == "198.18.0.0/15" {
+				md.skip("net")
+			}
+		}
+		if probe := md.str("probeResist"); probe != "" {
+			node.ProbeResist, node.ProbeResistValue, _ = strings.Cut(probe, ":")
+		}
+	}
+	if name := handler.str("resolver"); name != "" {
+		c.applyResolver(node, name, joinPath(handler.path, "resolver"))
+	}
+	// 分流/主机映射/准入规则本身作为节点规则导入，面板会自动挂载到主服务
+	handler.skip("bypass", "hosts")
+	svc.skip("admission")
+
+	lType := listener.str("type")
+	switch node.Protocol {
+	case "sshd", "redirect", "redu", "tun", "tap", "http2":
+		node.Transport = "tcp" // 监听器类型由协议决定
+	default:
+		if lType != "" {
+			node.Transport = lType
+		}
+	}
+	if tls := c.child(listener, "tls"); tls != nil {
+		c.applyTLS(node, tls)
+	}
+	if md := c.child(listener, "metadata"); md != nil {
+		node.WSPath = md.str("path")
+		node.WSHost = md.str("host")
+		if v, ok := md.get("proxyProtocol"); ok {
+			if b, isBool := v.(bool); isBool {
+				if b {
+					node.ProxyProtocol = 1
+				}
+			} else if n, isNum := gostInt(v); isNum {
+				node.ProxyProtocol = int(n)
+			}
+		}
+		if kcp := c.child(md, "kcp"); kcp != nil {
+			kcp.discard()
+			if opts, err := json.Marshal(map[string]interface{}{"kcp": kcp.data}); err == nil {
+				node.TransportOpts = string(opts)
+			}
+		}
+	}
+
+	if name := svc.str("limiter"); name != "" {
+		node.SpeedLimit = c.speedLimit(name, joinPath(svc.path, "limiter"))
+	}
+	if name := svc.str("rlimiter"); name != "" {
+		node.ConnRateLimit = c.rateLimit(name, joinPath(svc.path, "rlimiter"))
+	}
+}
+
+// convertPortForward 转发服务映射为端口转发 (GeneratePortForwardConfig 的逆过程)
+func (c *gostConverter) convertPortForward(i int, svc, handler, listener *gostObject) {
+	pf := ExportPortForward{
+		Name:      svc.str("name"),
+		NodeName:  c.opts.NodeName,
+		Type:      handler.str("type"),
+		LocalAddr: svc.str("addr"),
+		Enabled:   true,
+	}
+	if pf.Name == "" {
+		pf.Name = fmt.Sprintf("%s-forward-%d", c.opts.NodeName, i)
+	}
+	svc.skip("observer")
+	if lType := listener.str("type"); lType != "" && lType != pf.Type {
+		c.issue(joinPath(listener.path, "type"), "listener type %q differs from handler type %q, the panel uses the handler type for both", lType, pf.Type)
+	}
+	pf.RemoteAddr = c.forwardTarget(svc)
+	if name := listener.str("chain"); name != "" {
+		if pf.Type == "rtcp" || pf.Type == "rudp" {
+			pf.ChainName = c.chainRef(name, joinPath(listener.path, "chain"))
+		} else {
+			c.issue(joinPath(listener.path, "chain"), "listener chain is only supported for rtcp/rudp forwards")
+		}
+	}
+	c.data.PortForwards = append(c.data.PortForwards, pf)
+}
+
+// convertTunnel 带转发链的 tcp/udp 转发服务映射为隧道 (GenerateTunnelEntryConfig 的逆过程)
+// 同一入口地址、转发链和目标的 tcp 与 udp 服务合并为一条 tcp+udp 隧道
+func (c *gostConverter) convertTunnel(svc, handler, listener *gostObject) {
+	proto := handler.str("type")
+	chainName := handler.str("chain")
+	addr := svc.str("addr")
+	name := strings.TrimSuffix(svc.str("name"), "-"+proto)
+	svc.skip("observer")
+	if lType := listener.str("type"); lType != "" && lType != proto {
+		c.issue(joinPath(listener.path, "type"), "listener type %q differs from handler type %q, the panel uses the handler type for both", lType, proto)
+	}
+	target := c.forwardTarget(svc)
+
+	var speed int64
+	if limiter := svc.str("limiter"); limiter != "" {
+		speed = c.speedLimit(limiter, joinPath(svc.path, "limiter"))
+	}
+
+	key := addr + "|" + chainName + "|" + target
+	if idx, ok := c.tunnels[key]; ok {
+		if t := &c.data.Tunnels[idx]; t.Protocol != proto {
+			t.Protocol = "tcp+udp"
+		}
+		return
+	}
+
+	nodes := c.chainNodes(chainName, joinPath(handler.path, "chain"))
+	if len(nodes) == 0 {
+		c.issue(svc.path, "tunnel chain %q has no usable hops, service skipped", chainName)
+		return
+	}
+	if name == "" {
+		name = fmt.Sprintf("%s-tunnel-%d", c.opts.NodeName, len(c.data.Tunnels)+1)
+	}
+	tunnel := ExportTunnel{
+		Name:          name,
+		EntryNode:     c.opts.NodeName,
+		EntryPort:     c.port(&gostObject{data: map[string]interface{}{"addr": addr}, used: map[string]bool{}}, "addr"),
+		Protocol:      proto,
+		ExitNode:      nodes[len(nodes)-1],
+		TargetAddr:    target,
+		Enabled:       true,
+		QuotaResetDay: 1,
+		SpeedLimit:    speed,
+	}
+	for _, hop := range nodes[:len(nodes)-1] {
+		tunnel.Hops = append(tunnel.Hops, ExportTunnelHop{NodeName: hop})
+	}
+	c.tunnels[key] = len(c.data.Tunnels)
+	c.data.Tunnels = append(c.data.Tunnels, tunnel)
+}
+
+// convertProxyChain 带转发链的代理服务映射为代理链 (GenerateProxyChainFullConfig 的逆过程)
+func (c *gostConverter) convertProxyChain(i int, svc, handler, listener *gostObject) {
+	chain := ExportProxyChain{
+		Name:       svc.str("name"),
+		ListenAddr: svc.str("addr"),
+		ListenType: handler.str("type"),
+		Enabled:    true,
+	}
+	if chain.Name == "" {
+		chain.Name = fmt.Sprintf("%s-chain-%d", c.opts.NodeName, i)
+	}
+	svc.skip("observer")
+	if lType := listener.str("type"); lType != "" && lType != "tcp" {
+		c.issue(joinPath(listener.path, "type"), "proxy chains always listen on tcp, listener type %q ignored", lType)
+	}
+	if svc.has("forwarder") {
+		chain.TargetAddr = c.forwardTarget(svc)
+	}
+	chainName := handler.str("chain")
+	for _, hop := range c.chainNodes(chainName, joinPath(handler.path, "chain")) {
+		chain.Hops = append(chain.Hops, ExportChainHop{NodeName: hop, Enabled: true})
+	}
+	c.data.ProxyChains = append(c.data.ProxyChains, chain)
+}
+
+// chainRef 端口转发引用的转发链映射为代理链，返回代理链名称
+func (c *gostConverter) chainRef(name, path string) string {
+	for _, chain := range c.data.ProxyChains {
+		if chain.Name == name {
+			return name
+		}
+	}
+	nodes := c.chainNodes(name, path)
+	if len(nodes) == 0 {
+		return ""
+	}
+	chain := ExportProxyChain{Name: name, ListenType: "socks5", Enabled: true}
+	for _, hop := range nodes {
+		chain.Hops = append(chain.Hops, ExportChainHop{NodeName: hop, Enabled: true})
+	}
+	c.data.ProxyChains = append(c.data.ProxyChains, chain)
+	return name
+}
+
+// forwardTarget 读取转发目标，面板只支持单个目标
+func (c *gostConverter) forwardTarget(svc *gostObject) string {
+	forwarder := c.child(svc, "forwarder")
+	if forwarder == nil {
+		return ""
+	}
+	target := ""
+	for j, n := range c.children(forwarder, "nodes") {
+		if j > 0 {
+			c.reject(n, "only one forward target is supported, additional target skipped")
+			continue
+		}
+		n.skip("name")
+		target = n.str("addr")
+	}
+	return target
+}
+
+// chainNodes 将转发链的各跳映射为面板节点名称 (每跳只取第一个节点)
+func (c *gostConverter) chainNodes(name, path string) []string {
+	if nodes, ok := c.chains[name]; ok {
+		return nodes
+	}
+	chain := c.lookup("chains", name, path)
+	if chain == nil {
+		return nil
+	}
+
+	nodes := []string{}
+	for _, hop := range c.children(chain, "hops") {
+		// 跳点可以只写名称，引用顶层 hops 中的定义
+		if !hop.has("nodes") {
+			hopName := hop.str("name")
+			ref := c.lookup("hops", hopName, hop.path)
+			if ref == nil {
+				continue
+			}
+			hop = ref
+		}
+		hop.skip("name")
+		for j, n := range c.children(hop, "nodes") {
+			if j > 0 {
+				c.reject(n, "only one node per hop is supported, additional node skipped")
+				continue
+			}
+			if nodeName := c.hopNode(n); nodeName != "" {
+				nodes = append(nodes, nodeName)
+			}
+		}
+	}
+	c.chains[name] = nodes
+	return nodes
+}
+
+// hopNode 将转发链中的节点映射为面板节点：按地址匹配已有节点，否则新建节点
+func (c *gostConverter) hopNode(n *gostObject) string {
+	n.skip("name")
+	addr := n.str("addr")
+	host, portStr, err := net.SplitHostPort(addr)
+	port, _ := strconv.Atoi(portStr)
+	if err != nil || host == "" || port == 0 {
+		c.reject(n, "invalid node address %q", addr)
+		return ""
+	}
+	if name, ok := c.stubs[addr]; ok {
+		n.discard()
+		return name
+	}
+
+	var existing model.Node
+	if err := c.svc.db.Where("host = ? AND port = ?", host, port).Order("id").First(&existing).Error; err == nil {
+		n.discard() // 连接参数以面板中的节点为准
+		c.stubs[addr] = existing.Name
+		return existing.Name
+	}
+
+	node := ExportNode{
+		Name:          addr,
+		Host:          host,
+		Port:          port,
+		APIPort:       18080,
+		Protocol:      "socks5",
+		Transport:     "tcp",
+		QuotaResetDay: 1,
+	}
+	if connector := c.child(n, "connector"); connector != nil {
+		if t := connector.str("type"); t != "" {
+			node.Protocol = t
+		}
+		if auth := c.child(connector, "auth"); auth != nil {
+			node.ProxyUser = auth.str("username")
+			node.ProxyPass = auth.str("password")
+		}
+	}
+	if dialer := c.child(n, "dialer"); dialer != nil {
+		if t := dialer.str("type"); t != "" {
+			node.Transport = t
+		}
+		if tls := c.child(dialer, "tls"); tls != nil {
+			c.applyTLS(&node, tls)
+		}
+	}
+	c.stubs[addr] = node.Name
+	c.data.Nodes = append(c.data.Nodes, node)
+	return node.Name
+}
+
+// applyAuther 认证器的第一个账号作为节点代理账号
+func (c *gostConverter) applyAuther(node *ExportNode, name, path string) {
+	if c.authers[name] {
+		return
+	}
+	c.authers[name] = true
+	auther := c.lookup("authers", name, path)
+	if auther == nil {
+		return
+	}
+	if plugin := c.child(auther, "plugin"); plugin != nil {
+		if gost.IsAuthPluginURL(plugin.peek("addr")) {
+			plugin.discard() // 面板生成的用户凭据认证插件
+		} else {
+			c.reject(plugin, "auth plugins are not supported")
+		}
+	}
+	for _, auth := range c.children(auther, "auths") {
+		if node.ProxyUser != "" {
+			c.reject(auth, "only one proxy account per node is supported, use proxy credentials for additional users")
+			continue
+		}
+		node.ProxyUser = auth.str("username")
+		node.ProxyPass = auth.str("password")
+	}
+}
+
+// applyResolver DNS 解析器的第一个服务器作为节点 DNS
+func (c *gostConverter) applyResolver(node *ExportNode, name, path string) {
+	resolver := c.lookup("resolvers", name, path)
+	if resolver == nil {
+		return
+	}
+	for j, ns := range c.children(resolver, "nameservers") {
+		if j > 0 {
+			c.reject(ns, "only one DNS server per node is supported, additional server skipped")
+			continue
+		}
+		ns.skip("prefer")
+		node.DNSServer = ns.str("addr")
+	}
+}
+
+// applyTLS 读取 TLS 配置 (generateTLSConfig 的逆过程)
+func (c *gostConverter) applyTLS(node *ExportNode, tls *gostObject) {
+	node.TLSEnabled = true
+	node.TLSCertFile = tls.str("certFile")
+	node.TLSKeyFile = tls.str("keyFile")
+	node.TLSSNI = tls.str("serverName")
+	node.TLSALPN = strings.Join(tls.stringList("alpn"), ",")
+}
+
+// speedRe GOST 限速值，例如 10MB、1.50GB、512KB
+var speedRe = regexp.MustCompile(`(?i)^([0-9]+(?:\.[0-9]+)?)\s*([KMG]?)B$`)
+
+// speedLimit 解析限速器，只支持服务级 ($) 限速
+func (c *gostConverter) speedLimit(name, path string) int64 {
+	if speed, ok := c.speeds[name]; ok {
+		return speed
+	}
+	var speed int64
+	if limiter := c.lookup("limiters", name, path); limiter != nil {
+		for j, entry := range limiter.stringList("limits") {
+			entryPath := fmt.Sprintf("%s.limits[%d]", limiter.path, j)
+			fields := strings.Fields(entry)
+			if len(fields) < 2 || fields[0] != "$" {
+				c.issue(entryPath, "only service-level ($) limits are supported, %q skipped", entry)
+				continue
+			}
+			if len(fields) > 2 && fields[2] != fields[1] {
+				c.issue(entryPath, "separate input/output limits are not supported, using %s for both", fields[1])
+			}
+			m := speedRe.FindStringSubmatch(fields[1])
+			if m == nil {
+				c.issue(entryPath, "unrecognized rate %q", fields[1])
+				continue
+			}
+			value, _ := strconv.ParseFloat(m[1], 64)
+			switch strings.ToUpper(m[2]) {
+			case "K":
+				value *= 1024
+			case "M":
+				value *= 1024 * 1024
+			case "G":
+				value *= 1024 * 1024 * 1024
+			}
+			speed = int64(value)
+		}
+	}
+	c.speeds[name] = speed
+	return speed
+}
+
+// rateLimit 解析连接速率限制器，只支持服务级 ($) 每秒连接数
+func (c *gostConverter) rateLimit(name, path string) int {
+	if rate, ok := c.rates[name]; ok {
+		return rate
+	}
+	rate := 0
+	if limiter := c.lookup("rlimiters", name, path); limiter != nil {
+		for j, entry := range limiter.stringList("limits") {
+			fields := strings.Fields(entry)
+			value := ""
+			if len(fields) == 2 && fields[0] == "$" {
+				value = strings.TrimSuffix(fields[1], "/s")
+			}
+			n, err := strconv.Atoi(value)
+			if err != nil {
+				c.issue(fmt.Sprintf("%s.limits[%d]", limiter.path, j), "only service-level ($) per-second limits are supported, %q skipped", entry)
+				continue
+			}
+			rate = n
+		}
+	}
+	c.rates[name] = rate
+	return rate
+}
+
+// port 读取监听地址中的端口，面板总是监听所有地址
+func (c *gostConverter) port(o *gostObject, key string) int {
+	addr := o.str(key)
+	host, portStr, err := net.SplitHostPort(addr)
+	port, convErr := strconv.Atoi(portStr)
+	if err != nil || convErr != nil {
+		c.issue(joinPath(o.path, key), "invalid listen address %q", addr)
+		return 0
+	}
+	if host != "" && host != "0.0.0.0" && host != "::" {
+		c.issue(joinPath(o.path, key), "the panel listens on all addresses, bind address %q ignored", host)
+	}
+	return port
+}
+
+// convertRules 顶层规则映射为绑定到该节点的规则资源
+func (c *gostConverter) convertRules(root *gostObject) {
+	node := c.opts.NodeName
+	ruleName := func(o *gostObject, section string, i int) string {
+		if name := o.str("name"); name != "" {
+			return name
+		}
+		return fmt.Sprintf("%s-%s-%d", node, section, i)
+	}
+	marshal := func(v interface{}) string {
+		data, _ := json.Marshal(v)
+		return string(data)
+	}
+
+	for i, b := range c.children(root, "bypasses") {
+		c.data.Bypasses = append(c.data.Bypasses, ExportBypass{
+			Name:      ruleName(b, "bypass", i),
+			Whitelist: b.flag("whitelist"),
+			Matchers:  marshal(b.stringList("matchers")),
+			NodeName:  node,
+		})
+	}
+
+	for i, a := range c.children(root, "admissions") {
+		c.data.Admissions = append(c.data.Admissions, ExportAdmission{
+			Name:      ruleName(a, "admission", i),
+			Whitelist: a.flag("whitelist"),
+			Matchers:  marshal(a.stringList("matchers")),
+			NodeName:  node,
+		})
+	}
+
+	for i, h := range c.children(root, "hosts") {
+		mappings := []map[string]string{}
+		for _, m := range c.children(h, "mappings") {
+			ip, prefer := m.str("ip"), m.str("prefer")
+			hostnames := append([]string{m.str("hostname")}, m.stringList("aliases")...)
+			for _, hostname := range hostnames {
+				entry := map[string]string{"hostname": hostname, "ip": ip}
+				if prefer != "" {
+					entry["prefer"] = prefer
+				}
+				mappings = append(mappings, entry)
+			}
+		}
+		c.data.HostMappings = append(c.data.HostMappings, ExportHostMapping{
+			Name:     ruleName(h, "hosts", i),
+			Mappings: marshal(mappings),
+			NodeName: node,
+		})
+	}
+
+	for i, in := range c.children(root, "ingresses") {
+		rules := []map[string]string{}
+		for _, r := range c.children(in, "rules") {
+			rules = append(rules, map[string]string{"hostname": r.str("hostname"), "endpoint": r.str("endpoint")})
+		}
+		c.data.Ingresses = append(c.data.Ingresses, ExportIngress{
+			Name:     ruleName(in, "ingress", i),
+			Rules:    marshal(rules),
+			NodeName: node,
+		})
+	}
+
+	for i, r := range c.children(root, "routers") {
+		routes := []map[string]string{}
+		for _, rt := range c.children(r, "routes") {
+			routes = append(routes, map[string]string{"net": rt.str("net"), "gateway": rt.str("gateway")})
+		}
+		c.data.Routers = append(c.data.Routers, ExportRouter{
+			Name:     ruleName(r, "router", i),
+			Routes:   marshal(routes),
+			NodeName: node,
+		})
+	}
+
+	for i, r := range c.children(root, "recorders") {
+		name := ruleName(r, "recorder", i)
+		converted := false
+		for _, kind := range []string{"file", "redis", "http"} {
+			opts := c.child(r, kind)
+			if opts == nil {
+				continue
+			}
+			if converted {
+				c.reject(opts, "a recorder can only have one backend")
+				continue
+			}
+			opts.discard()
+			config := make(map[string]interface{}, len(opts.data))
+			for k, v := range opts.data {
+				config[k] = v
+			}
+			// 面板以秒为单位保存超时时间
+			if timeout, ok := config["timeout"].(string); ok {
+				if d, err := time.ParseDuration(timeout); err == nil {
+					config["timeout"] = int(d.Seconds())
+				}
+			}
+			c.data.Recorders = append(c.data.Recorders, ExportRecorder{Name: name, Type: kind, Config: marshal(config), NodeName: node})
+			converted = true
+		}
+		if !converted {
+			c.issue(r.path, "only file/redis/http recorders are supported")
+		}
+	}
+
+	for i, sd := range c.children(root, "sds") {
+		plugin := c.child(sd, "plugin")
+		if plugin == nil || plugin.peek("type") != "http" {
+			if plugin != nil {
+				plugin.discard()
+			}
+			c.reject(sd, "only http plugin service discovery is supported")
+			continue
+		}
+		plugin.skip("type")
+		config := map[string]interface{}{"url": plugin.str("addr")}
+		if timeout := plugin.str("timeout"); timeout != "" {
+			if d, err := time.ParseDuration(timeout); err == nil {
+				config["timeout"] = int(d.Seconds())
+			}
+		}
+		c.data.SDs = append(c.data.SDs, ExportSD{Name: ruleName(sd, "sd", i), Type: "http", Config: marshal(config), NodeName: node})
+	}
+}
+
+// gostInt 将 YAML/JSON 解析出的数字转换为整数
+func gostInt(v interface{}) (int64, bool) {
+	switch n := v.(type) {
+	case int:
+		return int64(n), true
+	case int64:
+		return n, true
+	case uint64:
+		return int64(n), true
+	case float64:
+		return int64(n), true
+	case string:
+		i, err := strconv.ParseInt(n, 10, 64)
+		return i, err == nil
+	}
+	return 0, false
+}
@@ -0,0 +1,323 @@
+package service
+
+import (
+	"reflect"
+	"sort"
+	"testing"
+
+	"github.com/AliceNetworks/gost-panel/internal/model"
+)
+
+func issuePaths(issues []GOSTImportIssue) []string {
+	paths := make([]string, 0, len(issues))
+	for _, issue := range issues {
+		paths = append(paths, issue.Path)
+	}
+	sort.Strings(paths)
+	return paths
+}
+
+// 配置项映射为面板资源，无法表示的配置项逐项报告 (每项只报告一次)
+func TestConvertGOSTConfig(t *testing.T) {
+	tests := []struct {
+		name        string
+		config      string
+		check       func(t *testing.T, data *ExportData)
+		unsupported []string // 报告为无法表示的配置项路径
+	}{
+		{
+			name: "main service",
+			config: `
+api:
+  addr: ":18090"
+  auth: {username: admin, password: secret}
+metrics: {addr: ":9000"}
+observers:
+  - name: stats-observer
+    plugin: {type: grpc}
+services:
+  - name: main-service
+    addr: ":1080"
+    observer: stats-observer
+    limiter: speed
+    rlimiter: rate
+    handler:
+      type: socks5
+      auther: users
+      metadata: {udp: true}
+    listener:
+      type: ws
+      metadata: {path: /ws}
+authers:
+  - name: users
+    auths:
+      - {username: alice, password: pw}
+limiters:
+  - name: speed
+    limits: ["$ 10MB"]
+rlimiters:
+  - name: rate
+    limits: ["$ 20/s"]
+bypasses:
+  - name: cn
+    whitelist: true
+    matchers: ["*.cn"]
+`,
+			check: func(t *testing.T, data *ExportData) {
+				if len(data.Nodes) != 1 {
+					t.Fatalf("got %d nodes, want 1", len(data.Nodes))
+				}
+				got := data.Nodes[0]
+				want := ExportNode{
+					Name: "edge", Host: "203.0.113.1", Port: 1080,
+					APIPort: 18090, APIUser: "admin", APIPass: "secret",
+					Protocol: "socks5", Transport: "ws", WSPath: "/ws",
+					ProxyUser: "alice", ProxyPass: "pw",
+					SpeedLimit: 10 * 1024 * 1024, ConnRateLimit: 20,
+					QuotaResetDay: 1,
+				}
+				if !reflect.DeepEqual(got, want) {
+					t.Errorf("node = %+v, want %+v", got, want)
+				}
+				if len(data.Bypasses) != 1 || data.Bypasses[0].Name != "cn" || !data.Bypasses[0].Whitelist ||
+					data.Bypasses[0].Matchers != `["*.cn"]` || data.Bypasses[0].NodeName != "edge" {
+					t.Errorf("bypasses = %+v", data.Bypasses)
+				}
+			},
+		},
+		{
+			name: "forwards and tunnels",
+			config: `
+services:
+  - name: web
+    addr: ":8080"
+    handler: {type: tcp}
+    listener: {type: tcp}
+    forwarder:
+      nodes:
+        - {name: target, addr: "10.0.0.5:80"}
+  - name: game-tcp
+    addr: ":9000"
+    limiter: speed
+    handler: {type: tcp, chain: to-exit}
+    listener: {type: tcp}
+    forwarder:
+      nodes: [{addr: "10.0.0.6:27015"}]
+  - name: game-udp
+    addr: ":9000"
+    handler: {type: udp, chain: to-exit}
+    listener: {type: udp}
+    forwarder:
+      nodes: [{addr: "10.0.0.6:27015"}]
+chains:
+  - name: to-exit
+    hops:
+      - name: relay
+      - name: exit
+        nodes:
+          - name: exit-0
+            addr: "198.51.100.2:8443"
+            connector: {type: relay}
+            dialer: {type: tls}
+hops:
+  - name: relay
+    nodes:
+      - {name: relay-0, addr: "198.51.100.1:1080"}
+limiters:
+  - name: speed
+    limits: ["$ 1.5MB"]
+`,
+			check: func(t *testing.T, data *ExportData) {
+				want := []ExportPortForward{{Name: "web", NodeName: "edge", Type: "tcp", LocalAddr: ":8080", RemoteAddr: "10.0.0.5:80", Enabled: true}}
+				if !reflect.DeepEqual(data.PortForwards, want) {
+					t.Errorf("port forwards = %+v, want %+v", data.PortForwards, want)
+				}
+				// 同一入口和目标的 tcp 与 udp 服务合并为一条隧道
+				if len(data.Tunnels) != 1 {
+					t.Fatalf("got %d tunnels, want 1", len(data.Tunnels))
+				}
+				tunnel := data.Tunnels[0]
+				if tunnel.Name != "game" || tunnel.Protocol != "tcp+udp" || tunnel.EntryPort != 9000 ||
+					tunnel.TargetAddr != "10.0.0.6:27015" || tunnel.SpeedLimit != 1536*1024 {
+					t.Errorf("tunnel = %+v", tunnel)
+				}
+				if tunnel.ExitNode != "198.51.100.2:8443" || len(tunnel.Hops) != 1 || tunnel.Hops[0].NodeName != "198.51.100.1:1080" {
+					t.Errorf("tunnel route = %s via %+v", tunnel.ExitNode, tunnel.Hops)
+				}
+				// 转发链中的未知节点新建为面板节点
+				if len(data.Nodes) != 3 {
+					t.Fatalf("got %d nodes, want entry node and two hop nodes", len(data.Nodes))
+				}
+				if exit := data.Nodes[2]; exit.Host != "198.51.100.2" || exit.Port != 8443 || exit.Protocol != "relay" || exit.Transport != "tls" {
+					t.Errorf("exit node = %+v", exit)
+				}
+			},
+			unsupported: []string{"services"}, // 没有主服务
+		},
+		{
+			name: "existing hop node and proxy chain",
+			config: `
+services:
+  - name: main
+    addr: ":1080"
+    handler: {type: http}
+  - name: via-hk
+    addr: ":7890"
+    handler: {type: socks5, chain: hk}
+chains:
+  - name: hk
+    hops:
+      - name: hop-0
+        nodes:
+          - name: node-0
+            addr: "192.0.2.10:443"
+            connector: {type: http2}
+`,
+			check: func(t *testing.T, data *ExportData) {
+				if len(data.Nodes) != 1 || data.Nodes[0].Protocol != "http" || data.Nodes[0].Port != 1080 {
+					t.Fatalf("nodes = %+v, want only the imported node", data.Nodes)
+				}
+				want := []ExportProxyChain{{
+					Name: "via-hk", ListenAddr: ":7890", ListenType: "socks5", Enabled: true,
+					Hops: []ExportChainHop{{NodeName: "hk-node", Enabled: true}},
+				}}
+				if !reflect.DeepEqual(data.ProxyChains, want) {
+					t.Errorf("proxy chains = %+v, want %+v", data.ProxyChains, want)
+				}
+			},
+		},
+		{
+			name: "unsupported items are reported",
+			config: `
+observers:
+  - name: custom
+    plugin: {type: grpc, addr: "127.0.0.1:8000"}
+services:
+  - name: main
+    addr: "127.0.0.1:1080"
+    limiter: per-ip
+    handler:
+      type: socks5
+      retries: 3
+      auther: users
+    forwarder-typo: x
+  - name: second
+    addr: ":1081"
+    handler: {type: http}
+  - name: forward
+    addr: ":2000"
+    handler: {type: tcp}
+    forwarder:
+      nodes:
+        - {addr: "10.0.0.1:22"}
+        - {addr: "10.0.0.2:22"}
+  - name: broken
+    addr: ":3000"
+    handler: {type: socks5, chain: missing}
+  - addr: ":4000"
+authers:
+  - name: users
+    plugin: {type: http, addr: "http://auth.example.com"}
+    auths:
+      - {username: a, password: a}
+      - {username: b, password: b}
+  - name: unused
+    auths: [{username: c, password: c}]
+limiters:
+  - name: per-ip
+    limits: ["$ 10MB", "192.168.1.1 1MB"]
+sds:
+  - name: consul
+    plugin: {type: grpc, addr: "127.0.0.1:8500"}
+log: {level: debug}
+`,
+			check: func(t *testing.T, data *ExportData) {
+				node := data.Nodes[0]
+				if node.Port != 1080 || node.ProxyUser != "a" || node.SpeedLimit != 10*1024*1024 {
+					t.Errorf("node = %+v", node)
+				}
+				if len(data.PortForwards) != 1 || data.PortForwards[0].RemoteAddr != "10.0.0.1:22" {
+					t.Errorf("port forwards = %+v, want only the first target", data.PortForwards)
+				}
+				if len(data.ProxyChains) != 1 || len(data.ProxyChains[0].Hops) != 0 {
+					t.Errorf("proxy chains = %+v, want broken chain without hops", data.ProxyChains)
+				}
+				if len(data.SDs) != 0 {
+					t.Errorf("sds = %+v, want none", data.SDs)
+				}
+			},
+			unsupported: []string{
+				"authers[0].auths[1]",            // 节点只有一个代理账号
+				"authers[0].plugin",              // 非面板生成的认证插件
+				"authers[1]",                     // 未被引用
+				"limiters[0].limits[1]",          // 非服务级限速
+				"log",                            // 未知的顶层字段
+				"observers[0]",                   // 自定义观察器
+				"sds[0]",                         // 非 http 服务发现
+				"services[0].addr",               // 绑定地址
+				"services[0].forwarder-typo",     // 未知字段
+				"services[0].handler.retries",    // 未知字段
+				"services[1]",                    // 第二个代理服务
+				"services[2].forwarder.nodes[1]", // 多个转发目标
+				"services[3].handler.chain",      // 未定义的转发链
+				"services[4]",                    // 没有处理器
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := newTestDBService(t)
+			if err := s.db.Create(&model.Node{Name: "hk-node", Host: "192.0.2.10", Port: 443, AgentToken: "hk"}).Error; err != nil {
+				t.Fatal(err)
+			}
+			data, issues, err := s.ConvertGOSTConfig([]byte(tt.config), GOSTImportOptions{NodeName: "edge", Host: "203.0.113.1"})
+			if err != nil {
+				t.Fatal(err)
+			}
+			tt.check(t, data)
+			want := tt.unsupported
+			if want == nil {
+				want = []string{}
+			}
+			if got := issuePaths(issues); !reflect.DeepEqual(got, want) {
+				t.Errorf("unsupported = %v, want %v", issues, want)
+			}
+		})
+	}
+}
+
+// 没有节点名称、新节点没有地址或配置无法解析时拒绝转换；导入到已有节点时沿用其地址
+func TestConvertGOSTConfigOptions(t *testing.T) {
+	s := newTestDBService(t)
+	if err := s.db.Create(&model.Node{Name: "edge", Host: "203.0.113.1", AgentToken: "edge"}).Error; err != nil {
+		t.Fatal(err)
+	}
+	config := []byte("services:\n  - {name: main, addr: \":1080\", handler: {type: socks5}}\n")
+
+	for _, tt := range []struct {
+		content []byte
+		opts    GOSTImportOptions
+	}{
+		{config, GOSTImportOptions{NodeName: " "}},
+		{config, GOSTImportOptions{NodeName: "new"}},
+		{[]byte("services: ["), GOSTImportOptions{NodeName: "edge"}},
+		{[]byte("- a\n- b\n"), GOSTImportOptions{NodeName: "edge"}},
+	} {
+		if _, _, err := s.ConvertGOSTConfig(tt.content, tt.opts); err == nil {
+			t.Errorf("ConvertGOSTConfig(%q, %+v) succeeded, want error", tt.content, tt.opts)
+		}
+	}
+
+	// JSON 也是合法的 YAML
+	data, issues, err := s.ConvertGOSTConfig([]byte(`{"services":[{"name":"main","addr":":1080","handler":{"type":"socks5"}}]}`), GOSTImportOptions{NodeName: "edge"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(issues) != 0 {
+		t.Errorf("unsupported = %v, want none", issues)
+	}
+	if node := data.Nodes[0]; node.Name != "edge" || node.Host != "203.0.113.1" || node.Port != 1080 {
+		t.Errorf("node = %+v, want existing host", node)
+	}
+}
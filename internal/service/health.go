@@ -16,6 +16,12 @@ type HealthChecker struct {
 	alertService interface {
 		TriggerAlert(alertType, targetType string, targetID uint, targetName, message string)
 	}
+	leader interface {
+		IsLeader() bool
+	}
+	prober interface {
+		ProbeNodes(nodes []model.Node)
+	}
 	interval time.Duration
 	stopCh   chan struct{}
 	wg       sync.WaitGroup
@@ -24,10 +30,16 @@ type HealthChecker struct {
 // NewHealthChecker 创建健康检查器
 func NewHealthChecker(db *gorm.DB, alertService interface {
 	TriggerAlert(alertType, targetType string, targetID uint, targetName, message string)
+}, leader interface {
+	IsLeader() bool
+}, prober interface {
+	ProbeNodes(nodes []model.Node)
 }, interval time.Duration) *HealthChecker {
 	return &HealthChecker{
 		db:           db,
 		alertService: alertService,
+		leader:       leader,
+		prober:       prober,
 		interval:     interval,
 		stopCh:       make(chan struct{}),
 	}
@@ -73,6 +85,11 @@ func (h *HealthChecker) run() {
 }
 
 func (h *HealthChecker) checkAll() {
+	// 多实例部署时由主实例检查，避免重复告警
+	if !h.leader.IsLeader() {
+		return
+	}
+
 	var nodes []model.Node
 	if err := h.db.Find(&nodes).Error; err != nil {
 		log.Printf("Health check: failed to get nodes: %v", err)
@@ -85,6 +102,11 @@ func (h *HealthChecker) checkAll() {
 		go h.checkNode(node)
 	}
 
+	// 经代理访问探测目标的端到端探测
+	if h.prober != nil {
+		h.prober.ProbeNodes(nodes)
+	}
+
 	// 检查节点超时 (2分钟无心跳则标记离线)
 	h.checkNodeTimeout()
 
@@ -112,6 +134,7 @@ func (h *HealthChecker) checkNode(node model.Node) {
 	if !node.LastSeen.IsZero() && time.Since(node.LastSeen) < 90*time.Second {
 		h.db.Create(&model.HealthCheckLog{
 			NodeID:    node.ID,
+			Type:      "heartbeat",
 			Status:    "healthy",
 			Latency:   0,
 			ErrorMsg:  "",
@@ -142,6 +165,7 @@ func (h *HealthChecker) checkNode(node model.Node) {
 	// 记录健康检查日志
 	h.db.Create(&model.HealthCheckLog{
 		NodeID:    node.ID,
+		Type:      "api",
 		Status:    status,
 		Latency:   latency,
 		ErrorMsg:  errMsg,
@@ -0,0 +1,51 @@
+package service
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/AliceNetworks/gost-panel/internal/model"
+)
+
+// 节点仍是隧道中转节点时拒绝删除，并列出受影响的隧道
+func TestDeleteNodeRefusesTunnelHop(t *testing.T) {
+	s := newTestDBService(t)
+
+	var nodes []*model.Node
+	for _, name := range []string{"entry", "relay", "exit"} {
+		n := &model.Node{Name: name, Host: "127.0.0.1"}
+		if err := s.CreateNode(n); err != nil {
+			t.Fatal(err)
+		}
+		nodes = append(nodes, n)
+	}
+	tunnel := &model.Tunnel{Name: "via-relay", EntryNodeID: nodes[0].ID, ExitNodeID: nodes[2].ID}
+	if err := s.db.Create(tunnel).Error; err != nil {
+		t.Fatal(err)
+	}
+	if err := s.db.Create(&model.TunnelHop{TunnelID: tunnel.ID, NodeID: nodes[1].ID}).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	err := s.DeleteNode(nodes[1].ID)
+	var inUse *NodeInUseError
+	if !errors.As(err, &inUse) {
+		t.Fatalf("DeleteNode() = %v, want *NodeInUseError", err)
+	}
+	if len(inUse.Tunnels) != 1 || inUse.Tunnels[0].ID != tunnel.ID || inUse.Tunnels[0].Name != "via-relay" {
+		t.Fatalf("affected tunnels = %+v, want [via-relay]", inUse.Tunnels)
+	}
+
+	var hops, relays int64
+	s.db.Model(&model.TunnelHop{}).Where("tunnel_id = ?", tunnel.ID).Count(&hops)
+	s.db.Model(&model.Node{}).Where("id = ?", nodes[1].ID).Count(&relays)
+	if hops != 1 || relays != 1 {
+		t.Fatalf("hops = %d, relay nodes = %d after refused delete; want 1, 1", hops, relays)
+	}
+
+	// 从隧道中移除后可以删除
+	s.db.Where("tunnel_id = ?", tunnel.ID).Delete(&model.TunnelHop{})
+	if err := s.DeleteNode(nodes[1].ID); err != nil {
+		t.Fatalf("DeleteNode() after removing hop = %v", err)
+	}
+}
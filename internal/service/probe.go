@@ -0,0 +1,208 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/AliceNetworks/gost-panel/internal/model"
+	"github.com/AliceNetworks/gost-panel/internal/probe"
+)
+
+// ==================== 端到端探测 ====================
+
+// ProbeSourcePanel 由面板发起的探测
+const ProbeSourcePanel = "panel"
+
+var (
+	// ErrNoProbeTarget 节点和全局设置都没有配置探测目标
+	ErrNoProbeTarget = errors.New("no probe target configured")
+	// ErrProbeAgentOffline 负责探测的节点 Agent 不在线
+	ErrProbeAgentOffline = errors.New("probe agent is offline")
+)
+
+// ProbeDispatcher 将探测请求下发给 fromNodeID 节点的 Agent，Agent 不在线时返回 false
+type ProbeDispatcher func(fromNodeID uint, req probe.Request) bool
+
+// proberState 定时探测的节流状态
+type proberState struct {
+	mu        sync.Mutex
+	lastProbe map[uint]time.Time
+}
+
+// ProbeSource 节点 Agent 作为探测来源时的标识
+func ProbeSource(nodeID uint) string {
+	return "node-" + strconv.FormatUint(uint64(nodeID), 10)
+}
+
+// SetProbeDispatcher 设置向 Agent 下发探测请求的回调
+func (s *Service) SetProbeDispatcher(fn ProbeDispatcher) {
+	s.probeDispatcher = fn
+}
+
+// ProbeTarget 节点的探测目标，未单独设置时使用全局默认目标
+func (s *Service) ProbeTarget(node *model.Node) string {
+	if node.ProbeTarget != "" {
+		return node.ProbeTarget
+	}
+	return s.GetSiteConfig(model.ConfigHealthProbeTarget)
+}
+
+// ProbeNodes 按探测间隔对节点发起端到端探测 (由健康检查每轮调用)
+func (s *Service) ProbeNodes(nodes []model.Node) {
+	interval := time.Duration(s.siteConfigInt(model.ConfigHealthProbeInterval, 60)) * time.Second
+	defaultTarget := s.GetSiteConfig(model.ConfigHealthProbeTarget)
+
+	s.prober.mu.Lock()
+	defer s.prober.mu.Unlock()
+	if s.prober.lastProbe == nil {
+		s.prober.lastProbe = make(map[uint]time.Time)
+	}
+
+	for _, node := range nodes {
+		if node.ProbeTarget == "" && defaultTarget == "" {
+			continue
+		}
+		if time.Since(s.prober.lastProbe[node.ID]) < interval {
+			continue
+		}
+		s.prober.lastProbe[node.ID] = time.Now()
+		if !probe.Supported(node.Protocol, node.Transport) {
+			s.recordProbeUnsupported(&node)
+			continue
+		}
+
+		go func(node model.Node) {
+			if _, _, err := s.ProbeNode(&node); err != nil && !errors.Is(err, ErrProbeAgentOffline) {
+				log.Printf("Probe node %s failed: %v", node.Name, err)
+			}
+		}(node)
+	}
+}
+
+// recordProbeUnsupported 配置了探测目标但协议或传输层不支持探测时记录为 unknown，说明没有探测结果的原因
+func (s *Service) recordProbeUnsupported(node *model.Node) {
+	source := ProbeSourcePanel
+	if node.ProbeFromNodeID != nil {
+		source = ProbeSource(*node.ProbeFromNodeID)
+	}
+	s.db.Create(&model.HealthCheckLog{
+		NodeID:    node.ID,
+		Type:      "probe",
+		Source:    source,
+		Target:    s.ProbeTarget(node),
+		Status:    "unknown",
+		ErrorMsg:  fmt.Sprintf("%s: %s/%s", probe.ErrUnsupported, node.Protocol, node.Transport),
+		CheckedAt: time.Now(),
+	})
+}
+
+// ProbeNode 探测节点。由面板发起时同步执行并返回结果；
+// 由其他节点的 Agent 发起时下发请求后立即返回 dispatched=true，结果由 Agent 异步上报
+func (s *Service) ProbeNode(node *model.Node) (result *probe.Result, dispatched bool, err error) {
+	target := s.ProbeTarget(node)
+	if target == "" {
+		return nil, false, ErrNoProbeTarget
+	}
+	if !probe.Supported(node.Protocol, node.Transport) {
+		return nil, false, probe.ErrUnsupported
+	}
+
+	timeout := s.siteConfigInt(model.ConfigHealthProbeTimeout, 10)
+	req := probe.Request{
+		NodeID: node.ID,
+		Proxy: probe.Proxy{
+			Addr:       net.JoinHostPort(node.Host, strconv.Itoa(node.Port)),
+			Protocol:   node.Protocol,
+			Transport:  node.Transport,
+			Username:   node.ProxyUser,
+			Password:   node.ProxyPass,
+			ServerName: node.TLSSNI,
+			WSPath:     node.WSPath,
+			WSHost:     node.WSHost,
+		},
+		Target:  target,
+		Timeout: timeout,
+	}
+
+	if node.ProbeFromNodeID != nil {
+		from := *node.ProbeFromNodeID
+		if s.probeDispatcher != nil && s.probeDispatcher(from, req) {
+			return nil, true, nil
+		}
+		// 探测来源离线时无法判断节点状态，记录为 unknown 而不是 unhealthy
+		s.db.Create(&model.HealthCheckLog{
+			NodeID:    node.ID,
+			Type:      "probe",
+			Source:    ProbeSource(from),
+			Target:    target,
+			Status:    "unknown",
+			ErrorMsg:  ErrProbeAgentOffline.Error(),
+			CheckedAt: time.Now(),
+		})
+		return nil, false, ErrProbeAgentOffline
+	}
+
+	r := probe.Run(req.Proxy, target, time.Duration(timeout)*time.Second)
+	s.RecordProbeResult(node.ID, ProbeSourcePanel, target, r)
+	return &r, false, nil
+}
+
+// HandleProbeReport 记录 Agent 上报的探测结果，只接受节点指定的探测来源
+func (s *Service) HandleProbeReport(fromNodeID uint, report probe.Report) error {
+	var node model.Node
+	if err := s.db.Select("id", "probe_from_node_id").First(&node, report.NodeID).Error; err != nil {
+		return err
+	}
+	if node.ProbeFromNodeID == nil || *node.ProbeFromNodeID != fromNodeID {
+		return fmt.Errorf("node %d is not a probe source for node %d", fromNodeID, report.NodeID)
+	}
+	s.RecordProbeResult(report.NodeID, ProbeSource(fromNodeID), report.Target, report.Result)
+	return nil
+}
+
+// RecordProbeResult 记录探测结果，由成功变为失败时触发告警
+func (s *Service) RecordProbeResult(nodeID uint, source, target string, r probe.Result) {
+	var previous model.HealthCheckLog
+	hasPrevious := s.db.Where("node_id = ? AND type = ? AND status <> ?", nodeID, "probe", "unknown").
+		Order("checked_at DESC").First(&previous).Error == nil
+
+	status := "healthy"
+	errMsg := ""
+	if !r.Success {
+		status = "unhealthy"
+		errMsg = r.Stage + ": " + r.Error
+		if len(errMsg) > 500 {
+			errMsg = errMsg[:500]
+		}
+	}
+
+	s.db.Create(&model.HealthCheckLog{
+		NodeID:           nodeID,
+		Type:             "probe",
+		Source:           source,
+		Target:           target,
+		Status:           status,
+		Latency:          int(r.Total),
+		ConnectLatency:   int(r.Connect),
+		TLSLatency:       int(r.TLS),
+		FirstByteLatency: int(r.FirstByte),
+		ErrorMsg:         errMsg,
+		CheckedAt:        time.Now(),
+	})
+
+	if r.Success || (hasPrevious && previous.Status == "unhealthy") {
+		return
+	}
+	var node model.Node
+	if err := s.db.Select("id", "name").First(&node, nodeID).Error; err != nil {
+		return
+	}
+	log.Printf("Probe: node %s failed from %s (%s)", node.Name, source, errMsg)
+	s.alertService.TriggerAlert("node_probe_failed", "node", node.ID, node.Name,
+		fmt.Sprintf("节点 %s 端到端探测失败\n来源: %s\n目标: %s\n错误: %s", node.Name, source, target, errMsg))
+}
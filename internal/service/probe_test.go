@@ -0,0 +1,52 @@
+package service
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/AliceNetworks/gost-panel/internal/model"
+	"github.com/AliceNetworks/gost-panel/internal/probe"
+)
+
+// 协议或传输层不支持探测的节点记录 unknown 结果，按探测间隔节流
+func TestProbeNodesRecordsUnsupported(t *testing.T) {
+	s := newTestDBService(t)
+	if err := s.SetSiteConfig(model.ConfigHealthProbeTarget, "https://example.com"); err != nil {
+		t.Fatal(err)
+	}
+	from := uint(7)
+	nodes := []model.Node{
+		{Name: "ss", Host: "127.0.0.1", AgentToken: "ss", Protocol: "ss", Transport: "tcp"},
+		{Name: "quic", Host: "127.0.0.1", AgentToken: "quic", Protocol: "socks5", Transport: "quic", ProbeTarget: "tcp://10.0.0.1:22", ProbeFromNodeID: &from},
+	}
+	for i := range nodes {
+		if err := s.db.Create(&nodes[i]).Error; err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	s.ProbeNodes(nodes)
+	s.ProbeNodes(nodes)
+
+	var logs []model.HealthCheckLog
+	if err := s.db.Where("type = ?", "probe").Order("node_id").Find(&logs).Error; err != nil {
+		t.Fatal(err)
+	}
+	if len(logs) != 2 {
+		t.Fatalf("got %d probe logs, want one per node", len(logs))
+	}
+	want := []struct {
+		source, target, protocol string
+	}{
+		{ProbeSourcePanel, "https://example.com", "ss/tcp"},
+		{ProbeSource(from), "tcp://10.0.0.1:22", "socks5/quic"},
+	}
+	for i, l := range logs {
+		if l.NodeID != nodes[i].ID || l.Status != "unknown" || l.Source != want[i].source || l.Target != want[i].target {
+			t.Errorf("log %d = %+v, want unknown from %s to %s", i, l, want[i].source, want[i].target)
+		}
+		if !strings.Contains(l.ErrorMsg, probe.ErrUnsupported.Error()) || !strings.Contains(l.ErrorMsg, want[i].protocol) {
+			t.Errorf("log %d error = %q, want unsupported %s", i, l.ErrorMsg, want[i].protocol)
+		}
+	}
+}
@@ -0,0 +1,306 @@
+package service
+
+import (
+	"bytes"
+	"database/sql"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/AliceNetworks/gost-panel/internal/backup"
+	"github.com/AliceNetworks/gost-panel/internal/model"
+	"gorm.io/gorm"
+)
+
+// sqliteHeader SQLite 数据库文件头
+const sqliteHeader = "SQLite format 3\x00"
+
+// restoreDrainTimeout 替换数据库文件前等待进行中的查询和事务结束的最长时间
+const restoreDrainTimeout = 30 * time.Second
+
+// sqliteSidecars 数据库文件的附属文件 (日志/WAL)
+var sqliteSidecars = []string{"-journal", "-wal", "-shm"}
+
+// TableDiff 恢复前后的表记录数
+type TableDiff struct {
+	Table  string `json:"table"`
+	Before int64  `json:"before"`
+	After  int64  `json:"after"`
+}
+
+// RestoreResult 数据库恢复结果
+type RestoreResult struct {
+	Tables     []TableDiff `json:"tables"`
+	PreviousDB string      `json:"previous_db"` // 恢复前数据库的保存位置
+}
+
+// Restoring 是否正在恢复数据库 (期间 API 请求应暂缓)
+func (s *Service) Restoring() bool {
+	return s.restoring.Load()
+}
+
+// RestoreDatabase 在线恢复数据库：校验并迁移上传的数据库后替换当前数据库文件，
+// 在进程内重新打开连接池，无需重启。任一步骤失败都会还原到恢复前的数据库。
+// 备份总是 SQLite 文件，使用 PostgreSQL/MySQL 时在单个事务中把备份数据复制到当前数据库。
+func (s *Service) RestoreDatabase(data []byte) (*RestoreResult, error) {
+	s.backupMu.Lock()
+	defer s.backupMu.Unlock()
+
+	if backup.IsEncrypted(data) {
+		key := s.GetSiteConfig(model.ConfigBackupEncryptionKey)
+		if key == "" {
+			return nil, fmt.Errorf("backup is encrypted but no backup_encryption_key is configured")
+		}
+		plain, err := backup.Decrypt(data, key)
+		if err != nil {
+			return nil, err
+		}
+		data = plain
+	}
+	if !bytes.HasPrefix(data, []byte(sqliteHeader)) {
+		return nil, fmt.Errorf("invalid database file")
+	}
+
+	dbPath := s.cfg.DBPath
+	stagingPath := dbPath + ".restore"
+	previousPath := dbPath + ".bak"
+	removeSQLiteFiles(stagingPath)
+	defer removeSQLiteFiles(stagingPath)
+
+	if err := os.WriteFile(stagingPath, data, 0600); err != nil {
+		return nil, err
+	}
+	after, err := prepareRestoreDB(stagingPath)
+	if err != nil {
+		return nil, err
+	}
+	before, err := countTables(s.db)
+	if err != nil {
+		return nil, err
+	}
+	if !s.isSQLite() {
+		return s.restoreFromSnapshot(stagingPath, previousPath, before, after)
+	}
+
+	pool, ok := s.db.ConnPool.(*model.SwitchablePool)
+	if !ok {
+		return nil, fmt.Errorf("database connection does not support online restore")
+	}
+
+	// 从这里开始替换数据库文件，期间拒绝 API 请求，后台任务的查询在替换完成前等待
+	s.restoring.Store(true)
+	defer s.restoring.Store(false)
+
+	var restoreErr error
+	pool.Switch(restoreDrainTimeout, func(old *sql.DB) *sql.DB {
+		// 进行中的查询和事务已结束，关闭时合并 WAL
+		if err := old.Close(); err != nil {
+			log.Printf("Restore: failed to close database: %v", err)
+		}
+		var fresh *sql.DB
+		fresh, restoreErr = s.replaceDBFile(stagingPath, previousPath)
+		return fresh
+	})
+	if restoreErr != nil {
+		return nil, restoreErr
+	}
+
+	log.Printf("Database restored, previous database saved to %s", previousPath)
+	return &RestoreResult{Tables: diffTables(before, after), PreviousDB: previousPath}, nil
+}
+
+// replaceDBFile 用已校验的文件替换数据库文件并打开新连接池，失败时还原恢复前的数据库。
+// 调用时连接池已暂停且旧连接池已关闭，返回 nil 表示无法重新打开数据库
+func (s *Service) replaceDBFile(stagingPath, previousPath string) (*sql.DB, error) {
+	dbPath := s.cfg.DBPath
+	removeSQLiteFiles(previousPath)
+	if err := moveSQLiteFiles(dbPath, previousPath); err != nil {
+		// 原文件未移动，直接重新打开
+		fresh, reopenErr := openSQLiteConn(dbPath)
+		if reopenErr != nil {
+			log.Printf("Restore: failed to reopen database: %v", reopenErr)
+		}
+		return fresh, fmt.Errorf("failed to move current database: %w", err)
+	}
+
+	err := moveSQLiteFiles(stagingPath, dbPath)
+	if err == nil {
+		var fresh *sql.DB
+		if fresh, err = openSQLiteConn(dbPath); err == nil {
+			return fresh, nil
+		}
+	}
+
+	// 回滚到恢复前的数据库
+	log.Printf("Restore: failed, rolling back: %v", err)
+	removeSQLiteFiles(dbPath)
+	if e := moveSQLiteFiles(previousPath, dbPath); e != nil {
+		log.Printf("Restore: rollback failed to move database back: %v", e)
+	}
+	fresh, e := openSQLiteConn(dbPath)
+	if e != nil {
+		log.Printf("Restore: rollback failed to reopen database: %v", e)
+	}
+	return fresh, fmt.Errorf("restore failed: %w", err)
+}
+
+// restoreFromSnapshot 将已校验的 SQLite 快照复制到 PostgreSQL/MySQL，失败时事务回滚，当前数据不变
+func (s *Service) restoreFromSnapshot(stagingPath, previousPath string, before, after map[string]int64) (*RestoreResult, error) {
+	// 恢复前的数据同样保存为 SQLite 快照
+	removeSQLiteFiles(previousPath)
+	if err := s.SnapshotDatabase(previousPath); err != nil {
+		return nil, fmt.Errorf("failed to save current database: %w", err)
+	}
+
+	staging, err := model.OpenDB(model.DriverSQLite, stagingPath)
+	if err != nil {
+		return nil, err
+	}
+	defer closeDB(staging)
+
+	// 复制期间拒绝 API 请求
+	s.restoring.Store(true)
+	defer s.restoring.Store(false)
+
+	if err := s.db.Transaction(func(tx *gorm.DB) error {
+		_, err := model.CopyDatabase(staging, tx)
+		return err
+	}); err != nil {
+		return nil, fmt.Errorf("restore failed: %w", err)
+	}
+
+	log.Printf("Database restored, previous data saved to %s", previousPath)
+	return &RestoreResult{Tables: diffTables(before, after), PreviousDB: previousPath}, nil
+}
+
+// RestoreBackup 从备份存储中的备份恢复
+func (s *Service) RestoreBackup(name string) (*RestoreResult, error) {
+	r, err := s.OpenBackup(name)
+	if err != nil {
+		return nil, err
+	}
+	data, err := io.ReadAll(r)
+	r.Close()
+	if err != nil {
+		return nil, err
+	}
+	return s.RestoreDatabase(data)
+}
+
+// openSQLiteConn 打开 SQLite 数据库并确认可用，返回底层连接池
+func openSQLiteConn(path string) (*sql.DB, error) {
+	db, err := model.OpenDB(model.DriverSQLite, path)
+	if err != nil {
+		return nil, err
+	}
+	sqlDB, err := db.DB()
+	if err != nil {
+		return nil, err
+	}
+	if err := sqlDB.Ping(); err != nil {
+		sqlDB.Close()
+		return nil, err
+	}
+	return sqlDB, nil
+}
+
+// prepareRestoreDB 校验待恢复的数据库并迁移到当前版本的表结构，返回各表记录数
+func prepareRestoreDB(path string) (map[string]int64, error) {
+	db, err := model.OpenDB(model.DriverSQLite, path)
+	if err != nil {
+		return nil, fmt.Errorf("invalid database file: %w", err)
+	}
+	sqlDB, err := db.DB()
+	if err != nil {
+		return nil, err
+	}
+	defer sqlDB.Close()
+
+	var result string
+	if err := db.Raw("PRAGMA integrity_check").Scan(&result).Error; err != nil || result != "ok" {
+		return nil, fmt.Errorf("database integrity check failed: %s", result)
+	}
+	if !db.Migrator().HasTable(&model.User{}) || !db.Migrator().HasTable(&model.Node{}) {
+		return nil, fmt.Errorf("not a GOST Panel database")
+	}
+
+	if err := model.MigrateDB(db); err != nil {
+		return nil, fmt.Errorf("migration failed: %w", err)
+	}
+	return countTables(db)
+}
+
+// isSQLite 当前是否使用 SQLite (备份/恢复直接操作数据库文件)
+func (s *Service) isSQLite() bool {
+	return s.db.Dialector.Name() == model.DriverSQLite
+}
+
+// closeDB 关闭数据库连接池
+func closeDB(db *gorm.DB) {
+	if sqlDB, err := db.DB(); err == nil {
+		sqlDB.Close()
+	}
+}
+
+// countTables 统计所有表的记录数
+func countTables(db *gorm.DB) (map[string]int64, error) {
+	tables, err := db.Migrator().GetTables()
+	if err != nil {
+		return nil, err
+	}
+	counts := make(map[string]int64, len(tables))
+	for _, table := range tables {
+		if strings.HasPrefix(table, "sqlite_") {
+			continue // SQLite 内部表
+		}
+		var n int64
+		if err := db.Table(table).Count(&n).Error; err != nil {
+			return nil, err
+		}
+		counts[table] = n
+	}
+	return counts, nil
+}
+
+func diffTables(before, after map[string]int64) []TableDiff {
+	names := make(map[string]bool, len(after))
+	for t := range before {
+		names[t] = true
+	}
+	for t := range after {
+		names[t] = true
+	}
+
+	diffs := make([]TableDiff, 0, len(names))
+	for t := range names {
+		diffs = append(diffs, TableDiff{Table: t, Before: before[t], After: after[t]})
+	}
+	sort.Slice(diffs, func(i, j int) bool { return diffs[i].Table < diffs[j].Table })
+	return diffs
+}
+
+// moveSQLiteFiles 移动数据库文件及其附属文件
+func moveSQLiteFiles(src, dst string) error {
+	if err := os.Rename(src, dst); err != nil {
+		return err
+	}
+	for _, suffix := range sqliteSidecars {
+		if err := os.Rename(src+suffix, dst+suffix); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return err
+		}
+	}
+	return nil
+}
+
+// removeSQLiteFiles 删除数据库文件及其附属文件
+func removeSQLiteFiles(path string) {
+	os.Remove(path)
+	for _, suffix := range sqliteSidecars {
+		os.Remove(path + suffix)
+	}
+}
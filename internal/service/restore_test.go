@@ -0,0 +1,104 @@
+package service
+
+import (
+	"os"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"testing"
+
+	"github.com/AliceNetworks/gost-panel/internal/cluster"
+	"github.com/AliceNetworks/gost-panel/internal/config"
+	"github.com/AliceNetworks/gost-panel/internal/model"
+)
+
+func newTestService(t *testing.T) *Service {
+	t.Helper()
+	dir := t.TempDir()
+	cfg := &config.Config{DBPath: filepath.Join(dir, "panel.db"), InstanceID: "test"}
+	db, err := model.InitDB(model.DriverSQLite, cfg.DBPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	svc := NewService(db, cfg, cluster.NewMemoryStore())
+	t.Cleanup(func() {
+		svc.Close()
+		closeDB(db)
+	})
+	return svc
+}
+
+// 后台任务和 API 持续访问数据库时在线恢复 (配合 -race 运行)
+func TestRestoreDatabaseWithConcurrentQueries(t *testing.T) {
+	svc := newTestService(t)
+	if err := svc.db.Create(&model.Node{Name: "kept", Host: "127.0.0.1", AgentToken: "kept"}).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	snapshot := filepath.Join(t.TempDir(), "snapshot.db")
+	if err := svc.SnapshotDatabase(snapshot); err != nil {
+		t.Fatal(err)
+	}
+	data, err := os.ReadFile(snapshot)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := svc.db.Create(&model.Node{Name: "dropped", Host: "127.0.0.1", AgentToken: "dropped"}).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	var stop atomic.Bool
+	var failures atomic.Int64
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for !stop.Load() {
+				var n int64
+				if err := svc.db.Model(&model.Node{}).Count(&n).Error; err != nil {
+					failures.Add(1)
+				}
+				if err := svc.db.Model(&model.Node{}).Where("name = ?", "kept").Update("status", "online").Error; err != nil {
+					failures.Add(1)
+				}
+			}
+		}()
+	}
+
+	result, err := svc.RestoreDatabase(data)
+	stop.Store(true)
+	wg.Wait()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n := failures.Load(); n != 0 {
+		t.Fatalf("%d queries failed during restore", n)
+	}
+
+	var names []string
+	svc.db.Model(&model.Node{}).Order("id").Pluck("name", &names)
+	if len(names) != 1 || names[0] != "kept" {
+		t.Fatalf("nodes after restore = %v, want [kept]", names)
+	}
+	if _, err := os.Stat(result.PreviousDB); err != nil {
+		t.Fatalf("previous database not saved: %v", err)
+	}
+}
+
+// 恢复失败时还原到恢复前的数据库
+func TestRestoreDatabaseRejectsInvalidFile(t *testing.T) {
+	svc := newTestService(t)
+	if err := svc.db.Create(&model.Node{Name: "kept", Host: "127.0.0.1", AgentToken: "kept"}).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := svc.RestoreDatabase([]byte(sqliteHeader + "garbage")); err == nil {
+		t.Fatal("RestoreDatabase accepted a corrupt database")
+	}
+
+	var n int64
+	if err := svc.db.Model(&model.Node{}).Count(&n).Error; err != nil || n != 1 {
+		t.Fatalf("nodes after failed restore = %d, %v; want 1", n, err)
+	}
+}
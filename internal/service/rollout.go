@@ -0,0 +1,128 @@
+package service
+
+import (
+	"fmt"
+	"hash/fnv"
+	"strconv"
+	"strings"
+
+	"github.com/AliceNetworks/gost-panel/internal/model"
+)
+
+// ==================== Agent 灰度更新 ====================
+
+// AgentRollout 当前的灰度更新设置
+type AgentRollout struct {
+	Percent int      `json:"percent"` // 按 Agent 分桶的下发比例 (0-100)
+	Tags    []string `json:"tags"`    // 只下发给带这些标签的节点 (客户端按所属节点)，为空表示不限
+}
+
+// Unrestricted 是否对所有 Agent 开放更新
+func (r AgentRollout) Unrestricted() bool {
+	return r.Percent >= 100 && len(r.Tags) == 0
+}
+
+// GetAgentRollout 读取灰度更新设置
+func (s *Service) GetAgentRollout() AgentRollout {
+	rollout := AgentRollout{Percent: 100}
+	if v, err := strconv.Atoi(strings.TrimSpace(s.GetSiteConfig(model.ConfigAgentRolloutPercent))); err == nil && v >= 0 && v <= 100 {
+		rollout.Percent = v
+	}
+	for _, tag := range strings.Split(s.GetSiteConfig(model.ConfigAgentRolloutTags), ",") {
+		if tag = strings.TrimSpace(tag); tag != "" {
+			rollout.Tags = append(rollout.Tags, tag)
+		}
+	}
+	return rollout
+}
+
+// AgentUpdateEligible 判断 Agent 是否在 version 的灰度范围内。
+// kind 为 node/client；id 为 0 表示无法识别的 Agent，只在不限范围时允许更新
+func (s *Service) AgentUpdateEligible(kind string, id uint, version string) bool {
+	return s.agentUpdateEligible(s.GetAgentRollout(), kind, id, version)
+}
+
+func (s *Service) agentUpdateEligible(rollout AgentRollout, kind string, id uint, version string) bool {
+	if rollout.Unrestricted() {
+		return true
+	}
+	if id == 0 || rollout.Percent == 0 {
+		return false
+	}
+
+	if len(rollout.Tags) > 0 {
+		nodeID := id
+		if kind == "client" {
+			var client model.Client
+			if err := s.db.Select("id", "node_id").First(&client, id).Error; err != nil {
+				return false
+			}
+			nodeID = client.NodeID
+		}
+		var count int64
+		s.db.Model(&model.NodeTag{}).
+			Joins("JOIN tags ON tags.id = node_tags.tag_id").
+			Where("node_tags.node_id = ? AND tags.name IN ?", nodeID, rollout.Tags).
+			Count(&count)
+		if count == 0 {
+			return false
+		}
+	}
+
+	return rolloutBucket(kind, id, version) < rollout.Percent
+}
+
+// rolloutBucket 将 Agent 稳定地分到 0-99 的桶中。
+// 桶号与版本相关，每次发版由不同的 Agent 先行更新
+func rolloutBucket(kind string, id uint, version string) int {
+	h := fnv.New32a()
+	fmt.Fprintf(h, "%s-%d@%s", kind, id, version)
+	return int(h.Sum32() % 100)
+}
+
+// SetAgentVersion 记录 Agent 上报的版本 (未变化时不写库)
+func (s *Service) SetAgentVersion(kind string, id uint, current, version string) {
+	if version == "" || version == current {
+		return
+	}
+	if kind == "client" {
+		s.db.Model(&model.Client{}).Where("id = ?", id).Update("agent_version", version)
+		return
+	}
+	s.db.Model(&model.Node{}).Where("id = ?", id).Update("agent_version", version)
+}
+
+// AgentRolloutStats 灰度更新进度
+type AgentRolloutStats struct {
+	Total    int `json:"total"`      // 已上报版本的 Agent 数
+	Eligible int `json:"eligible"`   // 在灰度范围内的 Agent 数
+	UpToDate int `json:"up_to_date"` // 已是目标版本的 Agent 数
+}
+
+// GetAgentRolloutStats 统计节点和客户端 Agent 的灰度更新进度
+func (s *Service) GetAgentRolloutStats(version string) map[string]AgentRolloutStats {
+	rollout := s.GetAgentRollout()
+	stats := make(map[string]AgentRolloutStats)
+
+	type agentRow struct {
+		ID           uint
+		AgentVersion string
+	}
+	for kind, table := range map[string]interface{}{"node": &model.Node{}, "client": &model.Client{}} {
+		var rows []agentRow
+		s.db.Model(table).Select("id", "agent_version").Where("agent_version <> ''").Find(&rows)
+
+		var st AgentRolloutStats
+		for _, row := range rows {
+			st.Total++
+			if row.AgentVersion == version {
+				st.UpToDate++
+			}
+			if s.agentUpdateEligible(rollout, kind, row.ID, version) {
+				st.Eligible++
+			}
+		}
+		stats[kind] = st
+	}
+	return stats
+}
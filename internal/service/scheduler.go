@@ -0,0 +1,349 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/AliceNetworks/gost-panel/internal/model"
+	"gorm.io/gorm"
+)
+
+var (
+	ErrJobNotFound       = errors.New("job not found")
+	ErrJobAlreadyRunning = errors.New("job is already running")
+)
+
+// Job 定时任务定义
+type Job struct {
+	Name        string
+	Description string
+	ConfigKey   string // 调度表达式所在的站点配置键
+	Run         func() error
+}
+
+// JobInfo 定时任务状态 (供 API 展示)
+type JobInfo struct {
+	Name        string           `json:"name"`
+	Description string           `json:"description"`
+	Schedule    string           `json:"schedule"`
+	Enabled     bool             `json:"enabled"`
+	Running     bool             `json:"running"`
+	NextRunAt   *time.Time       `json:"next_run_at"`
+	Status      *model.JobStatus `json:"status"`
+}
+
+// Scheduler 定时任务调度器，调度表达式保存在站点配置中，修改后下一分钟生效
+type Scheduler struct {
+	svc     *Service
+	jobs    []*Job
+	mu      sync.Mutex
+	running map[string]bool
+	stopCh  chan struct{}
+	wg      sync.WaitGroup
+}
+
+// NewScheduler 创建调度器并注册内置任务
+func NewScheduler(svc *Service) *Scheduler {
+	s := &Scheduler{
+		svc:     svc,
+		running: make(map[string]bool),
+		stopCh:  make(chan struct{}),
+	}
+
+	s.jobs = []*Job{
+		{
+			Name:        "traffic_history",
+			Description: "记录流量历史",
+			ConfigKey:   model.ConfigJobTrafficHistory,
+			Run:         svc.RecordTrafficHistory,
+		},
+		{
+			Name:        "session_cleanup",
+			Description: "清理过期会话和加入令牌",
+			ConfigKey:   model.ConfigJobSessionCleanup,
+			Run:         svc.CleanupExpiredSessions,
+		},
+		{
+			Name:        "quota_reset",
+			Description: "按重置日重置节点/客户端/隧道流量配额",
+			ConfigKey:   model.ConfigJobQuotaReset,
+			Run:         svc.ResetQuotas,
+		},
+		{
+			Name:        "user_quota_reset",
+			Description: "按重置日重置用户流量配额",
+			ConfigKey:   model.ConfigJobUserQuotaReset,
+			Run:         svc.CheckAndResetUserQuotas,
+		},
+		{
+			Name:        "plan_expiry",
+			Description: "处理到期套餐",
+			ConfigKey:   model.ConfigJobPlanExpiry,
+			Run: func() error {
+				n, err := svc.ExpireUserPlans()
+				if n > 0 {
+					log.Printf("Scheduler: %d user plan(s) expired", n)
+				}
+				return err
+			},
+		},
+		{
+			Name:        "quota_check",
+			Description: "同步流量超限状态并更新 Agent 配置",
+			ConfigKey:   model.ConfigJobQuotaCheck,
+			Run: func() error {
+				_, err := svc.SyncQuotaStates()
+				return err
+			},
+		},
+		{
+			Name:        "offline_check",
+			Description: "检查离线节点并告警",
+			ConfigKey:   model.ConfigJobOfflineCheck,
+			Run: func() error {
+				return svc.alertService.CheckOfflineNodes(svc.siteConfigInt(model.ConfigNodeOfflineTimeout, 3))
+			},
+		},
+		{
+			Name:        "backup",
+			Description: "备份数据库到备份存储",
+			ConfigKey:   model.ConfigJobBackup,
+			Run:         svc.RunScheduledBackup,
+		},
+		{
+			Name:        "alert_log_cleanup",
+			Description: "清理过期告警日志",
+			ConfigKey:   model.ConfigJobAlertLogCleanup,
+			Run: func() error {
+				return svc.alertService.CleanupAlertLogs(svc.siteConfigInt(model.ConfigAlertLogRetentionDays, 30))
+			},
+		},
+	}
+
+	return s
+}
+
+// Start 启动调度器
+func (s *Scheduler) Start() {
+	s.wg.Add(1)
+	go s.run()
+	log.Printf("Scheduler started (%d jobs)", len(s.jobs))
+}
+
+// Stop 停止调度器，等待正在执行的任务结束
+func (s *Scheduler) Stop() {
+	close(s.stopCh)
+	s.wg.Wait()
+	log.Println("Scheduler stopped")
+}
+
+func (s *Scheduler) run() {
+	defer s.wg.Done()
+
+	// 启动时先检查一次，之后对齐到整分钟
+	s.tick(time.Now())
+
+	wait := time.Until(time.Now().Truncate(time.Minute).Add(time.Minute))
+	select {
+	case <-time.After(wait):
+	case <-s.stopCh:
+		return
+	}
+
+	ticker := time.NewTicker(time.Minute)
+	defer ticker.Stop()
+
+	for {
+		s.tick(time.Now())
+		select {
+		case <-ticker.C:
+		case <-s.stopCh:
+			return
+		}
+	}
+}
+
+// tick 检查所有任务是否到期，多实例部署时只有主实例执行
+func (s *Scheduler) tick(now time.Time) {
+	if !s.svc.IsLeader() {
+		return
+	}
+	statuses := s.loadStatuses()
+
+	for _, job := range s.jobs {
+		expr := s.svc.GetSiteConfig(job.ConfigKey)
+		if expr == "" || expr == "off" {
+			continue
+		}
+		sched, err := ParseCron(expr)
+		if err != nil {
+			log.Printf("Scheduler: invalid schedule for %s (%q): %v", job.Name, expr, err)
+			continue
+		}
+
+		var lastRun time.Time
+		if st, ok := statuses[job.Name]; ok && st.LastRunAt != nil {
+			lastRun = *st.LastRunAt
+		}
+		if !sched.Due(now, lastRun) {
+			continue
+		}
+
+		if !s.acquire(job.Name) {
+			continue
+		}
+		s.wg.Add(1)
+		go func(job *Job) {
+			defer s.wg.Done()
+			defer s.release(job.Name)
+			s.execute(job)
+		}(job)
+	}
+}
+
+// RunNow 立即执行指定任务，返回执行后的状态
+func (s *Scheduler) RunNow(name string) (*model.JobStatus, error) {
+	job := s.findJob(name)
+	if job == nil {
+		return nil, ErrJobNotFound
+	}
+	if !s.acquire(name) {
+		return nil, ErrJobAlreadyRunning
+	}
+	defer s.release(name)
+
+	return s.execute(job), nil
+}
+
+// ListJobs 获取所有任务及其状态
+func (s *Scheduler) ListJobs() []JobInfo {
+	statuses := s.loadStatuses()
+	now := time.Now()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	result := make([]JobInfo, 0, len(s.jobs))
+	for _, job := range s.jobs {
+		info := JobInfo{
+			Name:        job.Name,
+			Description: job.Description,
+			Schedule:    s.svc.GetSiteConfig(job.ConfigKey),
+			Running:     s.running[job.Name],
+		}
+		if st, ok := statuses[job.Name]; ok {
+			st := st
+			info.Status = &st
+		}
+		if info.Schedule != "" && info.Schedule != "off" {
+			if sched, err := ParseCron(info.Schedule); err == nil {
+				info.Enabled = true
+				from := now
+				if sched.every > 0 && info.Status != nil && info.Status.LastRunAt != nil {
+					from = *info.Status.LastRunAt
+				}
+				if next := sched.Next(from); !next.IsZero() {
+					info.NextRunAt = &next
+				}
+			}
+		}
+		result = append(result, info)
+	}
+	return result
+}
+
+// JobConfigKey 返回任务对应的调度配置键
+func (s *Scheduler) JobConfigKey(name string) (string, bool) {
+	job := s.findJob(name)
+	if job == nil {
+		return "", false
+	}
+	return job.ConfigKey, true
+}
+
+func (s *Scheduler) findJob(name string) *Job {
+	for _, job := range s.jobs {
+		if job.Name == name {
+			return job
+		}
+	}
+	return nil
+}
+
+func (s *Scheduler) acquire(name string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.running[name] {
+		return false
+	}
+	s.running[name] = true
+	return true
+}
+
+func (s *Scheduler) release(name string) {
+	s.mu.Lock()
+	delete(s.running, name)
+	s.mu.Unlock()
+}
+
+// execute 执行任务并记录结果
+func (s *Scheduler) execute(job *Job) *model.JobStatus {
+	start := time.Now()
+	err := func() (err error) {
+		defer func() {
+			if r := recover(); r != nil {
+				err = fmt.Errorf("panic: %v", r)
+			}
+		}()
+		return job.Run()
+	}()
+	duration := time.Since(start)
+
+	if err != nil {
+		log.Printf("Scheduler: job %s failed after %v: %v", job.Name, duration, err)
+	}
+
+	var status model.JobStatus
+	if e := s.svc.db.Where("name = ?", job.Name).First(&status).Error; e != nil && !errors.Is(e, gorm.ErrRecordNotFound) {
+		log.Printf("Scheduler: failed to load status of %s: %v", job.Name, e)
+	}
+	status.Name = job.Name
+	status.LastRunAt = &start
+	status.LastDuration = duration.Milliseconds()
+	status.LastSuccess = err == nil
+	status.LastError = ""
+	status.RunCount++
+	if err != nil {
+		status.LastError = err.Error()
+		status.FailCount++
+	}
+	if e := s.svc.db.Save(&status).Error; e != nil {
+		log.Printf("Scheduler: failed to save status of %s: %v", job.Name, e)
+	}
+
+	return &status
+}
+
+func (s *Scheduler) loadStatuses() map[string]model.JobStatus {
+	var list []model.JobStatus
+	if err := s.svc.db.Find(&list).Error; err != nil {
+		log.Printf("Scheduler: failed to load job statuses: %v", err)
+	}
+	result := make(map[string]model.JobStatus, len(list))
+	for _, st := range list {
+		result[st.Name] = st
+	}
+	return result
+}
+
+// siteConfigInt 读取整数类型的站点配置，无效时返回默认值
+func (s *Service) siteConfigInt(key string, def int) int {
+	if v, err := strconv.Atoi(s.GetSiteConfig(key)); err == nil && v > 0 {
+		return v
+	}
+	return def
+}
@@ -1,12 +1,23 @@
 package service
 
 import (
+	"crypto/ed25519"
 	"crypto/rand"
+	"crypto/subtle"
 	"encoding/hex"
 	"errors"
 	"fmt"
+	"log"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
 	"time"
 
+	"github.com/AliceNetworks/gost-panel/internal/cluster"
 	"github.com/AliceNetworks/gost-panel/internal/config"
 	"github.com/AliceNetworks/gost-panel/internal/gost"
 	"github.com/AliceNetworks/gost-panel/internal/model"
@@ -18,24 +29,51 @@ type Service struct {
 	db            *gorm.DB
 	cfg           *config.Config
 	alertService  *notify.AlertService
+	store         cluster.Store
+	elector       *cluster.Elector
 	healthChecker *HealthChecker
+	scheduler     *Scheduler
+	backupMu      sync.Mutex
+	restoring     atomic.Bool
+	trafficMu     sync.Mutex // 流量采样与补报统计互斥，避免采样覆盖补报对采样基准的调整
+
+	quotaChangeHandler func()
+	probeDispatcher    ProbeDispatcher
+	prober             proberState
+
+	panelKeyMu    sync.Mutex
+	panelKeyCache ed25519.PrivateKey
 }
 
-func NewService(db *gorm.DB, cfg *config.Config) *Service {
+func NewService(db *gorm.DB, cfg *config.Config, store cluster.Store) *Service {
 	alertSvc := notify.NewAlertService(db)
 	// 创建默认告警规则
 	alertSvc.CreateDefaultRules()
 
+	// 数据目录用于本地备份和临时文件 (使用 PostgreSQL/MySQL 时不会由数据库创建)
+	if err := os.MkdirAll(filepath.Dir(cfg.DBPath), 0755); err != nil {
+		log.Printf("Failed to create data directory: %v", err)
+	}
+
 	svc := &Service{
 		db:           db,
 		cfg:          cfg,
 		alertService: alertSvc,
+		store:        store,
 	}
 
-	// 启动健康检查 (每30秒检查一次)
-	svc.healthChecker = NewHealthChecker(db, alertSvc, 30*time.Second)
+	// 多实例部署时只有主实例运行健康检查和定时任务
+	svc.elector = cluster.NewElector(store, cfg.InstanceID, 15*time.Second)
+	svc.elector.Start()
+
+	// 启动健康检查 (每30秒检查一次，端到端探测按 health_probe_interval 节流)
+	svc.healthChecker = NewHealthChecker(db, alertSvc, svc.elector, svc, 30*time.Second)
 	svc.healthChecker.Start()
 
+	// 启动定时任务调度器
+	svc.scheduler = NewScheduler(svc)
+	svc.scheduler.Start()
+
 	return svc
 }
 
@@ -44,6 +82,26 @@ func (s *Service) GetAlertService() *notify.AlertService {
 	return s.alertService
 }
 
+// Scheduler 获取定时任务调度器
+func (s *Service) Scheduler() *Scheduler {
+	return s.scheduler
+}
+
+// Store 返回多实例共享状态存储
+func (s *Service) Store() cluster.Store {
+	return s.store
+}
+
+// Elector 返回主实例选举器
+func (s *Service) Elector() *cluster.Elector {
+	return s.elector
+}
+
+// IsLeader 当前实例是否为主实例 (负责健康检查和定时任务)
+func (s *Service) IsLeader() bool {
+	return s.elector.IsLeader()
+}
+
 // DB 返回数据库实例
 func (s *Service) DB() *gorm.DB {
 	return s.db
@@ -61,9 +119,15 @@ func (s *Service) FilterIDsByOwner(tableName string, ids []uint, userID uint, is
 
 // Close 关闭服务
 func (s *Service) Close() {
+	if s.scheduler != nil {
+		s.scheduler.Stop()
+	}
 	if s.healthChecker != nil {
 		s.healthChecker.Stop()
 	}
+	if s.elector != nil {
+		s.elector.Stop()
+	}
 }
 
 // Ping 检查数据库连接
@@ -193,8 +257,9 @@ func (s *Service) ListNodesPaginated(userID uint, isAdmin bool, params Paginatio
 
 	// 搜索过滤
 	if params.Search != "" {
-		search := "%" + params.Search + "%"
-		query = query.Where("name LIKE ? OR host LIKE ?", search, search)
+		// SQLite 的 LIKE 不区分大小写，PostgreSQL 区分，统一转为小写比较
+		search := "%" + strings.ToLower(params.Search) + "%"
+		query = query.Where("LOWER(name) LIKE ? OR LOWER(host) LIKE ?", search, search)
 	}
 
 	// 计算总数
@@ -262,8 +327,48 @@ func (s *Service) UpdateNode(id uint, updates map[string]interface{}) error {
 	return s.db.Model(&model.Node{}).Where("id = ?", id).Updates(updates).Error
 }
 
+// NodeInUseError 节点仍是隧道的中转节点，需先从这些隧道中移除才能删除
+type NodeInUseError struct {
+	Tunnels []model.Tunnel // 只包含 ID 和名称
+}
+
+func (e *NodeInUseError) Error() string {
+	names := make([]string, 0, len(e.Tunnels))
+	for _, t := range e.Tunnels {
+		names = append(names, t.Name)
+	}
+	return fmt.Sprintf("node is a relay hop of tunnels: %s", strings.Join(names, ", "))
+}
+
+// DeleteNode 删除节点及其客户端、服务和代理凭据。
+// 节点仍是隧道中转节点时返回 *NodeInUseError，不删除 (静默移除中转会改变隧道路径)
 func (s *Service) DeleteNode(id uint) error {
 	return s.db.Transaction(func(tx *gorm.DB) error {
+		// 记录节点及其客户端的 Agent，之后上报时下发签名的卸载命令
+		var node model.Node
+		if err := tx.Select("id", "name", "agent_token", "agent_public_key").First(&node, id).Error; err != nil {
+			return err
+		}
+		var tunnels []model.Tunnel
+		if err := tx.Select("DISTINCT tunnels.id, tunnels.name").
+			Joins("JOIN tunnel_hops ON tunnel_hops.tunnel_id = tunnels.id").
+			Where("tunnel_hops.node_id = ?", id).Order("tunnels.id").Find(&tunnels).Error; err != nil {
+			return err
+		}
+		if len(tunnels) > 0 {
+			return &NodeInUseError{Tunnels: tunnels}
+		}
+		if err := recordDecommission(tx, "node", node.ID, node.Name, node.AgentToken, node.AgentPublicKey); err != nil {
+			return err
+		}
+		var clients []model.Client
+		tx.Select("id", "name", "token", "agent_public_key").Where("node_id = ?", id).Find(&clients)
+		for _, client := range clients {
+			if err := recordDecommission(tx, "client", client.ID, client.Name, client.Token, client.AgentPublicKey); err != nil {
+				return err
+			}
+		}
+
 		// 删除关联的客户端
 		if err := tx.Where("node_id = ?", id).Delete(&model.Client{}).Error; err != nil {
 			return err
@@ -272,6 +377,10 @@ func (s *Service) DeleteNode(id uint) error {
 		if err := tx.Where("node_id = ?", id).Delete(&model.Service{}).Error; err != nil {
 			return err
 		}
+		// 删除节点上的用户代理凭据
+		if err := tx.Where("node_id = ?", id).Delete(&model.ProxyCredential{}).Error; err != nil {
+			return err
+		}
 		// 删除节点
 		return tx.Delete(&model.Node{}, id).Error
 	})
@@ -321,41 +430,18 @@ func (s *Service) UpdateNodeStatus(id uint, status string, connections int, traf
 	return nil
 }
 
-// TouchNode 更新节点的 updated_at 时间戳，用于触发配置同步
-func (s *Service) TouchNode(id uint) error {
-	return s.db.Model(&model.Node{}).Where("id = ?", id).Update("updated_at", time.Now()).Error
-}
-
-// GetNodeConfigHash 获取节点配置的哈希值（基于 updated_at）
+// GetNodeConfigHash 获取节点配置的哈希值（基于生成的完整配置内容）
 func (s *Service) GetNodeConfigHash(id uint) string {
 	node, err := s.GetNode(id)
 	if err != nil {
 		return ""
 	}
-	// 使用 updated_at 的时间戳作为简单的版本号
-	return fmt.Sprintf("%d", node.UpdatedAt.Unix())
+	hash, _ := gost.ConfigHash(s.GenerateNodeFullConfig(node))
+	return hash
 }
 
 // ==================== Client 操作 ====================
 
-// GetClientConfigHash 获取客户端配置的哈希值（考虑客户端和关联节点的更新时间）
-func (s *Service) GetClientConfigHash(id uint) string {
-	var client model.Client
-	if err := s.db.Preload("Node").First(&client, id).Error; err != nil {
-		return ""
-	}
-	// 使用客户端和节点的 updated_at 的最大值作为版本号
-	clientTime := client.UpdatedAt.Unix()
-	nodeTime := int64(0)
-	if client.Node.ID > 0 {
-		nodeTime = client.Node.UpdatedAt.Unix()
-	}
-	if nodeTime > clientTime {
-		return fmt.Sprintf("%d", nodeTime)
-	}
-	return fmt.Sprintf("%d", clientTime)
-}
-
 func (s *Service) ListClients() ([]model.Client, error) {
 	var clients []model.Client
 	err := s.db.Preload("Node").Order("id desc").Find(&clients).Error
@@ -387,8 +473,8 @@ func (s *Service) ListClientsPaginated(userID uint, isAdmin bool, params Paginat
 
 	// 搜索过滤
 	if params.Search != "" {
-		search := "%" + params.Search + "%"
-		query = query.Where("name LIKE ?", search)
+		search := "%" + strings.ToLower(params.Search) + "%"
+		query = query.Where("LOWER(name) LIKE ?", search)
 	}
 
 	// 计算总数
@@ -462,7 +548,16 @@ func (s *Service) UpdateClient(id uint, updates map[string]interface{}) error {
 }
 
 func (s *Service) DeleteClient(id uint) error {
-	return s.db.Delete(&model.Client{}, id).Error
+	return s.db.Transaction(func(tx *gorm.DB) error {
+		var client model.Client
+		if err := tx.Select("id", "name", "token", "agent_public_key").First(&client, id).Error; err != nil {
+			return err
+		}
+		if err := recordDecommission(tx, "client", client.ID, client.Name, client.Token, client.AgentPublicKey); err != nil {
+			return err
+		}
+		return tx.Delete(&model.Client{}, id).Error
+	})
 }
 
 // GetClientByToken 通过 Token 获取客户端
@@ -472,6 +567,27 @@ func (s *Service) GetClientByToken(token string) (*model.Client, error) {
 	return &client, err
 }
 
+// UpdateClientStatus 更新客户端状态和流量 (Agent 心跳上报的增量)，并检查流量配额
+func (s *Service) UpdateClientStatus(id uint, status string, trafficIn, trafficOut int64) error {
+	err := s.db.Model(&model.Client{}).Where("id = ?", id).Updates(map[string]interface{}{
+		"status":      status,
+		"last_seen":   time.Now(),
+		"traffic_in":  gorm.Expr("traffic_in + ?", trafficIn),
+		"traffic_out": gorm.Expr("traffic_out + ?", trafficOut),
+		"quota_used":  gorm.Expr("quota_used + ?", trafficIn+trafficOut),
+		"updated_at":  time.Now(),
+	}).Error
+	if err != nil {
+		return err
+	}
+
+	var client model.Client
+	if err := s.db.First(&client, id).Error; err == nil {
+		s.alertService.CheckClientQuota(&client)
+	}
+	return nil
+}
+
 // UpdateClientHeartbeat 更新客户端心跳
 func (s *Service) UpdateClientHeartbeat(token string) error {
 	result := s.db.Model(&model.Client{}).Where("token = ?", token).Updates(map[string]interface{}{
@@ -661,7 +777,13 @@ func (s *Service) DeleteUser(id uint) error {
 		return errors.New("cannot delete the last admin user")
 	}
 
-	return s.db.Delete(&model.User{}, id).Error
+	return s.db.Transaction(func(tx *gorm.DB) error {
+		// 删除用户的代理凭据
+		if err := tx.Where("user_id = ?", id).Delete(&model.ProxyCredential{}).Error; err != nil {
+			return err
+		}
+		return tx.Delete(&model.User{}, id).Error
+	})
 }
 
 // ChangePassword 修改密码
@@ -897,15 +1019,16 @@ func (s *Service) ResendVerificationEmail(userID uint) (string, error) {
 
 // UserTrafficSummary 用户流量汇总
 type UserTrafficSummary struct {
-	TotalTrafficIn  int64 `json:"total_traffic_in"`
-	TotalTrafficOut int64 `json:"total_traffic_out"`
-	TotalQuotaUsed  int64 `json:"total_quota_used"`
-	NodesCount      int   `json:"nodes_count"`
-	ClientsCount    int   `json:"clients_count"`
-	TunnelsCount    int   `json:"tunnels_count"`
+	TotalTrafficIn   int64 `json:"total_traffic_in"`
+	TotalTrafficOut  int64 `json:"total_traffic_out"`
+	TotalQuotaUsed   int64 `json:"total_quota_used"`
+	NodesCount       int   `json:"nodes_count"`
+	ClientsCount     int   `json:"clients_count"`
+	TunnelsCount     int   `json:"tunnels_count"`
+	CredentialsCount int   `json:"credentials_count"`
 }
 
-// GetUserTrafficSummary 获取用户流量汇总 (聚合所有拥有的资源)
+// GetUserTrafficSummary 获取用户流量汇总 (聚合所有拥有的资源及代理凭据)
 func (s *Service) GetUserTrafficSummary(userID uint) (*UserTrafficSummary, error) {
 	summary := &UserTrafficSummary{}
 
@@ -944,12 +1067,25 @@ func (s *Service) GetUserTrafficSummary(userID uint) (*UserTrafficSummary, error
 		Select("COALESCE(SUM(traffic_in), 0) as traffic_in, COALESCE(SUM(traffic_out), 0) as traffic_out, COUNT(*) as count").
 		Scan(&tunnelResult)
 
-	summary.TotalTrafficIn = nodeResult.TrafficIn + clientResult.TrafficIn + tunnelResult.TrafficIn
-	summary.TotalTrafficOut = nodeResult.TrafficOut + clientResult.TrafficOut + tunnelResult.TrafficOut
+	// 统计用户通过代理凭据在他人节点上产生的流量 (自有节点的流量已计入节点)
+	var credentialResult struct {
+		TrafficIn  int64
+		TrafficOut int64
+		Count      int
+	}
+	s.db.Model(&model.ProxyCredential{}).
+		Joins("JOIN nodes ON nodes.id = proxy_credentials.node_id").
+		Where("proxy_credentials.user_id = ? AND (nodes.owner_id IS NULL OR nodes.owner_id <> ?)", userID, userID).
+		Select("COALESCE(SUM(proxy_credentials.traffic_in), 0) as traffic_in, COALESCE(SUM(proxy_credentials.traffic_out), 0) as traffic_out, COUNT(*) as count").
+		Scan(&credentialResult)
+
+	summary.TotalTrafficIn = nodeResult.TrafficIn + clientResult.TrafficIn + tunnelResult.TrafficIn + credentialResult.TrafficIn
+	summary.TotalTrafficOut = nodeResult.TrafficOut + clientResult.TrafficOut + tunnelResult.TrafficOut + credentialResult.TrafficOut
 	summary.TotalQuotaUsed = nodeResult.QuotaUsed + clientResult.QuotaUsed
 	summary.NodesCount = nodeResult.Count
 	summary.ClientsCount = clientResult.Count
 	summary.TunnelsCount = tunnelResult.Count
+	summary.CredentialsCount = credentialResult.Count
 
 	return summary, nil
 }
@@ -961,8 +1097,13 @@ func (s *Service) UpdateUserQuotaUsed(userID uint) error {
 		return err
 	}
 
-	// 更新用户的 quota_used
-	totalUsed := summary.TotalTrafficIn + summary.TotalTrafficOut
+	var user model.User
+	if err := s.db.Select("id", "quota_baseline").First(&user, userID).Error; err != nil {
+		return err
+	}
+
+	// 更新用户的 quota_used (扣除上次重置时的累计流量)
+	totalUsed := max(summary.TotalTrafficIn+summary.TotalTrafficOut-user.QuotaBaseline, 0)
 
 	return s.db.Model(&model.User{}).Where("id = ?", userID).Updates(map[string]interface{}{
 		"quota_used": totalUsed,
@@ -976,9 +1117,15 @@ func (s *Service) CheckUserQuota(userID uint) (bool, error) {
 		return false, err
 	}
 
-	// 如果没有设置配额，则不限制
+	// 套餐已过期同样视为超限
+	planExpired := user.PlanID != nil && user.PlanExpireAt != nil && user.PlanExpireAt.Before(time.Now())
+
+	// 如果没有设置配额，则只受套餐状态限制
 	if user.TrafficQuota <= 0 {
-		return false, nil
+		if user.QuotaExceeded != planExpired {
+			s.db.Model(&model.User{}).Where("id = ?", userID).Update("quota_exceeded", planExpired)
+		}
+		return planExpired, nil
 	}
 
 	// 获取用户流量汇总
@@ -987,25 +1134,44 @@ func (s *Service) CheckUserQuota(userID uint) (bool, error) {
 		return false, err
 	}
 
-	totalUsed := summary.TotalTrafficIn + summary.TotalTrafficOut
-	exceeded := totalUsed >= user.TrafficQuota
+	totalUsed := max(summary.TotalTrafficIn+summary.TotalTrafficOut-user.QuotaBaseline, 0)
+	exceeded := totalUsed >= user.TrafficQuota || planExpired
 
 	// 更新用户的 quota_used 和 quota_exceeded
-	s.db.Model(&model.User{}).Where("id = ?", userID).Updates(map[string]interface{}{
+	updates := map[string]interface{}{
 		"quota_used":     totalUsed,
 		"quota_exceeded": exceeded,
-	})
+	}
+	// 分配套餐时已重置基线，已用流量即为套餐周期内用量
+	if user.PlanID != nil {
+		updates["plan_traffic_used"] = totalUsed
+	}
+	s.db.Model(&model.User{}).Where("id = ?", userID).Updates(updates)
 
 	return exceeded, nil
 }
 
 // ResetUserQuota 重置用户配额
 func (s *Service) ResetUserQuota(userID uint) error {
-	return s.db.Model(&model.User{}).Where("id = ?", userID).Updates(map[string]interface{}{
+	err := s.db.Model(&model.User{}).Where("id = ?", userID).Updates(map[string]interface{}{
 		"quota_used":      0,
 		"quota_exceeded":  false,
 		"quota_reset_at":  time.Now(),
+		"quota_baseline":  s.userTrafficTotal(userID),
 	}).Error
+	if err == nil {
+		s.notifyQuotaChange()
+	}
+	return err
+}
+
+// userTrafficTotal 获取用户拥有资源的累计流量
+func (s *Service) userTrafficTotal(userID uint) int64 {
+	summary, err := s.GetUserTrafficSummary(userID)
+	if err != nil {
+		return 0
+	}
+	return summary.TotalTrafficIn + summary.TotalTrafficOut
 }
 
 // CheckAndResetUserQuotas 检查并重置所有用户的配额 (按月重置日)
@@ -1015,11 +1181,15 @@ func (s *Service) CheckAndResetUserQuotas() error {
 
 	// 获取需要重置的用户
 	var users []model.User
-	s.db.Where("quota_reset_day = ? AND (quota_reset_at < ? OR quota_reset_at IS NULL)",
-		day, now.AddDate(0, 0, -1)).Find(&users)
+	if err := s.db.Where("quota_reset_day = ? AND (quota_reset_at < ? OR quota_reset_at IS NULL)",
+		day, now.AddDate(0, 0, -1)).Find(&users).Error; err != nil {
+		return err
+	}
 
 	for _, user := range users {
-		s.ResetUserQuota(user.ID)
+		if err := s.ResetUserQuota(user.ID); err != nil {
+			return err
+		}
 	}
 
 	return nil
@@ -1109,89 +1279,6 @@ func (s *Service) GetStats() (*Stats, error) {
 	return &stats, nil
 }
 
-// ==================== Traffic History ====================
-
-// RecordTrafficHistory 记录流量历史
-func (s *Service) RecordTrafficHistory() error {
-	now := time.Now()
-
-	// 获取所有节点的当前流量数据
-	var nodes []model.Node
-	s.db.Find(&nodes)
-
-	for _, node := range nodes {
-		history := &model.TrafficHistory{
-			NodeID:      &node.ID,
-			TrafficIn:   node.TrafficIn,
-			TrafficOut:  node.TrafficOut,
-			Connections: node.Connections,
-			RecordedAt:  now,
-		}
-		s.db.Create(history)
-	}
-
-	// 记录总体流量
-	stats, _ := s.GetStats()
-	totalHistory := &model.TrafficHistory{
-		NodeID:      nil, // nil 表示总体数据
-		TrafficIn:   stats.TotalTrafficIn,
-		TrafficOut:  stats.TotalTrafficOut,
-		Connections: stats.TotalConnections,
-		RecordedAt:  now,
-	}
-	s.db.Create(totalHistory)
-
-	// 清理超过 24 小时的数据
-	s.db.Where("recorded_at < ?", now.Add(-24*time.Hour)).Delete(&model.TrafficHistory{})
-
-	return nil
-}
-
-// TrafficPoint 流量数据点
-type TrafficPoint struct {
-	Time        time.Time `json:"time"`
-	TrafficIn   int64     `json:"traffic_in"`
-	TrafficOut  int64     `json:"traffic_out"`
-	Connections int       `json:"connections"`
-}
-
-// GetTrafficHistory 获取流量历史数据
-func (s *Service) GetTrafficHistory(nodeID *uint, hours int) ([]TrafficPoint, error) {
-	if hours <= 0 {
-		hours = 1
-	}
-	if hours > 24 {
-		hours = 24
-	}
-
-	since := time.Now().Add(-time.Duration(hours) * time.Hour)
-
-	var histories []model.TrafficHistory
-	query := s.db.Where("recorded_at > ?", since).Order("recorded_at asc")
-
-	if nodeID != nil {
-		query = query.Where("node_id = ?", *nodeID)
-	} else {
-		query = query.Where("node_id IS NULL")
-	}
-
-	if err := query.Find(&histories).Error; err != nil {
-		return nil, err
-	}
-
-	points := make([]TrafficPoint, len(histories))
-	for i, h := range histories {
-		points[i] = TrafficPoint{
-			Time:        h.RecordedAt,
-			TrafficIn:   h.TrafficIn,
-			TrafficOut:  h.TrafficOut,
-			Connections: h.Connections,
-		}
-	}
-
-	return points, nil
-}
-
 // ==================== 辅助函数 ====================
 
 func generateToken() string {
@@ -1252,6 +1339,13 @@ func (s *Service) DeletePortForward(id uint) error {
 	return s.db.Delete(&model.PortForward{}, id).Error
 }
 
+// GetPortForwardsByNode 获取节点上已启用的端口转发
+func (s *Service) GetPortForwardsByNode(nodeID uint) ([]model.PortForward, error) {
+	var forwards []model.PortForward
+	err := s.db.Where("node_id = ? AND enabled = ?", nodeID, true).Order("id asc").Find(&forwards).Error
+	return forwards, err
+}
+
 // ==================== 节点组 (负载均衡) ====================
 
 func (s *Service) ListNodeGroups(userID uint, isAdmin bool) ([]model.NodeGroup, error) {
@@ -1483,14 +1577,14 @@ func (s *Service) CreateTunnel(tunnel *model.Tunnel) error {
 // GetTunnel 获取隧道
 func (s *Service) GetTunnel(id uint) (*model.Tunnel, error) {
 	var tunnel model.Tunnel
-	err := s.db.Preload("EntryNode").Preload("ExitNode").First(&tunnel, id).Error
+	err := preloadTunnelHops(s.db.Preload("EntryNode").Preload("ExitNode")).First(&tunnel, id).Error
 	return &tunnel, err
 }
 
 // GetTunnelByOwner 获取隧道（检查权限）
 func (s *Service) GetTunnelByOwner(id uint, userID uint, isAdmin bool) (*model.Tunnel, error) {
 	var tunnel model.Tunnel
-	query := s.db.Preload("EntryNode").Preload("ExitNode").Where("id = ?", id)
+	query := preloadTunnelHops(s.db.Preload("EntryNode").Preload("ExitNode")).Where("id = ?", id)
 	if !isAdmin {
 		query = query.Where("owner_id = ? OR owner_id IS NULL", userID)
 	}
@@ -1510,16 +1604,133 @@ func (s *Service) UpdateTunnelMap(id uint, updates map[string]interface{}) error
 
 // DeleteTunnel 删除隧道
 func (s *Service) DeleteTunnel(id uint) error {
-	return s.db.Delete(&model.Tunnel{}, id).Error
+	return s.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("tunnel_id = ?", id).Delete(&model.TunnelHop{}).Error; err != nil {
+			return err
+		}
+		return tx.Delete(&model.Tunnel{}, id).Error
+	})
+}
+
+// preloadTunnelHops 按顺序预加载隧道中转跳点及其节点
+func preloadTunnelHops(db *gorm.DB) *gorm.DB {
+	return db.Preload("Hops", func(db *gorm.DB) *gorm.DB {
+		return db.Order("hop_order ASC")
+	}).Preload("Hops.Node")
 }
 
-// UpdateTunnelTraffic 更新隧道流量统计 (增量)
+// SetTunnelHops 设置隧道的中转跳点 (按传入顺序，覆盖原有跳点)
+func (s *Service) SetTunnelHops(tunnelID uint, hops []model.TunnelHop) error {
+	return s.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("tunnel_id = ?", tunnelID).Delete(&model.TunnelHop{}).Error; err != nil {
+			return err
+		}
+		for i, hop := range hops {
+			var count int64
+			tx.Model(&model.Node{}).Where("id = ?", hop.NodeID).Count(&count)
+			if count == 0 {
+				return fmt.Errorf("第 %d 跳的节点不存在", i+1)
+			}
+			record := model.TunnelHop{
+				TunnelID:  tunnelID,
+				NodeID:    hop.NodeID,
+				HopOrder:  i,
+				Transport: hop.Transport,
+			}
+			if err := tx.Create(&record).Error; err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// TunnelHopStatus 隧道路径上单个节点的状态
+type TunnelHopStatus struct {
+	Role      string     `json:"role"` // entry / relay / exit
+	NodeID    uint       `json:"node_id"`
+	NodeName  string     `json:"node_name"`
+	Addr      string     `json:"addr"`
+	Transport string     `json:"transport"`
+	Status    string     `json:"status"`  // 节点状态 (Agent 心跳)
+	Health    string     `json:"health"`  // 最近一次健康检查结果，无记录时为 unknown
+	Latency   int64      `json:"latency"` // 面板到节点代理端口的 TCP 连接延迟 (ms)，-1 表示不可达
+	CheckedAt *time.Time `json:"checked_at,omitempty"`
+}
+
+// GetTunnelPathStatus 获取隧道完整路径 (入口 -> 中转 -> 出口) 上每一跳的延迟和健康状态
+func (s *Service) GetTunnelPathStatus(tunnel *model.Tunnel) []TunnelHopStatus {
+	path := []TunnelHopStatus{}
+	addHop := func(role string, node *model.Node, transport string) {
+		if node == nil {
+			return
+		}
+		if transport == "" {
+			transport = node.Transport
+		}
+		path = append(path, TunnelHopStatus{
+			Role:      role,
+			NodeID:    node.ID,
+			NodeName:  node.Name,
+			Addr:      net.JoinHostPort(node.Host, strconv.Itoa(node.Port)),
+			Transport: transport,
+			Status:    node.Status,
+			Health:    "unknown",
+			Latency:   -1,
+		})
+	}
+
+	addHop("entry", tunnel.EntryNode, "")
+	for i := range tunnel.Hops {
+		addHop("relay", tunnel.Hops[i].Node, tunnel.Hops[i].Transport)
+	}
+	addHop("exit", tunnel.ExitNode, "")
+
+	// 并发探测各跳延迟
+	var wg sync.WaitGroup
+	for i := range path {
+		wg.Add(1)
+		go func(hop *TunnelHopStatus) {
+			defer wg.Done()
+			start := time.Now()
+			conn, err := net.DialTimeout("tcp", hop.Addr, 3*time.Second)
+			if err != nil {
+				return
+			}
+			conn.Close()
+			hop.Latency = time.Since(start).Milliseconds()
+		}(&path[i])
+	}
+
+	for i := range path {
+		var latest model.HealthCheckLog
+		if err := s.db.Where("node_id = ?", path[i].NodeID).Order("checked_at DESC").First(&latest).Error; err == nil {
+			path[i].Health = latest.Status
+			path[i].CheckedAt = &latest.CheckedAt
+		}
+	}
+
+	wg.Wait()
+	return path
+}
+
+// UpdateTunnelTraffic 更新隧道流量统计 (增量)，并检查流量配额
 func (s *Service) UpdateTunnelTraffic(id uint, trafficIn, trafficOut int64) error {
-	return s.db.Model(&model.Tunnel{}).Where("id = ?", id).
+	err := s.db.Model(&model.Tunnel{}).Where("id = ?", id).
 		Updates(map[string]interface{}{
 			"traffic_in":  gorm.Expr("traffic_in + ?", trafficIn),
 			"traffic_out": gorm.Expr("traffic_out + ?", trafficOut),
+			"quota_used":  gorm.Expr("quota_used + ?", trafficIn+trafficOut),
 		}).Error
+	if err != nil {
+		return err
+	}
+
+	var tunnel model.Tunnel
+	if err := s.db.First(&tunnel, id).Error; err == nil {
+		s.alertService.CheckTunnelQuota(&tunnel)
+	}
+	return nil
 }
 
 // UpdateClientTraffic 更新客户端流量统计 (增量)
@@ -1531,10 +1742,19 @@ func (s *Service) UpdateClientTraffic(id uint, trafficIn, trafficOut int64) erro
 		}).Error
 }
 
+// UpdatePortForwardTraffic 更新端口转发流量统计 (增量)
+func (s *Service) UpdatePortForwardTraffic(id uint, trafficIn, trafficOut int64) error {
+	return s.db.Model(&model.PortForward{}).Where("id = ?", id).
+		Updates(map[string]interface{}{
+			"traffic_in":  gorm.Expr("traffic_in + ?", trafficIn),
+			"traffic_out": gorm.Expr("traffic_out + ?", trafficOut),
+		}).Error
+}
+
 // ListTunnels 获取隧道列表
 func (s *Service) ListTunnels(ownerID *uint) ([]model.Tunnel, error) {
 	var tunnels []model.Tunnel
-	query := s.db.Preload("EntryNode").Preload("ExitNode")
+	query := preloadTunnelHops(s.db.Preload("EntryNode").Preload("ExitNode"))
 	if ownerID != nil {
 		query = query.Where("owner_id = ? OR owner_id IS NULL", *ownerID)
 	}
@@ -1545,7 +1765,7 @@ func (s *Service) ListTunnels(ownerID *uint) ([]model.Tunnel, error) {
 // GetTunnelsByEntryNode 获取指定入口节点的所有隧道
 func (s *Service) GetTunnelsByEntryNode(nodeID uint) ([]model.Tunnel, error) {
 	var tunnels []model.Tunnel
-	err := s.db.Preload("ExitNode").Where("entry_node_id = ? AND enabled = ?", nodeID, true).Find(&tunnels).Error
+	err := preloadTunnelHops(s.db.Preload("ExitNode")).Where("entry_node_id = ? AND enabled = ?", nodeID, true).Find(&tunnels).Error
 	return tunnels, err
 }
 
@@ -1592,7 +1812,7 @@ func (s *Service) DeleteNotifyChannel(id uint) error {
 // GetSiteConfig 获取单个配置
 func (s *Service) GetSiteConfig(key string) string {
 	var config model.SiteConfig
-	if err := s.db.Where("key = ?", key).First(&config).Error; err != nil {
+	if err := s.db.Where(map[string]interface{}{"key": key}).First(&config).Error; err != nil {
 		return ""
 	}
 	return config.Value
@@ -1612,7 +1832,7 @@ func (s *Service) GetSiteConfigs() map[string]string {
 // SetSiteConfig 设置配置
 func (s *Service) SetSiteConfig(key, value string) error {
 	var config model.SiteConfig
-	if err := s.db.Where("key = ?", key).First(&config).Error; err != nil {
+	if err := s.db.Where(map[string]interface{}{"key": key}).First(&config).Error; err != nil {
 		// 不存在则创建
 		config = model.SiteConfig{Key: key, Value: value}
 		return s.db.Create(&config).Error
@@ -1856,7 +2076,7 @@ func (s *Service) AssignUserPlan(userID, planID uint) error {
 		expireAt = &expire
 	}
 
-	return s.db.Model(&model.User{}).Where("id = ?", userID).Updates(map[string]interface{}{
+	err = s.db.Model(&model.User{}).Where("id = ?", userID).Updates(map[string]interface{}{
 		"plan_id":           planID,
 		"plan_start_at":     now,
 		"plan_expire_at":    expireAt,
@@ -1865,17 +2085,31 @@ func (s *Service) AssignUserPlan(userID, planID uint) error {
 		"traffic_quota":     plan.TrafficQuota,
 		"quota_used":        0,
 		"quota_exceeded":    false,
+		"quota_baseline":    s.userTrafficTotal(userID),
 	}).Error
+	if err == nil {
+		s.notifyQuotaChange()
+	}
+	return err
 }
 
 // RemoveUserPlan 移除用户套餐
 func (s *Service) RemoveUserPlan(userID uint) error {
-	return s.db.Model(&model.User{}).Where("id = ?", userID).Updates(map[string]interface{}{
+	if err := s.db.Model(&model.User{}).Where("id = ?", userID).Updates(map[string]interface{}{
 		"plan_id":           nil,
 		"plan_start_at":     nil,
 		"plan_expire_at":    nil,
 		"plan_traffic_used": 0,
-	}).Error
+	}).Error; err != nil {
+		return err
+	}
+
+	// 套餐到期导致的超限随套餐一并解除，按用户配额重新判断
+	if _, err := s.CheckUserQuota(userID); err != nil {
+		return err
+	}
+	s.notifyQuotaChange()
+	return nil
 }
 
 // RenewUserPlan 续期用户套餐
@@ -1899,12 +2133,17 @@ func (s *Service) RenewUserPlan(userID uint, days int) error {
 
 	newExpireAt := baseTime.AddDate(0, 0, days)
 
-	return s.db.Model(&model.User{}).Where("id = ?", userID).Updates(map[string]interface{}{
+	err := s.db.Model(&model.User{}).Where("id = ?", userID).Updates(map[string]interface{}{
 		"plan_expire_at":    newExpireAt,
 		"plan_traffic_used": 0,
 		"quota_used":        0,
 		"quota_exceeded":    false,
+		"quota_baseline":    s.userTrafficTotal(userID),
 	}).Error
+	if err == nil {
+		s.notifyQuotaChange()
+	}
+	return err
 }
 
 // CheckUserPlanStatus 检查用户套餐状态 (是否过期或超限)
@@ -1945,6 +2184,37 @@ func (s *Service) GetUsersWithExpiredPlans() ([]model.User, error) {
 	return users, err
 }
 
+// ExpireUserPlans 处理套餐已过期的用户：标记为超限，续期或更换套餐后恢复
+func (s *Service) ExpireUserPlans() (int, error) {
+	users, err := s.GetUsersWithExpiredPlans()
+	if err != nil {
+		return 0, err
+	}
+
+	count := 0
+	for _, user := range users {
+		if user.QuotaExceeded {
+			continue
+		}
+		if err := s.db.Model(&model.User{}).Where("id = ?", user.ID).Update("quota_exceeded", true).Error; err != nil {
+			return count, err
+		}
+		planName := ""
+		if user.Plan != nil {
+			planName = user.Plan.Name
+		}
+		s.LogOperation(0, "system", "expire", "plan", user.ID,
+			fmt.Sprintf("用户 %s 的套餐 %s 已到期", user.Username, planName), "", "scheduler", "success")
+		count++
+	}
+
+	if count > 0 {
+		s.notifyQuotaChange()
+	}
+
+	return count, nil
+}
+
 // GetPlanUserCount 获取套餐的用户数量
 func (s *Service) GetPlanUserCount(planID uint) (int64, error) {
 	var count int64
@@ -2351,16 +2621,437 @@ func (s *Service) GetSDsByNode(nodeID uint) ([]model.SD, error) {
 	return sds, err
 }
 
+// ==================== 节点完整配置 ====================
+
+// GenerateNodeFullConfig 收集节点绑定的全部资源并生成完整合并配置
+func (s *Service) GenerateNodeFullConfig(node *model.Node) map[string]interface{} {
+	res := &gost.NodeResources{
+		PortForwardChains: map[uint][]model.ProxyChainHop{},
+	}
+	res.Bypasses, _ = s.GetBypassesByNode(node.ID)
+	res.Admissions, _ = s.GetAdmissionsByNode(node.ID)
+	res.HostMappings, _ = s.GetHostMappingsByNode(node.ID)
+	res.Ingresses, _ = s.GetIngressesByNode(node.ID)
+	res.Recorders, _ = s.GetRecordersByNode(node.ID)
+	res.Routers, _ = s.GetRoutersByNode(node.ID)
+	res.SDs, _ = s.GetSDsByNode(node.ID)
+	res.Tunnels, _ = s.GetTunnelsByEntryNode(node.ID)
+	res.PortForwards, _ = s.GetPortForwardsByNode(node.ID)
+
+	// 流量超限：节点或其所有者超限时整体受限，隧道/端口转发按自身及所有者判断
+	userExceeded := map[uint]bool{}
+	res.QuotaPolicy = s.GetQuotaPolicy()
+	res.QuotaExceeded = node.QuotaExceeded || s.isOwnerQuotaExceeded(node.OwnerID, userExceeded)
+	res.ExceededTunnels = map[uint]bool{}
+	for _, t := range res.Tunnels {
+		if t.QuotaExceeded || s.isOwnerQuotaExceeded(t.OwnerID, userExceeded) {
+			res.ExceededTunnels[t.ID] = true
+		}
+	}
+	res.ExceededForwards = map[uint]bool{}
+	for _, pf := range res.PortForwards {
+		if s.isOwnerQuotaExceeded(pf.OwnerID, userExceeded) {
+			res.ExceededForwards[pf.ID] = true
+		}
+	}
+
+	// 所有者的套餐限速
+	ownerIDs := []uint{}
+	if node.OwnerID != nil {
+		ownerIDs = append(ownerIDs, *node.OwnerID)
+	}
+	for _, t := range res.Tunnels {
+		if t.OwnerID != nil {
+			ownerIDs = append(ownerIDs, *t.OwnerID)
+		}
+	}
+	for _, pf := range res.PortForwards {
+		if pf.OwnerID != nil {
+			ownerIDs = append(ownerIDs, *pf.OwnerID)
+		}
+	}
+	res.UserLimits = s.getUserPlanLimits(ownerIDs)
+	if _, ok := gost.AuthPluginURL(node.AgentAuthListen); ok && s.GetSiteConfig(model.ConfigProxyAuthMode) == "plugin" {
+		// 凭据由面板实时校验，配置中只声明认证插件，凭据变更无需重载
+		// (Agent 未启用认证插件时仍写入配置)
+		var count int64
+		s.db.Model(&model.ProxyCredential{}).Where("node_id = ?", node.ID).Count(&count)
+		res.CredentialAuthPlugin = count > 0
+	} else {
+		res.Credentials, _ = s.GetActiveCredentialsByNode(node.ID)
+	}
+
+	for _, pf := range res.PortForwards {
+		if pf.ChainID == nil || *pf.ChainID == 0 {
+			continue
+		}
+		if _, ok := res.PortForwardChains[*pf.ChainID]; ok {
+			continue
+		}
+		hops, err := s.GetProxyChainHopsWithNodes(*pf.ChainID)
+		if err == nil {
+			res.PortForwardChains[*pf.ChainID] = hops
+		}
+	}
+
+	return gost.NewConfigGenerator().GenerateNodeFullConfig(node, res)
+}
+
+// ==================== 流量超限执行 ====================
+
+// SetQuotaChangeHandler 设置超限状态变化回调，用于通知在线 Agent 重新加载配置
+func (s *Service) SetQuotaChangeHandler(fn func()) {
+	s.quotaChangeHandler = fn
+}
+
+func (s *Service) notifyQuotaChange() {
+	if s.quotaChangeHandler != nil {
+		s.quotaChangeHandler()
+	}
+}
+
+// GetQuotaPolicy 获取流量超限处理策略
+func (s *Service) GetQuotaPolicy() gost.QuotaPolicy {
+	policy := gost.QuotaPolicy{Action: gost.QuotaActionBlock}
+	if s.GetSiteConfig(model.ConfigQuotaExceededAction) == gost.QuotaActionThrottle {
+		policy.Action = gost.QuotaActionThrottle
+		policy.ThrottleSpeed = int64(s.siteConfigInt(model.ConfigQuotaThrottleSpeed, 1024))
+	}
+	return policy
+}
+
+// isOwnerQuotaExceeded 检查资源所有者是否超限 (cache 用于同一次配置生成内复用查询结果)
+func (s *Service) isOwnerQuotaExceeded(ownerID *uint, cache map[uint]bool) bool {
+	if ownerID == nil {
+		return false
+	}
+	if exceeded, ok := cache[*ownerID]; ok {
+		return exceeded
+	}
+	var user model.User
+	exceeded := s.db.Select("id", "quota_exceeded").First(&user, *ownerID).Error == nil && user.QuotaExceeded
+	cache[*ownerID] = exceeded
+	return exceeded
+}
+
+// getUserPlanLimits 获取用户套餐的限速设置 (仅返回有限速的用户)
+func (s *Service) getUserPlanLimits(userIDs []uint) map[uint]gost.UserLimit {
+	limits := map[uint]gost.UserLimit{}
+	if len(userIDs) == 0 {
+		return limits
+	}
+
+	var users []model.User
+	if err := s.db.Preload("Plan").Where("id IN ? AND plan_id IS NOT NULL", userIDs).Find(&users).Error; err != nil {
+		return limits
+	}
+	for _, user := range users {
+		if user.Plan == nil || (user.Plan.SpeedLimit <= 0 && user.Plan.ConnRateLimit <= 0) {
+			continue
+		}
+		limits[user.ID] = gost.UserLimit{
+			SpeedLimit:    user.Plan.SpeedLimit,
+			ConnRateLimit: user.Plan.ConnRateLimit,
+		}
+	}
+	return limits
+}
+
+// IsClientQuotaExceeded 检查客户端是否应受限 (客户端自身或其所有者超限)
+func (s *Service) IsClientQuotaExceeded(client *model.Client) bool {
+	return client.QuotaExceeded || s.isOwnerQuotaExceeded(client.OwnerID, map[uint]bool{})
+}
+
+// ResetQuotas 按重置日重置节点/客户端/隧道配额，恢复受限资源
+func (s *Service) ResetQuotas() error {
+	if err := s.alertService.ResetQuotas(); err != nil {
+		return err
+	}
+	s.notifyQuotaChange()
+	return nil
+}
+
+// SyncQuotaStates 重新计算节点/客户端/隧道/用户的超限状态
+// 配额调低后立即标记超限，配额调高或取消后解除限制；状态有变化时通知 Agent 更新配置
+func (s *Service) SyncQuotaStates() (bool, error) {
+	changed := false
+
+	// 新超限：由告警服务标记并发送告警
+	var nodes []model.Node
+	if err := s.db.Where("quota_exceeded = ? AND traffic_quota > 0 AND quota_used >= traffic_quota", false).Find(&nodes).Error; err != nil {
+		return false, err
+	}
+	for i := range nodes {
+		s.alertService.CheckNodeQuota(&nodes[i])
+		changed = true
+	}
+
+	var clients []model.Client
+	if err := s.db.Where("quota_exceeded = ? AND traffic_quota > 0 AND quota_used >= traffic_quota", false).Find(&clients).Error; err != nil {
+		return false, err
+	}
+	for i := range clients {
+		s.alertService.CheckClientQuota(&clients[i])
+		changed = true
+	}
+
+	var tunnels []model.Tunnel
+	if err := s.db.Where("quota_exceeded = ? AND traffic_quota > 0 AND quota_used >= traffic_quota", false).Find(&tunnels).Error; err != nil {
+		return false, err
+	}
+	for i := range tunnels {
+		s.alertService.CheckTunnelQuota(&tunnels[i])
+		changed = true
+	}
+
+	// 已恢复：配额取消或调高
+	for _, m := range []interface{}{&model.Node{}, &model.Client{}, &model.Tunnel{}} {
+		result := s.db.Model(m).
+			Where("quota_exceeded = ? AND (traffic_quota <= 0 OR quota_used < traffic_quota)", true).
+			Update("quota_exceeded", false)
+		if result.Error != nil {
+			return false, result.Error
+		}
+		if result.RowsAffected > 0 {
+			changed = true
+		}
+	}
+
+	// 用户：聚合所拥有资源的流量，并考虑套餐到期
+	var users []model.User
+	if err := s.db.Where("traffic_quota > 0 OR quota_exceeded = ? OR plan_id IS NOT NULL", true).Find(&users).Error; err != nil {
+		return false, err
+	}
+	for _, user := range users {
+		exceeded, err := s.CheckUserQuota(user.ID)
+		if err != nil {
+			continue
+		}
+		if exceeded != user.QuotaExceeded {
+			changed = true
+		}
+	}
+
+	if changed {
+		s.notifyQuotaChange()
+	}
+	return changed, nil
+}
+
+// ==================== 用户代理凭据 ====================
+
+// ListNodeCredentials 获取节点上的所有用户凭据
+func (s *Service) ListNodeCredentials(nodeID uint) ([]model.ProxyCredential, error) {
+	var creds []model.ProxyCredential
+	err := s.db.Preload("User").Where("node_id = ?", nodeID).Order("id ASC").Find(&creds).Error
+	return creds, err
+}
+
+// ListUserCredentials 获取用户在各节点上的凭据
+func (s *Service) ListUserCredentials(userID uint) ([]model.ProxyCredential, error) {
+	var creds []model.ProxyCredential
+	err := s.db.Preload("Node").Where("user_id = ?", userID).Order("id ASC").Find(&creds).Error
+	return creds, err
+}
+
+// GetProxyCredential 获取单个凭据
+func (s *Service) GetProxyCredential(id uint) (*model.ProxyCredential, error) {
+	var cred model.ProxyCredential
+	if err := s.db.First(&cred, id).Error; err != nil {
+		return nil, err
+	}
+	return &cred, nil
+}
+
+// GetActiveCredentialsByNode 获取节点上可用的凭据 (凭据启用、用户启用且未超限)
+func (s *Service) GetActiveCredentialsByNode(nodeID uint) ([]model.ProxyCredential, error) {
+	var creds []model.ProxyCredential
+	err := s.db.Joins("JOIN users ON users.id = proxy_credentials.user_id").
+		Where("proxy_credentials.node_id = ? AND proxy_credentials.enabled = ? AND users.enabled = ? AND users.quota_exceeded = ?", nodeID, true, true, false).
+		Order("proxy_credentials.id ASC").
+		Find(&creds).Error
+	return creds, err
+}
+
+// CanUseNode 检查用户是否可以在节点上申请凭据 (公共节点、自己的节点或套餐包含的节点)
+func (s *Service) CanUseNode(userID, nodeID uint) bool {
+	node, err := s.GetNode(nodeID)
+	if err != nil {
+		return false
+	}
+	if node.OwnerID == nil || *node.OwnerID == userID {
+		return true
+	}
+	nodeIDs, _ := s.GetUserPlanResourceIDs(userID, "node")
+	for _, id := range nodeIDs {
+		if id == nodeID {
+			return true
+		}
+	}
+	return false
+}
+
+// CreateProxyCredential 为用户在节点上生成凭据，每个用户每个节点一个
+func (s *Service) CreateProxyCredential(nodeID, userID uint) (*model.ProxyCredential, error) {
+	var count int64
+	s.db.Model(&model.ProxyCredential{}).Where("node_id = ? AND user_id = ?", nodeID, userID).Count(&count)
+	if count > 0 {
+		return nil, errors.New("该用户在此节点上已有凭据")
+	}
+
+	cred := &model.ProxyCredential{
+		NodeID:   nodeID,
+		UserID:   userID,
+		Username: fmt.Sprintf("u%d-%s", userID, generateToken()[:8]),
+		Password: generateToken()[:24],
+		Enabled:  true,
+	}
+	if err := s.db.Create(cred).Error; err != nil {
+		return nil, err
+	}
+	return cred, nil
+}
+
+// RotateProxyCredential 轮换凭据密码 (用户名不变)
+func (s *Service) RotateProxyCredential(id uint) (*model.ProxyCredential, error) {
+	now := time.Now()
+	if err := s.db.Model(&model.ProxyCredential{}).Where("id = ?", id).Updates(map[string]interface{}{
+		"password":   generateToken()[:24],
+		"rotated_at": now,
+		"updated_at": now,
+	}).Error; err != nil {
+		return nil, err
+	}
+	return s.GetProxyCredential(id)
+}
+
+// SetProxyCredentialEnabled 启用或停用凭据
+func (s *Service) SetProxyCredentialEnabled(id uint, enabled bool) error {
+	return s.db.Model(&model.ProxyCredential{}).Where("id = ?", id).Updates(map[string]interface{}{
+		"enabled":    enabled,
+		"updated_at": time.Now(),
+	}).Error
+}
+
+// DeleteProxyCredential 吊销凭据
+func (s *Service) DeleteProxyCredential(id uint) error {
+	return s.db.Transaction(func(tx *gorm.DB) error {
+		var cred model.ProxyCredential
+		if err := tx.Preload("Node").First(&cred, id).Error; err != nil {
+			return err
+		}
+		// 凭据流量计入用户配额，删除后同步扣减基线，避免通过删除凭据清零已用流量
+		if used := cred.TrafficIn + cred.TrafficOut; used > 0 && !(cred.Node != nil && cred.Node.OwnerID != nil && *cred.Node.OwnerID == cred.UserID) {
+			if err := tx.Model(&model.User{}).Where("id = ?", cred.UserID).
+				Update("quota_baseline", gorm.Expr("quota_baseline - ?", used)).Error; err != nil {
+				return err
+			}
+		}
+		return tx.Delete(&cred).Error
+	})
+}
+
+// GetCredentialNodeIDs 获取用户持有凭据的节点ID列表
+func (s *Service) GetCredentialNodeIDs(userID uint) []uint {
+	var nodeIDs []uint
+	s.db.Model(&model.ProxyCredential{}).Where("user_id = ?", userID).Pluck("node_id", &nodeIDs)
+	return nodeIDs
+}
+
+// AuthenticateProxyUser 校验节点上的代理用户名/密码 (供 HTTP 认证插件使用)
+// 实时反映凭据和用户的启用状态、套餐到期和流量超限，返回值 id 用作 GOST 的客户端标识
+func (s *Service) AuthenticateProxyUser(node *model.Node, username, password string) (string, bool) {
+	if username == "" {
+		return "", false
+	}
+
+	// 节点自身的代理账号 (客户端和隧道使用)
+	if node.ProxyUser != "" && username == node.ProxyUser {
+		return username, subtle.ConstantTimeCompare([]byte(password), []byte(node.ProxyPass)) == 1
+	}
+
+	var cred model.ProxyCredential
+	if err := s.db.Preload("User").Where("node_id = ? AND username = ?", node.ID, username).First(&cred).Error; err != nil {
+		return "", false
+	}
+	if subtle.ConstantTimeCompare([]byte(password), []byte(cred.Password)) != 1 {
+		return "", false
+	}
+	if !cred.Enabled || cred.User == nil || !cred.User.Enabled || cred.User.QuotaExceeded {
+		return "", false
+	}
+	if cred.User.PlanID != nil && cred.User.PlanExpireAt != nil && cred.User.PlanExpireAt.Before(time.Now()) {
+		return "", false
+	}
+	return cred.Username, true
+}
+
+// RecordCredentialTraffic 按认证用户名记录凭据流量 (增量)
+func (s *Service) RecordCredentialTraffic(nodeID uint, username string, trafficIn, trafficOut int64) error {
+	if trafficIn == 0 && trafficOut == 0 {
+		return nil
+	}
+	return s.db.Model(&model.ProxyCredential{}).
+		Where("node_id = ? AND username = ?", nodeID, username).
+		Updates(map[string]interface{}{
+			"traffic_in":   gorm.Expr("traffic_in + ?", trafficIn),
+			"traffic_out":  gorm.Expr("traffic_out + ?", trafficOut),
+			"last_used_at": time.Now(),
+		}).Error
+}
+
+// ChargeCredentialTraffic 将共享节点上按认证用户名统计的流量计入凭据持有人，并重新判断其配额
+// 未匹配到凭据的用户名 (如节点自身的代理账号) 只计入节点流量，直接忽略
+func (s *Service) ChargeCredentialTraffic(nodeID uint, username string, trafficIn, trafficOut int64) error {
+	if trafficIn <= 0 && trafficOut <= 0 {
+		return nil
+	}
+
+	var cred model.ProxyCredential
+	if err := s.db.Select("id", "user_id").Where("node_id = ? AND username = ?", nodeID, username).First(&cred).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil
+		}
+		return err
+	}
+
+	if err := s.RecordCredentialTraffic(nodeID, username, trafficIn, trafficOut); err != nil {
+		return err
+	}
+
+	var user model.User
+	if err := s.db.Select("id", "quota_exceeded").First(&user, cred.UserID).Error; err != nil {
+		return err
+	}
+	exceeded, err := s.CheckUserQuota(cred.UserID)
+	if err != nil {
+		return err
+	}
+	if exceeded != user.QuotaExceeded {
+		s.notifyQuotaChange()
+	}
+	return nil
+}
+
 // ==================== ConfigVersion 配置版本历史 ====================
 
-// SaveConfigVersion 保存配置版本快照
-func (s *Service) SaveConfigVersion(nodeID uint, config string, comment string) error {
+// SaveConfigVersion 保存配置版本快照，hash 用于关联 Agent 上报的应用结果
+func (s *Service) SaveConfigVersion(nodeID uint, config string, hash string, comment string) error {
 	version := &model.ConfigVersion{
 		NodeID:    nodeID,
 		Config:    config,
 		Comment:   comment,
+		Hash:      hash,
 		CreatedAt: time.Now(),
 	}
+	// Agent 已上报过该配置的应用结果
+	var node model.Node
+	if hash != "" && s.db.Select("id", "config_status", "config_status_hash", "config_error", "config_reported_at").
+		First(&node, nodeID).Error == nil && node.ConfigStatusHash == hash {
+		version.ApplyStatus = node.ConfigStatus
+		version.ApplyError = node.ConfigError
+		version.AppliedAt = node.ConfigReportedAt
+	}
 	return s.db.Create(version).Error
 }
 
@@ -2653,9 +3344,12 @@ func (s *Service) DeleteOtherSessions(userID uint, currentJTI string) (int64, er
 	return result.RowsAffected, result.Error
 }
 
-// CleanupExpiredSessions 清理过期会话（定时任务）
+// CleanupExpiredSessions 清理过期会话和 Agent 加入令牌（定时任务）
 func (s *Service) CleanupExpiredSessions() error {
 	result := s.db.Where("expires_at < ?", time.Now()).Delete(&model.UserSession{})
-	return result.Error
+	if result.Error != nil {
+		return result.Error
+	}
+	return s.cleanupJoinTokens()
 }
 
@@ -0,0 +1,327 @@
+package service
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/AliceNetworks/gost-panel/internal/model"
+	"gorm.io/gorm"
+)
+
+// 流量时间序列粒度
+const (
+	ResolutionMinute = "minute"
+	ResolutionHour   = "hour"
+	ResolutionDay    = "day"
+)
+
+// trafficRetention 各粒度的保留时长
+var trafficRetention = map[string]time.Duration{
+	ResolutionMinute: 48 * time.Hour,
+	ResolutionHour:   90 * 24 * time.Hour,
+	ResolutionDay:    2 * 365 * 24 * time.Hour,
+}
+
+// maxTrafficPoints 单次查询返回的最大点数
+const maxTrafficPoints = 5000
+
+// TrafficPoint 流量数据点 (该时间段内的增量)
+type TrafficPoint struct {
+	Time        time.Time `json:"time"`
+	TrafficIn   int64     `json:"traffic_in"`
+	TrafficOut  int64     `json:"traffic_out"`
+	Connections int       `json:"connections"`
+}
+
+type trafficKey struct {
+	resourceType string
+	resourceID   uint
+}
+
+type trafficDelta struct {
+	in, out int64
+	conns   int
+}
+
+// RecordTrafficHistory 采样各资源的累计流量，计算增量后写入分层时间序列 (每分钟执行)
+// 分钟点直接写入，小时和天的汇总点同步累加，超过保留时长的数据随之清理
+func (s *Service) RecordTrafficHistory() error {
+	s.trafficMu.Lock()
+	defer s.trafficMu.Unlock()
+
+	now := time.Now().Truncate(time.Minute)
+
+	var counters []model.TrafficCounter
+	if err := s.db.Find(&counters).Error; err != nil {
+		return err
+	}
+	last := make(map[trafficKey]model.TrafficCounter, len(counters))
+	for _, c := range counters {
+		last[trafficKey{c.ResourceType, c.ResourceID}] = c
+	}
+
+	current := map[trafficKey]model.TrafficCounter{}
+	deltas := map[trafficKey]*trafficDelta{}
+
+	// sample 记录当前累计值并返回相对上次采样的增量，首次采样只建立基准
+	sample := func(key trafficKey, in, out int64) (int64, int64) {
+		current[key] = model.TrafficCounter{ResourceType: key.resourceType, ResourceID: key.resourceID, TrafficIn: in, TrafficOut: out, SampledAt: now}
+		prev, ok := last[key]
+		if !ok {
+			return 0, 0
+		}
+		deltaIn, deltaOut := in-prev.TrafficIn, out-prev.TrafficOut
+		// 累计值变小说明计数器被重置
+		if deltaIn < 0 {
+			deltaIn = in
+		}
+		if deltaOut < 0 {
+			deltaOut = out
+		}
+		return deltaIn, deltaOut
+	}
+	add := func(key trafficKey, in, out int64, conns int) {
+		d, ok := deltas[key]
+		if !ok {
+			d = &trafficDelta{}
+			deltas[key] = d
+		}
+		d.in += in
+		d.out += out
+		d.conns += conns
+	}
+	addOwner := func(ownerID *uint, in, out int64) {
+		if ownerID != nil {
+			add(trafficKey{model.TrafficResourceUser, *ownerID}, in, out, 0)
+		}
+	}
+	// 节点上的资源流量已包含在节点中，只有在他人节点上的部分计入资源所有者
+	nodeOwners := map[uint]*uint{}
+	addOwnerOnNode := func(nodeID uint, ownerID *uint, in, out int64) {
+		if owner := nodeOwners[nodeID]; ownerID != nil && (owner == nil || *owner != *ownerID) {
+			addOwner(ownerID, in, out)
+		}
+	}
+
+	totalKey := trafficKey{model.TrafficResourceTotal, 0}
+
+	var nodes []model.Node
+	if err := s.db.Select("id", "owner_id", "traffic_in", "traffic_out", "connections").Find(&nodes).Error; err != nil {
+		return err
+	}
+	for _, n := range nodes {
+		in, out := sample(trafficKey{model.TrafficResourceNode, n.ID}, n.TrafficIn, n.TrafficOut)
+		add(trafficKey{model.TrafficResourceNode, n.ID}, in, out, n.Connections)
+		add(totalKey, in, out, n.Connections)
+		addOwner(n.OwnerID, in, out)
+		nodeOwners[n.ID] = n.OwnerID
+	}
+
+	var tunnels []model.Tunnel
+	if err := s.db.Select("id", "entry_node_id", "owner_id", "traffic_in", "traffic_out").Find(&tunnels).Error; err != nil {
+		return err
+	}
+	for _, t := range tunnels {
+		in, out := sample(trafficKey{model.TrafficResourceTunnel, t.ID}, t.TrafficIn, t.TrafficOut)
+		add(trafficKey{model.TrafficResourceTunnel, t.ID}, in, out, 0)
+		addOwnerOnNode(t.EntryNodeID, t.OwnerID, in, out)
+	}
+
+	var clients []model.Client
+	if err := s.db.Select("id", "node_id", "owner_id", "traffic_in", "traffic_out").Find(&clients).Error; err != nil {
+		return err
+	}
+	for _, c := range clients {
+		in, out := sample(trafficKey{model.TrafficResourceClient, c.ID}, c.TrafficIn, c.TrafficOut)
+		add(trafficKey{model.TrafficResourceClient, c.ID}, in, out, 0)
+		addOwnerOnNode(c.NodeID, c.OwnerID, in, out)
+	}
+
+	var forwards []model.PortForward
+	if err := s.db.Select("id", "node_id", "owner_id", "traffic_in", "traffic_out").Find(&forwards).Error; err != nil {
+		return err
+	}
+	for _, f := range forwards {
+		in, out := sample(trafficKey{model.TrafficResourcePortForward, f.ID}, f.TrafficIn, f.TrafficOut)
+		add(trafficKey{model.TrafficResourcePortForward, f.ID}, in, out, 0)
+		addOwnerOnNode(f.NodeID, f.OwnerID, in, out)
+	}
+
+	// 代理凭据流量计入持有人 (与用户流量汇总一致，自有节点上的凭据流量已计入节点)
+	var creds []model.ProxyCredential
+	if err := s.db.Select("id", "node_id", "user_id", "traffic_in", "traffic_out").Find(&creds).Error; err != nil {
+		return err
+	}
+	for _, c := range creds {
+		in, out := sample(trafficKey{model.TrafficResourceCredential, c.ID}, c.TrafficIn, c.TrafficOut)
+		userID := c.UserID
+		addOwnerOnNode(c.NodeID, &userID, in, out)
+	}
+
+	return s.db.Transaction(func(tx *gorm.DB) error {
+		if err := addTrafficPoints(tx, now, deltas); err != nil {
+			return err
+		}
+
+		// 更新采样基准，只写入有变化的计数器
+		for key, c := range current {
+			prev, ok := last[key]
+			if ok && prev.TrafficIn == c.TrafficIn && prev.TrafficOut == c.TrafficOut {
+				continue
+			}
+			if ok {
+				if err := tx.Model(&model.TrafficCounter{}).
+					Where("resource_type = ? AND resource_id = ?", key.resourceType, key.resourceID).
+					Updates(map[string]interface{}{"traffic_in": c.TrafficIn, "traffic_out": c.TrafficOut, "sampled_at": now}).Error; err != nil {
+					return err
+				}
+			} else if err := tx.Create(&c).Error; err != nil {
+				return err
+			}
+		}
+		// 已删除资源的计数器
+		for key := range last {
+			if _, ok := current[key]; !ok {
+				tx.Where("resource_type = ? AND resource_id = ?", key.resourceType, key.resourceID).Delete(&model.TrafficCounter{})
+			}
+		}
+
+		// 清理超过保留时长的数据
+		for resolution, retention := range trafficRetention {
+			if err := tx.Where("resolution = ? AND bucket_at < ?", resolution, now.Add(-retention)).Delete(&model.TrafficSeries{}).Error; err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// addTrafficPoints 将增量累加到时间点 at 所在的分钟、小时和天时间段
+func addTrafficPoints(tx *gorm.DB, at time.Time, deltas map[trafficKey]*trafficDelta) error {
+	for key, d := range deltas {
+		if d.in == 0 && d.out == 0 && d.conns == 0 {
+			continue // 无流量的资源不写入，查询时补零
+		}
+		for _, resolution := range []string{ResolutionMinute, ResolutionHour, ResolutionDay} {
+			point := &model.TrafficSeries{
+				ResourceType: key.resourceType,
+				ResourceID:   key.resourceID,
+				Resolution:   resolution,
+				BucketAt:     trafficBucket(at, resolution),
+				TrafficIn:    d.in,
+				TrafficOut:   d.out,
+				Connections:  d.conns,
+			}
+			if err := upsertTrafficPoint(tx, point); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// upsertTrafficPoint 累加到已有的时间段，不存在时创建 (连接数取峰值)
+func upsertTrafficPoint(tx *gorm.DB, point *model.TrafficSeries) error {
+	result := tx.Model(&model.TrafficSeries{}).
+		Where("resource_type = ? AND resource_id = ? AND resolution = ? AND bucket_at = ?",
+			point.ResourceType, point.ResourceID, point.Resolution, point.BucketAt).
+		Updates(map[string]interface{}{
+			"traffic_in":  gorm.Expr("traffic_in + ?", point.TrafficIn),
+			"traffic_out": gorm.Expr("traffic_out + ?", point.TrafficOut),
+			"connections": gorm.Expr("CASE WHEN connections < ? THEN ? ELSE connections END", point.Connections, point.Connections),
+		})
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return tx.Create(point).Error
+	}
+	return nil
+}
+
+// trafficBucket 返回时间点所在时间段的起点 (天按服务器本地时区划分)
+func trafficBucket(t time.Time, resolution string) time.Time {
+	switch resolution {
+	case ResolutionHour:
+		return t.Truncate(time.Hour)
+	case ResolutionDay:
+		y, m, d := t.Date()
+		return time.Date(y, m, d, 0, 0, 0, 0, t.Location())
+	default:
+		return t.Truncate(time.Minute)
+	}
+}
+
+// nextTrafficBucket 返回下一个时间段的起点
+func nextTrafficBucket(t time.Time, resolution string) time.Time {
+	switch resolution {
+	case ResolutionHour:
+		return t.Add(time.Hour)
+	case ResolutionDay:
+		return t.AddDate(0, 0, 1)
+	default:
+		return t.Add(time.Minute)
+	}
+}
+
+// ValidTrafficResolution 检查粒度是否有效 (空值表示自动选择)
+func ValidTrafficResolution(resolution string) bool {
+	_, ok := trafficRetention[resolution]
+	return ok || resolution == ""
+}
+
+// chooseTrafficResolution 按时间跨度和保留时长自动选择粒度
+func chooseTrafficResolution(from, to time.Time) string {
+	age := time.Since(from)
+	span := to.Sub(from)
+	switch {
+	case span <= 24*time.Hour && age <= trafficRetention[ResolutionMinute]:
+		return ResolutionMinute
+	case span <= 90*24*time.Hour && age <= trafficRetention[ResolutionHour]:
+		return ResolutionHour
+	default:
+		return ResolutionDay
+	}
+}
+
+// GetTrafficSeries 查询资源在 [from, to) 内的流量序列，无流量的时间段补零
+// resolution 为空时自动选择：24 小时内按分钟，90 天内按小时，更长按天
+func (s *Service) GetTrafficSeries(resourceType string, resourceID uint, from, to time.Time, resolution string) ([]TrafficPoint, error) {
+	if !to.After(from) {
+		return nil, fmt.Errorf("invalid time range")
+	}
+	if resolution == "" {
+		resolution = chooseTrafficResolution(from, to)
+	}
+
+	start := trafficBucket(from, resolution)
+	count := 0
+	for t := start; t.Before(to); t = nextTrafficBucket(t, resolution) {
+		if count++; count > maxTrafficPoints {
+			return nil, fmt.Errorf("时间范围过大，请使用更粗的粒度")
+		}
+	}
+
+	var rows []model.TrafficSeries
+	if err := s.db.Where("resource_type = ? AND resource_id = ? AND resolution = ? AND bucket_at >= ? AND bucket_at < ?",
+		resourceType, resourceID, resolution, start, to).
+		Order("bucket_at asc").Find(&rows).Error; err != nil {
+		return nil, err
+	}
+	byBucket := make(map[int64]model.TrafficSeries, len(rows))
+	for _, r := range rows {
+		byBucket[r.BucketAt.Unix()] = r
+	}
+
+	points := make([]TrafficPoint, 0, count)
+	for t := start; t.Before(to); t = nextTrafficBucket(t, resolution) {
+		point := TrafficPoint{Time: t}
+		if r, ok := byBucket[t.Unix()]; ok {
+			point.TrafficIn = r.TrafficIn
+			point.TrafficOut = r.TrafficOut
+			point.Connections = r.Connections
+		}
+		points = append(points, point)
+	}
+	return points, nil
+}
@@ -0,0 +1,79 @@
+package service
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/AliceNetworks/gost-panel/internal/config"
+	"github.com/AliceNetworks/gost-panel/internal/model"
+)
+
+// newTestDBService 只有数据库的 Service (不启动后台任务)
+func newTestDBService(t *testing.T) *Service {
+	t.Helper()
+	cfg := &config.Config{DBPath: filepath.Join(t.TempDir(), "panel.db")}
+	db, err := model.InitDB(model.DriverSQLite, cfg.DBPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { closeDB(db) })
+	return &Service{db: db, cfg: cfg}
+}
+
+func userTraffic(t *testing.T, s *Service, userID uint) int64 {
+	t.Helper()
+	var total int64
+	s.db.Model(&model.TrafficSeries{}).
+		Where("resource_type = ? AND resource_id = ? AND resolution = ?", model.TrafficResourceUser, userID, ResolutionMinute).
+		Select("COALESCE(SUM(traffic_in + traffic_out), 0)").Scan(&total)
+	return total
+}
+
+// 自有节点上的隧道、客户端、端口转发和凭据流量已包含在节点中，不重复计入所有者
+func TestRecordTrafficHistoryOwnerNotDoubleCounted(t *testing.T) {
+	s := newTestDBService(t)
+	owner, other := uint(1), uint(2)
+
+	own := model.Node{Name: "own", Host: "127.0.0.1", AgentToken: "own", OwnerID: &owner}
+	shared := model.Node{Name: "shared", Host: "127.0.0.1", AgentToken: "shared", OwnerID: &other}
+	for _, n := range []*model.Node{&own, &shared} {
+		if err := s.db.Create(n).Error; err != nil {
+			t.Fatal(err)
+		}
+	}
+	resources := []interface{}{
+		&model.Tunnel{Name: "own-tunnel", EntryNodeID: own.ID, ExitNodeID: shared.ID, OwnerID: &owner},
+		&model.Tunnel{Name: "shared-tunnel", EntryNodeID: shared.ID, ExitNodeID: own.ID, OwnerID: &owner},
+		&model.Client{Name: "own-client", NodeID: own.ID, Token: "own-client", OwnerID: &owner},
+		&model.Client{Name: "shared-client", NodeID: shared.ID, Token: "shared-client", OwnerID: &owner},
+		&model.PortForward{Name: "own-forward", NodeID: own.ID, OwnerID: &owner},
+		&model.PortForward{Name: "shared-forward", NodeID: shared.ID, OwnerID: &owner},
+	}
+	for _, r := range resources {
+		if err := s.db.Create(r).Error; err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// 首次采样只建立基准
+	if err := s.RecordTrafficHistory(); err != nil {
+		t.Fatal(err)
+	}
+
+	// 自有节点 1000 (其中包含自有节点上资源的流量)，他人节点上的资源各 10
+	s.db.Model(&model.Node{}).Where("id = ?", own.ID).Update("traffic_in", 1000)
+	s.db.Model(&model.Node{}).Where("id = ?", shared.ID).Update("traffic_in", 5000)
+	for _, table := range []string{"tunnels", "clients", "port_forwards"} {
+		s.db.Table(table).Where("1 = 1").Update("traffic_in", 10)
+	}
+	if err := s.RecordTrafficHistory(); err != nil {
+		t.Fatal(err)
+	}
+
+	if got, want := userTraffic(t, s, owner), int64(1000+3*10); got != want {
+		t.Fatalf("owner traffic = %d, want %d", got, want)
+	}
+	if got, want := userTraffic(t, s, other), int64(5000); got != want {
+		t.Fatalf("shared node owner traffic = %d, want %d", got, want)
+	}
+}
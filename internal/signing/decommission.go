@@ -0,0 +1,66 @@
+package signing
+
+import (
+	"crypto/ed25519"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// DecommissionMaxAge 卸载命令的有效期 (允许一定的时钟偏差)
+const DecommissionMaxAge = time.Hour
+
+// ErrInvalidDecommission 卸载命令的签名与面板公钥不匹配
+var ErrInvalidDecommission = errors.New("invalid decommission signature")
+
+// Decommission 面板下发的卸载命令，由面板密钥签名并绑定目标 Agent 的凭据 (Token 或已登记的公钥)。
+// Agent 只执行用首次注册时记录的面板公钥校验通过的命令，
+// 恢复了旧备份或地址指错的面板无法让 Agent 自行卸载
+type Decommission struct {
+	Kind      string `json:"kind"`       // node/client
+	ID        uint   `json:"id"`         // 被删除的节点/客户端 ID
+	TokenHash string `json:"token_hash"` // Agent 凭据的 SHA-256
+	IssuedAt  int64  `json:"issued_at"`  // 签发时间 (Unix 秒)
+	Signature string `json:"signature"`
+}
+
+// TokenHash Token 或公钥的 SHA-256 (十六进制)，命令和数据库中不保存 Token 原文
+func TokenHash(token string) string {
+	return fmt.Sprintf("%x", sha256.Sum256([]byte(token)))
+}
+
+// PublicKey 私钥对应的 base64 公钥
+func PublicKey(key ed25519.PrivateKey) string {
+	return base64.StdEncoding.EncodeToString(key.Public().(ed25519.PublicKey))
+}
+
+func (d *Decommission) manifest() []byte {
+	return []byte(fmt.Sprintf("gost-agent-decommission\nkind: %s\nid: %d\ntoken: %s\nissued: %d\n",
+		d.Kind, d.ID, d.TokenHash, d.IssuedAt))
+}
+
+// SignDecommission 签发卸载命令
+func SignDecommission(key ed25519.PrivateKey, kind string, id uint, tokenHash string) *Decommission {
+	d := &Decommission{Kind: kind, ID: id, TokenHash: tokenHash, IssuedAt: time.Now().Unix()}
+	d.Signature = base64.StdEncoding.EncodeToString(ed25519.Sign(key, d.manifest()))
+	return d
+}
+
+// Verify 校验卸载命令的签名、目标凭据和有效期
+func (d *Decommission) Verify(key ed25519.PublicKey, credential string, now time.Time) error {
+	sig, err := base64.StdEncoding.DecodeString(strings.TrimSpace(d.Signature))
+	if err != nil || !ed25519.Verify(key, d.manifest(), sig) {
+		return ErrInvalidDecommission
+	}
+	if d.TokenHash != TokenHash(credential) {
+		return errors.New("decommission is for a different agent")
+	}
+	issued := time.Unix(d.IssuedAt, 0)
+	if now.Sub(issued) > DecommissionMaxAge || issued.Sub(now) > DecommissionMaxAge {
+		return errors.New("decommission has expired")
+	}
+	return nil
+}
@@ -0,0 +1,83 @@
+package signing
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Agent 请求签名头
+const (
+	HeaderAgentKey       = "X-Agent-Key"       // Agent 公钥 (base64)
+	HeaderAgentTimestamp = "X-Agent-Timestamp" // 签名时间 (Unix 秒)
+	HeaderAgentNonce     = "X-Agent-Nonce"     // 随机数，面板在有效期内拒绝重复的 nonce
+	HeaderAgentSignature = "X-Agent-Signature"
+)
+
+// RequestMaxSkew 签名请求允许的时间偏差
+const RequestMaxSkew = 5 * time.Minute
+
+// ErrUnsignedRequest 请求没有携带签名头
+var ErrUnsignedRequest = errors.New("request is not signed")
+
+func requestManifest(method, route, timestamp, nonce string, body []byte) []byte {
+	return []byte(fmt.Sprintf("gost-agent-request\nmethod: %s\nroute: %s\ntimestamp: %s\nnonce: %s\nbody: %x\n",
+		method, route, timestamp, nonce, sha256.Sum256(body)))
+}
+
+// SignRequest 生成 Agent 请求的签名头。route 为面板路由及查询参数 (例如 /agent/heartbeat)，
+// 不含面板地址，面板通过反向代理部署时签名不受影响
+func SignRequest(key ed25519.PrivateKey, method, route string, body []byte) http.Header {
+	nonce := make([]byte, 16)
+	rand.Read(nonce)
+	timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+	nonceHex := hex.EncodeToString(nonce)
+
+	h := http.Header{}
+	h.Set(HeaderAgentKey, PublicKey(key))
+	h.Set(HeaderAgentTimestamp, timestamp)
+	h.Set(HeaderAgentNonce, nonceHex)
+	h.Set(HeaderAgentSignature, base64.StdEncoding.EncodeToString(
+		ed25519.Sign(key, requestManifest(method, route, timestamp, nonceHex, body))))
+	return h
+}
+
+// VerifyRequest 校验 Agent 请求签名，返回签名所用的公钥和 nonce (调用方负责拒绝重复的 nonce)
+func VerifyRequest(h http.Header, method, route string, body []byte, now time.Time) (publicKey, nonce string, err error) {
+	publicKey = h.Get(HeaderAgentKey)
+	if publicKey == "" {
+		return "", "", ErrUnsignedRequest
+	}
+	key, err := ParsePublicKey(publicKey)
+	if err != nil {
+		return "", "", err
+	}
+
+	timestamp := h.Get(HeaderAgentTimestamp)
+	unix, err := strconv.ParseInt(timestamp, 10, 64)
+	if err != nil {
+		return "", "", errors.New("invalid request timestamp")
+	}
+	signedAt := time.Unix(unix, 0)
+	if now.Sub(signedAt) > RequestMaxSkew || signedAt.Sub(now) > RequestMaxSkew {
+		return "", "", errors.New("request timestamp out of range")
+	}
+
+	nonce = h.Get(HeaderAgentNonce)
+	if nonce == "" {
+		return "", "", errors.New("missing request nonce")
+	}
+	sig, err := base64.StdEncoding.DecodeString(strings.TrimSpace(h.Get(HeaderAgentSignature)))
+	if err != nil || !ed25519.Verify(key, requestManifest(method, route, timestamp, nonce, body), sig) {
+		return "", "", errors.New("invalid request signature")
+	}
+	return publicKey, nonce, nil
+}
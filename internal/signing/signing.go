@@ -0,0 +1,141 @@
+// Package signing Agent 更新包的发布签名、面板卸载命令的签名和 Agent 请求签名 (Ed25519)。
+//
+// 发布私钥只保存在发布环境中，面板只负责分发二进制和对应的 .sig 文件；
+// Agent 内置发布公钥并在安装前校验签名，面板被攻破或被冒充时无法下发任意代码。
+package signing
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"regexp"
+	"strings"
+)
+
+// SignatureExt 签名文件扩展名，与二进制放在同一目录
+const SignatureExt = ".sig"
+
+// ErrInvalidSignature 签名与二进制不匹配
+var ErrInvalidSignature = errors.New("invalid update signature")
+
+// Manifest 被签名的内容。签名绑定版本和平台，防止把其他平台的合法二进制或
+// 冒充其他版本的二进制当作更新下发；旧版本本身也有合法签名，Agent 另外只安装比当前版本新的版本 (CompareVersions)
+func Manifest(version, goos, goarch, checksum string) []byte {
+	return []byte(fmt.Sprintf("gost-agent-update\nversion: %s\nplatform: %s/%s\nsha256: %s\n",
+		version, goos, goarch, strings.ToLower(checksum)))
+}
+
+// GenerateKey 生成发布密钥对 (base64 编码)
+func GenerateKey() (publicKey, privateKey string, err error) {
+	pub, priv, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		return "", "", err
+	}
+	return base64.StdEncoding.EncodeToString(pub), base64.StdEncoding.EncodeToString(priv.Seed()), nil
+}
+
+// ParsePublicKey 解析 base64 编码的公钥
+func ParsePublicKey(s string) (ed25519.PublicKey, error) {
+	raw, err := base64.StdEncoding.DecodeString(strings.TrimSpace(s))
+	if err != nil || len(raw) != ed25519.PublicKeySize {
+		return nil, errors.New("invalid update public key")
+	}
+	return ed25519.PublicKey(raw), nil
+}
+
+// ParsePrivateKey 解析 base64 编码的私钥 (32 字节种子或 64 字节完整私钥)
+func ParsePrivateKey(s string) (ed25519.PrivateKey, error) {
+	raw, err := base64.StdEncoding.DecodeString(strings.TrimSpace(s))
+	if err != nil {
+		return nil, errors.New("invalid signing key")
+	}
+	switch len(raw) {
+	case ed25519.SeedSize:
+		return ed25519.NewKeyFromSeed(raw), nil
+	case ed25519.PrivateKeySize:
+		return ed25519.PrivateKey(raw), nil
+	}
+	return nil, errors.New("invalid signing key")
+}
+
+// Sign 签名并返回 base64 编码的签名
+func Sign(key ed25519.PrivateKey, version, goos, goarch, checksum string) string {
+	return base64.StdEncoding.EncodeToString(ed25519.Sign(key, Manifest(version, goos, goarch, checksum)))
+}
+
+// Verify 校验签名
+func Verify(key ed25519.PublicKey, version, goos, goarch, checksum, signature string) error {
+	sig, err := base64.StdEncoding.DecodeString(strings.TrimSpace(signature))
+	if err != nil || !ed25519.Verify(key, Manifest(version, goos, goarch, checksum), sig) {
+		return ErrInvalidSignature
+	}
+	return nil
+}
+
+// FileChecksum 计算文件的 SHA-256 (十六进制)
+func FileChecksum(path string) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("%x", h.Sum(nil)), nil
+}
+
+// agentFileName gost-agent-<os>-<arch>[.exe]
+var agentFileName = regexp.MustCompile(`^gost-agent-([a-z0-9]+)-([a-z0-9]+?)(?:v\d+)?(?:\.exe)?$`)
+
+// PlatformFromFileName 从发布文件名解析 Agent 的 GOOS/GOARCH，
+// armv5/armv6/armv7 等变体对应 Agent 上报的 arm
+func PlatformFromFileName(name string) (goos, goarch string, ok bool) {
+	m := agentFileName.FindStringSubmatch(name)
+	if m == nil {
+		return "", "", false
+	}
+	return m[1], m[2], true
+}
+
+// CompareVersions 比较两个版本号 (可带 v 前缀，按数字逐段比较)
+// 返回 -1 (v1 < v2)、0 (相等) 或 1 (v1 > v2)
+func CompareVersions(v1, v2 string) int {
+	// Remove 'v' prefix if present
+	v1 = strings.TrimPrefix(v1, "v")
+	v2 = strings.TrimPrefix(v2, "v")
+
+	parts1 := strings.Split(v1, ".")
+	parts2 := strings.Split(v2, ".")
+
+	maxLen := len(parts1)
+	if len(parts2) > maxLen {
+		maxLen = len(parts2)
+	}
+
+	for i := 0; i < maxLen; i++ {
+		var n1, n2 int
+		if i < len(parts1) {
+			fmt.Sscanf(parts1[i], "%d", &n1)
+		}
+		if i < len(parts2) {
+			fmt.Sscanf(parts2[i], "%d", &n2)
+		}
+
+		if n1 < n2 {
+			return -1
+		}
+		if n1 > n2 {
+			return 1
+		}
+	}
+
+	return 0
+}
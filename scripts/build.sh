@@ -63,10 +63,19 @@ build_agent() {
     AGENT_LDFLAGS="-X 'main.AgentVersion=${VERSION}'"
     AGENT_LDFLAGS="${AGENT_LDFLAGS} -X 'main.AgentBuildTime=${BUILD_TIME}'"
     AGENT_LDFLAGS="${AGENT_LDFLAGS} -X 'main.AgentCommit=${COMMIT}'"
+    # 发布公钥 (gost-panel sign-agent keygen 生成)，未设置时 Agent 不会自动更新
+    if [ -n "${AGENT_UPDATE_PUBLIC_KEY}" ]; then
+        AGENT_LDFLAGS="${AGENT_LDFLAGS} -X 'main.UpdatePublicKey=${AGENT_UPDATE_PUBLIC_KEY}'"
+    fi
 
     mkdir -p dist/agents
     GOOS=$os GOARCH=$arch go build -ldflags "${AGENT_LDFLAGS}" -o "$output" ./cmd/agent/
     echo -e "${GREEN}✓ Agent built: ${output}${NC}"
+
+    # 设置了发布私钥时签名 (私钥也可以用 AGENT_SIGNING_KEY_FILE 指定)
+    if [ -n "${AGENT_SIGNING_KEY}" ] || [ -n "${AGENT_SIGNING_KEY_FILE}" ]; then
+        go run ./cmd/panel sign-agent sign ${AGENT_SIGNING_KEY_FILE:+-key "$AGENT_SIGNING_KEY_FILE"} -version "${VERSION}" "$output"
+    fi
 }
 
 build_frontend() {
@@ -24,6 +24,12 @@ Write-Host "========================================"
 Write-Host ""
 Write-Info "Panel: $PanelUrl"
 
+# This installer runs GOST without gost-agent, join tokens can only be used by the agent
+if ($Token.StartsWith("join_")) {
+    Write-Err "Join tokens require gost-agent. Install the client with install-client.sh (Linux) or disable agent_require_enrollment"
+    exit 1
+}
+
 # Detect architecture
 $arch = switch ($env:PROCESSOR_ARCHITECTURE) {
     "AMD64" { "amd64" }
@@ -63,7 +69,8 @@ if (-not (Test-Path "$InstallDir\gost.exe")) {
 # Download config
 Write-Info "[3/4] Downloading config..."
 try {
-    Invoke-WebRequest -Uri "$PanelUrl/agent/config/$Token" -OutFile "$InstallDir\config\client.yml" -UseBasicParsing
+    # Token in a header keeps it out of access logs
+    Invoke-WebRequest -Uri "$PanelUrl/agent/config" -Headers @{ Authorization = "Bearer $Token" } -OutFile "$InstallDir\config\client.yml" -UseBasicParsing
     Write-Info "Config saved to $InstallDir\config\client.yml"
 } catch {
     Write-Err "Failed to download config: $_"
@@ -34,6 +34,16 @@ dl() {
     fi
 }
 
+# 从面板下载 (Token 放在请求头中，不出现在访问日志的 URL 里)
+panel_dl() {
+    local url="$1" output="$2"
+    if command -v curl &>/dev/null; then
+        curl -fsSL -H "Authorization: Bearer $TOKEN" "$url" -o "$output"
+    else
+        wget -q --header="Authorization: Bearer $TOKEN" -O "$output" "$url"
+    fi
+}
+
 # 解析参数
 while [[ $# -gt 0 ]]; do
     case $1 in
@@ -161,7 +171,7 @@ install_agent() {
     # 回退: 从面板下载
     log_warn "GitHub download failed, trying panel..."
     local panel_agent_url="$PANEL_URL/agent/download/linux/$GOST_ARCH"
-    if dl "$panel_agent_url" "$INSTALL_DIR/gost-agent" 2>/dev/null; then
+    if panel_dl "$panel_agent_url" "$INSTALL_DIR/gost-agent" 2>/dev/null; then
         chmod +x "$INSTALL_DIR/gost-agent"
         log_info "Agent downloaded from panel"
         return 0
@@ -266,7 +276,7 @@ show_info() {
     echo "  - Built-in heartbeat (every 30s)"
     echo "  - Auto config reload"
     echo "  - Auto GOST download"
-    echo "  - Auto uninstall when deleted from panel"
+    echo "  - Uninstall when deleted from panel (signed command only)"
     echo "  - Auto update"
     echo ""
 
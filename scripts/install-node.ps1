@@ -95,7 +95,7 @@ try {
     Write-Warn "GitHub download failed, trying panel..."
     $agentUrl = "$PanelUrl/agent/download/windows/$arch"
     try {
-        Invoke-WebRequest -Uri $agentUrl -OutFile "$InstallDir\gost-agent.exe" -UseBasicParsing
+        Invoke-WebRequest -Uri $agentUrl -Headers @{ Authorization = "Bearer $Token" } -OutFile "$InstallDir\gost-agent.exe" -UseBasicParsing
         Write-Info "Agent downloaded from panel"
         $useAgent = $true
     } catch {
@@ -103,14 +103,22 @@ try {
     }
 }
 
-# Download config
+# Download config (the agent downloads it with signed requests after enrolling)
 Write-Info "[4/5] Downloading config..."
-try {
-    Invoke-WebRequest -Uri "$PanelUrl/agent/config/$Token" -OutFile "$InstallDir\config\gost.yml" -UseBasicParsing
-    Write-Info "Config saved to $InstallDir\config\gost.yml"
-} catch {
-    Write-Err "Failed to download config: $_"
+if ($useAgent) {
+    Write-Info "Config will be downloaded by the agent after it enrolls with the panel"
+} elseif ($Token.StartsWith("join_")) {
+    Write-Err "Join tokens require gost-agent, but the agent could not be downloaded"
     exit 1
+} else {
+    try {
+        # Token in a header keeps it out of access logs
+        Invoke-WebRequest -Uri "$PanelUrl/agent/config" -Headers @{ Authorization = "Bearer $Token" } -OutFile "$InstallDir\config\gost.yml" -UseBasicParsing
+        Write-Info "Config saved to $InstallDir\config\gost.yml"
+    } catch {
+        Write-Err "Failed to download config: $_"
+        exit 1
+    }
 }
 
 # Create Windows Service
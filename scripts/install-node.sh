@@ -35,6 +35,16 @@ dl() {
     fi
 }
 
+# 从面板下载 (Token 放在请求头中，不出现在访问日志的 URL 里)
+panel_dl() {
+    local url="$1" output="$2"
+    if command -v curl &>/dev/null; then
+        curl -fsSL -H "Authorization: Bearer $TOKEN" "$url" -o "$output"
+    else
+        wget -q --header="Authorization: Bearer $TOKEN" -O "$output" "$url"
+    fi
+}
+
 # 解析参数
 while [[ $# -gt 0 ]]; do
     case $1 in
@@ -247,7 +257,7 @@ download_agent() {
     # 回退: 从面板下载
     log_warn "GitHub download failed, trying panel..."
     local panel_agent_url="$PANEL_URL/agent/download/linux/$GOST_ARCH"
-    if dl "$panel_agent_url" "$INSTALL_DIR/gost-agent" 2>/dev/null; then
+    if panel_dl "$panel_agent_url" "$INSTALL_DIR/gost-agent" 2>/dev/null; then
         chmod +x "$INSTALL_DIR/gost-agent"
         log_info "Agent downloaded from panel"
         return 0
@@ -258,11 +268,22 @@ download_agent() {
 }
 
 # 下载配置
+# 使用 Agent 时由 Agent 登记密钥后用签名请求下载；只有直接运行 GOST 时由脚本用 Token 下载
 download_config() {
+    local use_agent=$1
     log_info "[3/5] Downloading config..."
 
     mkdir -p /etc/gost
-    dl "$PANEL_URL/agent/config/$TOKEN" /etc/gost/gost.yml
+    if [[ "$use_agent" == "true" ]]; then
+        log_info "Config will be downloaded by the agent after it enrolls with the panel"
+        return 0
+    fi
+    # 加入令牌只能用于 Agent 登记
+    if [[ "$TOKEN" == join_* ]]; then
+        log_error "Join tokens require gost-agent, but the agent is not available for this system"
+        exit 1
+    fi
+    panel_dl "$PANEL_URL/agent/config" /etc/gost/gost.yml
     log_info "Config saved to /etc/gost/gost.yml"
 }
 
@@ -533,7 +554,7 @@ main() {
         install_gost
     fi
 
-    download_config
+    download_config "$use_agent"
     install_service "$use_agent"
 
     log_info "[5/5] Verifying installation..."
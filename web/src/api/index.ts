@@ -199,11 +199,13 @@ export const getOperationLogs = (params: { limit?: number, offset?: number, acti
   api.get('/operation-logs', { params })
 
 // 数据导出/导入
-export const exportData = (format: 'json' | 'yaml' = 'json', type: 'all' | 'nodes' | 'clients' = 'all') =>
+export const exportData = (format: 'json' | 'yaml' = 'json', type: string = 'all') =>
   api.get('/export', { params: { format, type }, responseType: 'blob' })
-export const importData = (file: File) => {
+export const importData = (file: File, options: { dryRun?: boolean, conflict?: 'skip' | 'overwrite' | 'rename' } = {}) => {
   const formData = new FormData()
   formData.append('file', file)
+  formData.append('dry_run', options.dryRun ? 'true' : 'false')
+  formData.append('conflict', options.conflict || 'skip')
   return api.post('/import', formData, {
     headers: { 'Content-Type': 'multipart/form-data' }
   })